@@ -1,2 +1,3 @@
 export { default as AddRouteModal } from './AddRouteModal.vue'
-export { default as EditRouteModal } from './EditRouteModal.vue'
\ No newline at end of file
+export { default as EditRouteModal } from './EditRouteModal.vue'
+export { default as ProvidersPanel } from './ProvidersPanel.vue'
\ No newline at end of file
@@ -9,9 +9,204 @@ export interface Route {
   api_key: string
   group: string
   format: string
+  weight: number
+  upstream_model: string
+  priority: number
+  extra_headers: string
+  extra_body: string
+  connect_timeout: number
+  first_byte_timeout: number
+  idle_timeout: number
+  outbound_proxy: string
+  rpm_limit: number
+  tpm_limit: number
+  provider_id: number
+  capabilities: string
   enabled: boolean
   created: string
   updated: string
+  circuit_state: 'closed' | 'open' | 'half_open'
+  health_status: 'healthy' | 'unhealthy' | 'unknown'
+  avg_latency_ms: number
+}
+
+// 添加和更新路由时提交的字段，未填写的字段使用后端默认值
+export type RouteInput = Partial<Pick<Route,
+  'id' | 'name' | 'model' | 'api_url' | 'api_key' | 'group' | 'format' | 'weight' | 'upstream_model' | 'priority' |
+  'extra_headers' | 'extra_body' | 'connect_timeout' | 'first_byte_timeout' | 'idle_timeout' | 'outbound_proxy' |
+  'rpm_limit' | 'tpm_limit' | 'capabilities'>>
+
+// Load balancing types
+export interface LoadBalanceConfig {
+  defaultStrategy: string
+  modelStrategies: Record<string, string>
+  strategies: string[]
+}
+
+export interface CircuitBreakerStatus {
+  route_id: number
+  state: 'closed' | 'open' | 'half_open'
+  consecutive_failures: number
+  window_requests: number
+  window_failures: number
+  opened_at: string
+  retry_at: string
+}
+
+export interface HealthCheckConfig {
+  enabled: boolean
+  intervalSeconds: number
+  method: 'models' | 'completion'
+  skipUnhealthy: boolean
+}
+
+export interface RouteHealthRecord {
+  id?: number
+  route_id: number
+  status: 'healthy' | 'unhealthy'
+  latency_ms: number
+  error_message: string
+  checked_at: string
+}
+
+export interface RouteTestCheck {
+  ok: boolean
+  status_code: number
+  latency_ms: number
+  ttft_ms?: number
+  request_tokens: number
+  response_tokens: number
+  total_tokens: number
+  chunks?: number
+  output?: string
+  error?: string
+  skipped?: boolean
+}
+
+export interface RouteProtocolTest {
+  protocol: 'openai' | 'claude' | 'claudecode' | 'gemini'
+  basic: RouteTestCheck
+  stream: RouteTestCheck
+  tool_call: RouteTestCheck
+}
+
+export interface RouteTestResult {
+  route_id: number
+  route_name: string
+  model: string
+  format: string
+  ok: boolean
+  tested_at: string
+  protocols: RouteProtocolTest[]
+}
+
+export interface KeyUsage {
+  route_id: number
+  key_id: number
+  requests: number
+  failures: number
+  unauthorized: number
+  rate_limited: number
+  last_status: number
+  last_used_at: string
+  cooldown_until: string
+}
+
+export interface RouteKey {
+  id: number
+  route_id: number
+  name: string
+  api_key: string
+  enabled: boolean
+  created_at: string
+  usage: KeyUsage
+}
+
+export interface KeyRotationConfig {
+  strategy: 'round_robin' | 'least_used'
+  cooldownSeconds: number
+  strategies: string[]
+}
+
+export interface RateLimitConfig {
+  queueSize: number
+  maxWaitSeconds: number
+}
+
+export interface RateLimitStatus {
+  route_id: number
+  rpm_limit: number
+  tpm_limit: number
+  requests_available: number
+  tokens_available: number
+  queued: number
+}
+
+export interface StickySessionConfig {
+  enabled: boolean
+  ttlSeconds: number
+  sessions: number
+}
+
+export interface RouteImportChange {
+  id?: number
+  name: string
+  model: string
+  group: string
+  fields?: string[]
+}
+
+export interface RouteImportResult {
+  mode: 'merge' | 'replace'
+  dry_run: boolean
+  added: RouteImportChange[]
+  updated: RouteImportChange[]
+  deleted: RouteImportChange[]
+  unchanged: number
+  warnings: string[]
+  local_secret_refs: string[] // 使用 file: / cmd: 引用作为 Key 的路由
+}
+
+export interface ExternalImportResult extends RouteImportResult {
+  source: 'cc-switch' | 'ccnexus' | 'code-switch'
+  path: string
+  unmapped: string[]
+}
+
+// Provider types; routes are created and toggled from the provider's upstream model list
+export interface Provider {
+  id: number
+  name: string
+  api_url: string
+  api_key: string
+  format: string
+  group: string
+  include_patterns: string
+  exclude_patterns: string
+  outbound_proxy: string
+  sync_interval: number
+  models: string[]
+  routes: number
+  enabled_routes: number
+  last_sync_at: string
+  last_sync_error: string
+  enabled: boolean
+  created_at: string
+}
+
+export interface ProviderSyncResult {
+  provider_id: number
+  models: number
+  added: string[]
+  enabled: string[]
+  disabled: string[]
+  filtered: number
+}
+
+export interface FailoverConfig {
+  enabled: boolean
+  maxRetries: number
+  statusCodes: number[]
 }
 
 // Stats types
@@ -33,11 +228,35 @@ export interface Config {
   redirectKeyword: string
   redirectTargetModel: string
   redirectTargetName: string
+  redirectRules: RedirectRule[]
+  defaultRouteGroup: string
   minimizeToTray: boolean
   autoStart: boolean
   enableFileLog: boolean
 }
 
+// Content-based routing rule; null conditions match anything
+export interface RoutingRule {
+  name: string
+  enabled: boolean
+  models: string[]
+  min_input_tokens: number
+  max_input_tokens: number
+  has_tools: boolean | null
+  has_images: boolean | null
+  stream: boolean | null
+  system_contains: string
+  target_model: string
+  target_route_id: number
+}
+
+export interface RedirectRule {
+  keyword: string
+  targetModel: string
+  targetRouteId: number
+  targetName: string
+}
+
 // App settings types
 export interface AppSettings {
   minimizeToTray: boolean
@@ -86,31 +305,181 @@ export const getRoutes = async (): Promise<Route[]> => {
   return callService<Route[]>('GetRoutes')
 }
 
-export const addRoute = async (
+export const addRoute = async (route: RouteInput): Promise<void> => {
+  return callService<void>('AddRoute', route)
+}
+
+export const updateRoute = async (route: RouteInput & { id: number }): Promise<void> => {
+  return callService<void>('UpdateRoute', route)
+}
+
+export const deleteRoute = async (id: number): Promise<void> => {
+  return callService<void>('DeleteRoute', id)
+}
+
+// Load balancing
+export const getLoadBalanceConfig = async (): Promise<LoadBalanceConfig> => {
+  return callService<LoadBalanceConfig>('GetLoadBalanceConfig')
+}
+
+export const setDefaultLoadBalanceStrategy = async (strategy: string): Promise<void> => {
+  return callService<void>('SetDefaultLoadBalanceStrategy', strategy)
+}
+
+export const setModelLoadBalanceStrategy = async (model: string, strategy: string): Promise<void> => {
+  return callService<void>('SetModelLoadBalanceStrategy', model, strategy)
+}
+
+export const getFailoverConfig = async (): Promise<FailoverConfig> => {
+  return callService<FailoverConfig>('GetFailoverConfig')
+}
+
+export const setFailoverConfig = async (enabled: boolean, maxRetries: number, statusCodes: number[]): Promise<void> => {
+  return callService<void>('SetFailoverConfig', enabled, maxRetries, statusCodes)
+}
+
+export const getCircuitBreakerStatus = async (): Promise<CircuitBreakerStatus[]> => {
+  return callService<CircuitBreakerStatus[]>('GetCircuitBreakerStatus')
+}
+
+export const resetCircuitBreaker = async (id: number): Promise<void> => {
+  return callService<void>('ResetCircuitBreaker', id)
+}
+
+export const getHealthCheckConfig = async (): Promise<HealthCheckConfig> => {
+  return callService<HealthCheckConfig>('GetHealthCheckConfig')
+}
+
+export const setHealthCheckConfig = async (enabled: boolean, intervalSeconds: number, method: string, skipUnhealthy: boolean): Promise<void> => {
+  return callService<void>('SetHealthCheckConfig', enabled, intervalSeconds, method, skipUnhealthy)
+}
+
+export const getRouteHealthHistory = async (id: number, limit: number): Promise<RouteHealthRecord[]> => {
+  return callService<RouteHealthRecord[]>('GetRouteHealthHistory', id, limit)
+}
+
+export const checkRouteHealth = async (id: number): Promise<RouteHealthRecord> => {
+  return callService<RouteHealthRecord>('CheckRouteHealth', id)
+}
+
+export const testRoute = async (id: number): Promise<RouteTestResult> => {
+  return callService<RouteTestResult>('TestRoute', id)
+}
+
+// Route API keys
+export const getRouteKeys = async (routeId: number): Promise<RouteKey[]> => {
+  return callService<RouteKey[]>('GetRouteKeys', routeId)
+}
+
+export const getRouteKeyUsage = async (routeId: number): Promise<KeyUsage[]> => {
+  return callService<KeyUsage[]>('GetRouteKeyUsage', routeId)
+}
+
+export const addRouteKey = async (routeId: number, name: string, apiKey: string): Promise<void> => {
+  return callService<void>('AddRouteKey', routeId, name, apiKey)
+}
+
+export const deleteRouteKey = async (id: number): Promise<void> => {
+  return callService<void>('DeleteRouteKey', id)
+}
+
+export const toggleRouteKey = async (id: number, enabled: boolean): Promise<void> => {
+  return callService<void>('ToggleRouteKey', id, enabled)
+}
+
+export const getKeyRotationConfig = async (): Promise<KeyRotationConfig> => {
+  return callService<KeyRotationConfig>('GetKeyRotationConfig')
+}
+
+export const setKeyRotationConfig = async (strategy: string, cooldownSeconds: number): Promise<void> => {
+  return callService<void>('SetKeyRotationConfig', strategy, cooldownSeconds)
+}
+
+export const getRateLimitConfig = async (): Promise<RateLimitConfig> => {
+  return callService<RateLimitConfig>('GetRateLimitConfig')
+}
+
+export const setRateLimitConfig = async (queueSize: number, maxWaitSeconds: number): Promise<void> => {
+  return callService<void>('SetRateLimitConfig', queueSize, maxWaitSeconds)
+}
+
+export const getRouteRateLimitStatus = async (routeId: number): Promise<RateLimitStatus> => {
+  return callService<RateLimitStatus>('GetRouteRateLimitStatus', routeId)
+}
+
+export const getStickySessionConfig = async (): Promise<StickySessionConfig> => {
+  return callService<StickySessionConfig>('GetStickySessionConfig')
+}
+
+export const setStickySessionConfig = async (enabled: boolean, ttlSeconds: number): Promise<void> => {
+  return callService<void>('SetStickySessionConfig', enabled, ttlSeconds)
+}
+
+export const clearStickySessions = async (): Promise<void> => {
+  return callService<void>('ClearStickySessions')
+}
+
+export const exportRoutes = async (format: 'json' | 'yaml', includeKeys: boolean): Promise<string> => {
+  return callService<string>('ExportRoutes', format, includeKeys)
+}
+
+export const importRoutes = async (content: string, mode: 'merge' | 'replace', dryRun: boolean, allowLocalRefs: boolean = false): Promise<RouteImportResult> => {
+  return callService<RouteImportResult>('ImportRoutes', content, mode, dryRun, allowLocalRefs)
+}
+
+export const importExternalConfig = async (
+  source: 'cc-switch' | 'ccnexus' | 'code-switch',
+  path: string,
+  group: string,
+  dryRun: boolean
+): Promise<ExternalImportResult> => {
+  return callService<ExternalImportResult>('ImportExternalConfig', source, path, group, dryRun)
+}
+
+// Providers
+export const getProviders = async (): Promise<Provider[]> => {
+  return callService<Provider[]>('GetProviders')
+}
+
+export const addProvider = async (
   name: string,
-  model: string,
   apiUrl: string,
   apiKey: string,
+  format: string,
   group: string,
-  format: string
-): Promise<void> => {
-  return callService<void>('AddRoute', name, model, apiUrl, apiKey, group, format)
+  includePatterns: string,
+  excludePatterns: string,
+  outboundProxy: string,
+  syncInterval: number
+): Promise<number> => {
+  return callService<number>('AddProvider', name, apiUrl, apiKey, format, group, includePatterns, excludePatterns, outboundProxy, syncInterval)
 }
 
-export const updateRoute = async (
+export const updateProvider = async (
   id: number,
   name: string,
-  model: string,
   apiUrl: string,
   apiKey: string,
+  format: string,
   group: string,
-  format: string
+  includePatterns: string,
+  excludePatterns: string,
+  outboundProxy: string,
+  syncInterval: number
 ): Promise<void> => {
-  return callService<void>('UpdateRoute', id, name, model, apiUrl, apiKey, group, format)
+  return callService<void>('UpdateProvider', id, name, apiUrl, apiKey, format, group, includePatterns, excludePatterns, outboundProxy, syncInterval)
 }
 
-export const deleteRoute = async (id: number): Promise<void> => {
-  return callService<void>('DeleteRoute', id)
+export const toggleProvider = async (id: number, enabled: boolean): Promise<void> => {
+  return callService<void>('ToggleProvider', id, enabled)
+}
+
+export const deleteProvider = async (id: number, deleteRoutes: boolean): Promise<void> => {
+  return callService<void>('DeleteProvider', id, deleteRoutes)
+}
+
+export const syncProvider = async (id: number): Promise<ProviderSyncResult> => {
+  return callService<ProviderSyncResult>('SyncProvider', id)
 }
 
 // Statistics
@@ -147,6 +516,43 @@ export const updateConfig = async (
   return callService<void>('UpdateConfig', redirectEnabled, redirectKeyword, redirectTargetModel)
 }
 
+export const getRedirectRules = async (): Promise<RedirectRule[]> => {
+  return callService<RedirectRule[]>('GetRedirectRules')
+}
+
+export const addRedirectRule = async (keyword: string, targetModel: string, targetRouteId: number = 0): Promise<void> => {
+  return callService<void>('AddRedirectRule', keyword, targetModel, targetRouteId)
+}
+
+export const updateRedirectRule = async (
+  oldKeyword: string,
+  keyword: string,
+  targetModel: string,
+  targetRouteId: number = 0
+): Promise<void> => {
+  return callService<void>('UpdateRedirectRule', oldKeyword, keyword, targetModel, targetRouteId)
+}
+
+export const deleteRedirectRule = async (keyword: string): Promise<void> => {
+  return callService<void>('DeleteRedirectRule', keyword)
+}
+
+export const getRoutingRules = async (): Promise<RoutingRule[]> => {
+  return callService<RoutingRule[]>('GetRoutingRules')
+}
+
+export const setRoutingRules = async (rules: RoutingRule[]): Promise<void> => {
+  return callService<void>('SetRoutingRules', rules)
+}
+
+export const getRouteGroups = async (): Promise<string[]> => {
+  return callService<string[]>('GetRouteGroups')
+}
+
+export const setDefaultRouteGroup = async (group: string): Promise<void> => {
+  return callService<void>('SetDefaultRouteGroup', group)
+}
+
 export const updateLocalApiKey = async (newApiKey: string): Promise<void> => {
   return callService<void>('UpdateLocalApiKey', newApiKey)
 }
@@ -169,8 +575,13 @@ export const setEnableFileLog = async (enabled: boolean): Promise<void> => {
 }
 
 // Remote models
-export const fetchRemoteModels = async (apiUrl: string, apiKey: string): Promise<string[]> => {
-  return callService<string[]>('FetchRemoteModels', apiUrl, apiKey)
+export const fetchRemoteModels = async (apiUrl: string, apiKey: string, outboundProxy: string = ''): Promise<string[]> => {
+  return callService<string[]>('FetchRemoteModels', apiUrl, apiKey, outboundProxy)
+}
+
+// Uses the route's stored key, for when the form only has the masked value
+export const fetchRouteRemoteModels = async (routeId: number, apiUrl: string, outboundProxy: string = ''): Promise<string[]> => {
+  return callService<string[]>('FetchRouteRemoteModels', routeId, apiUrl, outboundProxy)
 }
 
 // Import
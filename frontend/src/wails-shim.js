@@ -32,11 +32,49 @@ const createWailsShim = () => {
   const App = {
     // Route management
     GetRoutes: () => callService('GetRoutes'),
-    AddRoute: (name, model, apiUrl, apiKey, group, format) => 
-      callService('AddRoute', name, model, apiUrl, apiKey, group, format),
-    UpdateRoute: (id, name, model, apiUrl, apiKey, group, format) => 
-      callService('UpdateRoute', id, name, model, apiUrl, apiKey, group, format),
+    AddRoute: (route) => callService('AddRoute', route),
+    UpdateRoute: (route) => callService('UpdateRoute', route),
     DeleteRoute: (id) => callService('DeleteRoute', id),
+
+    // Load balancing
+    GetLoadBalanceConfig: () => callService('GetLoadBalanceConfig'),
+    SetDefaultLoadBalanceStrategy: (strategy) => callService('SetDefaultLoadBalanceStrategy', strategy),
+    SetModelLoadBalanceStrategy: (model, strategy) => callService('SetModelLoadBalanceStrategy', model, strategy),
+    GetFailoverConfig: () => callService('GetFailoverConfig'),
+    SetFailoverConfig: (enabled, maxRetries, statusCodes) => callService('SetFailoverConfig', enabled, maxRetries, statusCodes),
+    GetCircuitBreakerStatus: () => callService('GetCircuitBreakerStatus'),
+    ResetCircuitBreaker: (id) => callService('ResetCircuitBreaker', id),
+    GetHealthCheckConfig: () => callService('GetHealthCheckConfig'),
+    SetHealthCheckConfig: (enabled, intervalSeconds, method, skipUnhealthy) => callService('SetHealthCheckConfig', enabled, intervalSeconds, method, skipUnhealthy),
+    GetRouteHealthHistory: (id, limit) => callService('GetRouteHealthHistory', id, limit),
+    CheckRouteHealth: (id) => callService('CheckRouteHealth', id),
+    TestRoute: (id) => callService('TestRoute', id),
+    GetRouteKeys: (routeId) => callService('GetRouteKeys', routeId),
+    GetRouteKeyUsage: (routeId) => callService('GetRouteKeyUsage', routeId),
+    AddRouteKey: (routeId, name, apiKey) => callService('AddRouteKey', routeId, name ?? '', apiKey),
+    DeleteRouteKey: (id) => callService('DeleteRouteKey', id),
+    ToggleRouteKey: (id, enabled) => callService('ToggleRouteKey', id, enabled),
+    GetKeyRotationConfig: () => callService('GetKeyRotationConfig'),
+    SetKeyRotationConfig: (strategy, cooldownSeconds) => callService('SetKeyRotationConfig', strategy, cooldownSeconds),
+    GetRateLimitConfig: () => callService('GetRateLimitConfig'),
+    SetRateLimitConfig: (queueSize, maxWaitSeconds) => callService('SetRateLimitConfig', queueSize, maxWaitSeconds),
+    GetRouteRateLimitStatus: (routeId) => callService('GetRouteRateLimitStatus', routeId),
+    GetStickySessionConfig: () => callService('GetStickySessionConfig'),
+    SetStickySessionConfig: (enabled, ttlSeconds) => callService('SetStickySessionConfig', enabled, ttlSeconds),
+    ClearStickySessions: () => callService('ClearStickySessions'),
+    ExportRoutes: (format, includeKeys) => callService('ExportRoutes', format, includeKeys),
+    ImportRoutes: (content, mode, dryRun, allowLocalRefs) => callService('ImportRoutes', content, mode, dryRun, allowLocalRefs ?? false),
+    ImportExternalConfig: (source, path, group, dryRun) => callService('ImportExternalConfig', source, path, group, dryRun),
+    
+    // Providers
+    GetProviders: () => callService('GetProviders'),
+    AddProvider: (name, apiUrl, apiKey, format, group, includePatterns, excludePatterns, outboundProxy, syncInterval) =>
+      callService('AddProvider', name, apiUrl, apiKey, format, group ?? '', includePatterns ?? '', excludePatterns ?? '', outboundProxy ?? '', syncInterval ?? 0),
+    UpdateProvider: (id, name, apiUrl, apiKey, format, group, includePatterns, excludePatterns, outboundProxy, syncInterval) =>
+      callService('UpdateProvider', id, name, apiUrl, apiKey, format, group ?? '', includePatterns ?? '', excludePatterns ?? '', outboundProxy ?? '', syncInterval ?? 0),
+    ToggleProvider: (id, enabled) => callService('ToggleProvider', id, enabled),
+    DeleteProvider: (id, deleteRoutes) => callService('DeleteProvider', id, deleteRoutes),
+    SyncProvider: (id) => callService('SyncProvider', id),
     
     // Statistics
     GetStats: () => callService('GetStats'),
@@ -49,6 +87,15 @@ const createWailsShim = () => {
     GetConfig: () => callService('GetConfig'),
     UpdateConfig: (redirectEnabled, redirectKeyword, redirectTargetModel, redirectTargetRouteId) => 
       callService('UpdateConfig', redirectEnabled, redirectKeyword, redirectTargetModel, redirectTargetRouteId),
+    GetRedirectRules: () => callService('GetRedirectRules'),
+    AddRedirectRule: (keyword, targetModel, targetRouteId) => callService('AddRedirectRule', keyword, targetModel, targetRouteId ?? 0),
+    UpdateRedirectRule: (oldKeyword, keyword, targetModel, targetRouteId) => 
+      callService('UpdateRedirectRule', oldKeyword, keyword, targetModel, targetRouteId ?? 0),
+    DeleteRedirectRule: (keyword) => callService('DeleteRedirectRule', keyword),
+    GetRoutingRules: () => callService('GetRoutingRules'),
+    SetRoutingRules: (rules) => callService('SetRoutingRules', rules),
+    GetRouteGroups: () => callService('GetRouteGroups'),
+    SetDefaultRouteGroup: (group) => callService('SetDefaultRouteGroup', group ?? ''),
     UpdatePort: (port) => callService('UpdatePort', port),
     UpdateLocalApiKey: (newApiKey) => callService('UpdateLocalApiKey', newApiKey),
     RestartApp: () => callService('RestartApp'),
@@ -60,7 +107,8 @@ const createWailsShim = () => {
     SetEnableFileLog: (enabled) => callService('SetEnableFileLog', enabled),
     
     // Remote models
-    FetchRemoteModels: (apiUrl, apiKey) => callService('FetchRemoteModels', apiUrl, apiKey),
+    FetchRemoteModels: (apiUrl, apiKey, outboundProxy) => callService('FetchRemoteModels', apiUrl, apiKey, outboundProxy ?? ''),
+    FetchRouteRemoteModels: (routeId, apiUrl, outboundProxy) => callService('FetchRouteRemoteModels', routeId, apiUrl, outboundProxy ?? ''),
     
     // Import
     ImportRouteFromFormat: (name, model, apiUrl, apiKey, group, targetFormat) => 
@@ -8,10 +8,35 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// RedirectRule 重定向规则：请求模型为 Keyword 时转发到目标路由
+// TargetRouteID 优先，未配置或路由不存在时按 TargetModel 选路
+type RedirectRule struct {
+	Keyword       string `json:"keyword"`
+	TargetModel   string `json:"target_model"`
+	TargetRouteID int64  `json:"target_route_id"`
+}
+
+// RoutingRule 按请求内容选择路由的规则，所有已设置的条件同时满足时命中
+// 指针类型的条件为 nil 时表示不限
+type RoutingRule struct {
+	Name           string   `json:"name"`
+	Enabled        bool     `json:"enabled"`
+	Models         []string `json:"models"`           // 只对这些模型（或重定向关键字）生效，支持通配符，为空时对所有请求生效
+	MinInputTokens int      `json:"min_input_tokens"` // 估算的输入 token 数下限，0 表示不限
+	MaxInputTokens int      `json:"max_input_tokens"` // 估算的输入 token 数上限，0 表示不限
+	HasTools       *bool    `json:"has_tools"`
+	HasImages      *bool    `json:"has_images"`
+	Stream         *bool    `json:"stream"`
+	SystemContains string   `json:"system_contains"` // 系统提示词包含的子串（不区分大小写）
+	TargetModel    string   `json:"target_model"`
+	TargetRouteID  int64    `json:"target_route_id"`
+}
+
 type Config struct {
 	Host                  string `json:"host"`
 	Port                  int    `json:"port"`
 	DatabasePath          string `json:"database_path"`
+	MasterKeyFile         string `json:"master_key_file"` // 加密上游 API Key 的主密钥文件，环境变量 ANYPROXYAI_MASTER_KEY 优先
 	LocalAPIKey           string `json:"local_api_key"`
 	RedirectEnabled       bool   `json:"redirect_enabled"`
 	RedirectKeyword       string `json:"redirect_keyword"`
@@ -22,27 +47,88 @@ type Config struct {
 	AutoStart             bool   `json:"auto_start"`
 	EnableFileLog         bool   `json:"enable_file_log"`
 	Language              string `json:"language"`
-	configPath            string
+	// 额外的重定向规则，与单个重定向关键字共用 RedirectEnabled 开关
+	RedirectRules []RedirectRule `json:"redirect_rules"`
+	// 内容路由规则：按顺序匹配，命中的规则优先于重定向关键字和按模型选路
+	RoutingRules []RoutingRule `json:"routing_rules"`
+	// 请求未通过 X-Route-Group 请求头或 model@group 后缀指定分组时使用的默认分组，为空表示不限分组
+	DefaultRouteGroup string `json:"default_route_group"`
+	// 负载均衡策略：random / weighted_random / round_robin / least_latency
+	LoadBalanceStrategy string            `json:"load_balance_strategy"`
+	ModelStrategies     map[string]string `json:"model_strategies"` // 按模型覆盖负载均衡策略
+	// 故障转移：上游连接失败或返回指定状态码时切换到同模型的下一条路由
+	FailoverEnabled     bool  `json:"failover_enabled"`
+	FailoverMaxRetries  int   `json:"failover_max_retries"`
+	FailoverStatusCodes []int `json:"failover_status_codes"`
+	// 熔断器：路由连续失败或错误率过高时暂时跳过该路由，冷却后放行探测请求
+	CircuitBreakerEnabled          bool    `json:"circuit_breaker_enabled"`
+	CircuitBreakerFailureThreshold int     `json:"circuit_breaker_failure_threshold"` // 连续失败次数
+	CircuitBreakerErrorRate        float64 `json:"circuit_breaker_error_rate"`        // 统计窗口内的错误率 (0-1)
+	CircuitBreakerMinRequests      int     `json:"circuit_breaker_min_requests"`      // 计算错误率所需的最少请求数
+	CircuitBreakerWindowSeconds    int     `json:"circuit_breaker_window_seconds"`
+	CircuitBreakerCooldownSeconds  int     `json:"circuit_breaker_cooldown_seconds"`
+	// 健康检查：后台定时探测所有启用的路由
+	HealthCheckEnabled         bool   `json:"health_check_enabled"`
+	HealthCheckIntervalSeconds int    `json:"health_check_interval_seconds"`
+	HealthCheckTimeoutSeconds  int    `json:"health_check_timeout_seconds"`
+	HealthCheckMethod          string `json:"health_check_method"` // models: 请求模型列表 / completion: 发送极小的补全请求
+	HealthCheckSkipUnhealthy   bool   `json:"health_check_skip_unhealthy"`
+	// 多 Key 轮换：路由配置了附加 API Key 时的轮换策略（round_robin / least_used），Key 返回 401/429 后冷却的秒数
+	KeyRotationStrategy string `json:"key_rotation_strategy"`
+	KeyCooldownSeconds  int    `json:"key_cooldown_seconds"`
+	// 路由限流：超过路由 RPM/TPM 限额的请求最多排队的数量和最长排队秒数，超过后切换到其他路由或返回 429
+	RateLimitQueueSize      int `json:"rate_limit_queue_size"`
+	RateLimitMaxWaitSeconds int `json:"rate_limit_max_wait_seconds"`
+	// 会话保持：同一会话（X-Session-ID 请求头、metadata.user_id 或系统提示词加首条用户消息）的请求优先发往同一路由，以保留上游的提示词缓存
+	StickySessionEnabled    bool `json:"sticky_session_enabled"`
+	StickySessionTTLSeconds int  `json:"sticky_session_ttl_seconds"`
+	configPath              string
 }
 
 func LoadConfig() *Config {
 	configPath := "config.json"
 
 	cfg := &Config{
-		Host:                  "localhost",
-		Port:                  5642,
-		DatabasePath:          "routes.db",
-		LocalAPIKey:           "sk-local-default-key",
-		RedirectEnabled:       false,
-		RedirectKeyword:       "proxy_auto",
-		RedirectTargetModel:   "",
-		RedirectTargetName:    "",
-		RedirectTargetRouteID: 0,
-		MinimizeToTray:        true,
-		AutoStart:             false,
-		EnableFileLog:         false,
-		Language:              "en-US",
-		configPath:            configPath,
+		Host:                           "localhost",
+		Port:                           5642,
+		DatabasePath:                   "routes.db",
+		MasterKeyFile:                  "master.key",
+		LocalAPIKey:                    "sk-local-default-key",
+		RedirectEnabled:                false,
+		RedirectKeyword:                "proxy_auto",
+		RedirectTargetModel:            "",
+		RedirectTargetName:             "",
+		RedirectTargetRouteID:          0,
+		RedirectRules:                  []RedirectRule{},
+		RoutingRules:                   []RoutingRule{},
+		DefaultRouteGroup:              "",
+		MinimizeToTray:                 true,
+		AutoStart:                      false,
+		EnableFileLog:                  false,
+		Language:                       "en-US",
+		LoadBalanceStrategy:            "weighted_random",
+		ModelStrategies:                map[string]string{},
+		FailoverEnabled:                false,
+		FailoverMaxRetries:             2,
+		FailoverStatusCodes:            []int{429, 500, 502, 503, 504},
+		CircuitBreakerEnabled:          false,
+		CircuitBreakerFailureThreshold: 5,
+		CircuitBreakerErrorRate:        0.5,
+		CircuitBreakerMinRequests:      20,
+		CircuitBreakerWindowSeconds:    60,
+		CircuitBreakerCooldownSeconds:  30,
+		HealthCheckEnabled:             false,
+		HealthCheckIntervalSeconds:     300,
+		HealthCheckTimeoutSeconds:      15,
+		HealthCheckMethod:              "models",
+		HealthCheckSkipUnhealthy:       true,
+		KeyRotationStrategy:            "round_robin",
+		KeyCooldownSeconds:             60,
+		RateLimitQueueSize:             50,
+		RateLimitMaxWaitSeconds:        30,
+		StickySessionEnabled:           false,
+		StickySessionTTLSeconds:        1800,
+		configPath:                     configPath,
 	}
 
 	// 尝试从文件加载配置
@@ -10,16 +10,36 @@ import (
 
 // ModelRoute 模型路由表结构
 type ModelRoute struct {
-	ID        int64     `json:"id"`
-	Name      string    `json:"name"`
-	Model     string    `json:"model"`
-	APIUrl    string    `json:"api_url"`
-	APIKey    string    `json:"api_key"`
-	Group     string    `json:"group"`
-	Format    string    `json:"format"`    // 新增：格式类型 (openai, claude, gemini)
-	Enabled   bool      `json:"enabled"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID            int64     `json:"id"`
+	Name          string    `json:"name"`
+	Model         string    `json:"model"`
+	APIUrl        string    `json:"api_url"`
+	APIKey        string    `json:"api_key"`
+	Group         string    `json:"group"`
+	Format        string    `json:"format"`         // 新增：格式类型 (openai, claude, gemini)
+	Weight        int       `json:"weight"`         // 负载均衡权重，同一模型的多条路由按权重分配流量
+	UpstreamModel string    `json:"upstream_model"` // 发往上游的模型名，为空时使用 Model；Model 只作为对外暴露的名称
+	Priority      int       `json:"priority"`       // 优先级层级，数值越小越优先；只有更高层级全部不可用时才使用低层级
+	ExtraHeaders  string    `json:"extra_headers"`  // 自定义请求头（JSON 对象），添加或覆盖发往上游的请求头
+	ExtraBody     string    `json:"extra_body"`     // 附加请求体字段（JSON 对象），在适配器转换后合并到上游请求体
+	Enabled       bool      `json:"enabled"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+
+	// 上游超时（秒），0 表示不限制
+	ConnectTimeout   int `json:"connect_timeout"`    // 建立连接
+	FirstByteTimeout int `json:"first_byte_timeout"` // 发出请求到收到响应头
+	IdleTimeout      int `json:"idle_timeout"`       // 流式响应两次数据之间的最大间隔
+
+	OutboundProxy string `json:"outbound_proxy"` // 出站代理（http/https/socks5 URL），为空时沿用系统代理，direct 表示直连
+
+	// 上游限流，0 表示不限制；超过限额的请求排队等待，排队超时后切换到其他路由或返回 429
+	RPMLimit int `json:"rpm_limit"` // 每分钟请求数
+	TPMLimit int `json:"tpm_limit"` // 每分钟 token 数，发出请求前按估算的输入 token 预扣，完成后按实际用量校正
+
+	ProviderID int64 `json:"provider_id"` // 由供应商同步自动创建的路由为供应商 ID，手动添加的路由为 0
+
+	Capabilities string `json:"capabilities"` // 模型能力元数据（JSON 对象：上下文窗口、最大输出 token、是否支持图片/工具/流式/JSON Schema/推理），为空表示未知
 }
 
 // RequestLog 请求日志表结构
@@ -32,17 +52,63 @@ type RequestLog struct {
 	TotalTokens    int       `json:"total_tokens"`
 	Success        bool      `json:"success"`
 	ErrorMessage   string    `json:"error_message"`
+	Tier           int       `json:"tier"`       // 本次请求使用的路由优先级层级
+	LatencyMs      int64     `json:"latency_ms"` // 上游请求总耗时
+	TTFTMs         int64     `json:"ttft_ms"`    // 首字耗时，0 表示未知
+	RuleName       string    `json:"rule_name"`  // 命中的内容路由规则名
+	ErrorType      string    `json:"error_type"` // 失败的错误类型，如 connect_timeout / first_byte_timeout / idle_timeout
 	CreatedAt      time.Time `json:"created_at"`
 }
 
-func InitDB(dbPath string) (*sql.DB, error) {
+// RouteKey 路由的附加上游 API Key，与路由自身的 APIKey 一起轮换使用
+type RouteKey struct {
+	ID        int64     `json:"id"`
+	RouteID   int64     `json:"route_id"`
+	Name      string    `json:"name"`
+	APIKey    string    `json:"api_key"`
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Provider 上游供应商，定时拉取模型列表并自动创建、启用或禁用对应的路由
+type Provider struct {
+	ID              int64      `json:"id"`
+	Name            string     `json:"name"`
+	APIUrl          string     `json:"api_url"`
+	APIKey          string     `json:"api_key"`
+	Format          string     `json:"format"`
+	Group           string     `json:"group"`            // 自动创建的路由所属分组
+	IncludePatterns string     `json:"include_patterns"` // 只同步匹配的模型（逗号或换行分隔，支持通配符和正则），为空表示全部
+	ExcludePatterns string     `json:"exclude_patterns"` // 不同步匹配的模型，优先于 include_patterns
+	OutboundProxy   string     `json:"outbound_proxy"`
+	SyncInterval    int        `json:"sync_interval"` // 同步间隔（分钟），0 表示使用默认间隔
+	Models          []string   `json:"models"`        // 上次同步得到的模型（已过滤）
+	LastSyncAt      *time.Time `json:"last_sync_at"`
+	LastSyncError   string     `json:"last_sync_error"`
+	Enabled         bool       `json:"enabled"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// RouteHealth 路由健康检查记录
+type RouteHealth struct {
+	ID           int64     `json:"id"`
+	RouteID      int64     `json:"route_id"`
+	Status       string    `json:"status"` // healthy / unhealthy
+	LatencyMs    int64     `json:"latency_ms"`
+	ErrorMessage string    `json:"error_message"`
+	CheckedAt    time.Time `json:"checked_at"`
+}
+
+// InitDB 打开数据库并执行迁移，keys 用于加密保存的上游 API Key
+func InitDB(dbPath string, keys *KeyCipher) (*sql.DB, error) {
 	db, err := sql.Open("sqlite", dbPath)
 	if err != nil {
 		return nil, err
 	}
 
-	// 创建表
-	if err := createTables(db); err != nil {
+	// 按版本执行数据库迁移
+	if err := runMigrations(db, dbPath, keys); err != nil {
 		db.Close()
 		return nil, err
 	}
@@ -50,56 +116,3 @@ func InitDB(dbPath string) (*sql.DB, error) {
 	log.Info("Database initialized successfully")
 	return db, nil
 }
-
-func createTables(db *sql.DB) error {
-	schema := `
-	CREATE TABLE IF NOT EXISTS model_routes (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT NOT NULL,
-		model TEXT NOT NULL,
-		api_url TEXT NOT NULL,
-		api_key TEXT,
-		"group" TEXT,
-		format TEXT DEFAULT 'openai',
-		enabled INTEGER DEFAULT 1,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	);
-
-	CREATE INDEX IF NOT EXISTS idx_model_routes_model ON model_routes(model);
-	CREATE INDEX IF NOT EXISTS idx_model_routes_enabled ON model_routes(enabled);
-	CREATE INDEX IF NOT EXISTS idx_model_routes_group ON model_routes("group");
-
-	CREATE TABLE IF NOT EXISTS request_logs (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		model TEXT NOT NULL,
-		route_id INTEGER,
-		request_tokens INTEGER DEFAULT 0,
-		response_tokens INTEGER DEFAULT 0,
-		total_tokens INTEGER DEFAULT 0,
-		success INTEGER DEFAULT 1,
-		error_message TEXT,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (route_id) REFERENCES model_routes(id) ON DELETE SET NULL
-	);
-
-	CREATE INDEX IF NOT EXISTS idx_request_logs_model ON request_logs(model);
-	CREATE INDEX IF NOT EXISTS idx_request_logs_route_id ON request_logs(route_id);
-	CREATE INDEX IF NOT EXISTS idx_request_logs_created_at ON request_logs(created_at);
-	CREATE INDEX IF NOT EXISTS idx_request_logs_success ON request_logs(success);
-	`
-
-	_, err := db.Exec(schema)
-	if err != nil {
-		return err
-	}
-
-	// 添加 format 列（如果不存在）- 数据库迁移
-	migration := `
-	ALTER TABLE model_routes ADD COLUMN format TEXT DEFAULT 'openai';
-	`
-	// 忽略错误，因为列可能已经存在
-	db.Exec(migration)
-
-	return nil
-}
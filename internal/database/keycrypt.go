@@ -0,0 +1,202 @@
+package database
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// MasterKeyEnv 指定主密钥的环境变量，设置后优先于密钥文件
+const MasterKeyEnv = "ANYPROXYAI_MASTER_KEY"
+
+// encryptedKeyPrefix 加密后的 API Key 前缀，没有该前缀的值视为明文
+const encryptedKeyPrefix = "enc:v1:"
+
+// secretRefPrefixes 密钥引用的前缀，引用在请求时才解析为真正的 Key，本身不是机密，不加密保存
+var secretRefPrefixes = []string{"env:", "file:", "cmd:"}
+
+// KeyCipher 使用 AES-256-GCM 加密数据库中保存的上游 API Key
+// 为 nil 时不加密，读取已加密的值会返回错误
+type KeyCipher struct {
+	aead cipher.AEAD
+}
+
+// NewKeyCipher 使用 32 字节的主密钥创建加密器
+func NewKeyCipher(key []byte) (*KeyCipher, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("master key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyCipher{aead: aead}, nil
+}
+
+// LoadKeyCipher 加载主密钥：优先读取环境变量 ANYPROXYAI_MASTER_KEY，否则读取 keyFile，文件不存在时生成新的随机密钥并保存
+// 密钥可以是 base64 或十六进制编码的 32 字节，其他内容按口令处理（取 SHA-256）
+func LoadKeyCipher(keyFile string) (*KeyCipher, error) {
+	if value := strings.TrimSpace(os.Getenv(MasterKeyEnv)); value != "" {
+		log.Infof("Using master key from %s", MasterKeyEnv)
+		return NewKeyCipher(parseMasterKey(value))
+	}
+	if keyFile == "" {
+		return nil, fmt.Errorf("no master key: set %s or configure master_key_file", MasterKeyEnv)
+	}
+
+	data, err := os.ReadFile(keyFile)
+	if errors.Is(err, os.ErrNotExist) {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		if dir := filepath.Dir(keyFile); dir != "." {
+			if err := os.MkdirAll(dir, 0700); err != nil {
+				return nil, err
+			}
+		}
+		if err := os.WriteFile(keyFile, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0600); err != nil {
+			return nil, fmt.Errorf("failed to write master key file: %v", err)
+		}
+		log.Warnf("Generated master key file %s; back it up, encrypted API keys cannot be recovered without it", keyFile)
+		return NewKeyCipher(key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read master key file: %v", err)
+	}
+	value := strings.TrimSpace(string(data))
+	if value == "" {
+		return nil, fmt.Errorf("master key file %s is empty", keyFile)
+	}
+	return NewKeyCipher(parseMasterKey(value))
+}
+
+// parseMasterKey 将配置的主密钥转换为 32 字节
+func parseMasterKey(value string) []byte {
+	if key, err := base64.StdEncoding.DecodeString(value); err == nil && len(key) == 32 {
+		return key
+	}
+	if key, err := hex.DecodeString(value); err == nil && len(key) == 32 {
+		return key
+	}
+	sum := sha256.Sum256([]byte(value))
+	return sum[:]
+}
+
+// IsEncryptedKey 判断值是否为加密后的 API Key
+func IsEncryptedKey(value string) bool {
+	return strings.HasPrefix(value, encryptedKeyPrefix)
+}
+
+// IsSecretRef 判断值是否为密钥引用（env:变量名、file:路径 或 cmd:命令）
+func IsSecretRef(value string) bool {
+	for _, prefix := range secretRefPrefixes {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Encrypt 加密 API Key；空值、已加密的值和密钥引用原样返回
+func (c *KeyCipher) Encrypt(plain string) (string, error) {
+	if c == nil || plain == "" || IsEncryptedKey(plain) || IsSecretRef(plain) {
+		return plain, nil
+	}
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(plain), nil)
+	return encryptedKeyPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt 解密 API Key；没有加密前缀的值视为明文原样返回
+func (c *KeyCipher) Decrypt(stored string) (string, error) {
+	if !IsEncryptedKey(stored) {
+		return stored, nil
+	}
+	if c == nil {
+		return "", fmt.Errorf("api key is encrypted but no master key is loaded")
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, encryptedKeyPrefix))
+	if err != nil || len(data) < c.aead.NonceSize() {
+		return "", fmt.Errorf("malformed encrypted api key")
+	}
+	nonce, sealed := data[:c.aead.NonceSize()], data[c.aead.NonceSize():]
+	plain, err := c.aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt api key: wrong master key or corrupted value")
+	}
+	return string(plain), nil
+}
+
+// Matches 判断保存的（可能已加密的）API Key 是否与明文相同，只返回比较结果
+func (c *KeyCipher) Matches(stored, plain string) bool {
+	if stored == plain {
+		return true
+	}
+	decrypted, err := c.Decrypt(stored)
+	return err == nil && decrypted == plain
+}
+
+// encryptAPIKeys 加密各表中仍为明文的 API Key
+func encryptAPIKeys(tx *sql.Tx, keys *KeyCipher) error {
+	if keys == nil {
+		return fmt.Errorf("no master key loaded")
+	}
+	for _, table := range []string{"model_routes", "route_keys", "providers"} {
+		rows, err := tx.Query(fmt.Sprintf(`SELECT id, api_key FROM %s WHERE COALESCE(api_key, '') != '' AND api_key NOT LIKE '%s%%'`, table, encryptedKeyPrefix))
+		if err != nil {
+			return err
+		}
+		plain := map[int64]string{}
+		for rows.Next() {
+			var id int64
+			var key string
+			if err := rows.Scan(&id, &key); err != nil {
+				rows.Close()
+				return err
+			}
+			plain[id] = key
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		encrypted := 0
+		for id, key := range plain {
+			sealed, err := keys.Encrypt(key)
+			if err != nil {
+				return err
+			}
+			if sealed == key {
+				continue
+			}
+			if _, err := tx.Exec(fmt.Sprintf(`UPDATE %s SET api_key = ? WHERE id = ?`, table), sealed, id); err != nil {
+				return err
+			}
+			encrypted++
+		}
+		if encrypted > 0 {
+			log.Infof("Encrypted %d api keys in %s", encrypted, table)
+		}
+	}
+	return nil
+}
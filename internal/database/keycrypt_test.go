@@ -0,0 +1,185 @@
+package database
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestKeyCipherRoundTrip(t *testing.T) {
+	keys := newTestCipher(t)
+	const plain = "sk-test-0123456789abcdef"
+
+	sealed, err := keys.Encrypt(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncryptedKey(sealed) || strings.Contains(sealed, plain) {
+		t.Fatalf("Encrypt() = %q, want an %s value without the plaintext", sealed, encryptedKeyPrefix)
+	}
+	got, err := keys.Decrypt(sealed)
+	if err != nil || got != plain {
+		t.Fatalf("Decrypt() = %q, %v; want %q", got, err, plain)
+	}
+
+	// 每次加密使用新的随机 nonce
+	again, err := keys.Encrypt(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again == sealed {
+		t.Fatal("encrypting the same key twice should give different values")
+	}
+	if !keys.Matches(sealed, plain) || !keys.Matches(again, plain) {
+		t.Fatal("Matches() should accept both encrypted values")
+	}
+	if keys.Matches(sealed, "sk-other") {
+		t.Fatal("Matches() should reject a different key")
+	}
+}
+
+func TestKeyCipherPassthrough(t *testing.T) {
+	keys := newTestCipher(t)
+	sealed, err := keys.Encrypt("sk-already")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, value := range []string{"", "env:OPENAI_API_KEY", "file:/run/secrets/openai", "cmd:pass show openai", sealed} {
+		got, err := keys.Encrypt(value)
+		if err != nil || got != value {
+			t.Errorf("Encrypt(%q) = %q, %v; want it unchanged", value, got, err)
+		}
+	}
+
+	// 没有加密前缀的值（旧数据、密钥引用）按原样返回
+	for _, value := range []string{"", "sk-plain", "env:OPENAI_API_KEY"} {
+		got, err := keys.Decrypt(value)
+		if err != nil || got != value {
+			t.Errorf("Decrypt(%q) = %q, %v; want it unchanged", value, got, err)
+		}
+	}
+}
+
+func TestKeyCipherRejectsWrongKey(t *testing.T) {
+	sealed, err := newTestCipher(t).Encrypt("sk-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := NewKeyCipher(bytes.Repeat([]byte{9}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Decrypt(sealed); err == nil {
+		t.Fatal("Decrypt() with a different master key should fail")
+	}
+	if other.Matches(sealed, "sk-secret") {
+		t.Fatal("Matches() with a different master key should be false")
+	}
+
+	var none *KeyCipher
+	if _, err := none.Decrypt(sealed); err == nil {
+		t.Fatal("Decrypt() without a master key should fail for an encrypted value")
+	}
+	if _, err := other.Decrypt(encryptedKeyPrefix + "not-base64!"); err == nil {
+		t.Fatal("Decrypt() should fail for a malformed value")
+	}
+}
+
+func TestNilKeyCipherStoresPlaintext(t *testing.T) {
+	var none *KeyCipher
+	got, err := none.Encrypt("sk-plain")
+	if err != nil || got != "sk-plain" {
+		t.Fatalf("Encrypt() without a master key = %q, %v; want the plaintext", got, err)
+	}
+}
+
+func TestIsSecretRef(t *testing.T) {
+	for value, want := range map[string]bool{
+		"env:OPENAI_API_KEY":  true,
+		"file:/run/secrets/x": true,
+		"cmd:pass show x":     true,
+		"sk-env:abc":          false,
+		"":                    false,
+		encryptedKeyPrefix:    false,
+	} {
+		if got := IsSecretRef(value); got != want {
+			t.Errorf("IsSecretRef(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
+
+func TestParseMasterKey(t *testing.T) {
+	raw := bytes.Repeat([]byte{3}, 32)
+	for name, value := range map[string]string{
+		"base64": base64.StdEncoding.EncodeToString(raw),
+		"hex":    hex.EncodeToString(raw),
+	} {
+		if got := parseMasterKey(value); !bytes.Equal(got, raw) {
+			t.Errorf("%s key was not decoded", name)
+		}
+	}
+	if got := parseMasterKey("correct horse battery staple"); len(got) != 32 {
+		t.Errorf("passphrase gave a %d byte key, want 32", len(got))
+	}
+}
+
+func TestLoadKeyCipherGeneratesAndReusesKeyFile(t *testing.T) {
+	t.Setenv(MasterKeyEnv, "")
+	keyFile := filepath.Join(t.TempDir(), "keys", "master.key")
+
+	first, err := LoadKeyCipher(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); runtime.GOOS != "windows" && perm != 0600 {
+		t.Fatalf("master key file permissions = %v, want 0600", perm)
+	}
+
+	sealed, err := first.Encrypt("sk-persisted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := LoadKeyCipher(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := second.Decrypt(sealed); err != nil || got != "sk-persisted" {
+		t.Fatalf("key loaded from file Decrypt() = %q, %v; want the original key", got, err)
+	}
+}
+
+func TestLoadKeyCipherPrefersEnvironment(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "master.key")
+	t.Setenv(MasterKeyEnv, "env passphrase")
+
+	fromEnv, err := LoadKeyCipher(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(keyFile); !os.IsNotExist(err) {
+		t.Fatal("no key file should be created when the environment variable is set")
+	}
+
+	sealed, err := fromEnv.Encrypt("sk-env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	same, err := NewKeyCipher(parseMasterKey("env passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := same.Decrypt(sealed); err != nil || got != "sk-env" {
+		t.Fatalf("Decrypt() = %q, %v; want the original key", got, err)
+	}
+}
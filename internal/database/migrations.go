@@ -0,0 +1,347 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Migration 一次数据库结构变更
+// 迁移按 Version 顺序执行，每个迁移在独立的事务中运行，成功后记录到 schema_migrations 表
+// Up 必须是幂等的：旧版本程序创建的数据库没有迁移记录，会从第一个迁移开始重新执行
+type Migration struct {
+	Version     int
+	Name        string
+	Destructive bool // 会删除或改写已有数据，执行前先备份数据库文件
+	Up          func(tx *sql.Tx) error
+	// ScrubBackup 迁移成功后在备份文件上执行，清除备份中不应继续保留的数据（如明文 API Key）；
+	// 执行失败时删除备份。设置了该项的迁移完成后还会 VACUUM 数据库，避免旧数据残留在空闲页中
+	ScrubBackup func(tx *sql.Tx) error
+}
+
+// schemaMigrations 所有迁移，只能在末尾追加，已发布的迁移不能修改或重新编号
+// keys 为加密 API Key 的主密钥，供需要读写 Key 的迁移使用
+func schemaMigrations(keys *KeyCipher) []Migration {
+	return []Migration{
+		{Version: 1, Name: "create_core_tables", Up: createCoreTables},
+		{Version: 2, Name: "add_route_columns", Up: addRouteColumns},
+		{Version: 3, Name: "add_request_log_columns", Up: addRequestLogColumns},
+		{Version: 4, Name: "create_route_health", Up: createRouteHealth},
+		{Version: 5, Name: "create_route_keys", Up: createRouteKeys},
+		{Version: 6, Name: "create_providers", Up: createProviders},
+		{Version: 7, Name: "encrypt_api_keys", Destructive: true, Up: func(tx *sql.Tx) error { return encryptAPIKeys(tx, keys) },
+			ScrubBackup: func(tx *sql.Tx) error { return encryptAPIKeys(tx, keys) }},
+		{Version: 8, Name: "add_route_capabilities", Up: addRouteCapabilities},
+	}
+}
+
+// LatestSchemaVersion 当前程序支持的最新数据库结构版本
+func LatestSchemaVersion() int {
+	migrations := schemaMigrations(nil)
+	return migrations[len(migrations)-1].Version
+}
+
+// SchemaVersion 数据库当前已执行到的迁移版本，没有迁移记录时返回 0
+func SchemaVersion(db *sql.DB) (int, error) {
+	var version int
+	err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	return version, err
+}
+
+// runMigrations 按顺序执行尚未执行的迁移
+// 数据库版本比程序支持的更新时直接报错，避免旧版本程序读写新结构的数据库
+func runMigrations(db *sql.DB, dbPath string, keys *KeyCipher) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %v", err)
+	}
+
+	// 新建的数据库没有需要备份的数据
+	var existing int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'model_routes'`).Scan(&existing); err != nil {
+		return err
+	}
+
+	current, err := SchemaVersion(db)
+	if err != nil {
+		return fmt.Errorf("failed to read schema version: %v", err)
+	}
+	if latest := LatestSchemaVersion(); current > latest {
+		return fmt.Errorf("database %s has schema version %d, but this build only supports up to version %d; please upgrade the application", dbPath, current, latest)
+	}
+
+	for _, m := range schemaMigrations(keys) {
+		if m.Version <= current {
+			continue
+		}
+		var backup string
+		if m.Destructive && existing > 0 {
+			backup, err = backupDatabase(db, dbPath, m.Version)
+			if err != nil {
+				return fmt.Errorf("failed to back up database before migration %d (%s): %v", m.Version, m.Name, err)
+			}
+			if backup != "" {
+				log.Infof("Database backed up to %s before migration %d (%s)", backup, m.Version, m.Name)
+			}
+		}
+		if err := applyMigration(db, m); err != nil {
+			return fmt.Errorf("database migration %d (%s) failed: %v", m.Version, m.Name, err)
+		}
+		log.Infof("Applied database migration %d: %s", m.Version, m.Name)
+
+		if m.ScrubBackup != nil {
+			if _, err := db.Exec(`VACUUM`); err != nil {
+				log.Warnf("Failed to vacuum database after migration %d (%s): %v", m.Version, m.Name, err)
+			}
+			if backup != "" {
+				if err := scrubBackup(backup, m.ScrubBackup); err != nil {
+					log.Errorf("Failed to scrub backup %s after migration %d (%s), deleting it: %v", backup, m.Version, m.Name, err)
+					if err := os.Remove(backup); err != nil {
+						log.Errorf("Failed to delete backup %s, it may still contain plaintext secrets: %v", backup, err)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// scrubBackup 在事务中对备份文件执行清理，完成后 VACUUM 使被改写的数据不残留在文件中
+func scrubBackup(path string, scrub func(tx *sql.Tx) error) error {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := scrub(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	_, err = db.Exec(`VACUUM`)
+	return err
+}
+
+// applyMigration 在事务中执行迁移并记录版本，失败时整体回滚
+func applyMigration(db *sql.DB, m Migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := m.Up(tx); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`, m.Version, m.Name, time.Now()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// backupDatabase 将数据库完整复制到同目录下的 <文件名>.v<版本>-<时间>.bak，内存数据库不备份
+func backupDatabase(db *sql.DB, dbPath string, version int) (string, error) {
+	if dbPath == "" || dbPath == ":memory:" || strings.HasPrefix(dbPath, "file::memory:") {
+		return "", nil
+	}
+	path := strings.SplitN(strings.TrimPrefix(dbPath, "file:"), "?", 2)[0]
+	backup := fmt.Sprintf("%s.v%d-%s.bak", path, version, time.Now().Format("20060102-150405"))
+	if _, err := db.Exec(`VACUUM INTO ?`, backup); err != nil {
+		return "", err
+	}
+	return backup, nil
+}
+
+// hasColumn 判断表中是否已有该列
+func hasColumn(tx *sql.Tx, table, column string) (bool, error) {
+	rows, err := tx.Query(fmt.Sprintf(`PRAGMA table_info(%q)`, table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dflt, &pk); err != nil {
+			return false, err
+		}
+		if strings.EqualFold(name, column) {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+// addColumns 为表添加尚不存在的列，columns 为「列名 类型及默认值」
+func addColumns(tx *sql.Tx, table string, columns ...string) error {
+	for _, def := range columns {
+		column := strings.Fields(def)[0]
+		exists, err := hasColumn(tx, table, column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if _, err := tx.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s`, table, def)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createCoreTables 路由表和请求日志表（最初版本的结构）
+func createCoreTables(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	CREATE TABLE IF NOT EXISTS model_routes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		model TEXT NOT NULL,
+		api_url TEXT NOT NULL,
+		api_key TEXT,
+		"group" TEXT,
+		enabled INTEGER DEFAULT 1,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_model_routes_model ON model_routes(model);
+	CREATE INDEX IF NOT EXISTS idx_model_routes_enabled ON model_routes(enabled);
+	CREATE INDEX IF NOT EXISTS idx_model_routes_group ON model_routes("group");
+
+	CREATE TABLE IF NOT EXISTS request_logs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		model TEXT NOT NULL,
+		route_id INTEGER,
+		request_tokens INTEGER DEFAULT 0,
+		response_tokens INTEGER DEFAULT 0,
+		total_tokens INTEGER DEFAULT 0,
+		success INTEGER DEFAULT 1,
+		error_message TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (route_id) REFERENCES model_routes(id) ON DELETE SET NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_request_logs_model ON request_logs(model);
+	CREATE INDEX IF NOT EXISTS idx_request_logs_route_id ON request_logs(route_id);
+	CREATE INDEX IF NOT EXISTS idx_request_logs_created_at ON request_logs(created_at);
+	CREATE INDEX IF NOT EXISTS idx_request_logs_success ON request_logs(success);
+	`)
+	return err
+}
+
+// addRouteColumns 路由的格式、负载均衡、故障转移、超时、出站代理和限流配置
+func addRouteColumns(tx *sql.Tx) error {
+	return addColumns(tx, "model_routes",
+		`format TEXT DEFAULT 'openai'`,
+		`weight INTEGER DEFAULT 1`,
+		`upstream_model TEXT DEFAULT ''`,
+		`priority INTEGER DEFAULT 0`,
+		`extra_headers TEXT DEFAULT ''`,
+		`extra_body TEXT DEFAULT ''`,
+		`connect_timeout INTEGER DEFAULT 0`,
+		`first_byte_timeout INTEGER DEFAULT 0`,
+		`idle_timeout INTEGER DEFAULT 0`,
+		`outbound_proxy TEXT DEFAULT ''`,
+		`rpm_limit INTEGER DEFAULT 0`,
+		`tpm_limit INTEGER DEFAULT 0`,
+	)
+}
+
+// addRequestLogColumns 请求日志的故障转移层级、延迟、规则名和错误类型
+func addRequestLogColumns(tx *sql.Tx) error {
+	return addColumns(tx, "request_logs",
+		`tier INTEGER DEFAULT 0`,
+		`latency_ms INTEGER DEFAULT 0`,
+		`ttft_ms INTEGER DEFAULT 0`,
+		`rule_name TEXT DEFAULT ''`,
+		`error_type TEXT DEFAULT ''`,
+	)
+}
+
+// createRouteHealth 健康检查历史表
+func createRouteHealth(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	CREATE TABLE IF NOT EXISTS route_health (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		route_id INTEGER NOT NULL,
+		status TEXT NOT NULL,
+		latency_ms INTEGER DEFAULT 0,
+		error_message TEXT,
+		checked_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (route_id) REFERENCES model_routes(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_route_health_route_id ON route_health(route_id, checked_at);
+	CREATE INDEX IF NOT EXISTS idx_route_health_checked_at ON route_health(checked_at);
+	`)
+	return err
+}
+
+// createRouteKeys 路由附加 API Key 表
+func createRouteKeys(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	CREATE TABLE IF NOT EXISTS route_keys (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		route_id INTEGER NOT NULL,
+		name TEXT DEFAULT '',
+		api_key TEXT NOT NULL,
+		enabled INTEGER DEFAULT 1,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (route_id) REFERENCES model_routes(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_route_keys_route_id ON route_keys(route_id);
+	`)
+	return err
+}
+
+// createProviders 供应商表，以及路由上记录创建它的供应商的列
+func createProviders(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	CREATE TABLE IF NOT EXISTS providers (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		api_url TEXT NOT NULL,
+		api_key TEXT DEFAULT '',
+		format TEXT DEFAULT 'openai',
+		"group" TEXT DEFAULT '',
+		include_patterns TEXT DEFAULT '',
+		exclude_patterns TEXT DEFAULT '',
+		outbound_proxy TEXT DEFAULT '',
+		sync_interval INTEGER DEFAULT 0,
+		models TEXT DEFAULT '',
+		last_sync_at DATETIME,
+		last_sync_error TEXT DEFAULT '',
+		enabled INTEGER DEFAULT 1,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	`)
+	if err != nil {
+		return err
+	}
+	return addColumns(tx, "model_routes", `provider_id INTEGER DEFAULT 0`)
+}
+
+// addRouteCapabilities 路由的模型能力元数据
+func addRouteCapabilities(tx *sql.Tx) error {
+	return addColumns(tx, "model_routes", `capabilities TEXT DEFAULT ''`)
+}
@@ -0,0 +1,211 @@
+package database
+
+import (
+	"bytes"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestCipher(t *testing.T) *KeyCipher {
+	t.Helper()
+	keys, err := NewKeyCipher(bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func appliedVersions(t *testing.T, db *sql.DB) []int {
+	t.Helper()
+	rows, err := db.Query(`SELECT version FROM schema_migrations ORDER BY version`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var versions []int
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			t.Fatal(err)
+		}
+		versions = append(versions, version)
+	}
+	return versions
+}
+
+func TestSchemaMigrationsAreOrdered(t *testing.T) {
+	migrations := schemaMigrations(nil)
+	names := make(map[string]bool)
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Fatalf("migration %d (%s) has version %d; versions must start at 1 and have no gaps", i, m.Name, m.Version)
+		}
+		if m.Name == "" || names[m.Name] {
+			t.Fatalf("migration %d has an empty or duplicate name %q", m.Version, m.Name)
+		}
+		names[m.Name] = true
+		if m.Up == nil {
+			t.Fatalf("migration %d (%s) has no Up", m.Version, m.Name)
+		}
+	}
+	if latest := LatestSchemaVersion(); latest != migrations[len(migrations)-1].Version {
+		t.Fatalf("LatestSchemaVersion() = %d, want %d", latest, migrations[len(migrations)-1].Version)
+	}
+}
+
+func TestInitDBAppliesMigrationsInOrder(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "routes.db")
+	db, err := InitDB(dbPath, newTestCipher(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	versions := appliedVersions(t, db)
+	if len(versions) != LatestSchemaVersion() {
+		t.Fatalf("applied %d migrations, want %d", len(versions), LatestSchemaVersion())
+	}
+	for i, version := range versions {
+		if version != i+1 {
+			t.Fatalf("applied versions = %v, want 1..%d", versions, LatestSchemaVersion())
+		}
+	}
+
+	// 新建的数据库没有数据，不应该产生备份
+	if backups, _ := filepath.Glob(dbPath + ".v*.bak"); len(backups) != 0 {
+		t.Fatalf("unexpected backups for a new database: %v", backups)
+	}
+}
+
+func TestInitDBIsIdempotent(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "routes.db")
+	keys := newTestCipher(t)
+	for i := 0; i < 2; i++ {
+		db, err := InitDB(dbPath, keys)
+		if err != nil {
+			t.Fatalf("open #%d: %v", i+1, err)
+		}
+		versions := appliedVersions(t, db)
+		db.Close()
+		if len(versions) != LatestSchemaVersion() {
+			t.Fatalf("open #%d: applied %d migrations, want %d", i+1, len(versions), LatestSchemaVersion())
+		}
+	}
+}
+
+func TestMigrationsCanRunTwice(t *testing.T) {
+	// 旧版本程序创建的数据库没有迁移记录，会从第一个迁移开始重新执行，因此每个迁移都必须能在已迁移的结构上再执行一次
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "routes.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for round := 1; round <= 2; round++ {
+		for _, m := range schemaMigrations(newTestCipher(t)) {
+			tx, err := db.Begin()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := m.Up(tx); err != nil {
+				tx.Rollback()
+				t.Fatalf("round %d: migration %d (%s): %v", round, m.Version, m.Name, err)
+			}
+			if err := tx.Commit(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestInitDBRejectsNewerSchema(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "routes.db")
+	keys := newTestCipher(t)
+	db, err := InitDB(dbPath, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO schema_migrations (version, name) VALUES (?, 'from_the_future')`, LatestSchemaVersion()+1); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	db, err = InitDB(dbPath, keys)
+	if err == nil {
+		db.Close()
+		t.Fatal("expected an error for a database with a newer schema version")
+	}
+	if !strings.Contains(err.Error(), "please upgrade the application") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestLegacyDatabaseIsMigratedAndBackupScrubbed(t *testing.T) {
+	// 模拟旧版本程序创建的数据库：只有 model_routes 表，没有迁移记录，Key 为明文
+	dbPath := filepath.Join(t.TempDir(), "routes.db")
+	const plainKey = "sk-legacy-plaintext-key-0123456789"
+	legacy, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := legacy.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := createCoreTables(tx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec(`INSERT INTO model_routes (name, model, api_url, api_key) VALUES ('legacy', 'gpt-4o', 'https://api.example.com', ?)`, plainKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	legacy.Close()
+
+	keys := newTestCipher(t)
+	db, err := InitDB(dbPath, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored string
+	if err := db.QueryRow(`SELECT api_key FROM model_routes WHERE name = 'legacy'`).Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	if !IsEncryptedKey(stored) {
+		t.Fatalf("api key was not encrypted by the migration: %q", stored)
+	}
+	if plain, err := keys.Decrypt(stored); err != nil || plain != plainKey {
+		t.Fatalf("Decrypt() = %q, %v; want the original key", plain, err)
+	}
+
+	backups, err := filepath.Glob(dbPath + ".v7-*.bak")
+	if err != nil || len(backups) != 1 {
+		t.Fatalf("expected one backup before migration 7, got %v (%v)", backups, err)
+	}
+	for _, path := range []string{dbPath, backups[0]} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(data, []byte(plainKey)) {
+			t.Fatalf("%s still contains the plaintext key", filepath.Base(path))
+		}
+	}
+
+	backup, err := sql.Open("sqlite", backups[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backup.Close()
+	if err := backup.QueryRow(`SELECT api_key FROM model_routes WHERE name = 'legacy'`).Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if plain, err := keys.Decrypt(stored); err != nil || plain != plainKey {
+		t.Fatalf("backup key Decrypt() = %q, %v; want the original key", plain, err)
+	}
+}
@@ -3,7 +3,10 @@ package router
 import (
 	"encoding/json"
 	"io"
+	"mime"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"openai-router-go/internal/config"
@@ -94,8 +97,8 @@ func SetupAPIRouter(cfg *config.Config, routeService *service.RouteService, prox
 			var models []string
 			var err error
 
-			if cfg.RedirectEnabled && cfg.RedirectKeyword != "" {
-				models, err = routeService.GetAvailableModelsWithRedirect(cfg.RedirectKeyword)
+			if keywords := proxyService.GetRedirectKeywords(); len(keywords) > 0 {
+				models, err = routeService.GetAvailableModelsWithRedirect(keywords...)
 			} else {
 				models, err = routeService.GetAvailableModels()
 			}
@@ -110,6 +113,12 @@ func SetupAPIRouter(cfg *config.Config, routeService *service.RouteService, prox
 				return
 			}
 
+			// 附带路由配置的模型能力元数据（上下文窗口、最大输出、是否支持图片/工具等），读取失败时不影响模型列表
+			capabilities, err := routeService.GetModelCapabilities()
+			if err != nil {
+				log.Warnf("Failed to load model capabilities: %v", err)
+			}
+
 			modelsData := make([]gin.H, len(models))
 			for i, model := range models {
 				modelsData[i] = gin.H{
@@ -118,6 +127,9 @@ func SetupAPIRouter(cfg *config.Config, routeService *service.RouteService, prox
 					"created":  1677610602,
 					"owned_by": "openai-router",
 				}
+				if caps := capabilities[model]; caps != nil {
+					modelsData[i]["capabilities"] = caps
+				}
 			}
 
 			c.JSON(http.StatusOK, gin.H{
@@ -175,7 +187,7 @@ func SetupAPIRouter(cfg *config.Config, routeService *service.RouteService, prox
 
 						// 使用 Anthropic 专用流式处理（智能检测目标格式）
 						// 请求来自 Claude 格式，根据路由配置的 format 决定是否转换
-						err := proxyService.ProxyAnthropicStreamRequest(body, headers, c.Writer, flusher)
+						err := proxyService.ProxyAnthropicStreamRequest(c.Request.Context(), body, headers, c.Writer, flusher)
 						if err != nil {
 							log.Errorf("Stream proxy error: %v", err)
 						}
@@ -184,7 +196,7 @@ func SetupAPIRouter(cfg *config.Config, routeService *service.RouteService, prox
 				}
 
 				// 非流式请求 - 对 Anthropic 路径，不转换响应
-				respBody, statusCode, err := proxyService.ProxyAnthropicRequest(body, headers)
+				respBody, statusCode, err := proxyService.ProxyAnthropicRequest(c.Request.Context(), body, headers)
 				if err != nil {
 					c.JSON(statusCode, gin.H{
 						"error": gin.H{
@@ -249,7 +261,7 @@ func SetupAPIRouter(cfg *config.Config, routeService *service.RouteService, prox
 
 						// 使用 Claude Code 专用流式处理
 						// 将 Claude Code 格式转换为 OpenAI 格式，响应转换回 Claude 格式
-						err := proxyService.ProxyClaudeCodeStreamRequest(body, headers, c.Writer, flusher)
+						err := proxyService.ProxyClaudeCodeStreamRequest(c.Request.Context(), body, headers, c.Writer, flusher)
 						if err != nil {
 							log.Errorf("Claude Code stream proxy error: %v", err)
 						}
@@ -258,7 +270,7 @@ func SetupAPIRouter(cfg *config.Config, routeService *service.RouteService, prox
 				}
 
 				// 非流式请求
-				respBody, statusCode, err := proxyService.ProxyClaudeCodeRequest(body, headers)
+				respBody, statusCode, err := proxyService.ProxyClaudeCodeRequest(c.Request.Context(), body, headers)
 				if err != nil {
 					c.JSON(statusCode, gin.H{
 						"error": gin.H{
@@ -321,7 +333,7 @@ func SetupAPIRouter(cfg *config.Config, routeService *service.RouteService, prox
 							return
 						}
 
-						err := proxyService.ProxyStreamRequest(body, headers, c.Writer, flusher)
+						err := proxyService.ProxyStreamRequest(c.Request.Context(), body, headers, c.Writer, flusher)
 						if err != nil {
 							log.Errorf("Stream proxy error: %v", err)
 						}
@@ -330,7 +342,7 @@ func SetupAPIRouter(cfg *config.Config, routeService *service.RouteService, prox
 				}
 
 				// 非流式请求
-				respBody, statusCode, err := proxyService.ProxyRequest(body, headers)
+				respBody, statusCode, err := proxyService.ProxyRequest(c.Request.Context(), body, headers)
 				if err != nil {
 					c.JSON(statusCode, gin.H{
 						"error": gin.H{
@@ -395,7 +407,7 @@ func SetupAPIRouter(cfg *config.Config, routeService *service.RouteService, prox
 						return
 					}
 
-					err := proxyService.ProxyStreamRequest(body, headers, c.Writer, flusher)
+					err := proxyService.ProxyStreamRequest(c.Request.Context(), body, headers, c.Writer, flusher)
 					if err != nil {
 						log.Errorf("Stream proxy error: %v", err)
 					}
@@ -403,7 +415,7 @@ func SetupAPIRouter(cfg *config.Config, routeService *service.RouteService, prox
 				}
 
 				// 非流式请求
-				respBody, statusCode, err := proxyService.ProxyRequest(body, headers)
+				respBody, statusCode, err := proxyService.ProxyRequest(c.Request.Context(), body, headers)
 				if err != nil {
 					c.JSON(statusCode, gin.H{
 						"error": gin.H{
@@ -467,7 +479,7 @@ func SetupAPIRouter(cfg *config.Config, routeService *service.RouteService, prox
 						return
 					}
 
-					err := proxyService.ProxyStreamRequest(body, headers, c.Writer, flusher)
+					err := proxyService.ProxyStreamRequest(c.Request.Context(), body, headers, c.Writer, flusher)
 					if err != nil {
 						log.Errorf("Stream proxy error: %v", err)
 					}
@@ -475,7 +487,7 @@ func SetupAPIRouter(cfg *config.Config, routeService *service.RouteService, prox
 				}
 
 				// 非流式请求
-				respBody, statusCode, err := proxyService.ProxyRequest(body, headers)
+				respBody, statusCode, err := proxyService.ProxyRequest(c.Request.Context(), body, headers)
 				if err != nil {
 					c.JSON(statusCode, gin.H{
 						"error": gin.H{
@@ -499,8 +511,8 @@ func SetupAPIRouter(cfg *config.Config, routeService *service.RouteService, prox
 				var models []string
 				var err error
 
-				if cfg.RedirectEnabled && cfg.RedirectKeyword != "" {
-					models, err = routeService.GetAvailableModelsWithRedirect(cfg.RedirectKeyword)
+				if keywords := proxyService.GetRedirectKeywords(); len(keywords) > 0 {
+					models, err = routeService.GetAvailableModelsWithRedirect(keywords...)
 				} else {
 					models, err = routeService.GetAvailableModels()
 				}
@@ -515,6 +527,12 @@ func SetupAPIRouter(cfg *config.Config, routeService *service.RouteService, prox
 					return
 				}
 
+				// 附带路由配置的模型能力元数据（上下文窗口、最大输出、是否支持图片/工具等），读取失败时不影响模型列表
+				capabilities, err := routeService.GetModelCapabilities()
+				if err != nil {
+					log.Warnf("Failed to load model capabilities: %v", err)
+				}
+
 				modelsData := make([]gin.H, len(models))
 				for i, model := range models {
 					modelsData[i] = gin.H{
@@ -523,6 +541,9 @@ func SetupAPIRouter(cfg *config.Config, routeService *service.RouteService, prox
 						"created":  1677610602,
 						"owned_by": "openai-router",
 					}
+					if caps := capabilities[model]; caps != nil {
+						modelsData[i]["capabilities"] = caps
+					}
 				}
 
 				c.JSON(http.StatusOK, gin.H{
@@ -575,7 +596,7 @@ func SetupAPIRouter(cfg *config.Config, routeService *service.RouteService, prox
 							return
 						}
 
-						err := proxyService.ProxyStreamRequest(body, headers, c.Writer, flusher)
+						err := proxyService.ProxyStreamRequest(c.Request.Context(), body, headers, c.Writer, flusher)
 						if err != nil {
 							log.Errorf("Stream proxy error: %v", err)
 						}
@@ -584,7 +605,7 @@ func SetupAPIRouter(cfg *config.Config, routeService *service.RouteService, prox
 				}
 
 				// 非流式请求
-				respBody, statusCode, err := proxyService.ProxyRequest(body, headers)
+				respBody, statusCode, err := proxyService.ProxyRequest(c.Request.Context(), body, headers)
 				if err != nil {
 					c.JSON(statusCode, gin.H{
 						"error": gin.H{
@@ -693,7 +714,7 @@ func SetupAPIRouter(cfg *config.Config, routeService *service.RouteService, prox
 						}
 
 						// 使用 Gemini 专用流式处理
-						err := proxyService.ProxyGeminiStreamRequest(body, headers, c.Writer, flusher)
+						err := proxyService.ProxyGeminiStreamRequest(c.Request.Context(), body, headers, c.Writer, flusher)
 						if err != nil {
 							log.Errorf("Gemini stream proxy error: %v", err)
 						}
@@ -701,7 +722,7 @@ func SetupAPIRouter(cfg *config.Config, routeService *service.RouteService, prox
 					}
 
 					// 非流式请求
-					respBody, statusCode, err := proxyService.ProxyGeminiRequest(body, headers)
+					respBody, statusCode, err := proxyService.ProxyGeminiRequest(c.Request.Context(), body, headers)
 					if err != nil {
 						c.JSON(statusCode, gin.H{
 							"error": gin.H{
@@ -836,6 +857,134 @@ func SetupAPIRouter(cfg *config.Config, routeService *service.RouteService, prox
 		})
 	})
 
+	// 管理接口：路由导出 / 导入 / 测试
+	// local_api_key 会分发给所有客户端，不能作为管理凭据，管理接口只接受本机连接（按 TCP 对端地址判断，不信任转发头）
+	adminLocalOnly := func(c *gin.Context) {
+		if ip := net.ParseIP(c.RemoteIP()); ip == nil || !ip.IsLoopback() {
+			log.Warnf("Rejected admin request from %s, path: %s", c.RemoteIP(), c.Request.URL.Path)
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": gin.H{
+					"message": "Admin endpoints are only available from localhost",
+					"type":    "permission_error",
+				},
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+
+	// 未配置 local_api_key 时本机任意网页都能向管理接口发送跨站请求，修改类请求要求非简单的 Content-Type（如 application/json）
+	// 浏览器发送这样的跨站请求前需要 CORS 预检，而这里不响应预检，因此网页无法伪造
+	adminRejectSimpleRequests := func(c *gin.Context) {
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead || cfg.LocalAPIKey != "" {
+			c.Next()
+			return
+		}
+		if isSimpleContentType(c.GetHeader("Content-Type")) {
+			log.Warnf("Rejected admin request without a JSON or YAML content type from %s, path: %s", c.RemoteIP(), c.Request.URL.Path)
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{
+				"error": gin.H{
+					"message": "Admin requests must set Content-Type to application/json or application/yaml",
+					"type":    "invalid_request_error",
+				},
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+
+	admin := api.Group("/admin")
+	admin.Use(adminLocalOnly, adminRejectSimpleRequests)
+	{
+		// 导出全部路由（不含 API Key），?format=json|yaml；包含 Key 的导出只能在应用界面中进行
+		admin.GET("/routes/export", func(c *gin.Context) {
+			if c.Query("include_keys") == "true" {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": gin.H{
+						"message": "include_keys is not available over HTTP; export with keys from the app instead",
+						"type":    "invalid_request_error",
+					},
+				})
+				return
+			}
+			format := strings.ToLower(c.DefaultQuery("format", "json"))
+			data, err := proxyService.ExportRoutes(format, false)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": gin.H{
+						"message": err.Error(),
+						"type":    "invalid_request_error",
+					},
+				})
+				return
+			}
+
+			contentType, ext := "application/json", "json"
+			if format == "yaml" || format == "yml" {
+				contentType, ext = "application/yaml", "yaml"
+			}
+			c.Header("Content-Disposition", "attachment; filename=routes."+ext)
+			c.Data(http.StatusOK, contentType, data)
+		})
+
+		// 导入路由，请求体为导出的 JSON 或 YAML 文件
+		// ?mode=merge|replace（默认 merge），?dry_run=true 时只返回将要执行的变更；不接受 file: / cmd: 引用的 Key
+		admin.POST("/routes/import", func(c *gin.Context) {
+			body, err := io.ReadAll(c.Request.Body)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": gin.H{
+						"message": "Failed to read request body",
+						"type":    "invalid_request_error",
+					},
+				})
+				return
+			}
+
+			result, err := proxyService.ImportRoutes(body, c.DefaultQuery("mode", service.RouteImportMerge), c.Query("dry_run") == "true", false)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": gin.H{
+						"message": err.Error(),
+						"type":    "invalid_request_error",
+					},
+				})
+				return
+			}
+
+			c.JSON(http.StatusOK, result)
+		})
+
+		// 测试路由：以 OpenAI、Claude、Claude Code 和 Gemini 协议分别发送非流式、流式和工具调用请求
+		admin.POST("/routes/:id/test", func(c *gin.Context) {
+			id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": gin.H{
+						"message": "Invalid route id",
+						"type":    "invalid_request_error",
+					},
+				})
+				return
+			}
+
+			result, err := proxyService.TestRoute(id)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": gin.H{
+						"message": err.Error(),
+						"type":    "invalid_request_error",
+					},
+				})
+				return
+			}
+
+			c.JSON(http.StatusOK, result)
+		})
+	}
+
 	// Gemini 流式生成接口 (支持 streamGenerateContent)
 	// 这个接口已经通过适配器逻辑处理，不需要单独的路由
 
@@ -848,3 +997,20 @@ func SetupAPIRouter(cfg *config.Config, routeService *service.RouteService, prox
 
 	return r
 }
+
+// isSimpleContentType 判断 Content-Type 是否为浏览器无需 CORS 预检即可跨站发送的类型（包括未设置）
+func isSimpleContentType(contentType string) bool {
+	if strings.TrimSpace(contentType) == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		// 无法解析时按浏览器可能发送的最宽松情况处理
+		return true
+	}
+	switch mediaType {
+	case "text/plain", "application/x-www-form-urlencoded", "multipart/form-data":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,239 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"openai-router-go/internal/config"
+	"openai-router-go/internal/database"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// SessionAffinityHeader 客户端显式指定会话标识的请求头，同一会话的请求优先发往同一条路由
+const SessionAffinityHeader = "X-Session-ID"
+
+// DefaultStickySessionTTL 会话与路由绑定的默认有效期，配置值非法时使用
+const DefaultStickySessionTTL = 30 * time.Minute
+
+// affinityEntry 会话绑定的路由及过期时间
+type affinityEntry struct {
+	routeID int64
+	expires time.Time
+}
+
+// AffinityCache 会话到路由的绑定缓存，只保存在内存中
+// 每次命中都会重新计算过期时间，持续进行的会话不会中途换路由
+type AffinityCache struct {
+	mu      sync.Mutex
+	entries map[string]affinityEntry
+	sweepAt int // 条目数达到该值时清理一次过期条目
+}
+
+// NewAffinityCache 创建会话绑定缓存
+func NewAffinityCache() *AffinityCache {
+	return &AffinityCache{entries: make(map[string]affinityEntry), sweepAt: 1024}
+}
+
+// Get 获取会话绑定的路由，未绑定或已过期时返回 false
+func (c *AffinityCache) Get(key string, ttl time.Duration) (int64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return 0, false
+	}
+	now := time.Now()
+	if now.After(entry.expires) {
+		delete(c.entries, key)
+		return 0, false
+	}
+	entry.expires = now.Add(ttl)
+	c.entries[key] = entry
+	return entry.routeID, true
+}
+
+// Set 将会话绑定到路由
+func (c *AffinityCache) Set(key string, routeID int64, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	c.entries[key] = affinityEntry{routeID: routeID, expires: now.Add(ttl)}
+	if len(c.entries) >= c.sweepAt {
+		for k, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+		c.sweepAt = 2 * len(c.entries)
+		if c.sweepAt < 1024 {
+			c.sweepAt = 1024
+		}
+	}
+}
+
+// Forget 解除所有绑定到该路由的会话
+func (c *AffinityCache) Forget(routeID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, entry := range c.entries {
+		if entry.routeID == routeID {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// Clear 清除所有会话绑定
+func (c *AffinityCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]affinityEntry)
+}
+
+// Len 当前未过期的会话绑定数量
+func (c *AffinityCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	count := 0
+	for _, entry := range c.entries {
+		if !now.After(entry.expires) {
+			count++
+		}
+	}
+	return count
+}
+
+// firstUserMessage 提取第一条用户消息的文本（兼容 OpenAI / Claude 的 messages 和 Gemini 的 contents）
+func firstUserMessage(reqData map[string]interface{}) string {
+	for _, field := range []string{"messages", "contents"} {
+		list, ok := reqData[field].([]interface{})
+		if !ok {
+			continue
+		}
+		for _, item := range list {
+			msg, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			// Gemini 的 contents 可以省略 role
+			if role, _ := msg["role"].(string); role != "user" && role != "" {
+				continue
+			}
+			if content, ok := msg["content"]; ok {
+				return strings.Join(collectText(content), "\n")
+			}
+			return strings.Join(collectText(msg["parts"]), "\n")
+		}
+	}
+	return ""
+}
+
+// metadataUserID 读取 Claude 请求的 metadata.user_id（Claude Code 会在其中带上会话 ID）
+func metadataUserID(reqData map[string]interface{}) string {
+	metadata, ok := reqData["metadata"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	userID, _ := metadata["user_id"].(string)
+	return strings.TrimSpace(userID)
+}
+
+// sessionKey 计算请求的会话标识，优先级：X-Session-ID 请求头 > metadata.user_id > 系统提示词加第一条用户消息的哈希
+// 模型名也参与计算，同一会话请求不同模型时分别绑定；无法识别会话时返回空
+func sessionKey(model string, reqData map[string]interface{}, headers map[string]string) string {
+	var source string
+	if id := strings.TrimSpace(headerValue(headers, SessionAffinityHeader)); id != "" {
+		source = "header:" + id
+	} else if userID := metadataUserID(reqData); userID != "" {
+		source = "user:" + userID
+	} else {
+		system, first := extractSystemPrompt(reqData), firstUserMessage(reqData)
+		if system == "" && first == "" {
+			return ""
+		}
+		source = "prompt:" + system + "\x00" + first
+	}
+
+	sum := sha256.Sum256([]byte(model + "\x00" + source))
+	return hex.EncodeToString(sum[:16])
+}
+
+// stickySessionTTL 会话与路由绑定的有效期
+func (s *ProxyService) stickySessionTTL() time.Duration {
+	if s.config.StickySessionTTLSeconds > 0 {
+		return time.Duration(s.config.StickySessionTTLSeconds) * time.Second
+	}
+	return DefaultStickySessionTTL
+}
+
+// resolveAffinity 计算请求的会话标识并记录到 trace，未开启会话保持时或路由测试请求不记录
+func (s *ProxyService) resolveAffinity(trace *requestTrace, model string, reqData map[string]interface{}, headers map[string]string) {
+	if s.config.StickySessionEnabled && trace.test == nil {
+		trace.affinity = sessionKey(model, reqData, headers)
+	}
+}
+
+// stickyRoute 从候选路由中找出会话绑定的路由
+// 只有绑定的路由仍在候选中（未熔断、健康、未在本次请求中失败）且属于最高优先级层时才使用，否则返回 nil 按负载均衡重新选择
+func (s *ProxyService) stickyRoute(trace *requestTrace, tier []database.ModelRoute) *database.ModelRoute {
+	if trace == nil || trace.affinity == "" {
+		return nil
+	}
+	routeID, ok := s.affinity.Get(trace.affinity, s.stickySessionTTL())
+	if !ok {
+		return nil
+	}
+	for i := range tier {
+		if tier[i].ID == routeID {
+			return &tier[i]
+		}
+	}
+	return nil
+}
+
+// rememberAffinity 请求成功后将会话绑定到最终使用的路由
+func (s *ProxyService) rememberAffinity(trace *requestTrace, route *database.ModelRoute) {
+	if trace == nil || trace.affinity == "" {
+		return
+	}
+	s.affinity.Set(trace.affinity, route.ID, s.stickySessionTTL())
+}
+
+// SetStickySessionConfig 更新会话保持配置并保存，关闭时清除已有的绑定
+func (s *ProxyService) SetStickySessionConfig(enabled bool, ttlSeconds int) error {
+	if ttlSeconds <= 0 {
+		return fmt.Errorf("invalid sticky session ttl: %d", ttlSeconds)
+	}
+
+	err := s.UpdateConfig(func(cfg *config.Config) {
+		cfg.StickySessionEnabled = enabled
+		cfg.StickySessionTTLSeconds = ttlSeconds
+	})
+	if !enabled {
+		s.affinity.Clear()
+	}
+	log.Infof("[Affinity] Sticky sessions enabled: %v, ttl: %ds", enabled, ttlSeconds)
+	return err
+}
+
+// GetStickySessionCount 获取当前有效的会话绑定数量
+func (s *ProxyService) GetStickySessionCount() int {
+	return s.affinity.Len()
+}
+
+// ClearStickySessions 清除所有会话绑定
+func (s *ProxyService) ClearStickySessions() {
+	s.affinity.Clear()
+}
+
+// ForgetRouteAffinity 解除绑定到该路由的会话
+func (s *ProxyService) ForgetRouteAffinity(routeID int64) {
+	s.affinity.Forget(routeID)
+}
@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"openai-router-go/internal/database"
+)
+
+// expireAffinity 把会话绑定的过期时间往前拨，模拟有效期已过
+func expireAffinity(c *AffinityCache, key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := c.entries[key]
+	entry.expires = time.Now().Add(-time.Second)
+	c.entries[key] = entry
+}
+
+func TestAffinityCacheTTL(t *testing.T) {
+	c := NewAffinityCache()
+	if _, ok := c.Get("session", time.Minute); ok {
+		t.Fatal("unknown session should not be bound")
+	}
+
+	c.Set("session", 7, time.Minute)
+	if routeID, ok := c.Get("session", time.Minute); !ok || routeID != 7 {
+		t.Fatalf("Get() = %d, %v; want 7", routeID, ok)
+	}
+
+	expireAffinity(c, "session")
+	if c.Len() != 0 {
+		t.Fatalf("Len() = %d, want expired bindings not counted", c.Len())
+	}
+	if _, ok := c.Get("session", time.Minute); ok {
+		t.Fatal("expired binding should not be returned")
+	}
+	if _, ok := c.entries["session"]; ok {
+		t.Fatal("expired binding should be removed on lookup")
+	}
+}
+
+func TestAffinityCacheGetExtendsTTL(t *testing.T) {
+	c := NewAffinityCache()
+	c.Set("session", 7, time.Second)
+	// 命中后按新的有效期重新计时
+	if _, ok := c.Get("session", time.Hour); !ok {
+		t.Fatal("binding should still be valid")
+	}
+	if expires := c.entries["session"].expires; time.Until(expires) < 59*time.Minute {
+		t.Fatalf("binding expires in %v, want the TTL to restart on a hit", time.Until(expires))
+	}
+}
+
+func TestAffinityCacheSweep(t *testing.T) {
+	c := NewAffinityCache()
+	c.sweepAt = 3
+	c.Set("a", 1, time.Minute)
+	c.Set("b", 1, time.Minute)
+	expireAffinity(c, "a")
+	expireAffinity(c, "b")
+
+	c.Set("c", 2, time.Minute)
+	if len(c.entries) != 1 || c.sweepAt != 1024 {
+		t.Fatalf("entries = %d, sweepAt = %d; want expired entries swept and the threshold reset", len(c.entries), c.sweepAt)
+	}
+}
+
+func TestAffinityCacheForget(t *testing.T) {
+	c := NewAffinityCache()
+	c.Set("a", 1, time.Minute)
+	c.Set("b", 1, time.Minute)
+	c.Set("c", 2, time.Minute)
+
+	c.Forget(1)
+	if c.Len() != 1 {
+		t.Fatalf("Len() after Forget = %d, want 1", c.Len())
+	}
+	c.Clear()
+	if c.Len() != 0 {
+		t.Fatalf("Len() after Clear = %d, want 0", c.Len())
+	}
+}
+
+func TestSessionKey(t *testing.T) {
+	prompt := func(system, user string) map[string]interface{} {
+		return map[string]interface{}{"messages": []interface{}{
+			map[string]interface{}{"role": "system", "content": system},
+			map[string]interface{}{"role": "user", "content": user},
+			map[string]interface{}{"role": "assistant", "content": "reply"},
+		}}
+	}
+	header := map[string]string{"x-session-id": "abc"}
+	withUser := map[string]interface{}{"metadata": map[string]interface{}{"user_id": "user_1_session_2"}}
+
+	tests := []struct {
+		name     string
+		a, b     map[string]interface{}
+		ha, hb   map[string]string
+		modelA   string
+		modelB   string
+		wantSame bool
+	}{
+		{"same prompt", prompt("sys", "hi"), prompt("sys", "hi"), nil, nil, "gpt-4o", "gpt-4o", true},
+		{"different first message", prompt("sys", "hi"), prompt("sys", "hello"), nil, nil, "gpt-4o", "gpt-4o", false},
+		{"different model", prompt("sys", "hi"), prompt("sys", "hi"), nil, nil, "gpt-4o", "gpt-4.1", false},
+		{"header beats prompt", prompt("sys", "hi"), prompt("other", "hello"), header, header, "gpt-4o", "gpt-4o", true},
+		{"metadata user id beats prompt", withUser, withUser, nil, nil, "claude", "claude", true},
+	}
+	for _, tt := range tests {
+		a, b := sessionKey(tt.modelA, tt.a, tt.ha), sessionKey(tt.modelB, tt.b, tt.hb)
+		if a == "" || (a == b) != tt.wantSame {
+			t.Errorf("%s: keys %q and %q, want same = %v", tt.name, a, b, tt.wantSame)
+		}
+	}
+
+	gemini := map[string]interface{}{"contents": []interface{}{
+		map[string]interface{}{"parts": []interface{}{map[string]interface{}{"text": "hi"}}},
+	}}
+	if firstUserMessage(gemini) != "hi" {
+		t.Fatalf("firstUserMessage() for Gemini contents = %q, want %q", firstUserMessage(gemini), "hi")
+	}
+	if key := sessionKey("gpt-4o", map[string]interface{}{"messages": []interface{}{}}, nil); key != "" {
+		t.Fatalf("sessionKey() without a session source = %q, want empty", key)
+	}
+}
+
+func TestStickySessionRouting(t *testing.T) {
+	s := newTestProxyService(t)
+	s.config.StickySessionEnabled = true
+	s.config.StickySessionTTLSeconds = 60
+	server, _ := testUpstream(t, http.StatusOK)
+	a := addTestRoute(t, s.routeService, database.ModelRoute{Name: "a", Model: "gpt-4o", APIUrl: server.URL})
+	b := addTestRoute(t, s.routeService, database.ModelRoute{Name: "b", Model: "gpt-4o", APIUrl: server.URL})
+	headers := map[string]string{SessionAffinityHeader: "session-1"}
+
+	send := func() *database.ModelRoute {
+		t.Helper()
+		reqData := map[string]interface{}{"model": "gpt-4o"}
+		trace := s.traceRequest(context.Background(), headers)
+		route, model, err := s.resolveRequestRoute("gpt-4o", headers, reqData, false, trace)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, route, err := s.sendWithFailover(model, route, trace, testRequestBuilder)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return route
+	}
+
+	bound := send()
+	for i := 0; i < 20; i++ {
+		if route := send(); route.ID != bound.ID {
+			t.Fatalf("request %d went to route %d, want the bound route %d", i+2, route.ID, bound.ID)
+		}
+	}
+	if s.GetStickySessionCount() != 1 {
+		t.Fatalf("GetStickySessionCount() = %d, want 1", s.GetStickySessionCount())
+	}
+
+	// 绑定的路由不再可用时按负载均衡重新选择，成功后改绑到新路由
+	other := a
+	if bound.ID == a.ID {
+		other = b
+	}
+	if err := s.routeService.ToggleRoute(bound.ID, false); err != nil {
+		t.Fatal(err)
+	}
+	if route := send(); route.ID != other.ID {
+		t.Fatalf("request after the bound route was disabled went to %d, want %d", route.ID, other.ID)
+	}
+	if err := s.routeService.ToggleRoute(bound.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if route := send(); route.ID != other.ID {
+		t.Fatalf("session should stay on the new route %d, got %d", other.ID, route.ID)
+	}
+
+	// 关闭会话保持时清除已有的绑定
+	if err := s.SetStickySessionConfig(false, 60); err != nil {
+		t.Fatal(err)
+	}
+	if s.GetStickySessionCount() != 0 {
+		t.Fatal("disabling sticky sessions should clear the bindings")
+	}
+	trace := s.traceRequest(context.Background(), headers)
+	s.resolveAffinity(trace, "gpt-4o", map[string]interface{}{}, headers)
+	if trace.affinity != "" {
+		t.Fatal("no session key should be computed while sticky sessions are disabled")
+	}
+}
+
+func TestSetStickySessionConfig(t *testing.T) {
+	s := newTestProxyService(t)
+	if err := s.SetStickySessionConfig(true, 0); err == nil {
+		t.Fatal("non-positive ttl should be rejected")
+	}
+	if err := s.SetStickySessionConfig(true, 90); err != nil {
+		t.Fatal(err)
+	}
+	if s.stickySessionTTL() != 90*time.Second {
+		t.Fatalf("stickySessionTTL() = %v, want 90s", s.stickySessionTTL())
+	}
+	s.config.StickySessionTTLSeconds = 0
+	if s.stickySessionTTL() != DefaultStickySessionTTL {
+		t.Fatalf("stickySessionTTL() with an invalid value = %v, want the default", s.stickySessionTTL())
+	}
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"openai-router-go/internal/database"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrorTypeAPIKey 路由的 API Key 无法使用（如无法解密、密钥引用无法解析），请求未发出
+const ErrorTypeAPIKey = "api_key_error"
+
+// maskedKeyPlaceholder 无法显示首尾字符时的遮蔽值
+const maskedKeyPlaceholder = "********"
+
+// maskAPIKey 遮蔽 API Key，只保留开头 3 个和结尾 4 个字符，较短的 Key 全部遮蔽
+func maskAPIKey(plain string) string {
+	if plain == "" {
+		return ""
+	}
+	if len(plain) <= 12 {
+		return maskedKeyPlaceholder
+	}
+	return plain[:3] + maskedKeyPlaceholder + plain[len(plain)-4:]
+}
+
+// revealAPIKey 获取保存的 API Key 的明文（解密并解析密钥引用），只在发往上游的请求中使用
+func (s *ProxyService) revealAPIKey(stored string) (string, error) {
+	return revealStoredKey(s.keys, s.secrets, stored)
+}
+
+// revealStoredKey 解密保存的 API Key，是密钥引用时再解析为真正的 Key
+func revealStoredKey(keys *database.KeyCipher, secrets *SecretResolver, stored string) (string, error) {
+	value, err := keys.Decrypt(stored)
+	if err != nil {
+		return "", err
+	}
+	return secrets.Resolve(value)
+}
+
+// MaskAPIKey 获取保存的 API Key 的遮蔽值，用于在界面和接口中显示；无法解密时返回固定的遮蔽值
+// 密钥引用不是机密，原样显示
+func (s *ProxyService) MaskAPIKey(stored string) string {
+	plain, err := s.keys.Decrypt(stored)
+	if err != nil {
+		return maskedKeyPlaceholder
+	}
+	if database.IsSecretRef(plain) {
+		return plain
+	}
+	return maskAPIKey(plain)
+}
+
+// KeepMaskedAPIKey 界面提交的 Key 与已保存 Key 的遮蔽值相同时（用户没有修改），返回已保存的 Key
+func (s *ProxyService) KeepMaskedAPIKey(stored, submitted string) string {
+	if submitted != "" && stored != "" && submitted == s.MaskAPIKey(stored) {
+		return stored
+	}
+	return submitted
+}
+
+// ExportRoutes 导出全部路由，format 为 json 或 yaml；includeKeys 为 true 时导出解密后的主 Key 和附加 Key
+// 密钥引用不是机密，includeKeys 为 false 时也会导出，且不会解析为真正的 Key
+func (s *ProxyService) ExportRoutes(format string, includeKeys bool) ([]byte, error) {
+	file, err := s.routeService.routeExportFile(includeKeys)
+	if err != nil {
+		return nil, err
+	}
+	for i := range file.Routes {
+		record := &file.Routes[i]
+		if record.APIKey, err = s.exportedAPIKey(record.APIKey, includeKeys); err != nil {
+			return nil, fmt.Errorf("route %s (%s): %v", record.Name, record.Model, err)
+		}
+		for j := range record.Keys {
+			if record.Keys[j].APIKey, err = s.exportedAPIKey(record.Keys[j].APIKey, includeKeys); err != nil {
+				return nil, fmt.Errorf("route %s (%s): %v", record.Name, record.Model, err)
+			}
+			// 附加 Key 会整体替换，只要有一个不能导出就不导出附加 Key，导入时保留已有的
+			if record.Keys[j].APIKey == "" {
+				record.Keys = nil
+				break
+			}
+		}
+	}
+
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", "json":
+		return json.MarshalIndent(file, "", "  ")
+	case "yaml", "yml":
+		return yaml.Marshal(file)
+	}
+	return nil, fmt.Errorf("unsupported export format: %q (use json or yaml)", format)
+}
+
+// exportedAPIKey 导出文件中的 Key：includeKeys 为 false 时只保留密钥引用
+func (s *ProxyService) exportedAPIKey(stored string, includeKeys bool) (string, error) {
+	plain, err := s.keys.Decrypt(stored)
+	if err != nil {
+		if !includeKeys {
+			return "", nil
+		}
+		return "", err
+	}
+	if !includeKeys && !database.IsSecretRef(plain) {
+		return "", nil
+	}
+	return plain, nil
+}
+
+// FetchRouteRemoteModels 使用路由已保存的 API Key 获取远程模型列表，apiUrl / outboundProxy 为界面上当前填写的值
+func (s *ProxyService) FetchRouteRemoteModels(routeID int64, apiUrl, outboundProxy string) ([]string, error) {
+	route, err := s.routeService.GetRouteByIDIncludeDisabled(routeID)
+	if err != nil {
+		return nil, err
+	}
+	apiKey, err := s.revealAPIKey(route.APIKey)
+	if err != nil {
+		return nil, err
+	}
+	return s.FetchRemoteModels(apiUrl, apiKey, outboundProxy)
+}
+
+// keyRevealedRoute 返回 APIKey 已解密的路由副本，用于健康检查等后台请求
+func keyRevealedRoute(keys *database.KeyCipher, secrets *SecretResolver, route *database.ModelRoute) (*database.ModelRoute, error) {
+	apiKey, err := revealStoredKey(keys, secrets, route.APIKey)
+	if err != nil {
+		return nil, err
+	}
+	revealed := *route
+	revealed.APIKey = apiKey
+	return &revealed, nil
+}
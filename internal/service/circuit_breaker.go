@@ -0,0 +1,299 @@
+package service
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"openai-router-go/internal/config"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// 熔断器状态
+const (
+	BreakerClosed   = "closed"    // 正常放行
+	BreakerOpen     = "open"      // 熔断中，选路时跳过
+	BreakerHalfOpen = "half_open" // 冷却结束，放行一个探测请求
+)
+
+// 熔断器默认参数，配置值非法时使用
+const (
+	DefaultBreakerFailureThreshold = 5
+	DefaultBreakerErrorRate        = 0.5
+	DefaultBreakerMinRequests      = 20
+	DefaultBreakerWindow           = 60 * time.Second
+	DefaultBreakerCooldown         = 30 * time.Second
+)
+
+// BreakerStatus 路由熔断器状态快照
+type BreakerStatus struct {
+	RouteID             int64     `json:"route_id"`
+	State               string    `json:"state"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	WindowRequests      int       `json:"window_requests"`
+	WindowFailures      int       `json:"window_failures"`
+	OpenedAt            time.Time `json:"opened_at"`
+	RetryAt             time.Time `json:"retry_at"` // 熔断状态下允许探测的时间
+}
+
+// routeBreaker 单条路由的熔断状态
+type routeBreaker struct {
+	state               string
+	consecutiveFailures int
+	windowStart         time.Time
+	windowRequests      int
+	windowFailures      int
+	openedAt            time.Time
+	probing             bool      // 半开状态下是否已有探测请求在途
+	probeAt             time.Time // 探测请求发出时间，探测超过冷却时间仍无结果时允许重新探测
+}
+
+// CircuitBreaker 按路由维护熔断状态
+type CircuitBreaker struct {
+	mu       sync.Mutex
+	config   *config.Config
+	breakers map[int64]*routeBreaker
+}
+
+// NewCircuitBreaker 创建熔断器
+func NewCircuitBreaker(cfg *config.Config) *CircuitBreaker {
+	return &CircuitBreaker{
+		config:   cfg,
+		breakers: make(map[int64]*routeBreaker),
+	}
+}
+
+func (cb *CircuitBreaker) failureThreshold() int {
+	if cb.config.CircuitBreakerFailureThreshold > 0 {
+		return cb.config.CircuitBreakerFailureThreshold
+	}
+	return DefaultBreakerFailureThreshold
+}
+
+func (cb *CircuitBreaker) errorRate() float64 {
+	if cb.config.CircuitBreakerErrorRate > 0 && cb.config.CircuitBreakerErrorRate <= 1 {
+		return cb.config.CircuitBreakerErrorRate
+	}
+	return DefaultBreakerErrorRate
+}
+
+func (cb *CircuitBreaker) minRequests() int {
+	if cb.config.CircuitBreakerMinRequests > 0 {
+		return cb.config.CircuitBreakerMinRequests
+	}
+	return DefaultBreakerMinRequests
+}
+
+func (cb *CircuitBreaker) window() time.Duration {
+	if cb.config.CircuitBreakerWindowSeconds > 0 {
+		return time.Duration(cb.config.CircuitBreakerWindowSeconds) * time.Second
+	}
+	return DefaultBreakerWindow
+}
+
+func (cb *CircuitBreaker) cooldown() time.Duration {
+	if cb.config.CircuitBreakerCooldownSeconds > 0 {
+		return time.Duration(cb.config.CircuitBreakerCooldownSeconds) * time.Second
+	}
+	return DefaultBreakerCooldown
+}
+
+// get 获取路由的熔断状态，不存在时创建（调用方需持有锁）
+func (cb *CircuitBreaker) get(routeID int64) *routeBreaker {
+	b, ok := cb.breakers[routeID]
+	if !ok {
+		b = &routeBreaker{state: BreakerClosed, windowStart: time.Now()}
+		cb.breakers[routeID] = b
+	}
+	return b
+}
+
+// Available 判断路由当前是否可以参与选路，不改变状态
+func (cb *CircuitBreaker) Available(routeID int64) bool {
+	if !cb.config.CircuitBreakerEnabled {
+		return true
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	b, ok := cb.breakers[routeID]
+	if !ok {
+		return true
+	}
+	switch b.state {
+	case BreakerOpen:
+		return time.Since(b.openedAt) >= cb.cooldown()
+	case BreakerHalfOpen:
+		return !b.probing || time.Since(b.probeAt) >= cb.cooldown()
+	default:
+		return true
+	}
+}
+
+// Acquire 路由被选中后调用，冷却结束的熔断路由转为半开并占用唯一的探测名额
+// 返回 false 表示探测名额已被其他请求占用
+func (cb *CircuitBreaker) Acquire(routeID int64) bool {
+	if !cb.config.CircuitBreakerEnabled {
+		return true
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	b, ok := cb.breakers[routeID]
+	if !ok {
+		return true
+	}
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < cb.cooldown() {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+		b.probeAt = time.Now()
+		log.Infof("[CircuitBreaker] Route %d half-open, sending probe request", routeID)
+		return true
+	case BreakerHalfOpen:
+		if b.probing && time.Since(b.probeAt) < cb.cooldown() {
+			return false
+		}
+		b.probing = true
+		b.probeAt = time.Now()
+		return true
+	default:
+		return true
+	}
+}
+
+// RecordSuccess 记录一次成功请求，半开状态下探测成功则恢复闭合
+func (cb *CircuitBreaker) RecordSuccess(routeID int64) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	b := cb.get(routeID)
+	cb.rollWindow(b)
+	b.windowRequests++
+	b.consecutiveFailures = 0
+
+	if b.state != BreakerClosed {
+		log.Infof("[CircuitBreaker] Route %d recovered, breaker closed", routeID)
+		b.state = BreakerClosed
+		b.probing = false
+		b.windowStart = time.Now()
+		b.windowRequests = 0
+		b.windowFailures = 0
+	}
+}
+
+// RecordFailure 记录一次失败请求，达到阈值或半开探测失败时打开熔断
+func (cb *CircuitBreaker) RecordFailure(routeID int64) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	b := cb.get(routeID)
+	cb.rollWindow(b)
+	b.windowRequests++
+	b.windowFailures++
+	b.consecutiveFailures++
+
+	if !cb.config.CircuitBreakerEnabled {
+		return
+	}
+
+	switch b.state {
+	case BreakerHalfOpen:
+		cb.trip(routeID, b, "probe request failed")
+	case BreakerClosed:
+		if b.consecutiveFailures >= cb.failureThreshold() {
+			cb.trip(routeID, b, "too many consecutive failures")
+		} else if b.windowRequests >= cb.minRequests() &&
+			float64(b.windowFailures)/float64(b.windowRequests) >= cb.errorRate() {
+			cb.trip(routeID, b, "error rate exceeded")
+		}
+	}
+}
+
+// trip 打开熔断（调用方需持有锁）
+func (cb *CircuitBreaker) trip(routeID int64, b *routeBreaker, reason string) {
+	b.state = BreakerOpen
+	b.openedAt = time.Now()
+	b.probing = false
+	log.Warnf("[CircuitBreaker] Route %d opened: %s (consecutive failures: %d, window: %d/%d), retry after %v",
+		routeID, reason, b.consecutiveFailures, b.windowFailures, b.windowRequests, cb.cooldown())
+}
+
+// rollWindow 统计窗口过期时重新计数（调用方需持有锁）
+func (cb *CircuitBreaker) rollWindow(b *routeBreaker) {
+	if time.Since(b.windowStart) >= cb.window() {
+		b.windowStart = time.Now()
+		b.windowRequests = 0
+		b.windowFailures = 0
+	}
+}
+
+// Reset 手动将路由的熔断器恢复为闭合状态
+func (cb *CircuitBreaker) Reset(routeID int64) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	delete(cb.breakers, routeID)
+}
+
+// Status 获取单条路由的熔断状态
+func (cb *CircuitBreaker) Status(routeID int64) BreakerStatus {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	b, ok := cb.breakers[routeID]
+	if !ok {
+		return BreakerStatus{RouteID: routeID, State: BreakerClosed}
+	}
+	return cb.snapshot(routeID, b)
+}
+
+// Snapshot 获取所有有记录路由的熔断状态
+func (cb *CircuitBreaker) Snapshot() []BreakerStatus {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	result := make([]BreakerStatus, 0, len(cb.breakers))
+	for routeID, b := range cb.breakers {
+		result = append(result, cb.snapshot(routeID, b))
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].RouteID < result[j].RouteID })
+	return result
+}
+
+// snapshot 生成状态快照（调用方需持有锁）
+func (cb *CircuitBreaker) snapshot(routeID int64, b *routeBreaker) BreakerStatus {
+	status := BreakerStatus{
+		RouteID:             routeID,
+		State:               b.state,
+		ConsecutiveFailures: b.consecutiveFailures,
+		WindowRequests:      b.windowRequests,
+		WindowFailures:      b.windowFailures,
+	}
+	if b.state != BreakerClosed {
+		status.OpenedAt = b.openedAt
+		status.RetryAt = b.openedAt.Add(cb.cooldown())
+	}
+	return status
+}
+
+// GetCircuitBreakerStatus 获取所有路由的熔断器状态
+func (s *ProxyService) GetCircuitBreakerStatus() []BreakerStatus {
+	return s.breaker.Snapshot()
+}
+
+// GetRouteCircuitState 获取单条路由的熔断器状态
+func (s *ProxyService) GetRouteCircuitState(routeID int64) BreakerStatus {
+	return s.breaker.Status(routeID)
+}
+
+// ResetCircuitBreaker 手动重置路由的熔断器
+func (s *ProxyService) ResetCircuitBreaker(routeID int64) {
+	s.breaker.Reset(routeID)
+	log.Infof("[CircuitBreaker] Route %d reset", routeID)
+}
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"openai-router-go/internal/config"
+)
+
+func newTestBreaker() *CircuitBreaker {
+	return NewCircuitBreaker(&config.Config{
+		CircuitBreakerEnabled:          true,
+		CircuitBreakerFailureThreshold: 3,
+		CircuitBreakerErrorRate:        0.5,
+		CircuitBreakerMinRequests:      10,
+		CircuitBreakerWindowSeconds:    60,
+		CircuitBreakerCooldownSeconds:  30,
+	})
+}
+
+// expireCooldown 把熔断时间往前拨，模拟冷却时间已过
+func expireCooldown(cb *CircuitBreaker, routeID int64) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	b := cb.breakers[routeID]
+	b.openedAt = b.openedAt.Add(-cb.cooldown())
+	b.probeAt = b.probeAt.Add(-cb.cooldown())
+}
+
+func TestCircuitBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	cb := newTestBreaker()
+	for i := 0; i < 2; i++ {
+		cb.RecordFailure(1)
+	}
+	if state := cb.Status(1).State; state != BreakerClosed {
+		t.Fatalf("state after 2 failures = %s, want %s", state, BreakerClosed)
+	}
+
+	cb.RecordFailure(1)
+	if state := cb.Status(1).State; state != BreakerOpen {
+		t.Fatalf("state after 3 failures = %s, want %s", state, BreakerOpen)
+	}
+	if cb.Available(1) {
+		t.Fatal("open breaker should not be available during cooldown")
+	}
+	if cb.Acquire(1) {
+		t.Fatal("open breaker should not be acquired during cooldown")
+	}
+}
+
+func TestCircuitBreakerSuccessResetsConsecutiveFailures(t *testing.T) {
+	cb := newTestBreaker()
+	cb.RecordFailure(1)
+	cb.RecordFailure(1)
+	cb.RecordSuccess(1)
+	cb.RecordFailure(1)
+	cb.RecordFailure(1)
+
+	status := cb.Status(1)
+	if status.State != BreakerClosed {
+		t.Fatalf("state = %s, want %s", status.State, BreakerClosed)
+	}
+	if status.ConsecutiveFailures != 2 {
+		t.Fatalf("consecutive failures = %d, want 2", status.ConsecutiveFailures)
+	}
+}
+
+func TestCircuitBreakerOpensOnErrorRate(t *testing.T) {
+	cb := newTestBreaker()
+	// 成功和失败交替，不会触发连续失败阈值
+	for i := 0; i < 4; i++ {
+		cb.RecordSuccess(1)
+		cb.RecordFailure(1)
+	}
+	if state := cb.Status(1).State; state != BreakerClosed {
+		t.Fatalf("state below min requests = %s, want %s", state, BreakerClosed)
+	}
+
+	cb.RecordSuccess(1)
+	cb.RecordFailure(1)
+	status := cb.Status(1)
+	if status.State != BreakerOpen {
+		t.Fatalf("state at 5/10 failures = %s, want %s", status.State, BreakerOpen)
+	}
+	if status.WindowRequests != 10 || status.WindowFailures != 5 {
+		t.Fatalf("window = %d/%d, want 5/10", status.WindowFailures, status.WindowRequests)
+	}
+}
+
+func TestCircuitBreakerHalfOpenProbeSuccessCloses(t *testing.T) {
+	cb := newTestBreaker()
+	for i := 0; i < 3; i++ {
+		cb.RecordFailure(1)
+	}
+	expireCooldown(cb, 1)
+
+	if !cb.Available(1) {
+		t.Fatal("breaker should be available once the cooldown has passed")
+	}
+	if !cb.Acquire(1) {
+		t.Fatal("first request after cooldown should get the probe slot")
+	}
+	if state := cb.Status(1).State; state != BreakerHalfOpen {
+		t.Fatalf("state after acquire = %s, want %s", state, BreakerHalfOpen)
+	}
+	if cb.Available(1) || cb.Acquire(1) {
+		t.Fatal("only one probe request should be let through while half-open")
+	}
+
+	cb.RecordSuccess(1)
+	status := cb.Status(1)
+	if status.State != BreakerClosed {
+		t.Fatalf("state after probe success = %s, want %s", status.State, BreakerClosed)
+	}
+	if status.ConsecutiveFailures != 0 || status.WindowRequests != 0 || status.WindowFailures != 0 {
+		t.Fatalf("counters not reset after recovery: %+v", status)
+	}
+	if !cb.Available(1) || !cb.Acquire(1) {
+		t.Fatal("closed breaker should let requests through")
+	}
+}
+
+func TestCircuitBreakerHalfOpenProbeFailureReopens(t *testing.T) {
+	cb := newTestBreaker()
+	for i := 0; i < 3; i++ {
+		cb.RecordFailure(1)
+	}
+	expireCooldown(cb, 1)
+	if !cb.Acquire(1) {
+		t.Fatal("first request after cooldown should get the probe slot")
+	}
+
+	before := time.Now()
+	cb.RecordFailure(1)
+	status := cb.Status(1)
+	if status.State != BreakerOpen {
+		t.Fatalf("state after probe failure = %s, want %s", status.State, BreakerOpen)
+	}
+	if status.OpenedAt.Before(before) {
+		t.Fatal("cooldown should restart when the probe fails")
+	}
+	if cb.Available(1) {
+		t.Fatal("reopened breaker should not be available during cooldown")
+	}
+}
+
+func TestCircuitBreakerStalledProbeCanBeRetried(t *testing.T) {
+	cb := newTestBreaker()
+	for i := 0; i < 3; i++ {
+		cb.RecordFailure(1)
+	}
+	expireCooldown(cb, 1)
+	if !cb.Acquire(1) {
+		t.Fatal("first request after cooldown should get the probe slot")
+	}
+
+	// 探测请求超过冷却时间仍没有结果时允许重新探测
+	expireCooldown(cb, 1)
+	if !cb.Available(1) || !cb.Acquire(1) {
+		t.Fatal("stalled probe should free the probe slot after the cooldown")
+	}
+}
+
+func TestCircuitBreakerDisabledNeverOpens(t *testing.T) {
+	cb := newTestBreaker()
+	cb.config.CircuitBreakerEnabled = false
+	for i := 0; i < 10; i++ {
+		cb.RecordFailure(1)
+	}
+	if state := cb.Status(1).State; state != BreakerClosed {
+		t.Fatalf("state with breaker disabled = %s, want %s", state, BreakerClosed)
+	}
+	if !cb.Available(1) || !cb.Acquire(1) {
+		t.Fatal("disabled breaker should let requests through")
+	}
+}
+
+func TestCircuitBreakerReset(t *testing.T) {
+	cb := newTestBreaker()
+	for i := 0; i < 3; i++ {
+		cb.RecordFailure(1)
+	}
+	cb.RecordFailure(2)
+
+	cb.Reset(1)
+	if status := cb.Status(1); status.State != BreakerClosed || status.ConsecutiveFailures != 0 {
+		t.Fatalf("status after reset = %+v, want a fresh closed breaker", status)
+	}
+	if !cb.Available(1) {
+		t.Fatal("reset breaker should be available")
+	}
+	if failures := cb.Status(2).ConsecutiveFailures; failures != 1 {
+		t.Fatalf("reset should not touch other routes, route 2 failures = %d", failures)
+	}
+}
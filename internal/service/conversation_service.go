@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -87,7 +88,7 @@ func (cs *ConversationService) sendOpenAIConversation(req ConversationRequest) (
 		"Authorization": fmt.Sprintf("Bearer %s", cs.config.LocalAPIKey),
 	}
 
-	respBody, statusCode, err := cs.proxyService.ProxyRequest(reqBody, headers)
+	respBody, statusCode, err := cs.proxyService.ProxyRequest(context.Background(), reqBody, headers)
 	if err != nil {
 		return &ConversationResponse{
 			Provider: "openai",
@@ -198,7 +199,7 @@ func (cs *ConversationService) sendClaudeConversation(req ConversationRequest) (
 		"x-api-key":         cs.config.LocalAPIKey,
 	}
 
-	respBody, statusCode, err := cs.proxyService.ProxyAnthropicRequest(reqBody, headers)
+	respBody, statusCode, err := cs.proxyService.ProxyAnthropicRequest(context.Background(), reqBody, headers)
 	if err != nil {
 		return &ConversationResponse{
 			Provider: "claude",
@@ -309,7 +310,7 @@ func (cs *ConversationService) sendGeminiConversation(req ConversationRequest) (
 		"Content-Type": "application/json",
 	}
 
-	respBody, statusCode, err := cs.proxyService.ProxyRequest(reqBody, headers)
+	respBody, statusCode, err := cs.proxyService.ProxyRequest(context.Background(), reqBody, headers)
 	if err != nil {
 		return &ConversationResponse{
 			Provider: "gemini",
@@ -0,0 +1,612 @@
+package service
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// 支持导入路由的外部工具
+const (
+	ExternalSourceCCSwitch   = "cc-switch"   // ~/.cc-switch/config.json 或 cc-switch.db
+	ExternalSourceCCNexus    = "ccnexus"     // ~/.ccNexus/config.json 或 ccnexus.db
+	ExternalSourceCodeSwitch = "code-switch" // ~/.code-switch/claude-code.json 和 codex.json
+)
+
+// 外部工具的官方服务地址，供应商没有配置 base URL 时使用
+const (
+	defaultClaudeBaseURL = "https://api.anthropic.com"
+	defaultOpenAIBaseURL = "https://api.openai.com/v1"
+	defaultGeminiBaseURL = "https://generativelanguage.googleapis.com"
+)
+
+// ExternalImportResult 从外部工具导入路由的结果
+type ExternalImportResult struct {
+	*RouteImportResult
+	Source   string   `json:"source"`
+	Path     string   `json:"path"`
+	Unmapped []string `json:"unmapped"` // 无法转换为路由的供应商及原因
+}
+
+// externalProvider 外部工具中的一个供应商，转换为一条或多条路由
+type externalProvider struct {
+	label    string // 报告中使用的来源描述，如 cc-switch/codex "name"
+	name     string
+	format   string
+	baseURL  string
+	apiKey   string
+	models   []string          // 对外暴露的模型名，上游使用相同的名称
+	mapping  map[string]string // 模型名（可为通配符）-> 上游模型名
+	priority int
+	enabled  bool
+}
+
+// externalConfig 解析外部工具配置得到的供应商，以及解析阶段就无法转换的条目
+type externalConfig struct {
+	path      string
+	providers []externalProvider
+	unmapped  []string
+	warnings  []string
+}
+
+// ImportExternalConfig 从 cc-switch / ccNexus / code-switch 的配置导入路由，导入模式固定为合并
+// path 为空时读取工具的默认配置目录；group 为导入路由所属的分组；dryRun 为 true 时只返回将要执行的变更
+func (s *RouteService) ImportExternalConfig(source, path, group string, dryRun bool) (*ExternalImportResult, error) {
+	source = strings.ToLower(strings.TrimSpace(source))
+	if path = strings.TrimSpace(path); path == "" {
+		dir, err := defaultExternalDir(source)
+		if err != nil {
+			return nil, err
+		}
+		path = dir
+	}
+
+	var cfg *externalConfig
+	var err error
+	switch source {
+	case ExternalSourceCCSwitch:
+		cfg, err = readCCSwitchConfig(path)
+	case ExternalSourceCCNexus:
+		cfg, err = readCCNexusConfig(path)
+	case ExternalSourceCodeSwitch:
+		cfg, err = readCodeSwitchConfig(path)
+	default:
+		return nil, fmt.Errorf("unsupported import source: %q (use cc-switch, ccnexus or code-switch)", source)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	file := &RouteExportFile{Version: RouteExportVersion, IncludeKeys: true}
+	unmapped := cfg.unmapped
+	seen := make(map[string]bool)
+	for _, p := range cfg.providers {
+		records, err := p.routeRecords(strings.TrimSpace(group))
+		if err != nil {
+			unmapped = append(unmapped, fmt.Sprintf("%s: %v", p.label, err))
+			continue
+		}
+		for _, record := range records {
+			// 同名供应商导出相同的模型时加上序号，避免被识别为同一条路由
+			base := record.Name
+			for n := 2; seen[routeIdentity(record.Name, record.Model, record.Group)]; n++ {
+				record.Name = fmt.Sprintf("%s (%d)", base, n)
+			}
+			seen[routeIdentity(record.Name, record.Model, record.Group)] = true
+			file.Routes = append(file.Routes, record)
+		}
+	}
+
+	result, err := s.importRouteFile(file, RouteImportMerge, dryRun, false)
+	if err != nil {
+		return nil, err
+	}
+	result.Warnings = append(append([]string{}, cfg.warnings...), result.Warnings...)
+	if unmapped == nil {
+		unmapped = []string{}
+	}
+
+	log.Infof("Imported %d providers from %s (%s), %d unmapped", len(cfg.providers), source, cfg.path, len(unmapped))
+	return &ExternalImportResult{RouteImportResult: result, Source: source, Path: cfg.path, Unmapped: unmapped}, nil
+}
+
+// defaultExternalDir 外部工具的默认配置目录
+func defaultExternalDir(source string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	switch source {
+	case ExternalSourceCCSwitch:
+		return filepath.Join(home, ".cc-switch"), nil
+	case ExternalSourceCCNexus:
+		return filepath.Join(home, ".ccNexus"), nil
+	case ExternalSourceCodeSwitch:
+		return filepath.Join(home, ".code-switch"), nil
+	}
+	return "", fmt.Errorf("unsupported import source: %q (use cc-switch, ccnexus or code-switch)", source)
+}
+
+// resolveConfigFile path 为目录时依次查找候选文件名，返回第一个存在的文件
+func resolveConfigFile(path string, candidates ...string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return path, nil
+	}
+	for _, name := range candidates {
+		file := filepath.Join(path, name)
+		if _, err := os.Stat(file); err == nil {
+			return file, nil
+		}
+	}
+	return "", fmt.Errorf("no %s found in %s", strings.Join(candidates, " or "), path)
+}
+
+// openReadOnlyDB 以只读方式打开外部工具的 SQLite 数据库
+func openReadOnlyDB(path string) (*sql.DB, error) {
+	return sql.Open("sqlite", "file:"+filepath.ToSlash(path)+"?mode=ro")
+}
+
+// routeRecords 将供应商转换为路由：有模型映射或模型列表时每个模型一条路由，否则按协议生成通配符路由
+func (p *externalProvider) routeRecords(group string) ([]RouteRecord, error) {
+	if p.apiKey == "" {
+		return nil, fmt.Errorf("api key is missing")
+	}
+	apiURL, err := externalBaseURL(p.baseURL, p.format)
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSpace(p.name)
+	if name == "" {
+		name = p.label
+	}
+	newRecord := func(model, upstream string) RouteRecord {
+		enabled := p.enabled
+		return RouteRecord{
+			Name: name, Model: model, APIUrl: apiURL, APIKey: p.apiKey, Group: group, Format: p.format,
+			UpstreamModel: upstream, Priority: p.priority, Enabled: &enabled,
+		}
+	}
+
+	var records []RouteRecord
+	mapped := make(map[string]bool)
+	for _, model := range sortedKeys(p.mapping) {
+		records = append(records, newRecord(model, p.mapping[model]))
+		mapped[model] = true
+	}
+	for _, model := range p.models {
+		if !mapped[model] {
+			records = append(records, newRecord(model, ""))
+			mapped[model] = true
+		}
+	}
+	if len(records) == 0 {
+		records = append(records, newRecord(wildcardModel(p.format), ""))
+	}
+
+	for i := range records {
+		if _, err := records[i].toRoute(false); err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+// externalBaseURL 将外部工具中的 base URL 转换为路由的 api_url
+// 补全缺少的协议头；OpenAI 格式的 base URL 通常已包含 /v1 等路径，加上末尾斜杠使请求直接拼接 chat/completions
+func externalBaseURL(baseURL, format string) (string, error) {
+	baseURL = strings.TrimSpace(baseURL)
+	if baseURL == "" {
+		return "", fmt.Errorf("base url is missing")
+	}
+	if !strings.Contains(baseURL, "://") {
+		baseURL = "https://" + baseURL
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid base url: %s", baseURL)
+	}
+
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	if format == protocolOpenAI && strings.Trim(u.Path, "/") != "" {
+		baseURL += "/"
+	}
+	return baseURL, nil
+}
+
+// wildcardModel 供应商没有配置模型时使用的通配符，匹配该协议常见的模型名
+func wildcardModel(format string) string {
+	switch format {
+	case protocolClaude:
+		return "claude-*"
+	case protocolGemini:
+		return "gemini-*"
+	}
+	return "gpt-*"
+}
+
+// sortedKeys 返回按字母排序的键，使导入结果稳定
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// stringValue 读取 JSON 对象中的字符串字段，不存在或不是字符串时返回空
+func stringValue(m map[string]interface{}, key string) string {
+	v, _ := m[key].(string)
+	return strings.TrimSpace(v)
+}
+
+// appendUnique 追加不为空且不重复的值
+func appendUnique(list []string, values ...string) []string {
+	for _, v := range values {
+		if v == "" {
+			continue
+		}
+		exists := false
+		for _, item := range list {
+			if item == v {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// ---- cc-switch ----
+
+// ccSwitchProvider cc-switch 中的供应商，settingsConfig 的结构随应用不同
+type ccSwitchProvider struct {
+	ID             string          `json:"id"`
+	Name           string          `json:"name"`
+	SettingsConfig json.RawMessage `json:"settingsConfig"`
+}
+
+// ccSwitchApp cc-switch 中一个应用（claude / codex / gemini）的供应商列表
+type ccSwitchApp struct {
+	Providers map[string]ccSwitchProvider `json:"providers"`
+	Current   string                      `json:"current"`
+}
+
+// readCCSwitchConfig 读取 cc-switch 的 config.json（v1 只有 Claude，v2 按应用分组）或新版本的 cc-switch.db
+// 只有各应用当前使用的供应商导入后是启用状态，避免多个供应商同时分担流量
+func readCCSwitchConfig(path string) (*externalConfig, error) {
+	file, err := resolveConfigFile(path, "config.json", "cc-switch.db")
+	if err != nil {
+		return nil, err
+	}
+	cfg := &externalConfig{path: file}
+
+	if strings.EqualFold(filepath.Ext(file), ".db") {
+		if err := readCCSwitchDB(file, cfg); err != nil {
+			return nil, err
+		}
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var root map[string]json.RawMessage
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("invalid cc-switch config: %v", err)
+	}
+
+	apps := map[string]json.RawMessage{}
+	if _, ok := root["providers"]; ok {
+		apps["claude"] = data
+	} else {
+		for _, app := range []string{"claude", "codex", "gemini"} {
+			if raw, ok := root[app]; ok {
+				apps[app] = raw
+			}
+		}
+	}
+
+	for _, appType := range sortedKeys(apps) {
+		var app ccSwitchApp
+		if err := json.Unmarshal(apps[appType], &app); err != nil {
+			return nil, fmt.Errorf("invalid cc-switch config (%s): %v", appType, err)
+		}
+		ids := sortedKeys(app.Providers)
+		sort.SliceStable(ids, func(i, j int) bool { return app.Providers[ids[i]].Name < app.Providers[ids[j]].Name })
+		for _, id := range ids {
+			p := app.Providers[id]
+			cfg.addCCSwitchProvider(appType, p.Name, p.SettingsConfig, id == app.Current)
+		}
+	}
+	return cfg, nil
+}
+
+// readCCSwitchDB 读取新版本 cc-switch 保存在 SQLite 中的供应商
+func readCCSwitchDB(file string, cfg *externalConfig) error {
+	db, err := openReadOnlyDB(file)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT app_type, name, settings_config, COALESCE(is_current, 0) FROM providers ORDER BY app_type, name`)
+	if err != nil {
+		return fmt.Errorf("unrecognized cc-switch database: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var appType, name, settings string
+		var current bool
+		if err := rows.Scan(&appType, &name, &settings, &current); err != nil {
+			return err
+		}
+		cfg.addCCSwitchProvider(appType, name, json.RawMessage(settings), current)
+	}
+	return rows.Err()
+}
+
+// addCCSwitchProvider 按应用类型解析 cc-switch 供应商的 settingsConfig
+func (cfg *externalConfig) addCCSwitchProvider(appType, name string, settings json.RawMessage, current bool) {
+	label := fmt.Sprintf("cc-switch/%s %q", appType, name)
+	var sc struct {
+		Env    map[string]interface{} `json:"env"`
+		Auth   map[string]interface{} `json:"auth"`
+		Config string                 `json:"config"`
+	}
+	if err := json.Unmarshal(settings, &sc); err != nil {
+		cfg.unmapped = append(cfg.unmapped, fmt.Sprintf("%s: invalid settingsConfig: %v", label, err))
+		return
+	}
+
+	p := externalProvider{label: label, name: name, enabled: current}
+	switch appType {
+	case "claude":
+		p.format = protocolClaude
+		p.baseURL = stringValue(sc.Env, "ANTHROPIC_BASE_URL")
+		p.apiKey = stringValue(sc.Env, "ANTHROPIC_AUTH_TOKEN")
+		if p.apiKey == "" {
+			p.apiKey = stringValue(sc.Env, "ANTHROPIC_API_KEY")
+		}
+		for _, key := range []string{"ANTHROPIC_MODEL", "ANTHROPIC_DEFAULT_OPUS_MODEL", "ANTHROPIC_DEFAULT_SONNET_MODEL",
+			"ANTHROPIC_DEFAULT_HAIKU_MODEL", "ANTHROPIC_SMALL_FAST_MODEL"} {
+			p.models = appendUnique(p.models, stringValue(sc.Env, key))
+		}
+		if p.baseURL == "" && p.apiKey != "" {
+			p.baseURL = defaultClaudeBaseURL
+		}
+	case "codex":
+		p.format = protocolOpenAI
+		p.apiKey = stringValue(sc.Auth, "OPENAI_API_KEY")
+		var codex struct {
+			ModelProvider  string `toml:"model_provider"`
+			Model          string `toml:"model"`
+			ModelProviders map[string]struct {
+				BaseURL string `toml:"base_url"`
+				WireAPI string `toml:"wire_api"`
+			} `toml:"model_providers"`
+		}
+		if err := toml.Unmarshal([]byte(sc.Config), &codex); err != nil {
+			cfg.unmapped = append(cfg.unmapped, fmt.Sprintf("%s: invalid config.toml: %v", label, err))
+			return
+		}
+		provider := codex.ModelProviders[codex.ModelProvider]
+		p.baseURL = provider.BaseURL
+		p.models = appendUnique(p.models, strings.TrimSpace(codex.Model))
+		if p.baseURL == "" && (codex.ModelProvider == "" || codex.ModelProvider == "openai") && p.apiKey != "" {
+			p.baseURL = defaultOpenAIBaseURL
+		}
+		if provider.WireAPI == "responses" {
+			cfg.warnings = append(cfg.warnings, fmt.Sprintf("%s uses the Responses API; the route sends Chat Completions requests, make sure the provider supports them", label))
+		}
+	case "gemini":
+		p.format = protocolGemini
+		p.baseURL = stringValue(sc.Env, "GOOGLE_GEMINI_BASE_URL")
+		p.apiKey = stringValue(sc.Env, "GEMINI_API_KEY")
+		p.models = appendUnique(p.models, stringValue(sc.Env, "GEMINI_MODEL"))
+		if p.baseURL == "" && p.apiKey != "" {
+			p.baseURL = defaultGeminiBaseURL
+		}
+	default:
+		cfg.unmapped = append(cfg.unmapped, fmt.Sprintf("%s: unsupported app type", label))
+		return
+	}
+	cfg.providers = append(cfg.providers, p)
+}
+
+// ---- ccNexus ----
+
+// ccNexusEndpoint ccNexus 中的端点，transformer 决定上游协议，model 为发往上游的模型名
+type ccNexusEndpoint struct {
+	Name        string `json:"name"`
+	APIUrl      string `json:"apiUrl"`
+	APIKey      string `json:"apiKey"`
+	Enabled     bool   `json:"enabled"`
+	Transformer string `json:"transformer"`
+	Model       string `json:"model"`
+}
+
+// readCCNexusConfig 读取 ccNexus 的 config.json 或 ccnexus.db
+// ccNexus 面向 Claude Code，所有端点都转换为 claude-* 通配符路由；端点顺序即故障转移顺序，对应路由的优先级
+func readCCNexusConfig(path string) (*externalConfig, error) {
+	file, err := resolveConfigFile(path, "config.json", "ccnexus.db")
+	if err != nil {
+		return nil, err
+	}
+	cfg := &externalConfig{path: file}
+
+	var endpoints []ccNexusEndpoint
+	if strings.EqualFold(filepath.Ext(file), ".db") {
+		if endpoints, err = readCCNexusDB(file); err != nil {
+			return nil, err
+		}
+	} else {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var root struct {
+			Endpoints []ccNexusEndpoint `json:"endpoints"`
+		}
+		if err := json.Unmarshal(data, &root); err != nil {
+			return nil, fmt.Errorf("invalid ccNexus config: %v", err)
+		}
+		endpoints = root.Endpoints
+	}
+
+	for i, ep := range endpoints {
+		label := fmt.Sprintf("ccNexus %q", ep.Name)
+		p := externalProvider{
+			label: label, name: ep.Name, baseURL: ep.APIUrl, apiKey: strings.TrimSpace(ep.APIKey),
+			mapping:  map[string]string{"claude-*": strings.TrimSpace(ep.Model)},
+			priority: i, enabled: ep.Enabled,
+		}
+		switch strings.ToLower(strings.TrimSpace(ep.Transformer)) {
+		case "", "claude":
+			p.format = protocolClaude
+		case "openai":
+			p.format = protocolOpenAI
+		case "openai2":
+			p.format = protocolOpenAI
+			cfg.warnings = append(cfg.warnings, fmt.Sprintf("%s uses the Responses API; the route sends Chat Completions requests, make sure the provider supports them", label))
+		case "gemini":
+			p.format = protocolGemini
+		default:
+			cfg.unmapped = append(cfg.unmapped, fmt.Sprintf("%s: unsupported transformer %q", label, ep.Transformer))
+			continue
+		}
+		if p.format != protocolClaude && p.mapping["claude-*"] == "" {
+			cfg.unmapped = append(cfg.unmapped, fmt.Sprintf("%s: model is required for the %s transformer", label, ep.Transformer))
+			continue
+		}
+		cfg.providers = append(cfg.providers, p)
+	}
+	return cfg, nil
+}
+
+// readCCNexusDB 读取新版本 ccNexus 保存在 SQLite 中的端点
+func readCCNexusDB(file string) ([]ccNexusEndpoint, error) {
+	db, err := openReadOnlyDB(file)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT name, api_url, api_key, enabled, COALESCE(transformer, ''), COALESCE(model, '') FROM endpoints ORDER BY rowid`)
+	if err != nil {
+		return nil, fmt.Errorf("unrecognized ccNexus database: %v", err)
+	}
+	defer rows.Close()
+
+	var endpoints []ccNexusEndpoint
+	for rows.Next() {
+		var ep ccNexusEndpoint
+		if err := rows.Scan(&ep.Name, &ep.APIUrl, &ep.APIKey, &ep.Enabled, &ep.Transformer, &ep.Model); err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, ep)
+	}
+	return endpoints, rows.Err()
+}
+
+// ---- code-switch ----
+
+// codeSwitchProvider code-switch 中的供应商
+// supportedModels 为支持的模型名，modelMapping 为模型名（可为通配符）到上游模型名的映射，level 越小越优先
+type codeSwitchProvider struct {
+	Name            string            `json:"name"`
+	APIUrl          string            `json:"apiUrl"`
+	APIKey          string            `json:"apiKey"`
+	Enabled         bool              `json:"enabled"`
+	SupportedModels map[string]bool   `json:"supportedModels"`
+	ModelMapping    map[string]string `json:"modelMapping"`
+	Level           int               `json:"level"`
+}
+
+// readCodeSwitchConfig 读取 code-switch 的 claude-code.json（Claude 协议）和 codex.json（OpenAI 协议）
+// path 可以是配置目录，也可以是其中的单个文件
+func readCodeSwitchConfig(path string) (*externalConfig, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{path}
+	if info.IsDir() {
+		files = nil
+		for _, name := range []string{"claude-code.json", "codex.json"} {
+			if _, err := os.Stat(filepath.Join(path, name)); err == nil {
+				files = append(files, filepath.Join(path, name))
+			}
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("no claude-code.json or codex.json found in %s", path)
+		}
+	}
+
+	cfg := &externalConfig{path: path}
+	for _, file := range files {
+		kind, format := "claude-code", protocolClaude
+		if strings.Contains(strings.ToLower(filepath.Base(file)), "codex") {
+			kind, format = "codex", protocolOpenAI
+		}
+
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var root struct {
+			Providers []codeSwitchProvider `json:"providers"`
+		}
+		if err := json.Unmarshal(data, &root); err != nil {
+			return nil, fmt.Errorf("invalid code-switch config %s: %v", filepath.Base(file), err)
+		}
+
+		for _, cp := range root.Providers {
+			p := externalProvider{
+				label: fmt.Sprintf("code-switch/%s %q", kind, cp.Name), name: cp.Name, format: format,
+				baseURL: cp.APIUrl, apiKey: strings.TrimSpace(cp.APIKey), mapping: map[string]string{},
+				priority: cp.Level, enabled: cp.Enabled,
+			}
+			for model, target := range cp.ModelMapping {
+				if model = strings.TrimSpace(model); model != "" {
+					p.mapping[model] = strings.TrimSpace(target)
+				}
+			}
+			for _, model := range sortedKeys(cp.SupportedModels) {
+				if cp.SupportedModels[model] {
+					p.models = appendUnique(p.models, strings.TrimSpace(model))
+				}
+			}
+			cfg.providers = append(cfg.providers, p)
+		}
+	}
+	return cfg, nil
+}
+
+// ImportExternalConfig 从外部工具的配置导入路由，并清除被更新的路由在内存中的状态
+func (s *ProxyService) ImportExternalConfig(source, path, group string, dryRun bool) (*ExternalImportResult, error) {
+	result, err := s.routeService.ImportExternalConfig(source, path, group, dryRun)
+	if err != nil || dryRun {
+		return result, err
+	}
+	s.forgetImportedRoutes(result.RouteImportResult)
+	return result, nil
+}
@@ -0,0 +1,293 @@
+package service
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"openai-router-go/internal/database"
+)
+
+// writeTestFile 在目录中写入外部工具的配置文件
+func writeTestFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// writeTestDB 创建外部工具的 SQLite 数据库
+func writeTestDB(t *testing.T, path string, statements ...string) {
+	t.Helper()
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, stmt := range statements {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// importedRoutes 导入外部配置并返回导入后的全部路由，按 名称/模型 排序
+func importedRoutes(t *testing.T, source, path string) (*ExternalImportResult, []database.ModelRoute) {
+	t.Helper()
+	rs := newTestRouteService(t)
+	result, err := rs.ImportExternalConfig(source, path, "imported", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	routes, err := rs.GetAllRoutes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Name != routes[j].Name {
+			return routes[i].Name < routes[j].Name
+		}
+		return routes[i].Model < routes[j].Model
+	})
+	for _, route := range routes {
+		if route.Group != "imported" {
+			t.Fatalf("route %s imported into group %q, want %q", route.Name, route.Group, "imported")
+		}
+	}
+	return result, routes
+}
+
+// routeSummary 路由的关键字段，便于整体比较
+func routeSummary(routes []database.ModelRoute) []string {
+	var summary []string
+	for _, r := range routes {
+		state := "off"
+		if r.Enabled {
+			state = "on"
+		}
+		summary = append(summary, strings.Join([]string{r.Name, r.Model, r.UpstreamModel, r.APIUrl, r.Format, state}, " | "))
+	}
+	return summary
+}
+
+func checkSummary(t *testing.T, routes []database.ModelRoute, want []string) {
+	t.Helper()
+	got := routeSummary(routes)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("imported routes:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestExternalBaseURL(t *testing.T) {
+	tests := []struct {
+		baseURL string
+		format  string
+		want    string
+		wantErr bool
+	}{
+		{"https://api.anthropic.com/", protocolClaude, "https://api.anthropic.com", false},
+		{"relay.example.com", protocolClaude, "https://relay.example.com", false},
+		{"https://relay.example.com/v1", protocolOpenAI, "https://relay.example.com/v1/", false},
+		{"https://relay.example.com/", protocolOpenAI, "https://relay.example.com", false},
+		{"https://relay.example.com/v1beta", protocolGemini, "https://relay.example.com/v1beta", false},
+		{"", protocolOpenAI, "", true},
+		{"https://", protocolOpenAI, "", true},
+	}
+	for _, tt := range tests {
+		got, err := externalBaseURL(tt.baseURL, tt.format)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("externalBaseURL(%q, %s) = %q, %v; want %q", tt.baseURL, tt.format, got, err, tt.want)
+		}
+	}
+}
+
+func TestImportCCSwitchConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "config.json", `{
+  "claude": {
+    "current": "p1",
+    "providers": {
+      "p1": {"name": "Relay", "settingsConfig": {"env": {
+        "ANTHROPIC_BASE_URL": "https://relay.example.com",
+        "ANTHROPIC_AUTH_TOKEN": "sk-relay",
+        "ANTHROPIC_MODEL": "claude-sonnet-4",
+        "ANTHROPIC_SMALL_FAST_MODEL": "claude-3-5-haiku"
+      }}},
+      "p2": {"name": "Official", "settingsConfig": {"env": {"ANTHROPIC_API_KEY": "sk-official"}}},
+      "p3": {"name": "Broken", "settingsConfig": {"env": {"ANTHROPIC_BASE_URL": "https://broken.example.com"}}}
+    }
+  },
+  "codex": {
+    "current": "c1",
+    "providers": {
+      "c1": {"name": "Codex Relay", "settingsConfig": {
+        "auth": {"OPENAI_API_KEY": "sk-codex"},
+        "config": "model_provider = \"relay\"\nmodel = \"gpt-5\"\n[model_providers.relay]\nbase_url = \"https://codex.example.com/v1\"\nwire_api = \"responses\"\n"
+      }}
+    }
+  },
+  "gemini": {
+    "current": "",
+    "providers": {
+      "g1": {"name": "Gemini", "settingsConfig": {"env": {"GEMINI_API_KEY": "gm-key", "GEMINI_MODEL": "gemini-2.5-pro"}}}
+    }
+  }
+}`)
+
+	result, routes := importedRoutes(t, "CC-Switch", dir)
+	checkSummary(t, routes, []string{
+		"Codex Relay | gpt-5 |  | https://codex.example.com/v1/ | openai | on",
+		"Gemini | gemini-2.5-pro |  | https://generativelanguage.googleapis.com | gemini | off",
+		"Official | claude-* |  | https://api.anthropic.com | claude | off",
+		"Relay | claude-3-5-haiku |  | https://relay.example.com | claude | on",
+		"Relay | claude-sonnet-4 |  | https://relay.example.com | claude | on",
+	})
+	if len(result.Unmapped) != 1 || !strings.Contains(result.Unmapped[0], `"Broken"`) {
+		t.Fatalf("unmapped = %v, want the provider without a key", result.Unmapped)
+	}
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "Responses API") {
+		t.Fatalf("warnings = %v, want the Responses API warning", result.Warnings)
+	}
+	if result.Path != filepath.Join(dir, "config.json") {
+		t.Fatalf("path = %q, want the config file", result.Path)
+	}
+}
+
+func TestImportCCSwitchLegacyConfig(t *testing.T) {
+	// v1 的配置只有 Claude 供应商，位于顶层
+	file := writeTestFile(t, t.TempDir(), "config.json", `{
+  "current": "a",
+  "providers": {"a": {"name": "Legacy", "settingsConfig": {"env": {"ANTHROPIC_AUTH_TOKEN": "sk-legacy"}}}}
+}`)
+	_, routes := importedRoutes(t, ExternalSourceCCSwitch, file)
+	checkSummary(t, routes, []string{"Legacy | claude-* |  | https://api.anthropic.com | claude | on"})
+}
+
+func TestImportCCSwitchDB(t *testing.T) {
+	dir := t.TempDir()
+	writeTestDB(t, filepath.Join(dir, "cc-switch.db"),
+		`CREATE TABLE providers (id TEXT, app_type TEXT, name TEXT, settings_config TEXT, is_current INTEGER)`,
+		`INSERT INTO providers VALUES ('1', 'claude', 'Relay', '{"env":{"ANTHROPIC_AUTH_TOKEN":"sk-relay","ANTHROPIC_BASE_URL":"https://relay.example.com"}}', 1)`,
+		`INSERT INTO providers VALUES ('2', 'codex', 'Bad', 'not json', 0)`,
+		`INSERT INTO providers VALUES ('3', 'opencode', 'Other', '{}', NULL)`,
+	)
+
+	result, routes := importedRoutes(t, ExternalSourceCCSwitch, dir)
+	checkSummary(t, routes, []string{"Relay | claude-* |  | https://relay.example.com | claude | on"})
+	if len(result.Unmapped) != 2 {
+		t.Fatalf("unmapped = %v, want the invalid and the unsupported provider", result.Unmapped)
+	}
+}
+
+func TestImportCCNexusConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "config.json", `{"endpoints": [
+  {"name": "Primary", "apiUrl": "https://primary.example.com", "apiKey": "sk-1", "enabled": true},
+  {"name": "OpenAI", "apiUrl": "https://openai.example.com/v1", "apiKey": "sk-2", "enabled": false, "transformer": "openai", "model": "gpt-4o"},
+  {"name": "No model", "apiUrl": "https://x.example.com", "apiKey": "sk-3", "enabled": true, "transformer": "gemini"},
+  {"name": "Unknown", "apiUrl": "https://x.example.com", "apiKey": "sk-4", "enabled": true, "transformer": "custom"}
+]}`)
+
+	result, routes := importedRoutes(t, ExternalSourceCCNexus, dir)
+	checkSummary(t, routes, []string{
+		"OpenAI | claude-* | gpt-4o | https://openai.example.com/v1/ | openai | off",
+		"Primary | claude-* |  | https://primary.example.com | claude | on",
+	})
+	// 端点顺序即故障转移顺序
+	for _, route := range routes {
+		if want := map[string]int{"Primary": 0, "OpenAI": 1}[route.Name]; route.Priority != want {
+			t.Fatalf("route %s priority = %d, want %d", route.Name, route.Priority, want)
+		}
+	}
+	if len(result.Unmapped) != 2 {
+		t.Fatalf("unmapped = %v, want the endpoint without a model and the unknown transformer", result.Unmapped)
+	}
+}
+
+func TestImportCCNexusDB(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ccnexus.db")
+	writeTestDB(t, path,
+		`CREATE TABLE endpoints (name TEXT, api_url TEXT, api_key TEXT, enabled INTEGER, transformer TEXT, model TEXT)`,
+		`INSERT INTO endpoints VALUES ('First', 'https://first.example.com', 'sk-1', 1, NULL, NULL)`,
+		`INSERT INTO endpoints VALUES ('Second', 'https://second.example.com', 'sk-2', 1, 'claude', 'claude-opus-4')`,
+	)
+	_, routes := importedRoutes(t, ExternalSourceCCNexus, path)
+	checkSummary(t, routes, []string{
+		"First | claude-* |  | https://first.example.com | claude | on",
+		"Second | claude-* | claude-opus-4 | https://second.example.com | claude | on",
+	})
+}
+
+func TestImportCodeSwitchConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "claude-code.json", `{"providers": [
+  {"name": "Relay", "apiUrl": "https://relay.example.com", "apiKey": "sk-1", "enabled": true, "level": 2,
+   "supportedModels": {"claude-sonnet-4": true, "claude-opus-4": false},
+   "modelMapping": {"claude-*-haiku": "glm-4.5-air"}},
+  {"name": "Relay", "apiUrl": "https://relay2.example.com", "apiKey": "sk-2", "enabled": true, "supportedModels": {"claude-sonnet-4": true}},
+  {"name": "No key", "apiUrl": "https://x.example.com", "enabled": true}
+]}`)
+	writeTestFile(t, dir, "codex.json", `{"providers": [
+  {"name": "Codex", "apiUrl": "https://codex.example.com/v1", "apiKey": "sk-3", "enabled": false}
+]}`)
+
+	result, routes := importedRoutes(t, ExternalSourceCodeSwitch, dir)
+	// 同名供应商导出相同的模型时加上序号
+	checkSummary(t, routes, []string{
+		"Codex | gpt-* |  | https://codex.example.com/v1/ | openai | off",
+		"Relay | claude-*-haiku | glm-4.5-air | https://relay.example.com | claude | on",
+		"Relay | claude-sonnet-4 |  | https://relay.example.com | claude | on",
+		"Relay (2) | claude-sonnet-4 |  | https://relay2.example.com | claude | on",
+	})
+	for _, route := range routes {
+		if route.Name == "Relay" && route.Priority != 2 {
+			t.Fatalf("route %s (%s) priority = %d, want the provider level 2", route.Name, route.Model, route.Priority)
+		}
+	}
+	if len(result.Unmapped) != 1 || !strings.Contains(result.Unmapped[0], "api key is missing") {
+		t.Fatalf("unmapped = %v, want the provider without a key", result.Unmapped)
+	}
+}
+
+func TestImportExternalConfigMergesAndDryRuns(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "config.json", `{"endpoints": [{"name": "Primary", "apiUrl": "https://primary.example.com", "apiKey": "sk-1", "enabled": true}]}`)
+	rs := newTestRouteService(t)
+	addTestRoute(t, rs, database.ModelRoute{Name: "existing", Model: "gpt-4o"})
+
+	result, err := rs.ImportExternalConfig(ExternalSourceCCNexus, dir, "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.DryRun || len(result.Added) != 1 || len(result.Deleted) != 0 {
+		t.Fatalf("dry run result = %+v, want one route added and nothing deleted", result.RouteImportResult)
+	}
+	if routes, _ := rs.GetAllRoutes(); len(routes) != 1 {
+		t.Fatalf("dry run added routes: %d routes", len(routes))
+	}
+
+	for i := 0; i < 2; i++ {
+		if result, err = rs.ImportExternalConfig(ExternalSourceCCNexus, dir, "", false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 再次导入时已导入的路由保持不变，已有路由不会被删除
+	if result.Unchanged != 1 || len(result.Added) != 0 {
+		t.Fatalf("second import = %+v, want the imported route unchanged", result.RouteImportResult)
+	}
+	if routes, _ := rs.GetAllRoutes(); len(routes) != 2 {
+		t.Fatalf("routes after import = %d, want 2", len(routes))
+	}
+
+	if _, err := rs.ImportExternalConfig("other-tool", dir, "", true); err == nil {
+		t.Fatal("unsupported source should be rejected")
+	}
+	if _, err := rs.ImportExternalConfig(ExternalSourceCodeSwitch, dir, "", true); err == nil {
+		t.Fatal("directory without code-switch files should be rejected")
+	}
+}
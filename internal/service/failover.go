@@ -0,0 +1,254 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+
+	"openai-router-go/internal/config"
+	"openai-router-go/internal/database"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// 故障转移默认配置
+const (
+	DefaultFailoverMaxRetries = 2
+)
+
+// DefaultFailoverStatusCodes 默认触发故障转移的上游状态码
+var DefaultFailoverStatusCodes = []int{
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// requestBuilder 根据候选路由构建上游请求
+// 每次故障转移都会用新的路由重新调用，因此适配器、URL 和请求头都需要在这里按路由计算
+type requestBuilder func(route *database.ModelRoute) (*http.Request, error)
+
+// isRetryableStatus 判断上游状态码是否应该切换到下一条路由
+func (s *ProxyService) isRetryableStatus(statusCode int) bool {
+	_, _, codes := s.GetFailoverConfig()
+	for _, code := range codes {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// maxFailoverAttempts 单个请求最多尝试的路由数量（包含第一次）
+func (s *ProxyService) maxFailoverAttempts() int {
+	enabled, maxRetries, _ := s.GetFailoverConfig()
+	if !enabled || maxRetries < 0 {
+		return 1
+	}
+	return maxRetries + 1
+}
+
+// GetFailoverConfig 获取故障转移配置，未配置状态码时返回默认状态码列表；返回的切片不可修改
+func (s *ProxyService) GetFailoverConfig() (enabled bool, maxRetries int, statusCodes []int) {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	statusCodes = s.config.FailoverStatusCodes
+	if len(statusCodes) == 0 {
+		statusCodes = DefaultFailoverStatusCodes
+	}
+	return s.config.FailoverEnabled, s.config.FailoverMaxRetries, statusCodes
+}
+
+// SetFailoverConfig 更新故障转移配置并保存
+// statusCodes 为空时使用默认状态码列表
+func (s *ProxyService) SetFailoverConfig(enabled bool, maxRetries int, statusCodes []int) error {
+	if maxRetries < 0 {
+		return fmt.Errorf("invalid max retries: %d", maxRetries)
+	}
+	for _, code := range statusCodes {
+		if code < 100 || code > 599 {
+			return fmt.Errorf("invalid status code: %d", code)
+		}
+	}
+	if len(statusCodes) == 0 {
+		statusCodes = DefaultFailoverStatusCodes
+	}
+	// 保存副本，调用方之后修改传入的切片不会影响配置
+	statusCodes = append([]int(nil), statusCodes...)
+
+	return s.UpdateConfig(func(cfg *config.Config) {
+		cfg.FailoverEnabled = enabled
+		cfg.FailoverMaxRetries = maxRetries
+		cfg.FailoverStatusCodes = statusCodes
+	})
+}
+
+// sendWithFailover 发送上游请求，遇到连接错误或可重试状态码时切换到同模型的下一条路由
+// 返回的 route 为最终发出请求的路由，调用方用它记录日志和转换响应；除最后一次以外的失败尝试在这里写入 request_logs
+func (s *ProxyService) sendWithFailover(model string, route *database.ModelRoute, trace *requestTrace, build requestBuilder) (*http.Response, *database.ModelRoute, error) {
+	maxAttempts := s.maxFailoverAttempts()
+	tried := make(map[int64]bool)
+	var admitted int64 // 已通过限流的路由，换 Key 重试时不再重复计数
+	var acquired int64 // 已占用熔断器探测名额的路由，换 Key 重试时继续使用
+
+	for attempt := 1; ; attempt++ {
+		tried[route.ID] = true
+
+		if admitted != route.ID {
+			if err := s.waitRateLimit(route, trace); err != nil {
+				if !isRateLimitError(err) {
+					return nil, route, err
+				}
+				next, selectErr := s.selectRoute(model, trace, tried)
+				if selectErr != nil {
+					trace.setErrorType(ErrorTypeRateLimited)
+					log.Warnf("[RateLimit] %v; no other route available for model %s", err, model)
+					return nil, route, err
+				}
+				log.Warnf("[RateLimit] %v; spilling over to route %s (id=%d)", err, next.Name, next.ID)
+				route = next
+				attempt--
+				continue
+			}
+			admitted = route.ID
+		}
+
+		keys := s.routeKeyPool(route)
+		key := s.keyPool.Pick(route.ID, keys, s.keyRotationStrategy())
+		keyedRoute := *route
+		apiKey, err := s.revealAPIKey(key.apiKey)
+		if err != nil {
+			// Key 不可用时请求不会发出，按路由故障记录并尝试下一条路由
+			err = fmt.Errorf("api key of route %s (id=%d) is unavailable: %v", route.Name, route.ID, err)
+			trace.begin()
+			trace.setErrorType(ErrorTypeAPIKey)
+			s.rateLimiter.Refund(route.ID, trace.estimated)
+			if trace.test == nil {
+				s.breaker.RecordFailure(route.ID)
+			}
+			log.Errorf("[KeyPool] %v", err)
+			if attempt >= maxAttempts {
+				return nil, route, err
+			}
+			next, selectErr := s.selectRoute(model, trace, tried)
+			if selectErr != nil {
+				return nil, route, err
+			}
+			s.logRequest(model, route.ID, trace, 0, 0, 0, false, err.Error())
+			route = next
+			continue
+		}
+		keyedRoute.APIKey = apiKey
+
+		proxyReq, err := build(&keyedRoute)
+		if err == nil {
+			err = applyRouteExtras(proxyReq, route)
+		}
+		var client *http.Client
+		if err == nil {
+			client, err = s.transports.client(route.OutboundProxy)
+		}
+		if err != nil {
+			s.rateLimiter.Refund(route.ID, trace.estimated)
+			return nil, route, &requestBuildError{err: err}
+		}
+		// 半开路由的探测名额在请求真正发出前才占用，因限流、Key 不可用等原因没有发出的请求不会占住名额
+		if trace.test == nil && acquired != route.ID && !s.breaker.Acquire(route.ID) {
+			s.rateLimiter.Cancel(route.ID, trace.estimated)
+			next, selectErr := s.selectRoute(model, trace, tried)
+			if selectErr != nil {
+				return nil, route, fmt.Errorf("route %s (id=%d) is half-open and its probe request is already in flight", route.Name, route.ID)
+			}
+			log.Infof("[CircuitBreaker] Probe of route %s (id=%d) already in flight; switching to route %s (id=%d)", route.Name, route.ID, next.Name, next.ID)
+			route = next
+			attempt--
+			continue
+		}
+		acquired = route.ID
+		proxyReq, deadline := withRouteTimeouts(proxyReq, route)
+
+		trace.begin()
+		resp, err := client.Do(proxyReq)
+		if err = deadline.responded(err); err != nil {
+			if errorType := timeoutErrorType(err); errorType != "" {
+				trace.setErrorType(errorType)
+				log.Warnf("[Timeout] Route %s (id=%d): %v", route.Name, route.ID, err)
+			}
+		}
+		trace.attach(resp, deadline)
+		if trace.test == nil {
+			s.keyPool.Record(route.ID, key.id, resp, s.keyCooldown())
+		}
+		if err == nil && trace.test == nil && len(keys) > 1 && isKeyRejected(resp.StatusCode) && s.keyPool.HasAvailable(route.ID, keys) {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			failure := fmt.Sprintf("backend error: %d - %s", resp.StatusCode, string(body))
+			s.logRequest(model, route.ID, trace, 0, 0, 0, false, failure)
+			log.Warnf("[KeyPool] Key %d of route %s (id=%d) rejected with status %d; retrying with another key",
+				key.id, route.Name, route.ID, resp.StatusCode)
+			attempt--
+			continue
+		}
+
+		var failure string
+		if err != nil {
+			failure = err.Error()
+		} else if s.isRetryableStatus(resp.StatusCode) {
+			// 读出响应体，以便最后一次失败时调用方仍能拿到完整的错误信息
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			resp.Body = &timedBody{ReadCloser: io.NopCloser(bytes.NewReader(body)), trace: trace}
+			failure = fmt.Sprintf("backend error: %d - %s", resp.StatusCode, string(body))
+		} else {
+			if trace.test == nil {
+				s.breaker.RecordSuccess(route.ID)
+			}
+			if resp.StatusCode < http.StatusBadRequest {
+				s.rememberAffinity(trace, route)
+			} else {
+				s.rateLimiter.Refund(route.ID, trace.estimated)
+			}
+			return resp, route, nil
+		}
+		if trace.test == nil {
+			s.breaker.RecordFailure(route.ID)
+		}
+		s.rateLimiter.Refund(route.ID, trace.estimated)
+
+		if attempt >= maxAttempts {
+			return resp, route, err
+		}
+
+		next, selectErr := s.selectRoute(model, trace, tried)
+		if selectErr != nil {
+			log.Warnf("[Failover] No more routes for model %s after %d attempt(s): %v", model, attempt, selectErr)
+			return resp, route, err
+		}
+
+		s.logRequest(model, route.ID, trace, 0, 0, 0, false, failure)
+		log.Warnf("[Failover] Route %s (id=%d) failed for model %s: %s; retrying with route %s (id=%d), attempt %d/%d",
+			route.Name, route.ID, model, failure, next.Name, next.ID, attempt+1, maxAttempts)
+		route = next
+	}
+}
+
+// requestBuildError 构建上游请求失败（如适配器转换失败），不属于上游故障，不会触发故障转移
+type requestBuildError struct {
+	err error
+}
+
+func (e *requestBuildError) Error() string {
+	return e.err.Error()
+}
+
+func (e *requestBuildError) Unwrap() error {
+	return e.err
+}
+
+// isRequestBuildError 判断错误是否来自请求构建阶段
+func isRequestBuildError(err error) bool {
+	_, ok := err.(*requestBuildError)
+	return ok
+}
@@ -0,0 +1,228 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"openai-router-go/internal/database"
+)
+
+// testUpstream 返回固定状态码的上游，并统计收到的请求数
+func testUpstream(t *testing.T, status int) (*httptest.Server, *int32) {
+	t.Helper()
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(status)
+		w.Write([]byte(`{"status":` + http.StatusText(status) + `}`))
+	}))
+	t.Cleanup(server.Close)
+	return server, &hits
+}
+
+func testRequestBuilder(route *database.ModelRoute) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodPost, route.APIUrl+"/v1/chat/completions", strings.NewReader(`{}`))
+	if err == nil && route.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+route.APIKey)
+	}
+	return req, err
+}
+
+// sendTestRequest 按正常请求的流程选路并发送
+func sendTestRequest(t *testing.T, s *ProxyService, model string) (*http.Response, *database.ModelRoute, error) {
+	t.Helper()
+	trace := s.traceRequest(context.Background(), nil)
+	route, err := s.selectRoute(model, trace, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, route, err := s.sendWithFailover(model, route, trace, testRequestBuilder)
+	if resp != nil {
+		t.Cleanup(func() { resp.Body.Close() })
+	}
+	return resp, route, err
+}
+
+func TestIsRetryableStatus(t *testing.T) {
+	s := newTestProxyService(t)
+
+	s.config.FailoverStatusCodes = nil
+	for status, want := range map[int]bool{
+		http.StatusTooManyRequests:     true,
+		http.StatusInternalServerError: true,
+		http.StatusBadGateway:          true,
+		http.StatusServiceUnavailable:  true,
+		http.StatusGatewayTimeout:      true,
+		http.StatusOK:                  false,
+		http.StatusBadRequest:          false,
+		http.StatusUnauthorized:        false,
+		http.StatusNotImplemented:      false,
+	} {
+		if got := s.isRetryableStatus(status); got != want {
+			t.Errorf("default codes: isRetryableStatus(%d) = %v, want %v", status, got, want)
+		}
+	}
+
+	s.config.FailoverStatusCodes = []int{http.StatusNotFound}
+	if !s.isRetryableStatus(http.StatusNotFound) || s.isRetryableStatus(http.StatusServiceUnavailable) {
+		t.Fatal("configured status codes should replace the default list")
+	}
+}
+
+func TestSetFailoverConfig(t *testing.T) {
+	s := newTestProxyService(t)
+	if err := s.SetFailoverConfig(true, -1, nil); err == nil {
+		t.Fatal("negative max retries should be rejected")
+	}
+	if err := s.SetFailoverConfig(true, 1, []int{503, 99}); err == nil {
+		t.Fatal("invalid status codes should be rejected")
+	}
+
+	codes := []int{http.StatusBadGateway}
+	if err := s.SetFailoverConfig(true, 3, codes); err != nil {
+		t.Fatal(err)
+	}
+	codes[0] = http.StatusOK
+	enabled, maxRetries, statusCodes := s.GetFailoverConfig()
+	if !enabled || maxRetries != 3 || len(statusCodes) != 1 || statusCodes[0] != http.StatusBadGateway {
+		t.Fatalf("GetFailoverConfig() = %v, %d, %v; want true, 3, [502]", enabled, maxRetries, statusCodes)
+	}
+	if s.maxFailoverAttempts() != 4 {
+		t.Fatalf("maxFailoverAttempts() = %d, want 4", s.maxFailoverAttempts())
+	}
+
+	if err := s.SetFailoverConfig(false, 3, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, statusCodes := s.GetFailoverConfig(); len(statusCodes) != len(DefaultFailoverStatusCodes) {
+		t.Fatalf("empty status codes should restore the defaults, got %v", statusCodes)
+	}
+	if s.maxFailoverAttempts() != 1 {
+		t.Fatalf("maxFailoverAttempts() with failover disabled = %d, want 1", s.maxFailoverAttempts())
+	}
+}
+
+func TestSendWithFailoverSwitchesRoutes(t *testing.T) {
+	s := newTestProxyService(t)
+	s.config.FailoverEnabled = true
+	s.config.FailoverMaxRetries = 2
+
+	failing, failingHits := testUpstream(t, http.StatusServiceUnavailable)
+	healthy, healthyHits := testUpstream(t, http.StatusOK)
+	addTestRoute(t, s.routeService, database.ModelRoute{Name: "primary", Model: "gpt-4o", APIUrl: failing.URL})
+	backup := addTestRoute(t, s.routeService, database.ModelRoute{Name: "backup", Model: "gpt-4o", APIUrl: healthy.URL, Priority: 1})
+
+	resp, route, err := sendTestRequest(t, s, "gpt-4o")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || route.ID != backup.ID {
+		t.Fatalf("got status %d from route %d, want 200 from the backup route %d", resp.StatusCode, route.ID, backup.ID)
+	}
+	if *failingHits != 1 || *healthyHits != 1 {
+		t.Fatalf("upstream hits = %d failing, %d healthy; want 1 each", *failingHits, *healthyHits)
+	}
+}
+
+func TestSendWithFailoverSwitchesOnConnectionError(t *testing.T) {
+	s := newTestProxyService(t)
+	s.config.FailoverEnabled = true
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	healthy, _ := testUpstream(t, http.StatusOK)
+	addTestRoute(t, s.routeService, database.ModelRoute{Name: "down", Model: "gpt-4o", APIUrl: closed.URL})
+	backup := addTestRoute(t, s.routeService, database.ModelRoute{Name: "backup", Model: "gpt-4o", APIUrl: healthy.URL, Priority: 1})
+
+	resp, route, err := sendTestRequest(t, s, "gpt-4o")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || route.ID != backup.ID {
+		t.Fatalf("got status %d from route %d, want 200 from the backup route %d", resp.StatusCode, route.ID, backup.ID)
+	}
+}
+
+func TestSendWithFailoverRetriesRejectedKey(t *testing.T) {
+	s := newTestProxyService(t)
+	// Key 被拒绝后在同一路由上换 Key 重试，不算故障转移次数
+	s.config.FailoverEnabled = false
+
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		if r.Header.Get("Authorization") != "Bearer sk-valid" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	route := addTestRoute(t, s.routeService, database.ModelRoute{Name: "pooled", Model: "gpt-4o", APIUrl: server.URL, APIKey: "sk-revoked"})
+	if _, err := s.routeService.AddRouteKey(route.ID, "valid", "sk-valid"); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, got, err := sendTestRequest(t, s, "gpt-4o")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || got.ID != route.ID || hits != 2 {
+		t.Fatalf("got status %d from route %d after %d request(s), want 200 from route %d after 2", resp.StatusCode, got.ID, hits, route.ID)
+	}
+	usage := s.GetRouteKeyUsage(route.ID, []int64{PrimaryKeyID})
+	if usage[0].Unauthorized != 1 || !usage[0].CooldownUntil.After(time.Now()) {
+		t.Fatalf("rejected key usage = %+v, want one 401 and an active cooldown", usage[0])
+	}
+}
+
+func TestSendWithFailoverStops(t *testing.T) {
+	tests := []struct {
+		name       string
+		enabled    bool
+		maxRetries int
+		status     int
+		wantHits   []int32 // 各条路由收到的请求数
+	}{
+		{"disabled", false, 2, http.StatusServiceUnavailable, []int32{1, 0, 0}},
+		{"non-retryable status", true, 2, http.StatusBadRequest, []int32{1, 0, 0}},
+		{"max retries reached", true, 1, http.StatusServiceUnavailable, []int32{1, 1, 0}},
+		{"all routes failed", true, 5, http.StatusServiceUnavailable, []int32{1, 1, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestProxyService(t)
+			s.config.FailoverEnabled = tt.enabled
+			s.config.FailoverMaxRetries = tt.maxRetries
+
+			hits := make([]*int32, 3)
+			var last *database.ModelRoute
+			for i := range hits {
+				var server *httptest.Server
+				server, hits[i] = testUpstream(t, tt.status)
+				last = addTestRoute(t, s.routeService, database.ModelRoute{Name: "route", Model: "gpt-4o", APIUrl: server.URL, Priority: i})
+			}
+
+			resp, route, err := sendTestRequest(t, s, "gpt-4o")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status = %d, want the last upstream status %d", resp.StatusCode, tt.status)
+			}
+			for i, want := range tt.wantHits {
+				if got := atomic.LoadInt32(hits[i]); got != want {
+					t.Fatalf("route %d received %d request(s), want %d", i, got, want)
+				}
+			}
+			if tt.name == "all routes failed" && route.ID != last.ID {
+				t.Fatalf("returned route %d, want the last route tried (%d)", route.ID, last.ID)
+			}
+		})
+	}
+}
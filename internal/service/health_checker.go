@@ -0,0 +1,409 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"openai-router-go/internal/config"
+	"openai-router-go/internal/database"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// 健康检查状态
+const (
+	HealthStatusHealthy   = "healthy"
+	HealthStatusUnhealthy = "unhealthy"
+	HealthStatusUnknown   = "unknown" // 尚未检查
+)
+
+// 健康检查方式
+const (
+	HealthCheckMethodModels     = "models"     // 请求上游模型列表接口
+	HealthCheckMethodCompletion = "completion" // 发送 max_tokens=1 的补全请求
+)
+
+// 健康检查默认参数
+const (
+	DefaultHealthCheckInterval = 5 * time.Minute
+	DefaultHealthCheckTimeout  = 15 * time.Second
+	healthCheckConcurrency     = 4
+	healthHistoryRetentionDays = 7
+)
+
+// HealthChecker 后台定时探测所有启用的路由，结果写入 route_health 表
+type HealthChecker struct {
+	routeService *RouteService
+	config       *config.Config
+	transports   *transportPool // 与代理请求共用，探测同样经过路由的出站代理
+	keys         *database.KeyCipher
+	secrets      *SecretResolver
+
+	mu      sync.RWMutex
+	latest  map[int64]database.RouteHealth // routeID -> 最近一次检查结果
+	stopCh  chan struct{}
+	running bool
+}
+
+// NewHealthChecker 创建健康检查器
+func NewHealthChecker(routeService *RouteService, cfg *config.Config, transports *transportPool, keys *database.KeyCipher, secrets *SecretResolver) *HealthChecker {
+	return &HealthChecker{
+		routeService: routeService,
+		config:       cfg,
+		transports:   transports,
+		keys:         keys,
+		secrets:      secrets,
+		latest:       make(map[int64]database.RouteHealth),
+	}
+}
+
+func (hc *HealthChecker) interval() time.Duration {
+	if hc.config.HealthCheckIntervalSeconds > 0 {
+		return time.Duration(hc.config.HealthCheckIntervalSeconds) * time.Second
+	}
+	return DefaultHealthCheckInterval
+}
+
+func (hc *HealthChecker) timeout() time.Duration {
+	if hc.config.HealthCheckTimeoutSeconds > 0 {
+		return time.Duration(hc.config.HealthCheckTimeoutSeconds) * time.Second
+	}
+	return DefaultHealthCheckTimeout
+}
+
+// Start 启动后台调度，配置中关闭健康检查时调度仍在运行但跳过探测，便于运行时开关
+func (hc *HealthChecker) Start() {
+	hc.mu.Lock()
+	if hc.running {
+		hc.mu.Unlock()
+		return
+	}
+	hc.running = true
+	hc.stopCh = make(chan struct{})
+	stopCh := hc.stopCh
+	hc.mu.Unlock()
+
+	// 载入上次运行保存的结果，避免重启后所有路由都处于未知状态；健康检查关闭时旧结果已不可信，不载入
+	if hc.config.HealthCheckEnabled {
+		hc.loadLatest()
+	}
+
+	go func() {
+		log.Infof("[HealthCheck] Scheduler started")
+		for {
+			if hc.config.HealthCheckEnabled {
+				hc.CheckAll()
+			}
+
+			select {
+			case <-stopCh:
+				log.Infof("[HealthCheck] Scheduler stopped")
+				return
+			case <-time.After(hc.interval()):
+			}
+		}
+	}()
+}
+
+// Stop 停止后台调度
+func (hc *HealthChecker) Stop() {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	if !hc.running {
+		return
+	}
+	close(hc.stopCh)
+	hc.running = false
+}
+
+// loadLatest 从数据库载入每条路由最近一次的检查结果
+func (hc *HealthChecker) loadLatest() {
+	latest, err := hc.routeService.GetLatestRouteHealth()
+	if err != nil {
+		log.Warnf("[HealthCheck] Failed to load previous health records: %v", err)
+		return
+	}
+	hc.mu.Lock()
+	for routeID, record := range latest {
+		hc.latest[routeID] = record
+	}
+	hc.mu.Unlock()
+}
+
+// CheckAll 探测所有启用的路由
+func (hc *HealthChecker) CheckAll() {
+	routes, err := hc.routeService.GetAllRoutes()
+	if err != nil {
+		log.Errorf("[HealthCheck] Failed to load routes: %v", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, healthCheckConcurrency)
+	checked := 0
+	for i := range routes {
+		if !routes[i].Enabled {
+			continue
+		}
+		checked++
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(route *database.ModelRoute) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			hc.CheckRoute(route)
+		}(&routes[i])
+	}
+	wg.Wait()
+
+	if err := hc.routeService.CleanRouteHealth(healthHistoryRetentionDays); err != nil {
+		log.Warnf("[HealthCheck] Failed to clean old health records: %v", err)
+	}
+	log.Infof("[HealthCheck] Checked %d route(s)", checked)
+}
+
+// CheckRoute 探测单条路由并记录结果
+func (hc *HealthChecker) CheckRoute(route *database.ModelRoute) database.RouteHealth {
+	start := time.Now()
+	err := hc.probe(route)
+	latency := time.Since(start).Milliseconds()
+
+	record := database.RouteHealth{
+		RouteID:   route.ID,
+		Status:    HealthStatusHealthy,
+		LatencyMs: latency,
+		CheckedAt: time.Now(),
+	}
+	if err != nil {
+		record.Status = HealthStatusUnhealthy
+		record.ErrorMessage = err.Error()
+		log.Warnf("[HealthCheck] Route %s (id=%d) unhealthy: %v", route.Name, route.ID, err)
+	}
+
+	hc.mu.Lock()
+	hc.latest[route.ID] = record
+	hc.mu.Unlock()
+
+	hc.routeService.LogRouteHealth(record.RouteID, record.Status, record.LatencyMs, record.ErrorMessage)
+	return record
+}
+
+// IsHealthy 判断路由是否健康，未检查过的路由视为健康；健康检查关闭时所有路由都视为健康
+func (hc *HealthChecker) IsHealthy(routeID int64) bool {
+	if !hc.config.HealthCheckEnabled {
+		return true
+	}
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+	record, ok := hc.latest[routeID]
+	return !ok || record.Status != HealthStatusUnhealthy
+}
+
+// Latest 获取单条路由最近一次的检查结果
+func (hc *HealthChecker) Latest(routeID int64) (database.RouteHealth, bool) {
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+	record, ok := hc.latest[routeID]
+	return record, ok
+}
+
+// Reset 清除所有路由的检查结果（关闭健康检查时调用，重新开启后从头检查）
+func (hc *HealthChecker) Reset() {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	hc.latest = make(map[int64]database.RouteHealth)
+}
+
+// Forget 清除路由的检查结果（路由被删除或修改时调用）
+func (hc *HealthChecker) Forget(routeID int64) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	delete(hc.latest, routeID)
+}
+
+// probe 按路由格式向上游发送探测请求，2xx 视为健康
+// 通配符或正则路由没有配置 upstream_model 时没有可以发送的模型名，补全探测改用模型列表探测
+func (hc *HealthChecker) probe(route *database.ModelRoute) error {
+	route, err := keyRevealedRoute(hc.keys, hc.secrets, route)
+	if err != nil {
+		return err
+	}
+	format := normalizeFormat(route.Format)
+	if strings.TrimSpace(route.Format) == "" {
+		format = inferFormatFromRoute(route.APIUrl, route.Model)
+	}
+
+	var req *http.Request
+	if hc.config.HealthCheckMethod == HealthCheckMethodCompletion && (!IsModelPattern(route.Model) || route.UpstreamModel != "") {
+		req, err = buildCompletionProbe(route, format)
+	} else {
+		req, err = buildModelsProbe(route, format)
+	}
+	if err != nil {
+		return err
+	}
+	setProbeAuth(req, route, format)
+	if headers, err := parseExtraHeaders(route.ExtraHeaders); err == nil {
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+	}
+
+	transport, err := hc.transports.get(route.OutboundProxy)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: hc.timeout(), Transport: transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		if msg := strings.TrimSpace(string(body)); msg != "" {
+			return fmt.Errorf("status %d: %s", resp.StatusCode, msg)
+		}
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// buildModelsProbe 构建模型列表探测请求
+func buildModelsProbe(route *database.ModelRoute, format string) (*http.Request, error) {
+	var url string
+	switch format {
+	case "claude":
+		url = strings.TrimSuffix(buildClaudeMessagesURL(route.APIUrl), "messages") + "models"
+	case "gemini":
+		url = strings.TrimSuffix(route.APIUrl, "/") + "/v1beta/models"
+	default:
+		url = strings.TrimSuffix(buildOpenAIChatURL(route.APIUrl), "chat/completions") + "models"
+	}
+	return http.NewRequest("GET", url, nil)
+}
+
+// buildCompletionProbe 构建只生成 1 个 token 的补全探测请求
+func buildCompletionProbe(route *database.ModelRoute, format string) (*http.Request, error) {
+	var url string
+	var payload map[string]interface{}
+	switch format {
+	case "claude":
+		url = buildClaudeMessagesURL(route.APIUrl)
+		payload = map[string]interface{}{
+			"model":      upstreamModelName(route, route.Model),
+			"max_tokens": 1,
+			"messages":   []map[string]string{{"role": "user", "content": "ping"}},
+		}
+	case "gemini":
+		url = fmt.Sprintf("%s/v1beta/models/%s:generateContent", strings.TrimSuffix(route.APIUrl, "/"), upstreamModelName(route, route.Model))
+		payload = map[string]interface{}{
+			"contents":         []map[string]interface{}{{"role": "user", "parts": []map[string]string{{"text": "ping"}}}},
+			"generationConfig": map[string]interface{}{"maxOutputTokens": 1},
+		}
+	default:
+		url = buildOpenAIChatURL(route.APIUrl)
+		payload = map[string]interface{}{
+			"model":      upstreamModelName(route, route.Model),
+			"max_tokens": 1,
+			"messages":   []map[string]string{{"role": "user", "content": "ping"}},
+		}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// setProbeAuth 按路由格式设置认证头
+func setProbeAuth(req *http.Request, route *database.ModelRoute, format string) {
+	if route.APIKey == "" {
+		return
+	}
+	switch format {
+	case "claude":
+		req.Header.Set("x-api-key", route.APIKey)
+		req.Header.Set("anthropic-version", "2023-06-01")
+	case "gemini":
+		req.Header.Set("x-goog-api-key", route.APIKey)
+	default:
+		req.Header.Set("Authorization", "Bearer "+route.APIKey)
+	}
+}
+
+// StartHealthChecker 启动后台健康检查
+func (s *ProxyService) StartHealthChecker() {
+	s.healthChecker.Start()
+}
+
+// StopHealthChecker 停止后台健康检查
+func (s *ProxyService) StopHealthChecker() {
+	s.healthChecker.Stop()
+}
+
+// CheckRouteHealth 立即探测单条路由
+func (s *ProxyService) CheckRouteHealth(routeID int64) (database.RouteHealth, error) {
+	route, err := s.routeService.GetRouteByID(routeID)
+	if err != nil {
+		return database.RouteHealth{}, err
+	}
+	return s.healthChecker.CheckRoute(route), nil
+}
+
+// GetRouteHealthStatus 获取路由最近一次的健康状态
+func (s *ProxyService) GetRouteHealthStatus(routeID int64) string {
+	record, ok := s.healthChecker.Latest(routeID)
+	if !ok {
+		return HealthStatusUnknown
+	}
+	return record.Status
+}
+
+// ForgetRouteHealth 清除路由在内存中的健康状态
+func (s *ProxyService) ForgetRouteHealth(routeID int64) {
+	s.healthChecker.Forget(routeID)
+}
+
+// SetHealthCheckConfig 更新健康检查配置并保存
+func (s *ProxyService) SetHealthCheckConfig(enabled bool, intervalSeconds int, method string, skipUnhealthy bool) error {
+	if intervalSeconds < 10 {
+		return fmt.Errorf("health check interval must be at least 10 seconds")
+	}
+	if method != HealthCheckMethodModels && method != HealthCheckMethodCompletion {
+		return fmt.Errorf("invalid health check method: %s", method)
+	}
+
+	var wasEnabled bool
+	err := s.UpdateConfig(func(cfg *config.Config) {
+		wasEnabled = cfg.HealthCheckEnabled
+		cfg.HealthCheckEnabled = enabled
+		cfg.HealthCheckIntervalSeconds = intervalSeconds
+		cfg.HealthCheckMethod = method
+		cfg.HealthCheckSkipUnhealthy = skipUnhealthy
+	})
+	if err != nil {
+		return err
+	}
+
+	// 刚开启时立即检查一轮，不必等待下一个调度周期；关闭时丢弃已有结果，避免重新开启前沿用过期的状态
+	if enabled && !wasEnabled {
+		go s.healthChecker.CheckAll()
+	} else if !enabled && wasEnabled {
+		s.healthChecker.Reset()
+	}
+	return nil
+}
@@ -0,0 +1,333 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"openai-router-go/internal/config"
+	"openai-router-go/internal/database"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Key 轮换策略
+const (
+	KeyRotationRoundRobin = "round_robin" // 按顺序轮流使用
+	KeyRotationLeastUsed  = "least_used"  // 使用请求次数最少的 Key
+)
+
+// DefaultKeyCooldown Key 返回 401/429 后的默认冷却时间，配置值非法时使用
+const DefaultKeyCooldown = 60 * time.Second
+
+// PrimaryKeyID 路由自身 APIKey 在轮换池中的 ID，附加 Key 使用 route_keys 表中的 ID
+const PrimaryKeyID int64 = 0
+
+// KeyUsage 单个 API Key 的使用统计，只保存在内存中
+type KeyUsage struct {
+	RouteID       int64     `json:"route_id"`
+	KeyID         int64     `json:"key_id"`
+	Requests      int64     `json:"requests"`
+	Failures      int64     `json:"failures"`
+	Unauthorized  int64     `json:"unauthorized"` // 上游返回 401 的次数
+	RateLimited   int64     `json:"rate_limited"` // 上游返回 429 的次数
+	LastStatus    int       `json:"last_status"`  // 最近一次响应状态码，0 表示连接失败或未使用
+	LastUsedAt    time.Time `json:"last_used_at"`
+	CooldownUntil time.Time `json:"cooldown_until"`
+}
+
+// poolKey 轮换池中的一个 Key
+type poolKey struct {
+	id     int64
+	apiKey string
+}
+
+// keyRef 标识某条路由下的某个 Key
+type keyRef struct {
+	routeID int64
+	keyID   int64
+}
+
+// KeyPool 按路由维护 API Key 的轮换位置、冷却时间和使用统计，并缓存各路由启用的附加 Key
+type KeyPool struct {
+	mu         sync.Mutex
+	usage      map[keyRef]*KeyUsage
+	next       map[int64]int       // 每条路由的轮询位置
+	extra      map[int64][]poolKey // 每条路由启用的附加 Key，首次使用时从数据库加载
+	generation uint64              // 附加 Key 缓存失效的次数，加载期间缓存被清除时不保存加载结果
+}
+
+// NewKeyPool 创建 Key 轮换池
+func NewKeyPool() *KeyPool {
+	return &KeyPool{
+		usage: make(map[keyRef]*KeyUsage),
+		next:  make(map[int64]int),
+		extra: make(map[int64][]poolKey),
+	}
+}
+
+// cachedExtra 获取缓存的附加 Key，没有缓存时同时返回当前的缓存版本，供加载后调用 storeExtra
+func (kp *KeyPool) cachedExtra(routeID int64) ([]poolKey, uint64, bool) {
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+	keys, ok := kp.extra[routeID]
+	return keys, kp.generation, ok
+}
+
+// storeExtra 缓存从数据库加载的附加 Key；加载期间缓存被清除过时放弃，下次请求重新加载
+func (kp *KeyPool) storeExtra(routeID int64, keys []poolKey, generation uint64) {
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+	if kp.generation == generation {
+		kp.extra[routeID] = keys
+	}
+}
+
+// dropExtra 清除路由的附加 Key 缓存，调用方需持有锁
+func (kp *KeyPool) dropExtra(routeID int64) {
+	delete(kp.extra, routeID)
+	kp.generation++
+}
+
+func (kp *KeyPool) get(routeID, keyID int64) *KeyUsage {
+	ref := keyRef{routeID: routeID, keyID: keyID}
+	u, ok := kp.usage[ref]
+	if !ok {
+		u = &KeyUsage{RouteID: routeID, KeyID: keyID}
+		kp.usage[ref] = u
+	}
+	return u
+}
+
+// available 过滤掉冷却中的 Key，调用方需持有锁
+func (kp *KeyPool) available(routeID int64, keys []poolKey, now time.Time) []poolKey {
+	result := make([]poolKey, 0, len(keys))
+	for _, k := range keys {
+		if u, ok := kp.usage[keyRef{routeID: routeID, keyID: k.id}]; ok && now.Before(u.CooldownUntil) {
+			continue
+		}
+		result = append(result, k)
+	}
+	return result
+}
+
+// Pick 按策略选择一个未在冷却中的 Key
+// 所有 Key 都在冷却时选择最早结束冷却的 Key，由上游决定是否仍然拒绝
+func (kp *KeyPool) Pick(routeID int64, keys []poolKey, strategy string) poolKey {
+	if len(keys) == 1 {
+		return keys[0]
+	}
+
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+
+	now := time.Now()
+	candidates := kp.available(routeID, keys, now)
+	if len(candidates) == 0 {
+		best := keys[0]
+		for _, k := range keys[1:] {
+			if kp.get(routeID, k.id).CooldownUntil.Before(kp.get(routeID, best.id).CooldownUntil) {
+				best = k
+			}
+		}
+		return best
+	}
+
+	if strategy == KeyRotationLeastUsed {
+		best := candidates[0]
+		for _, k := range candidates[1:] {
+			if kp.get(routeID, k.id).Requests < kp.get(routeID, best.id).Requests {
+				best = k
+			}
+		}
+		return best
+	}
+
+	n := kp.next[routeID]
+	kp.next[routeID] = n + 1
+	return candidates[n%len(candidates)]
+}
+
+// HasAvailable 判断路由是否还有未在冷却中的 Key
+func (kp *KeyPool) HasAvailable(routeID int64, keys []poolKey) bool {
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+	return len(kp.available(routeID, keys, time.Now())) > 0
+}
+
+// Record 记录一次请求结果，401/429 时让该 Key 进入冷却
+// 429 响应带有 Retry-After 时以其为准
+func (kp *KeyPool) Record(routeID, keyID int64, resp *http.Response, cooldown time.Duration) {
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+
+	u := kp.get(routeID, keyID)
+	u.Requests++
+	u.LastUsedAt = time.Now()
+	if resp == nil {
+		u.Failures++
+		u.LastStatus = 0
+		return
+	}
+
+	u.LastStatus = resp.StatusCode
+	if resp.StatusCode >= 400 {
+		u.Failures++
+	}
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		u.Unauthorized++
+	case http.StatusTooManyRequests:
+		u.RateLimited++
+		if retryAfter := parseRetryAfter(resp.Header.Get("Retry-After")); retryAfter > 0 {
+			cooldown = retryAfter
+		}
+	default:
+		return
+	}
+	u.CooldownUntil = u.LastUsedAt.Add(cooldown)
+	log.Warnf("[KeyPool] Key %d of route %d got status %d, cooling down until %s",
+		keyID, routeID, resp.StatusCode, u.CooldownUntil.Format("15:04:05"))
+}
+
+// Usage 获取路由下各个 Key 的使用统计
+func (kp *KeyPool) Usage(routeID int64, keyIDs []int64) []KeyUsage {
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+
+	result := make([]KeyUsage, 0, len(keyIDs))
+	for _, id := range keyIDs {
+		if u, ok := kp.usage[keyRef{routeID: routeID, keyID: id}]; ok {
+			result = append(result, *u)
+		} else {
+			result = append(result, KeyUsage{RouteID: routeID, KeyID: id})
+		}
+	}
+	return result
+}
+
+// Forget 清除路由下所有 Key 的统计和冷却状态
+func (kp *KeyPool) Forget(routeID int64) {
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+	for ref := range kp.usage {
+		if ref.routeID == routeID {
+			delete(kp.usage, ref)
+		}
+	}
+	delete(kp.next, routeID)
+	kp.dropExtra(routeID)
+}
+
+// ForgetKey 清除单个 Key 的统计和冷却状态，附加 Key 被添加、删除或启用/禁用后调用，路由的附加 Key 会重新加载
+func (kp *KeyPool) ForgetKey(routeID, keyID int64) {
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+	delete(kp.usage, keyRef{routeID: routeID, keyID: keyID})
+	kp.dropExtra(routeID)
+}
+
+// parseRetryAfter 解析 Retry-After 响应头（秒数或 HTTP 日期）
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return time.Until(at)
+	}
+	return 0
+}
+
+// isKeyRejected 判断上游状态码是否表示当前 Key 不可用（认证失败或被限流）
+func isKeyRejected(statusCode int) bool {
+	return statusCode == http.StatusUnauthorized || statusCode == http.StatusTooManyRequests
+}
+
+// routeKeyPool 获取路由的 Key 轮换池：路由自身的 APIKey 加上启用的附加 Key
+// 附加 Key 从数据库加载后缓存在 KeyPool 中，由 ForgetRouteKeys / ForgetRouteKey 清除
+// 没有任何 Key 时返回一个空 Key，请求沿用原请求中的 Key
+func (s *ProxyService) routeKeyPool(route *database.ModelRoute) []poolKey {
+	keys := make([]poolKey, 0, 1)
+	if route.APIKey != "" {
+		keys = append(keys, poolKey{id: PrimaryKeyID, apiKey: route.APIKey})
+	}
+	keys = append(keys, s.routeExtraKeys(route.ID)...)
+
+	if len(keys) == 0 {
+		keys = append(keys, poolKey{id: PrimaryKeyID})
+	}
+	return keys
+}
+
+// routeExtraKeys 获取路由启用的附加 Key，优先使用缓存；加载失败时不缓存，下次请求重试
+func (s *ProxyService) routeExtraKeys(routeID int64) []poolKey {
+	cached, generation, ok := s.keyPool.cachedExtra(routeID)
+	if ok {
+		return cached
+	}
+
+	extra, err := s.routeService.GetRouteKeys(routeID)
+	if err != nil {
+		log.Warnf("[KeyPool] Failed to load keys for route %d: %v", routeID, err)
+		return nil
+	}
+	keys := make([]poolKey, 0, len(extra))
+	for _, k := range extra {
+		if k.Enabled {
+			keys = append(keys, poolKey{id: k.ID, apiKey: k.APIKey})
+		}
+	}
+	s.keyPool.storeExtra(routeID, keys, generation)
+	return keys
+}
+
+// keyRotationStrategy 当前的 Key 轮换策略
+func (s *ProxyService) keyRotationStrategy() string {
+	if s.config.KeyRotationStrategy == KeyRotationLeastUsed {
+		return KeyRotationLeastUsed
+	}
+	return KeyRotationRoundRobin
+}
+
+// keyCooldown Key 返回 401/429 后的冷却时间
+func (s *ProxyService) keyCooldown() time.Duration {
+	if s.config.KeyCooldownSeconds > 0 {
+		return time.Duration(s.config.KeyCooldownSeconds) * time.Second
+	}
+	return DefaultKeyCooldown
+}
+
+// SetKeyRotationConfig 更新 Key 轮换策略和冷却时间并保存
+func (s *ProxyService) SetKeyRotationConfig(strategy string, cooldownSeconds int) error {
+	if strategy != KeyRotationRoundRobin && strategy != KeyRotationLeastUsed {
+		return fmt.Errorf("invalid key rotation strategy: %s", strategy)
+	}
+	if cooldownSeconds <= 0 {
+		return fmt.Errorf("invalid key cooldown: %d", cooldownSeconds)
+	}
+
+	return s.UpdateConfig(func(cfg *config.Config) {
+		cfg.KeyRotationStrategy = strategy
+		cfg.KeyCooldownSeconds = cooldownSeconds
+	})
+}
+
+// GetRouteKeyUsage 获取路由各个 Key 的使用统计，路由自身的 APIKey 的 KeyID 为 0
+func (s *ProxyService) GetRouteKeyUsage(routeID int64, keyIDs []int64) []KeyUsage {
+	return s.keyPool.Usage(routeID, keyIDs)
+}
+
+// ForgetRouteKeys 清除路由在内存中的 Key 统计和冷却状态
+func (s *ProxyService) ForgetRouteKeys(routeID int64) {
+	s.keyPool.Forget(routeID)
+}
+
+// ForgetRouteKey 清除单个附加 Key 在内存中的统计和冷却状态，并重新加载路由的附加 Key
+func (s *ProxyService) ForgetRouteKey(routeID, keyID int64) {
+	s.keyPool.ForgetKey(routeID, keyID)
+}
@@ -0,0 +1,249 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"openai-router-go/internal/database"
+)
+
+var testKeys = []poolKey{{id: 0, apiKey: "sk-a"}, {id: 1, apiKey: "sk-b"}, {id: 2, apiKey: "sk-c"}}
+
+func testResponse(status int, header http.Header) *http.Response {
+	return &http.Response{StatusCode: status, Header: header}
+}
+
+// pickSequence 连续选择 n 次并记录成功响应
+func pickSequence(kp *KeyPool, strategy string, n int) []int64 {
+	var ids []int64
+	for i := 0; i < n; i++ {
+		key := kp.Pick(1, testKeys, strategy)
+		kp.Record(1, key.id, testResponse(http.StatusOK, nil), time.Minute)
+		ids = append(ids, key.id)
+	}
+	return ids
+}
+
+func equalIDs(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestKeyPoolRoundRobin(t *testing.T) {
+	kp := NewKeyPool()
+	if got := pickSequence(kp, KeyRotationRoundRobin, 5); !equalIDs(got, []int64{0, 1, 2, 0, 1}) {
+		t.Fatalf("round robin picks = %v, want [0 1 2 0 1]", got)
+	}
+	// 每条路由有各自的轮询位置
+	if key := kp.Pick(2, testKeys, KeyRotationRoundRobin); key.id != 0 {
+		t.Fatalf("first pick for another route = %d, want 0", key.id)
+	}
+}
+
+func TestKeyPoolLeastUsed(t *testing.T) {
+	kp := NewKeyPool()
+	for i := 0; i < 3; i++ {
+		kp.Record(1, 0, testResponse(http.StatusOK, nil), time.Minute)
+	}
+	kp.Record(1, 2, testResponse(http.StatusOK, nil), time.Minute)
+
+	if got := pickSequence(kp, KeyRotationLeastUsed, 4); !equalIDs(got, []int64{1, 1, 2, 1}) {
+		t.Fatalf("least used picks = %v, want [1 1 2 1]", got)
+	}
+}
+
+func TestKeyPoolCooldown(t *testing.T) {
+	kp := NewKeyPool()
+	kp.Record(1, 0, testResponse(http.StatusUnauthorized, nil), time.Minute)
+	kp.Record(1, 1, testResponse(http.StatusInternalServerError, nil), time.Minute)
+
+	// 5xx 不是 Key 的问题，不进入冷却
+	for i := 0; i < 4; i++ {
+		if key := kp.Pick(1, testKeys, KeyRotationRoundRobin); key.id == 0 {
+			t.Fatal("key in cooldown should be skipped")
+		}
+	}
+	if !kp.HasAvailable(1, testKeys) {
+		t.Fatal("HasAvailable() should be true while other keys are usable")
+	}
+
+	usage := kp.Usage(1, []int64{0, 1, 9})
+	if usage[0].Unauthorized != 1 || usage[0].Failures != 1 || usage[0].LastStatus != http.StatusUnauthorized {
+		t.Fatalf("usage of the rejected key = %+v", usage[0])
+	}
+	if !usage[1].CooldownUntil.IsZero() || usage[1].Failures != 1 {
+		t.Fatalf("usage of the key with a 5xx = %+v, want a failure without cooldown", usage[1])
+	}
+	if usage[2].KeyID != 9 || usage[2].Requests != 0 {
+		t.Fatalf("usage of an unused key = %+v, want an empty entry", usage[2])
+	}
+}
+
+func TestKeyPoolAllKeysCoolingDown(t *testing.T) {
+	kp := NewKeyPool()
+	kp.Record(1, 0, testResponse(http.StatusTooManyRequests, nil), 3*time.Minute)
+	kp.Record(1, 1, testResponse(http.StatusTooManyRequests, nil), time.Minute)
+	kp.Record(1, 2, testResponse(http.StatusTooManyRequests, nil), 2*time.Minute)
+
+	if kp.HasAvailable(1, testKeys) {
+		t.Fatal("HasAvailable() should be false when every key is cooling down")
+	}
+	// 都在冷却时选择最早结束冷却的 Key
+	for _, strategy := range []string{KeyRotationRoundRobin, KeyRotationLeastUsed} {
+		if key := kp.Pick(1, testKeys, strategy); key.id != 1 {
+			t.Fatalf("%s pick = %d, want the key whose cooldown ends first (1)", strategy, key.id)
+		}
+	}
+}
+
+func TestKeyPoolRetryAfter(t *testing.T) {
+	kp := NewKeyPool()
+	before := time.Now()
+	kp.Record(1, 0, testResponse(http.StatusTooManyRequests, http.Header{"Retry-After": []string{"600"}}), time.Minute)
+
+	usage := kp.Usage(1, []int64{0})[0]
+	if usage.RateLimited != 1 || usage.CooldownUntil.Before(before.Add(10*time.Minute)) {
+		t.Fatalf("usage = %+v, want a cooldown from Retry-After", usage)
+	}
+
+	for value, want := range map[string]time.Duration{
+		"":        0,
+		"30":      30 * time.Second,
+		"0":       0,
+		"-5":      0,
+		"invalid": 0,
+	} {
+		if got := parseRetryAfter(value); got != want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", value, got, want)
+		}
+	}
+	at := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(at); got < 59*time.Minute || got > time.Hour {
+		t.Errorf("parseRetryAfter(%q) = %v, want about an hour", at, got)
+	}
+}
+
+func TestKeyPoolConnectionFailureDoesNotCoolDown(t *testing.T) {
+	kp := NewKeyPool()
+	kp.Record(1, 0, nil, time.Minute)
+	usage := kp.Usage(1, []int64{0})[0]
+	if usage.Failures != 1 || usage.LastStatus != 0 || !usage.CooldownUntil.IsZero() {
+		t.Fatalf("usage after a connection failure = %+v", usage)
+	}
+}
+
+func TestKeyPoolForget(t *testing.T) {
+	kp := NewKeyPool()
+	kp.Record(1, 0, testResponse(http.StatusUnauthorized, nil), time.Minute)
+	kp.Record(1, 1, testResponse(http.StatusUnauthorized, nil), time.Minute)
+	kp.Record(2, 0, testResponse(http.StatusUnauthorized, nil), time.Minute)
+
+	kp.ForgetKey(1, 1)
+	if usage := kp.Usage(1, []int64{0, 1}); usage[0].Requests != 1 || usage[1].Requests != 0 {
+		t.Fatalf("usage after ForgetKey = %+v, want only key 1 cleared", usage)
+	}
+	kp.Forget(1)
+	if usage := kp.Usage(1, []int64{0}); usage[0].Requests != 0 {
+		t.Fatalf("usage after Forget = %+v, want it cleared", usage)
+	}
+	if usage := kp.Usage(2, []int64{0}); usage[0].Requests != 1 {
+		t.Fatal("Forget should not touch other routes")
+	}
+}
+
+func TestKeyPoolExtraCache(t *testing.T) {
+	kp := NewKeyPool()
+	if _, _, ok := kp.cachedExtra(1); ok {
+		t.Fatal("nothing should be cached before the first load")
+	}
+
+	// 加载期间缓存被清除时丢弃加载结果
+	_, generation, _ := kp.cachedExtra(1)
+	kp.ForgetKey(1, 5)
+	kp.storeExtra(1, testKeys[1:], generation)
+	if _, _, ok := kp.cachedExtra(1); ok {
+		t.Fatal("a load that raced with ForgetKey should not be cached")
+	}
+
+	_, generation, _ = kp.cachedExtra(1)
+	kp.storeExtra(1, testKeys[1:], generation)
+	if keys, _, ok := kp.cachedExtra(1); !ok || len(keys) != 2 {
+		t.Fatalf("cachedExtra() = %v, %v; want the stored keys", keys, ok)
+	}
+}
+
+func TestRouteKeyPool(t *testing.T) {
+	s := newTestProxyService(t)
+	route := addTestRoute(t, s.routeService, database.ModelRoute{Name: "pooled", Model: "gpt-4o", APIKey: "sk-primary"})
+	keyID, err := s.routeService.AddRouteKey(route.ID, "second", "sk-second")
+	if err != nil {
+		t.Fatal(err)
+	}
+	disabledID, err := s.routeService.AddRouteKey(route.ID, "disabled", "sk-disabled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.routeService.ToggleRouteKey(disabledID, false); err != nil {
+		t.Fatal(err)
+	}
+
+	route, err = s.routeService.GetRouteByID(route.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := s.routeKeyPool(route)
+	if len(keys) != 2 || keys[0].id != PrimaryKeyID || keys[1].id != keyID {
+		t.Fatalf("routeKeyPool() = %+v, want the primary key and the enabled extra key", keys)
+	}
+	if plain, err := s.revealAPIKey(keys[1].apiKey); err != nil || plain != "sk-second" {
+		t.Fatalf("extra key = %q, %v; want %q", plain, err, "sk-second")
+	}
+
+	// 附加 Key 变化后通过 ForgetRouteKey 重新加载
+	if err := s.routeService.ToggleRouteKey(disabledID, true); err != nil {
+		t.Fatal(err)
+	}
+	if keys := s.routeKeyPool(route); len(keys) != 2 {
+		t.Fatalf("routeKeyPool() before ForgetRouteKey = %d keys, want the cached 2", len(keys))
+	}
+	s.ForgetRouteKey(route.ID, disabledID)
+	if keys := s.routeKeyPool(route); len(keys) != 3 {
+		t.Fatalf("routeKeyPool() after ForgetRouteKey = %d keys, want 3", len(keys))
+	}
+
+	// 没有任何 Key 时返回一个空 Key，沿用原请求中的 Key
+	bare := addTestRoute(t, s.routeService, database.ModelRoute{Name: "bare", Model: "gpt-4o"})
+	if keys := s.routeKeyPool(bare); len(keys) != 1 || keys[0].apiKey != "" {
+		t.Fatalf("routeKeyPool() without keys = %+v, want a single empty key", keys)
+	}
+}
+
+func TestSetKeyRotationConfig(t *testing.T) {
+	s := newTestProxyService(t)
+	if err := s.SetKeyRotationConfig("random", 60); err == nil {
+		t.Fatal("unknown strategy should be rejected")
+	}
+	if err := s.SetKeyRotationConfig(KeyRotationLeastUsed, 0); err == nil {
+		t.Fatal("non-positive cooldown should be rejected")
+	}
+	if err := s.SetKeyRotationConfig(KeyRotationLeastUsed, 15); err != nil {
+		t.Fatal(err)
+	}
+	if s.keyRotationStrategy() != KeyRotationLeastUsed || s.keyCooldown() != 15*time.Second {
+		t.Fatalf("strategy %s, cooldown %v; want %s and 15s", s.keyRotationStrategy(), s.keyCooldown(), KeyRotationLeastUsed)
+	}
+
+	s.config.KeyRotationStrategy = "bogus"
+	s.config.KeyCooldownSeconds = -1
+	if s.keyRotationStrategy() != KeyRotationRoundRobin || s.keyCooldown() != DefaultKeyCooldown {
+		t.Fatal("invalid config values should fall back to the defaults")
+	}
+}
@@ -0,0 +1,297 @@
+package service
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"openai-router-go/internal/database"
+)
+
+// 最低延迟策略参数
+const (
+	latencyEWMAAlpha       = 0.3 // 新样本在移动平均中的权重
+	latencyExplorationRate = 0.1 // 分给非最快路由的探索流量比例
+)
+
+// requestTrace 记录单次代理请求的上下文：当前上游尝试的耗时、命中的路由规则、路由分组和会话标识
+type requestTrace struct {
+	mu            sync.Mutex
+	start         time.Time
+	firstToken    time.Time        // 首个响应数据到达的时间
+	rule          string           // 命中的内容路由规则名
+	group         string           // 请求指定的路由分组，为空时不限分组
+	errorType     string           // 本次尝试失败的错误类型（如上游超时），为空表示普通错误
+	estimated     int              // 估算的输入 token 数，路由 TPM 限流时预扣
+	affinity      string           // 会话标识，为空表示不做会话保持
+	test          *routeTestRecord // 路由测试请求的结果记录，不为空时请求固定发往被测路由，结果不写入请求日志
+	needs         capabilityNeeds  // 请求需要路由具备的能力，选路时跳过无法满足的路由
+	ctx           context.Context  // 客户端请求的上下文，客户端断开后不再排队等待限流
+	queueUntil    time.Time        // 限流排队的截止时间，故障转移到其他路由时沿用，避免多次排队累计超过最长排队时间
+	redirectModel string           // 命中重定向时请求改用的模型名
+}
+
+// newRequestTrace 创建请求上下文
+func newRequestTrace() *requestTrace {
+	return &requestTrace{start: time.Now(), ctx: context.Background()}
+}
+
+// begin 开始一次上游尝试，故障转移时每次尝试重新计时
+func (t *requestTrace) begin() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.start = time.Now()
+	t.firstToken = time.Time{}
+	t.errorType = ""
+}
+
+// attach 为响应体挂上计时和空闲超时控制
+func (t *requestTrace) attach(resp *http.Response, deadline *upstreamDeadline) {
+	if resp != nil && t.test != nil {
+		t.test.setStatus(resp.StatusCode)
+	}
+	if resp == nil || resp.Body == nil {
+		return
+	}
+	resp.Body = &timedBody{ReadCloser: resp.Body, trace: t, deadline: deadline}
+}
+
+// setErrorType 记录本次尝试失败的错误类型
+func (t *requestTrace) setErrorType(errorType string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.errorType = errorType
+}
+
+// ErrorType 本次尝试失败的错误类型
+func (t *requestTrace) ErrorType() string {
+	if t == nil {
+		return ""
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.errorType
+}
+
+// Rule 命中的内容路由规则名，未命中时为空
+func (t *requestTrace) Rule() string {
+	if t == nil {
+		return ""
+	}
+	return t.rule
+}
+
+// markFirstToken 记录首个响应数据到达的时间，只记录第一次
+func (t *requestTrace) markFirstToken() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.firstToken.IsZero() {
+		t.firstToken = time.Now()
+	}
+}
+
+// LatencyMs 本次尝试开始到现在的耗时（毫秒）
+func (t *requestTrace) LatencyMs() int64 {
+	if t == nil {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return time.Since(t.start).Milliseconds()
+}
+
+// TTFTMs 本次尝试开始到首个响应数据到达的耗时（毫秒），尚未收到数据时返回 0
+func (t *requestTrace) TTFTMs() int64 {
+	if t == nil {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.firstToken.IsZero() {
+		return 0
+	}
+	return t.firstToken.Sub(t.start).Milliseconds()
+}
+
+// timedBody 包装上游响应体，在第一次读到数据时记录首字耗时
+// 挂有 deadline 时每读到一次数据重新开始空闲计时，空闲超时导致的读取失败会返回 timeoutError
+type timedBody struct {
+	io.ReadCloser
+	trace    *requestTrace
+	deadline *upstreamDeadline
+}
+
+func (b *timedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.trace.markFirstToken()
+		if b.deadline != nil {
+			b.deadline.received()
+		}
+	}
+	if err != nil && err != io.EOF {
+		if expired := b.deadline.err(); expired != nil {
+			b.trace.setErrorType(expired.kind)
+			err = expired
+		}
+	}
+	return n, err
+}
+
+func (b *timedBody) Close() error {
+	err := b.ReadCloser.Close()
+	if b.deadline != nil {
+		b.deadline.close()
+	}
+	return err
+}
+
+// traceOf 获取响应体所属请求的上下文，未经 sendWithFailover 发出的响应返回 nil
+func traceOf(reader io.Reader) *requestTrace {
+	if body, ok := reader.(*timedBody); ok {
+		return body.trace
+	}
+	return nil
+}
+
+// LatencyTracker 按路由维护响应耗时的指数加权移动平均（EWMA），只保存在内存中
+type LatencyTracker struct {
+	mu      sync.RWMutex
+	ewma    map[int64]float64
+	samples map[int64]int
+}
+
+// NewLatencyTracker 创建延迟统计
+func NewLatencyTracker() *LatencyTracker {
+	return &LatencyTracker{
+		ewma:    make(map[int64]float64),
+		samples: make(map[int64]int),
+	}
+}
+
+// Observe 记录一次成功请求的耗时
+func (lt *LatencyTracker) Observe(routeID int64, latencyMs int64) {
+	if latencyMs <= 0 {
+		return
+	}
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	if lt.samples[routeID] == 0 {
+		lt.ewma[routeID] = float64(latencyMs)
+	} else {
+		lt.ewma[routeID] = latencyEWMAAlpha*float64(latencyMs) + (1-latencyEWMAAlpha)*lt.ewma[routeID]
+	}
+	lt.samples[routeID]++
+}
+
+// Get 获取路由的平均耗时（毫秒），没有样本时返回 false
+func (lt *LatencyTracker) Get(routeID int64) (float64, bool) {
+	lt.mu.RLock()
+	defer lt.mu.RUnlock()
+	if lt.samples[routeID] == 0 {
+		return 0, false
+	}
+	return lt.ewma[routeID], true
+}
+
+// Forget 清除路由的延迟统计（路由被删除或修改时调用）
+func (lt *LatencyTracker) Forget(routeID int64) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	delete(lt.ewma, routeID)
+	delete(lt.samples, routeID)
+}
+
+// pickLeastLatency 选择平均耗时最低的路由
+// 没有样本的路由优先被选中以获得测量值；其余情况下按探索比例随机分一小部分流量给其他路由，避免慢路由恢复后一直得不到流量
+func (lt *LatencyTracker) pickLeastLatency(routes []database.ModelRoute) *database.ModelRoute {
+	best := -1
+	bestLatency := 0.0
+	for i := range routes {
+		latency, ok := lt.Get(routes[i].ID)
+		if !ok {
+			return &routes[i]
+		}
+		if best < 0 || latency < bestLatency {
+			best = i
+			bestLatency = latency
+		}
+	}
+
+	if rand.Float64() < latencyExplorationRate {
+		n := rand.Intn(len(routes) - 1)
+		if n >= best {
+			n++
+		}
+		return &routes[n]
+	}
+	return &routes[best]
+}
+
+// logRequest 记录请求日志及耗时、命中的路由规则和失败的错误类型，成功的请求同时更新路由的延迟统计，并按实际 token 用量校正路由的 TPM 限流
+func (s *ProxyService) logRequest(model string, routeID int64, trace *requestTrace, requestTokens, responseTokens, totalTokens int, success bool, errorMsg string) {
+	latencyMs, ttftMs := trace.LatencyMs(), trace.TTFTMs()
+	var errorType string
+	if !success {
+		errorType = trace.ErrorType()
+	}
+	if trace != nil && trace.test != nil {
+		// 路由测试只记录结果，不计入请求日志和延迟统计
+		trace.test.record(requestTokens, responseTokens, totalTokens, success, errorMsg, errorType, ttftMs)
+		if success {
+			s.rateLimiter.Settle(routeID, trace.estimated, totalTokens)
+		}
+		return
+	}
+	s.routeService.LogRequestDetail(database.RequestLog{
+		Model:          model,
+		RouteID:        routeID,
+		RequestTokens:  requestTokens,
+		ResponseTokens: responseTokens,
+		TotalTokens:    totalTokens,
+		Success:        success,
+		ErrorMessage:   errorMsg,
+		LatencyMs:      latencyMs,
+		TTFTMs:         ttftMs,
+		RuleName:       trace.Rule(),
+		ErrorType:      errorType,
+	})
+
+	if success {
+		s.rateLimiter.Settle(routeID, trace.estimated, totalTokens)
+		// 优先以首字耗时衡量路由快慢，流式请求的总耗时主要取决于输出长度
+		if ttftMs > 0 {
+			s.loadBalancer.latency.Observe(routeID, ttftMs)
+		} else {
+			s.loadBalancer.latency.Observe(routeID, latencyMs)
+		}
+	}
+}
+
+// usageTokens 读取 usage 中第一个存在的 token 字段
+func usageTokens(usage map[string]interface{}, keys ...string) int {
+	for _, key := range keys {
+		if v, ok := usage[key].(float64); ok {
+			return int(v)
+		}
+	}
+	return 0
+}
+
+// GetRouteLatency 获取路由的平均耗时（毫秒），没有样本时返回 0
+func (s *ProxyService) GetRouteLatency(routeID int64) int64 {
+	latency, ok := s.loadBalancer.latency.Get(routeID)
+	if !ok {
+		return 0
+	}
+	return int64(latency)
+}
+
+// ForgetRouteLatency 清除路由在内存中的延迟统计
+func (s *ProxyService) ForgetRouteLatency(routeID int64) {
+	s.loadBalancer.latency.Forget(routeID)
+}
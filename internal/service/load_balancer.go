@@ -0,0 +1,147 @@
+package service
+
+import (
+	"math/rand"
+	"sync"
+
+	"openai-router-go/internal/database"
+)
+
+// 负载均衡策略
+const (
+	StrategyRandom         = "random"          // 等概率随机
+	StrategyWeightedRandom = "weighted_random" // 按权重随机
+	StrategyRoundRobin     = "round_robin"     // 平滑加权轮询
+	StrategyLeastLatency   = "least_latency"   // 平均耗时最低优先，保留少量探索流量
+)
+
+// DefaultLoadBalanceStrategy 未配置时使用的默认策略
+const DefaultLoadBalanceStrategy = StrategyWeightedRandom
+
+// IsValidStrategy 判断策略名是否合法
+func IsValidStrategy(strategy string) bool {
+	switch strategy {
+	case StrategyRandom, StrategyWeightedRandom, StrategyRoundRobin, StrategyLeastLatency:
+		return true
+	default:
+		return false
+	}
+}
+
+// normalizeWeight 权重小于 1 时按 1 处理
+func normalizeWeight(weight int) int {
+	if weight < 1 {
+		return 1
+	}
+	return weight
+}
+
+// normalizePriority 优先级小于 0 时按 0 处理
+func normalizePriority(priority int) int {
+	if priority < 0 {
+		return 0
+	}
+	return priority
+}
+
+// topPriorityTier 返回候选路由中优先级最高（数值最小）的一层
+func topPriorityTier(routes []database.ModelRoute) []database.ModelRoute {
+	if len(routes) == 0 {
+		return nil
+	}
+	best := routes[0].Priority
+	for _, route := range routes[1:] {
+		if route.Priority < best {
+			best = route.Priority
+		}
+	}
+
+	tier := make([]database.ModelRoute, 0, len(routes))
+	for _, route := range routes {
+		if route.Priority == best {
+			tier = append(tier, route)
+		}
+	}
+	return tier
+}
+
+// LoadBalancer 在同一模型的多条路由之间分配流量
+// 平滑加权轮询需要记录每条路由的当前权重，因此按模型保存状态
+type LoadBalancer struct {
+	mu             sync.Mutex
+	currentWeights map[string]map[int64]int // model -> routeID -> current weight
+	latency        *LatencyTracker
+}
+
+// NewLoadBalancer 创建负载均衡器
+func NewLoadBalancer() *LoadBalancer {
+	return &LoadBalancer{
+		currentWeights: make(map[string]map[int64]int),
+		latency:        NewLatencyTracker(),
+	}
+}
+
+// Pick 按策略从候选路由中选出一条
+func (lb *LoadBalancer) Pick(model, strategy string, routes []database.ModelRoute) *database.ModelRoute {
+	if len(routes) == 0 {
+		return nil
+	}
+	if len(routes) == 1 {
+		return &routes[0]
+	}
+
+	switch strategy {
+	case StrategyRandom:
+		return &routes[rand.Intn(len(routes))]
+	case StrategyRoundRobin:
+		return lb.pickSmoothWeighted(model, routes)
+	case StrategyLeastLatency:
+		return lb.latency.pickLeastLatency(routes)
+	default:
+		return pickWeightedRandom(routes)
+	}
+}
+
+// pickSmoothWeighted 平滑加权轮询（与 nginx 的实现一致）
+// 每轮所有路由的当前权重加上各自权重，选出当前权重最大的路由，再减去总权重
+func (lb *LoadBalancer) pickSmoothWeighted(model string, routes []database.ModelRoute) *database.ModelRoute {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	current, ok := lb.currentWeights[model]
+	if !ok {
+		current = make(map[int64]int)
+		lb.currentWeights[model] = current
+	}
+
+	total := 0
+	best := -1
+	for i := range routes {
+		weight := normalizeWeight(routes[i].Weight)
+		current[routes[i].ID] += weight
+		total += weight
+		if best < 0 || current[routes[i].ID] > current[routes[best].ID] {
+			best = i
+		}
+	}
+
+	current[routes[best].ID] -= total
+	return &routes[best]
+}
+
+// pickWeightedRandom 按权重随机选择路由
+func pickWeightedRandom(routes []database.ModelRoute) *database.ModelRoute {
+	total := 0
+	for _, route := range routes {
+		total += normalizeWeight(route.Weight)
+	}
+
+	n := rand.Intn(total)
+	for i := range routes {
+		n -= normalizeWeight(routes[i].Weight)
+		if n < 0 {
+			return &routes[i]
+		}
+	}
+	return &routes[len(routes)-1]
+}
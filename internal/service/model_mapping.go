@@ -0,0 +1,188 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"openai-router-go/internal/database"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// normalizeUpstreamModel 上游模型名与对外名称相同时不单独保存
+func normalizeUpstreamModel(model, upstreamModel string) string {
+	upstreamModel = strings.TrimSpace(upstreamModel)
+	if upstreamModel == model {
+		return ""
+	}
+	return upstreamModel
+}
+
+// upstreamModelName 返回发往上游时使用的模型名
+// 路由配置了 upstream_model 时使用该值，否则沿用客户端请求的模型名
+func upstreamModelName(route *database.ModelRoute, model string) string {
+	if route.UpstreamModel != "" {
+		return route.UpstreamModel
+	}
+	return model
+}
+
+// withUpstreamModel 按路由的上游模型名改写请求
+// 需要改写时返回请求数据的浅拷贝和重新编码的请求体，不修改调用方的原始数据，以便故障转移时按下一条路由重新改写
+func withUpstreamModel(route *database.ModelRoute, model string, reqData map[string]interface{}, requestBody []byte) (string, map[string]interface{}, []byte) {
+	upstreamModel := upstreamModelName(route, model)
+	if upstreamModel == model {
+		return model, reqData, requestBody
+	}
+
+	upstreamReq := make(map[string]interface{}, len(reqData))
+	for k, v := range reqData {
+		upstreamReq[k] = v
+	}
+	upstreamReq["model"] = upstreamModel
+
+	upstreamBody, err := json.Marshal(upstreamReq)
+	if err != nil {
+		return model, reqData, requestBody
+	}
+	return upstreamModel, upstreamReq, upstreamBody
+}
+
+// 模型名匹配方式
+// 路由的 model 字段除了精确的模型名，还可以写成:
+//   - 通配符: 含有 * 或 ?，如 claude-*、gpt-4o-*-preview
+//   - 正则表达式: 以 ^ 开头，如 ^gpt-4o.*$
+//
+// 查找路由时按 精确匹配 > 最长前缀的通配符 > 正则 的顺序，命中较高优先级后不再继续
+const (
+	modelMatchExact    = "exact"
+	modelMatchWildcard = "wildcard"
+	modelMatchRegex    = "regex"
+)
+
+// modelMatchKind 判断路由 model 字段的匹配方式
+func modelMatchKind(pattern string) string {
+	if strings.HasPrefix(pattern, "^") {
+		return modelMatchRegex
+	}
+	if strings.ContainsAny(pattern, "*?") {
+		return modelMatchWildcard
+	}
+	return modelMatchExact
+}
+
+// IsModelPattern 判断路由 model 字段是否为通配符或正则
+func IsModelPattern(pattern string) bool {
+	return modelMatchKind(pattern) != modelMatchExact
+}
+
+// wildcardPrefixLen 通配符中第一个通配符之前的字面前缀长度，用于比较匹配的精确程度
+func wildcardPrefixLen(pattern string) int {
+	if i := strings.IndexAny(pattern, "*?"); i >= 0 {
+		return i
+	}
+	return len(pattern)
+}
+
+// wildcardToRegexp 将通配符转换为正则表达式，* 匹配任意字符串，? 匹配单个字符
+func wildcardToRegexp(pattern string) string {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	sb.WriteString("$")
+	return sb.String()
+}
+
+// modelPatternCache 缓存已编译的模型匹配表达式
+type modelPatternCache struct {
+	mu       sync.Mutex
+	compiled map[string]*regexp.Regexp
+}
+
+func newModelPatternCache() *modelPatternCache {
+	return &modelPatternCache{compiled: make(map[string]*regexp.Regexp)}
+}
+
+// compile 编译路由的 model 字段（通配符或正则）
+func (c *modelPatternCache) compile(pattern string) (*regexp.Regexp, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if re, ok := c.compiled[pattern]; ok {
+		return re, nil
+	}
+
+	expr := pattern
+	if modelMatchKind(pattern) == modelMatchWildcard {
+		expr = wildcardToRegexp(pattern)
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	c.compiled[pattern] = re
+	return re, nil
+}
+
+// ValidateModelPattern 校验路由的 model 字段，正则表达式必须能够编译
+func ValidateModelPattern(pattern string) error {
+	if strings.TrimSpace(pattern) == "" {
+		return fmt.Errorf("model is required")
+	}
+	if modelMatchKind(pattern) == modelMatchRegex {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid model regex %q: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+// matchPatternRoutes 在通配符/正则路由中查找与模型名匹配的路由
+// 通配符优先，多个通配符命中时只保留字面前缀最长的；没有通配符命中时才使用正则
+func (c *modelPatternCache) matchPatternRoutes(model string, routes []database.ModelRoute) []database.ModelRoute {
+	var wildcard []database.ModelRoute
+	var regex []database.ModelRoute
+	bestPrefix := -1
+
+	for _, route := range routes {
+		re, err := c.compile(route.Model)
+		if err != nil {
+			log.Warnf("Skipping route %s (id=%d) with invalid model pattern %q: %v", route.Name, route.ID, route.Model, err)
+			continue
+		}
+		if !re.MatchString(model) {
+			continue
+		}
+
+		switch modelMatchKind(route.Model) {
+		case modelMatchWildcard:
+			prefix := wildcardPrefixLen(route.Model)
+			if prefix > bestPrefix {
+				bestPrefix = prefix
+				wildcard = wildcard[:0]
+			}
+			if prefix == bestPrefix {
+				wildcard = append(wildcard, route)
+			}
+		case modelMatchRegex:
+			regex = append(regex, route)
+		}
+	}
+
+	if len(wildcard) > 0 {
+		return wildcard
+	}
+	return regex
+}
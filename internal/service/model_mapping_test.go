@@ -0,0 +1,128 @@
+package service
+
+import (
+	"sort"
+	"testing"
+
+	"openai-router-go/internal/database"
+)
+
+func routeNames(routes []database.ModelRoute) []string {
+	names := make([]string, 0, len(routes))
+	for _, route := range routes {
+		names = append(names, route.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestModelMatchKind(t *testing.T) {
+	for pattern, want := range map[string]string{
+		"gpt-4o":             modelMatchExact,
+		"claude-*":           modelMatchWildcard,
+		"gpt-4o-?":           modelMatchWildcard,
+		"^gemini-.*$":        modelMatchRegex,
+		"^gpt-*":             modelMatchRegex,
+		"deepseek/chat-v3.1": modelMatchExact,
+	} {
+		if got := modelMatchKind(pattern); got != want {
+			t.Errorf("modelMatchKind(%q) = %s, want %s", pattern, got, want)
+		}
+	}
+}
+
+func TestWildcardToRegexp(t *testing.T) {
+	c := newModelPatternCache()
+	tests := []struct {
+		pattern string
+		model   string
+		want    bool
+	}{
+		{"claude-*", "claude-sonnet-4", true},
+		{"claude-*", "claude-", true},
+		{"claude-*", "my-claude-sonnet", false},
+		{"gpt-4o-?", "gpt-4o-x", true},
+		{"gpt-4o-?", "gpt-4o-xl", false},
+		// 通配符之外的字符按字面匹配
+		{"gpt-4.1*", "gpt-451", false},
+		{"gpt-4.1*", "gpt-4.1-mini", true},
+	}
+	for _, tt := range tests {
+		re, err := c.compile(tt.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := re.MatchString(tt.model); got != tt.want {
+			t.Errorf("%q matches %q = %v, want %v", tt.pattern, tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestValidateModelPattern(t *testing.T) {
+	for _, pattern := range []string{"gpt-4o", "claude-*", "^gemini-(pro|flash)$", "[odd"} {
+		if err := ValidateModelPattern(pattern); err != nil {
+			t.Errorf("ValidateModelPattern(%q) = %v, want nil", pattern, err)
+		}
+	}
+	for _, pattern := range []string{"", "  ", "^gemini-(pro"} {
+		if err := ValidateModelPattern(pattern); err == nil {
+			t.Errorf("ValidateModelPattern(%q) should fail", pattern)
+		}
+	}
+}
+
+func TestGetRoutesByModelInGroupOrder(t *testing.T) {
+	rs := newTestRouteService(t)
+	for _, route := range []database.ModelRoute{
+		{Name: "exact", Model: "claude-sonnet-4"},
+		{Name: "claude", Model: "claude-*"},
+		{Name: "claude-sonnet", Model: "claude-sonnet-*"},
+		{Name: "claude-sonnet-other", Model: "claude-sonnet-?*"},
+		{Name: "claude-regex", Model: "^claude-.*$"},
+		{Name: "gemini-regex", Model: "^gemini-.*$"},
+		{Name: "gemini-regex-2", Model: "^gemini-2\\..*$"},
+		{Name: "team-exact", Model: "gpt-4o", Group: "team"},
+		{Name: "team-gpt", Model: "gpt-*", Group: "team"},
+		{Name: "gpt", Model: "gpt-*"},
+	} {
+		addTestRoute(t, rs, route)
+	}
+	disabled := addTestRoute(t, rs, database.ModelRoute{Name: "disabled", Model: "claude-opus-4"})
+	if err := rs.ToggleRoute(disabled.ID, false); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		model string
+		group string
+		want  []string
+	}{
+		{"exact beats patterns", "claude-sonnet-4", "", []string{"exact"}},
+		{"longest wildcard prefix wins", "claude-sonnet-4.5", "", []string{"claude-sonnet", "claude-sonnet-other"}},
+		{"wildcard beats regex", "claude-opus-4", "", []string{"claude"}},
+		{"all matching regex routes", "gemini-2.5-pro", "", []string{"gemini-regex", "gemini-regex-2"}},
+		{"no match", "llama-3", "", []string{}},
+		{"group filters exact routes", "gpt-4o", "team", []string{"team-exact"}},
+		{"exact route in another group is skipped", "gpt-4o", "other", []string{}},
+		{"group filters pattern routes", "gpt-4.1", "team", []string{"team-gpt"}},
+		{"no group matches every group", "gpt-4.1", "", []string{"gpt", "team-gpt"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routes, err := rs.GetRoutesByModelInGroup(tt.model, tt.group)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := routeNames(routes)
+			if len(got) != len(tt.want) {
+				t.Fatalf("routes = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("routes = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// OutboundProxyDirect 路由的 outbound_proxy 设为该值时直连上游，不使用环境变量中的代理
+// outbound_proxy 为空时沿用系统默认（HTTP_PROXY / HTTPS_PROXY / NO_PROXY 环境变量）
+const OutboundProxyDirect = "direct"
+
+// normalizeOutboundProxy 校验出站代理地址，支持 http、https、socks5 和 socks5h
+func normalizeOutboundProxy(proxy string) (string, error) {
+	proxy = strings.TrimSpace(proxy)
+	if proxy == "" || strings.EqualFold(proxy, OutboundProxyDirect) {
+		return strings.ToLower(proxy), nil
+	}
+
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return "", fmt.Errorf("invalid outbound proxy: %v", err)
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return "", fmt.Errorf("unsupported outbound proxy scheme: %q (use http, https or socks5)", u.Scheme)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("outbound proxy host is required: %s", proxy)
+	}
+	return proxy, nil
+}
+
+// transportPool 按出站代理设置维护上游传输层，每个不同的代理地址使用独立的连接池
+type transportPool struct {
+	mu         sync.Mutex
+	transports map[string]*http.Transport
+}
+
+// newTransportPool 创建传输层池
+func newTransportPool() *transportPool {
+	return &transportPool{transports: make(map[string]*http.Transport)}
+}
+
+// get 获取出站代理对应的传输层，不存在时创建
+func (p *transportPool) get(proxy string) (*http.Transport, error) {
+	proxy, err := normalizeOutboundProxy(proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if transport, ok := p.transports[proxy]; ok {
+		return transport, nil
+	}
+
+	transport := newUpstreamTransport()
+	switch proxy {
+	case "":
+		// 保持 http.DefaultTransport 的环境变量代理
+	case OutboundProxyDirect:
+		transport.Proxy = nil
+	default:
+		proxyURL, _ := url.Parse(proxy)
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	p.transports[proxy] = transport
+	return transport, nil
+}
+
+// client 获取出站代理对应的 HTTP 客户端，不设置整体超时（超时由路由配置控制）
+func (p *transportPool) client(proxy string) (*http.Client, error) {
+	transport, err := p.get(proxy)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: transport}, nil
+}
@@ -0,0 +1,699 @@
+package service
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"openai-router-go/internal/database"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// 供应商模型同步默认参数
+const (
+	DefaultProviderSyncInterval = 60 * time.Minute // 供应商没有设置同步间隔时使用
+	providerSyncTick            = time.Minute      // 调度器检查是否有供应商到期的间隔
+	providerSyncTimeout         = 30 * time.Second
+	providerSyncMaxPages        = 20 // 分页拉取模型列表的最大页数
+)
+
+// providerColumns 供应商查询的公共列
+const providerColumns = `id, name, api_url, COALESCE(api_key, ''), COALESCE(format, 'openai'), COALESCE("group", ''),
+	COALESCE(include_patterns, ''), COALESCE(exclude_patterns, ''), COALESCE(outbound_proxy, ''), COALESCE(sync_interval, 0),
+	COALESCE(models, ''), last_sync_at, COALESCE(last_sync_error, ''), enabled, created_at, updated_at`
+
+// scanProvider 将查询结果扫描为供应商结构
+func scanProvider(scanner rowScanner) (*database.Provider, error) {
+	var p database.Provider
+	var models string
+	var lastSync sql.NullTime
+	err := scanner.Scan(&p.ID, &p.Name, &p.APIUrl, &p.APIKey, &p.Format, &p.Group,
+		&p.IncludePatterns, &p.ExcludePatterns, &p.OutboundProxy, &p.SyncInterval,
+		&models, &lastSync, &p.LastSyncError, &p.Enabled, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	p.Models = []string{}
+	if models != "" {
+		json.Unmarshal([]byte(models), &p.Models)
+	}
+	if lastSync.Valid {
+		p.LastSyncAt = &lastSync.Time
+	}
+	return &p, nil
+}
+
+// splitModelPatterns 拆分逗号或换行分隔的模型匹配规则
+func splitModelPatterns(patterns string) []string {
+	var list []string
+	for _, item := range strings.FieldsFunc(patterns, func(r rune) bool { return r == ',' || r == '\n' || r == '\r' }) {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// normalizeModelPatterns 校验模型匹配规则并整理为每行一条
+func normalizeModelPatterns(patterns string) (string, error) {
+	list := splitModelPatterns(patterns)
+	for _, pattern := range list {
+		if err := ValidateModelPattern(pattern); err != nil {
+			return "", err
+		}
+	}
+	return strings.Join(list, "\n"), nil
+}
+
+// normalizeProvider 校验供应商配置并规范化各字段
+func normalizeProvider(p *database.Provider) error {
+	p.Name = strings.TrimSpace(p.Name)
+	p.APIUrl = strings.TrimSpace(p.APIUrl)
+	if p.Name == "" {
+		return fmt.Errorf("provider name is required")
+	}
+	if p.APIUrl == "" {
+		return fmt.Errorf("provider api url is required")
+	}
+
+	var err error
+	if p.Format, err = normalizeRouteFormat(p.Format); err != nil {
+		return err
+	}
+	if p.IncludePatterns, err = normalizeModelPatterns(p.IncludePatterns); err != nil {
+		return fmt.Errorf("invalid include pattern: %v", err)
+	}
+	if p.ExcludePatterns, err = normalizeModelPatterns(p.ExcludePatterns); err != nil {
+		return fmt.Errorf("invalid exclude pattern: %v", err)
+	}
+	if p.OutboundProxy, err = normalizeOutboundProxy(p.OutboundProxy); err != nil {
+		return err
+	}
+	p.APIKey = strings.TrimSpace(p.APIKey)
+	p.Group = strings.TrimSpace(p.Group)
+	if p.SyncInterval < 0 {
+		p.SyncInterval = 0
+	}
+	return nil
+}
+
+// GetProviders 获取所有供应商
+func (s *RouteService) GetProviders() ([]database.Provider, error) {
+	rows, err := s.db.Query(`SELECT ` + providerColumns + ` FROM providers ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	providers := []database.Provider{}
+	for rows.Next() {
+		p, err := scanProvider(rows)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, *p)
+	}
+	return providers, rows.Err()
+}
+
+// GetProviderByID 根据 ID 获取供应商
+func (s *RouteService) GetProviderByID(id int64) (*database.Provider, error) {
+	p, err := scanProvider(s.db.QueryRow(`SELECT `+providerColumns+` FROM providers WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("provider not found: %d", id)
+	}
+	return p, err
+}
+
+// GetProviderRoutes 获取供应商同步创建的所有路由（包括已禁用的）
+func (s *RouteService) GetProviderRoutes(providerID int64) ([]database.ModelRoute, error) {
+	return s.queryRoutes(`SELECT `+routeColumns+` FROM model_routes WHERE provider_id = ? ORDER BY id`, providerID)
+}
+
+// AddProvider 添加供应商，返回新供应商的 ID；模型列表在下一次同步时拉取
+// includePatterns / excludePatterns 为逗号或换行分隔的模型匹配规则，syncInterval 为同步间隔分钟数，0 表示使用默认间隔
+func (s *RouteService) AddProvider(name, apiUrl, apiKey, format, group, includePatterns, excludePatterns, outboundProxy string, syncInterval int) (int64, error) {
+	p := &database.Provider{
+		Name: name, APIUrl: apiUrl, APIKey: apiKey, Format: format, Group: group,
+		IncludePatterns: includePatterns, ExcludePatterns: excludePatterns, OutboundProxy: outboundProxy, SyncInterval: syncInterval,
+	}
+	if err := normalizeProvider(p); err != nil {
+		return 0, err
+	}
+	sealed, err := s.keys.Encrypt(p.APIKey)
+	if err != nil {
+		return 0, err
+	}
+
+	query := `INSERT INTO providers (name, api_url, api_key, format, "group", include_patterns, exclude_patterns, outbound_proxy, sync_interval,
+	          enabled, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, 1, ?, ?)`
+	now := time.Now()
+	result, err := s.db.Exec(query, p.Name, p.APIUrl, sealed, p.Format, p.Group, p.IncludePatterns, p.ExcludePatterns,
+		p.OutboundProxy, p.SyncInterval, now, now)
+	if err != nil {
+		log.Errorf("Failed to add provider: %v", err)
+		return 0, err
+	}
+
+	id, _ := result.LastInsertId()
+	log.Infof("Provider added: %s -> %s [%s]", p.Name, p.APIUrl, p.Format)
+	return id, nil
+}
+
+// UpdateProvider 更新供应商，连接相关的配置（名称、地址、Key、格式、分组、出站代理）同步到它创建的路由
+// 路由上某项配置已被单独修改（与供应商修改前的值不同）时保留路由自己的值；匹配规则的变化在下一次同步时生效
+// 返回连接配置有变化的路由 ID
+func (s *RouteService) UpdateProvider(id int64, name, apiUrl, apiKey, format, group, includePatterns, excludePatterns, outboundProxy string, syncInterval int) ([]int64, error) {
+	p := &database.Provider{
+		ID: id, Name: name, APIUrl: apiUrl, APIKey: apiKey, Format: format, Group: group,
+		IncludePatterns: includePatterns, ExcludePatterns: excludePatterns, OutboundProxy: outboundProxy, SyncInterval: syncInterval,
+	}
+	if err := normalizeProvider(p); err != nil {
+		return nil, err
+	}
+	sealed, err := s.keys.Encrypt(p.APIKey)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := s.GetProviderByID(id)
+	if err != nil {
+		return nil, err
+	}
+	previousKey, err := s.keys.Decrypt(previous.APIKey)
+	if err != nil {
+		return nil, err
+	}
+	routes, err := s.GetProviderRoutes(id)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	query := `UPDATE providers SET name = ?, api_url = ?, api_key = ?, format = ?, "group" = ?, include_patterns = ?, exclude_patterns = ?,
+	          outbound_proxy = ?, sync_interval = ?, updated_at = ? WHERE id = ?`
+	result, err := tx.Exec(query, p.Name, p.APIUrl, sealed, p.Format, p.Group, p.IncludePatterns, p.ExcludePatterns,
+		p.OutboundProxy, p.SyncInterval, now, id)
+	if err != nil {
+		log.Errorf("Failed to update provider: %v", err)
+		return nil, err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return nil, fmt.Errorf("provider not found: id=%d", id)
+	}
+
+	var changed []int64
+	query = `UPDATE model_routes SET name = ?, api_url = ?, api_key = ?, format = ?, "group" = ?, outbound_proxy = ?, updated_at = ?
+	         WHERE id = ?`
+	for _, route := range routes {
+		updated := route
+		inherit(&updated.Name, previous.Name, p.Name)
+		inherit(&updated.APIUrl, previous.APIUrl, p.APIUrl)
+		inherit(&updated.Format, previous.Format, p.Format)
+		inherit(&updated.Group, previous.Group, p.Group)
+		inherit(&updated.OutboundProxy, previous.OutboundProxy, p.OutboundProxy)
+		// Key 未变化时保留原密文，避免重新加密后被误判为有变化
+		if p.APIKey != previousKey && (route.APIKey == previous.APIKey || s.keys.Matches(route.APIKey, previousKey)) {
+			updated.APIKey = sealed
+		}
+		if updated == route {
+			continue
+		}
+		if _, err := tx.Exec(query, updated.Name, updated.APIUrl, updated.APIKey, updated.Format, updated.Group, updated.OutboundProxy, now, route.ID); err != nil {
+			log.Errorf("Failed to update provider routes: %v", err)
+			return nil, err
+		}
+		changed = append(changed, route.ID)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	log.Infof("Provider updated: id=%d, %d of %d route(s) updated", id, len(changed), len(routes))
+	return changed, nil
+}
+
+// inherit 路由的配置仍与供应商修改前的值相同时改为供应商的新值，已被单独修改的保留不变
+func inherit(field *string, previous, current string) {
+	if *field == previous {
+		*field = current
+	}
+}
+
+// ToggleProvider 启用/禁用供应商的定时同步，不影响已创建的路由
+func (s *RouteService) ToggleProvider(id int64, enabled bool) error {
+	result, err := s.db.Exec(`UPDATE providers SET enabled = ?, updated_at = ? WHERE id = ?`, enabled, time.Now(), id)
+	if err != nil {
+		log.Errorf("Failed to toggle provider: %v", err)
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("provider not found: id=%d", id)
+	}
+
+	log.Infof("Provider toggled: id=%d, enabled=%v", id, enabled)
+	return nil
+}
+
+// DeleteProvider 删除供应商，deleteRoutes 为 true 时同时删除它创建的路由，否则这些路由转为普通路由保留
+// 返回被删除的路由 ID
+func (s *RouteService) DeleteProvider(id int64, deleteRoutes bool) ([]int64, error) {
+	routes, err := s.GetProviderRoutes(id)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var deleted []int64
+	if deleteRoutes {
+		for _, route := range routes {
+			if err := deleteRouteRows(tx, route.ID); err != nil {
+				return nil, err
+			}
+			deleted = append(deleted, route.ID)
+		}
+	} else if _, err := tx.Exec(`UPDATE model_routes SET provider_id = 0 WHERE provider_id = ?`, id); err != nil {
+		return nil, err
+	}
+
+	result, err := tx.Exec(`DELETE FROM providers WHERE id = ?`, id)
+	if err != nil {
+		log.Errorf("Failed to delete provider: %v", err)
+		return nil, err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return nil, fmt.Errorf("provider not found: id=%d", id)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	log.Infof("Provider deleted: id=%d (%d routes deleted)", id, len(deleted))
+	return deleted, nil
+}
+
+// setProviderSyncError 记录供应商同步失败的原因，已有的路由保持不变
+func (s *RouteService) setProviderSyncError(id int64, syncErr error) {
+	if _, err := s.db.Exec(`UPDATE providers SET last_sync_at = ?, last_sync_error = ? WHERE id = ?`, time.Now(), syncErr.Error(), id); err != nil {
+		log.Warnf("Failed to save provider sync error: %v", err)
+	}
+}
+
+// matchesAny 判断模型名是否匹配任一规则（精确、通配符或正则）
+func (s *RouteService) matchesAny(model string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if modelMatchKind(pattern) == modelMatchExact {
+			if pattern == model {
+				return true
+			}
+			continue
+		}
+		if re, err := s.patterns.compile(pattern); err == nil && re.MatchString(model) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterProviderModels 按供应商的 include / exclude 规则过滤模型，去重并排序
+func (s *RouteService) filterProviderModels(p *database.Provider, models []string) []string {
+	include, exclude := splitModelPatterns(p.IncludePatterns), splitModelPatterns(p.ExcludePatterns)
+	seen := make(map[string]bool)
+	filtered := []string{}
+	for _, model := range models {
+		model = strings.TrimSpace(model)
+		if model == "" || seen[model] {
+			continue
+		}
+		seen[model] = true
+		if len(include) > 0 && !s.matchesAny(model, include) {
+			continue
+		}
+		if s.matchesAny(model, exclude) {
+			continue
+		}
+		filtered = append(filtered, model)
+	}
+	sort.Strings(filtered)
+	return filtered
+}
+
+// ProviderSyncResult 一次供应商同步的结果
+type ProviderSyncResult struct {
+	ProviderID int64    `json:"provider_id"`
+	Models     int      `json:"models"`   // 过滤后的模型数量
+	Added      []string `json:"added"`    // 新创建路由的模型
+	Enabled    []string `json:"enabled"`  // 上游重新提供而被重新启用的模型
+	Disabled   []string `json:"disabled"` // 上游不再提供（或被规则排除）而被禁用的模型
+	Filtered   int      `json:"filtered"` // 被 include / exclude 规则过滤掉的模型数量
+}
+
+// applyProviderSync 按拉取到的模型列表维护供应商的路由
+// 只处理相对上次同步的变化：新出现的模型创建路由或重新启用，消失的模型禁用路由；手动启用或禁用的路由在模型未变化时保持不变
+func (s *RouteService) applyProviderSync(p *database.Provider, fetched []string) (*ProviderSyncResult, error) {
+	models := s.filterProviderModels(p, fetched)
+	result := &ProviderSyncResult{
+		ProviderID: p.ID, Models: len(models), Filtered: len(fetched) - len(models),
+		Added: []string{}, Enabled: []string{}, Disabled: []string{},
+	}
+
+	routes, err := s.GetProviderRoutes(p.ID)
+	if err != nil {
+		return nil, err
+	}
+	byModel := make(map[string]*database.ModelRoute, len(routes))
+	for i := range routes {
+		byModel[routes[i].Model] = &routes[i]
+	}
+	previous := make(map[string]bool, len(p.Models))
+	for _, model := range p.Models {
+		previous[model] = true
+	}
+	current := make(map[string]bool, len(models))
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	for _, model := range models {
+		current[model] = true
+		route, ok := byModel[model]
+		if !ok {
+			newRoute := &database.ModelRoute{
+				Name: p.Name, Model: model, APIUrl: p.APIUrl, APIKey: p.APIKey, Group: p.Group, Format: p.Format,
+				OutboundProxy: p.OutboundProxy, ProviderID: p.ID, Enabled: true,
+			}
+			if err := normalizeRoute(newRoute); err != nil {
+				log.Warnf("[ProviderSync] Skip model %q of provider %s: %v", model, p.Name, err)
+				continue
+			}
+			if _, err := s.insertRoute(tx, newRoute); err != nil {
+				return nil, err
+			}
+			result.Added = append(result.Added, model)
+			continue
+		}
+		if !route.Enabled && !previous[model] {
+			if _, err := tx.Exec(`UPDATE model_routes SET enabled = 1, updated_at = ? WHERE id = ?`, now, route.ID); err != nil {
+				return nil, err
+			}
+			result.Enabled = append(result.Enabled, model)
+		}
+	}
+	for _, route := range routes {
+		if route.Enabled && previous[route.Model] && !current[route.Model] {
+			if _, err := tx.Exec(`UPDATE model_routes SET enabled = 0, updated_at = ? WHERE id = ?`, now, route.ID); err != nil {
+				return nil, err
+			}
+			result.Disabled = append(result.Disabled, route.Model)
+		}
+	}
+
+	data, _ := json.Marshal(models)
+	if _, err := tx.Exec(`UPDATE providers SET models = ?, last_sync_at = ?, last_sync_error = '' WHERE id = ?`, string(data), now, p.ID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	log.Infof("[ProviderSync] Provider %s synced: %d models, %d added, %d enabled, %d disabled, %d filtered",
+		p.Name, result.Models, len(result.Added), len(result.Enabled), len(result.Disabled), result.Filtered)
+	return result, nil
+}
+
+// ModelSyncer 后台定时拉取供应商的模型列表并同步路由
+type ModelSyncer struct {
+	routeService *RouteService
+	transports   *transportPool
+	keys         *database.KeyCipher // 解密供应商的 API Key
+	secrets      *SecretResolver     // 解析供应商 API Key 中的密钥引用
+
+	mu      sync.Mutex
+	syncing map[int64]bool // 正在同步的供应商，避免定时同步和手动同步同时进行
+	stopCh  chan struct{}
+	running bool
+}
+
+// NewModelSyncer 创建供应商模型同步器
+func NewModelSyncer(routeService *RouteService, transports *transportPool, keys *database.KeyCipher, secrets *SecretResolver) *ModelSyncer {
+	return &ModelSyncer{routeService: routeService, transports: transports, keys: keys, secrets: secrets, syncing: make(map[int64]bool)}
+}
+
+// providerInterval 供应商的同步间隔
+func providerInterval(p *database.Provider) time.Duration {
+	if p.SyncInterval > 0 {
+		return time.Duration(p.SyncInterval) * time.Minute
+	}
+	return DefaultProviderSyncInterval
+}
+
+// Start 启动后台调度，每分钟检查一次哪些启用的供应商已到同步时间
+func (ms *ModelSyncer) Start() {
+	ms.mu.Lock()
+	if ms.running {
+		ms.mu.Unlock()
+		return
+	}
+	ms.running = true
+	ms.stopCh = make(chan struct{})
+	stopCh := ms.stopCh
+	ms.mu.Unlock()
+
+	go func() {
+		log.Infof("[ProviderSync] Scheduler started")
+		for {
+			ms.SyncDue()
+
+			select {
+			case <-stopCh:
+				log.Infof("[ProviderSync] Scheduler stopped")
+				return
+			case <-time.After(providerSyncTick):
+			}
+		}
+	}()
+}
+
+// Stop 停止后台调度
+func (ms *ModelSyncer) Stop() {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if !ms.running {
+		return
+	}
+	close(ms.stopCh)
+	ms.running = false
+}
+
+// SyncDue 同步所有已到同步时间的启用供应商，从未同步过的供应商立即同步
+func (ms *ModelSyncer) SyncDue() {
+	providers, err := ms.routeService.GetProviders()
+	if err != nil {
+		log.Errorf("[ProviderSync] Failed to load providers: %v", err)
+		return
+	}
+	for i := range providers {
+		p := &providers[i]
+		if !p.Enabled || (p.LastSyncAt != nil && time.Since(*p.LastSyncAt) < providerInterval(p)) {
+			continue
+		}
+		if _, err := ms.Sync(p); err != nil {
+			log.Warnf("[ProviderSync] Provider %s (id=%d) sync failed: %v", p.Name, p.ID, err)
+		}
+	}
+}
+
+// Sync 拉取供应商的模型列表并同步路由；拉取失败或上游返回空列表时只记录错误，不修改路由
+func (ms *ModelSyncer) Sync(p *database.Provider) (*ProviderSyncResult, error) {
+	ms.mu.Lock()
+	if ms.syncing[p.ID] {
+		ms.mu.Unlock()
+		return nil, fmt.Errorf("provider %s is already syncing", p.Name)
+	}
+	ms.syncing[p.ID] = true
+	ms.mu.Unlock()
+	defer func() {
+		ms.mu.Lock()
+		delete(ms.syncing, p.ID)
+		ms.mu.Unlock()
+	}()
+
+	models, err := ms.fetchModels(p)
+	if err == nil && len(models) == 0 {
+		err = fmt.Errorf("upstream returned an empty model list")
+	}
+	if err != nil {
+		ms.routeService.setProviderSyncError(p.ID, err)
+		return nil, err
+	}
+	return ms.routeService.applyProviderSync(p, models)
+}
+
+// fetchModels 按供应商格式拉取上游的完整模型列表（跟随分页）
+// OpenAI / Claude 返回 data[].id，Gemini 返回 models[].name（去掉 models/ 前缀）
+func (ms *ModelSyncer) fetchModels(p *database.Provider) ([]string, error) {
+	apiKey, err := revealStoredKey(ms.keys, ms.secrets, p.APIKey)
+	if err != nil {
+		return nil, err
+	}
+	route := &database.ModelRoute{APIUrl: p.APIUrl, APIKey: apiKey, Format: p.Format}
+	transport, err := ms.transports.get(p.OutboundProxy)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: providerSyncTimeout, Transport: transport}
+
+	var models []string
+	cursor := ""
+	for page := 0; page < providerSyncMaxPages; page++ {
+		req, err := buildModelsProbe(route, p.Format)
+		if err != nil {
+			return nil, err
+		}
+		query := req.URL.Query()
+		switch p.Format {
+		case protocolClaude:
+			query.Set("limit", "1000")
+			if cursor != "" {
+				query.Set("after_id", cursor)
+			}
+		case protocolGemini:
+			query.Set("pageSize", "1000")
+			if cursor != "" {
+				query.Set("pageToken", cursor)
+			}
+		}
+		req.URL.RawQuery = query.Encode()
+		setProbeAuth(req, route, p.Format)
+
+		var body struct {
+			Data []struct {
+				ID string `json:"id"`
+			} `json:"data"`
+			HasMore bool   `json:"has_more"`
+			LastID  string `json:"last_id"`
+			Models  []struct {
+				Name string `json:"name"`
+			} `json:"models"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		if err := fetchJSON(client, req, &body); err != nil {
+			return nil, err
+		}
+
+		for _, m := range body.Data {
+			models = append(models, m.ID)
+		}
+		for _, m := range body.Models {
+			models = append(models, strings.TrimPrefix(m.Name, "models/"))
+		}
+
+		switch {
+		case p.Format == protocolClaude && body.HasMore && body.LastID != "":
+			cursor = body.LastID
+		case p.Format == protocolGemini && body.NextPageToken != "":
+			cursor = body.NextPageToken
+		default:
+			return models, nil
+		}
+	}
+	return models, nil
+}
+
+// fetchJSON 发送请求并解析 JSON 响应，非 2xx 状态码返回错误
+func fetchJSON(client *http.Client, req *http.Request, v interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg := strings.TrimSpace(string(body))
+		if len(msg) > 512 {
+			msg = msg[:512]
+		}
+		return fmt.Errorf("GET %s returned status %d: %s", (&url.URL{Scheme: req.URL.Scheme, Host: req.URL.Host, Path: req.URL.Path}).String(), resp.StatusCode, msg)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("failed to parse model list: %v", err)
+	}
+	return nil
+}
+
+// StartModelSyncer 启动供应商模型的后台同步
+func (s *ProxyService) StartModelSyncer() {
+	s.modelSyncer.Start()
+}
+
+// StopModelSyncer 停止供应商模型的后台同步
+func (s *ProxyService) StopModelSyncer() {
+	s.modelSyncer.Stop()
+}
+
+// SyncProvider 立即同步供应商的模型列表，被禁用的路由清除其在内存中的会话保持状态
+func (s *ProxyService) SyncProvider(id int64) (*ProviderSyncResult, error) {
+	p, err := s.routeService.GetProviderByID(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.modelSyncer.Sync(p)
+}
+
+// forgetProviderRoutes 供应商的连接配置变化或被删除时，清除其路由在内存中的状态
+func (s *ProxyService) forgetProviderRoutes(routeIDs []int64) {
+	for _, id := range routeIDs {
+		s.ResetCircuitBreaker(id)
+		s.ForgetRouteHealth(id)
+		s.ForgetRouteLatency(id)
+		s.ForgetRouteKeys(id)
+		s.ForgetRouteRateLimit(id)
+		s.ForgetRouteAffinity(id)
+	}
+}
+
+// UpdateProvider 更新供应商并清除连接配置有变化的路由在内存中的状态
+func (s *ProxyService) UpdateProvider(id int64, name, apiUrl, apiKey, format, group, includePatterns, excludePatterns, outboundProxy string, syncInterval int) error {
+	changed, err := s.routeService.UpdateProvider(id, name, apiUrl, apiKey, format, group, includePatterns, excludePatterns, outboundProxy, syncInterval)
+	if err != nil {
+		return err
+	}
+	s.forgetProviderRoutes(changed)
+	return nil
+}
+
+// DeleteProvider 删除供应商，deleteRoutes 为 true 时同时删除它创建的路由
+func (s *ProxyService) DeleteProvider(id int64, deleteRoutes bool) error {
+	deleted, err := s.routeService.DeleteProvider(id, deleteRoutes)
+	if err != nil {
+		return err
+	}
+	s.forgetProviderRoutes(deleted)
+	return nil
+}
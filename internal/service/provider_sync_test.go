@@ -0,0 +1,325 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"openai-router-go/internal/database"
+)
+
+// testModelServer 模拟上游的 OpenAI 格式模型列表接口，返回的列表可以在测试中修改
+type testModelServer struct {
+	*httptest.Server
+	mu     sync.Mutex
+	models []string
+	status int
+}
+
+func newTestModelServer(t *testing.T, models ...string) *testModelServer {
+	t.Helper()
+	ms := &testModelServer{models: models, status: http.StatusOK}
+	ms.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ms.mu.Lock()
+		defer ms.mu.Unlock()
+		if !strings.HasSuffix(r.URL.Path, "/models") || r.Header.Get("Authorization") != "Bearer sk-provider" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		if ms.status != http.StatusOK {
+			http.Error(w, "upstream error", ms.status)
+			return
+		}
+		data := make([]map[string]string, 0, len(ms.models))
+		for _, model := range ms.models {
+			data = append(data, map[string]string{"id": model})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"object": "list", "data": data})
+	}))
+	t.Cleanup(ms.Close)
+	return ms
+}
+
+func (ms *testModelServer) serve(status int, models ...string) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.status = status
+	ms.models = models
+}
+
+// providerRouteStates 供应商路由的启用状态，格式为 模型:on/off，按模型排序
+func providerRouteStates(t *testing.T, rs *RouteService, providerID int64) []string {
+	t.Helper()
+	routes, err := rs.GetProviderRoutes(providerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var states []string
+	for _, route := range routes {
+		state := "off"
+		if route.Enabled {
+			state = "on"
+		}
+		states = append(states, route.Model+":"+state)
+	}
+	sort.Strings(states)
+	return states
+}
+
+func checkStates(t *testing.T, rs *RouteService, providerID int64, want ...string) {
+	t.Helper()
+	if got := providerRouteStates(t, rs, providerID); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("provider routes = %v, want %v", got, want)
+	}
+}
+
+func TestFilterProviderModels(t *testing.T) {
+	rs := newTestRouteService(t)
+	models := []string{"gpt-4o", "gpt-4o-mini", "gpt-4o", " ", "text-embedding-3-small", "o3", "dall-e-3", "gpt-4o-audio-preview"}
+
+	tests := []struct {
+		name    string
+		include string
+		exclude string
+		want    string
+	}{
+		{"no rules keeps everything", "", "", "dall-e-3 gpt-4o gpt-4o-audio-preview gpt-4o-mini o3 text-embedding-3-small"},
+		{"include wildcard and exact", "gpt-*\no3", "", "gpt-4o gpt-4o-audio-preview gpt-4o-mini o3"},
+		{"exclude after include", "gpt-*", "*-preview, gpt-4o-mini", "gpt-4o"},
+		{"exclude regex", "", "^(dall-e|text-embedding)-.*$", "gpt-4o gpt-4o-audio-preview gpt-4o-mini o3"},
+		{"exact include does not match prefixes", "gpt-4o", "", "gpt-4o"},
+	}
+	for _, tt := range tests {
+		p := &database.Provider{IncludePatterns: tt.include, ExcludePatterns: tt.exclude}
+		if got := strings.Join(rs.filterProviderModels(p, models), " "); got != tt.want {
+			t.Errorf("%s: filterProviderModels() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAddProviderValidation(t *testing.T) {
+	rs := newTestRouteService(t)
+	tests := []struct {
+		name, apiURL, format, include, proxy string
+		wantErr                              string
+	}{
+		{"", "https://a.example.com", "", "", "", "name is required"},
+		{"p", " ", "", "", "", "api url is required"},
+		{"p", "https://a.example.com", "azure", "", "", "unsupported route format"},
+		{"p", "https://a.example.com", "", "^gpt-(4", "", "invalid include pattern"},
+	}
+	for _, tt := range tests {
+		if _, err := rs.AddProvider(tt.name, tt.apiURL, "", tt.format, "", tt.include, "", tt.proxy, 0); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("AddProvider(%q, %q, %q, %q) = %v, want an error containing %q", tt.name, tt.apiURL, tt.format, tt.include, err, tt.wantErr)
+		}
+	}
+
+	id, err := rs.AddProvider(" Relay ", "https://relay.example.com", " sk-provider ", "", " team ", "gpt-*, o3", "", "", -5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := rs.GetProviderByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "Relay" || p.Format != protocolOpenAI || p.Group != "team" || p.IncludePatterns != "gpt-*\no3" || p.SyncInterval != 0 {
+		t.Fatalf("provider = %+v, want normalized fields", p)
+	}
+	if !database.IsEncryptedKey(p.APIKey) || !rs.keys.Matches(p.APIKey, "sk-provider") {
+		t.Fatal("provider api key should be stored encrypted")
+	}
+	if providerInterval(p) != DefaultProviderSyncInterval {
+		t.Fatalf("providerInterval() = %v, want the default", providerInterval(p))
+	}
+}
+
+func TestSyncProvider(t *testing.T) {
+	s := newTestProxyService(t)
+	rs := s.routeService
+	upstream := newTestModelServer(t, "gpt-4o", "gpt-4o-mini", "dall-e-3")
+	id, err := rs.AddProvider("Relay", upstream.URL, "sk-provider", "openai", "team", "", "dall-e-*", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := s.SyncProvider(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(result.Added, " ") != "gpt-4o gpt-4o-mini" || result.Filtered != 1 || result.Models != 2 {
+		t.Fatalf("first sync = %+v, want two routes added and one model filtered", result)
+	}
+	checkStates(t, rs, id, "gpt-4o-mini:on", "gpt-4o:on")
+	routes, _ := rs.GetProviderRoutes(id)
+	if routes[0].Name != "Relay" || routes[0].Group != "team" || routes[0].ProviderID != id || !rs.keys.Matches(routes[0].APIKey, "sk-provider") {
+		t.Fatalf("synced route = %+v, want the provider's settings", routes[0])
+	}
+
+	// 手动禁用的路由在模型没有变化时保持禁用
+	if err := rs.ToggleRoute(routes[1].ID, false); err != nil {
+		t.Fatal(err)
+	}
+	if result, err = s.SyncProvider(id); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Added)+len(result.Enabled)+len(result.Disabled) != 0 {
+		t.Fatalf("sync without upstream changes = %+v, want no changes", result)
+	}
+	checkStates(t, rs, id, "gpt-4o-mini:off", "gpt-4o:on")
+
+	// 上游不再提供的模型被禁用，重新提供时启用
+	upstream.serve(http.StatusOK, "gpt-4o-mini", "o3")
+	if result, err = s.SyncProvider(id); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(result.Added, " ") != "o3" || strings.Join(result.Disabled, " ") != "gpt-4o" {
+		t.Fatalf("sync after upstream changes = %+v, want o3 added and gpt-4o disabled", result)
+	}
+	upstream.serve(http.StatusOK, "gpt-4o", "gpt-4o-mini", "o3")
+	if result, err = s.SyncProvider(id); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(result.Enabled, " ") != "gpt-4o" {
+		t.Fatalf("sync after a model came back = %+v, want gpt-4o enabled", result)
+	}
+	checkStates(t, rs, id, "gpt-4o-mini:off", "gpt-4o:on", "o3:on")
+
+	// 拉取失败或返回空列表时只记录错误，路由保持不变
+	for _, tt := range []struct {
+		status int
+		models []string
+		want   string
+	}{
+		{http.StatusUnauthorized, nil, "returned status 401"},
+		{http.StatusOK, nil, "empty model list"},
+	} {
+		upstream.serve(tt.status, tt.models...)
+		if _, err := s.SyncProvider(id); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Fatalf("SyncProvider() = %v, want an error containing %q", err, tt.want)
+		}
+		p, err := rs.GetProviderByID(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(p.LastSyncError, tt.want) || p.LastSyncAt == nil || len(p.Models) != 3 {
+			t.Fatalf("provider after a failed sync = %+v, want the error recorded and the models kept", p)
+		}
+		checkStates(t, rs, id, "gpt-4o-mini:off", "gpt-4o:on", "o3:on")
+	}
+}
+
+func TestFetchModelsPagination(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path+"?"+r.URL.RawQuery)
+		switch {
+		case r.Header.Get("x-api-key") == "sk-claude" && r.URL.Query().Get("after_id") == "":
+			w.Write([]byte(`{"data":[{"id":"claude-sonnet-4"}],"has_more":true,"last_id":"claude-sonnet-4"}`))
+		case r.Header.Get("x-api-key") == "sk-claude":
+			w.Write([]byte(`{"data":[{"id":"claude-opus-4"}],"has_more":false}`))
+		case r.Header.Get("x-goog-api-key") == "gm-key" && r.URL.Query().Get("pageToken") == "":
+			w.Write([]byte(`{"models":[{"name":"models/gemini-2.5-pro"}],"nextPageToken":"next"}`))
+		case r.Header.Get("x-goog-api-key") == "gm-key":
+			w.Write([]byte(`{"models":[{"name":"models/gemini-2.5-flash"}]}`))
+		default:
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	s := newTestProxyService(t)
+	for _, tt := range []struct {
+		format, key, want string
+	}{
+		{protocolClaude, "sk-claude", "claude-sonnet-4 claude-opus-4"},
+		{protocolGemini, "gm-key", "gemini-2.5-pro gemini-2.5-flash"},
+	} {
+		requests = nil
+		models, err := s.modelSyncer.fetchModels(&database.Provider{Name: tt.format, APIUrl: server.URL, APIKey: tt.key, Format: tt.format})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.format, err)
+		}
+		if strings.Join(models, " ") != tt.want || len(requests) != 2 {
+			t.Fatalf("%s: models = %v after %d request(s) %v, want %q from 2 pages", tt.format, models, len(requests), requests, tt.want)
+		}
+	}
+}
+
+func TestUpdateProviderPropagatesSettings(t *testing.T) {
+	s := newTestProxyService(t)
+	rs := s.routeService
+	upstream := newTestModelServer(t, "gpt-4o", "o3")
+	id, err := rs.AddProvider("Relay", upstream.URL, "sk-provider", "openai", "", "", "", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SyncProvider(id); err != nil {
+		t.Fatal(err)
+	}
+	routes, _ := rs.GetProviderRoutes(id)
+	custom := routes[1]
+	custom.Name = "Custom name"
+	if err := rs.UpdateRoute(&custom); err != nil {
+		t.Fatal(err)
+	}
+
+	// 路由上单独修改过的配置保留，其余跟随供应商
+	changed, err := rs.UpdateProvider(id, "Relay 2", "https://relay2.example.com", "sk-new", "openai", "team", "", "", "", 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changed) != 2 {
+		t.Fatalf("changed routes = %v, want both routes", changed)
+	}
+	routes, _ = rs.GetProviderRoutes(id)
+	for _, route := range routes {
+		wantName := "Relay 2"
+		if route.ID == custom.ID {
+			wantName = "Custom name"
+		}
+		if route.Name != wantName || route.APIUrl != "https://relay2.example.com" || route.Group != "team" || !rs.keys.Matches(route.APIKey, "sk-new") {
+			t.Fatalf("route after provider update = %+v, want name %q and the new connection settings", route, wantName)
+		}
+	}
+
+	// 没有变化时不返回任何路由
+	if changed, err = rs.UpdateProvider(id, "Relay 2", "https://relay2.example.com", "sk-new", "openai", "team", "", "", "", 30); err != nil || len(changed) != 0 {
+		t.Fatalf("UpdateProvider() without changes = %v, %v; want no routes", changed, err)
+	}
+}
+
+func TestDeleteProvider(t *testing.T) {
+	for _, deleteRoutes := range []bool{true, false} {
+		s := newTestProxyService(t)
+		rs := s.routeService
+		upstream := newTestModelServer(t, "gpt-4o")
+		id, err := rs.AddProvider("Relay", upstream.URL, "sk-provider", "openai", "", "", "", "", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.SyncProvider(id); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := s.DeleteProvider(id, deleteRoutes); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := rs.GetProviderByID(id); err == nil {
+			t.Fatal("provider should be deleted")
+		}
+		routes, _ := rs.GetAllRoutes()
+		if deleteRoutes && len(routes) != 0 {
+			t.Fatalf("routes after deleting the provider with its routes = %d, want 0", len(routes))
+		}
+		if !deleteRoutes && (len(routes) != 1 || routes[0].ProviderID != 0) {
+			t.Fatalf("routes after deleting only the provider = %+v, want one standalone route", routes)
+		}
+		if err := s.DeleteProvider(id, deleteRoutes); err == nil {
+			t.Fatal("deleting a missing provider should fail")
+		}
+	}
+}
@@ -3,11 +3,13 @@
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"openai-router-go/internal/adapters"
@@ -18,43 +20,267 @@ import (
 )
 
 type ProxyService struct {
-	routeService *RouteService
-	config       *config.Config
-	httpClient   *http.Client
+	routeService  *RouteService
+	config        *config.Config
+	transports    *transportPool // 按路由的出站代理设置分别维护连接池
+	loadBalancer  *LoadBalancer
+	breaker       *CircuitBreaker
+	healthChecker *HealthChecker
+	keyPool       *KeyPool
+	rateLimiter   *RateLimiter
+	affinity      *AffinityCache
+	modelSyncer   *ModelSyncer
+	keys          *database.KeyCipher // 解密路由保存的 API Key，明文只用于发往上游的请求
+	secrets       *SecretResolver     // 解析 API Key 中的 env: / file: / cmd: 引用
+	routeTests    *routeTestRegistry  // 进行中的路由测试
+	configMu      sync.RWMutex        // 保护运行中会被修改的配置，修改和保存都在写锁内进行；切片和 map 整体替换，已发布的不再写入
 }
 
 func NewProxyService(routeService *RouteService, cfg *config.Config) *ProxyService {
+	// 上游请求不设置整体超时，因为大模型生成非常耗时；按路由配置连接、首字节和空闲超时
+	transports := newTransportPool()
+	secrets := NewSecretResolver(DefaultSecretCacheTTL)
 	return &ProxyService{
-		routeService: routeService,
-		config:       cfg,
-		httpClient: &http.Client{
-			Timeout: 0, // 不设置超时，因为大模型生成非常耗时
-		},
+		routeService:  routeService,
+		config:        cfg,
+		transports:    transports,
+		loadBalancer:  NewLoadBalancer(),
+		breaker:       NewCircuitBreaker(cfg),
+		healthChecker: NewHealthChecker(routeService, cfg, transports, routeService.keys, secrets),
+		keyPool:       NewKeyPool(),
+		rateLimiter:   NewRateLimiter(),
+		affinity:      NewAffinityCache(),
+		modelSyncer:   NewModelSyncer(routeService, transports, routeService.keys, secrets),
+		keys:          routeService.keys,
+		secrets:       secrets,
+		routeTests:    newRouteTestRegistry(),
+	}
+}
+
+// routeLookupError 请求选路失败，status 为返回给客户端的 HTTP 状态码
+type routeLookupError struct {
+	status int
+	err    error
+}
+
+func (e *routeLookupError) Error() string {
+	return e.err.Error()
+}
+
+// routeErrorStatus 获取 resolveRequestRoute 返回的错误对应的 HTTP 状态码
+func routeErrorStatus(err error) int {
+	if lookupErr, ok := err.(*routeLookupError); ok {
+		return lookupErr.status
+	}
+	return http.StatusServiceUnavailable
+}
+
+// resolveRequestRoute 为请求选择路由：解析路由分组和会话保持，再匹配内容路由规则和重定向关键字，都未命中时按模型名选路
+// 返回选中的路由和发往上游使用的模型名，模型名有变化（去掉分组后缀或命中重定向）时同时改写 reqData["model"]
+// 失败时返回 capabilityError 或带状态码的 routeLookupError
+func (s *ProxyService) resolveRequestRoute(model string, headers map[string]string, reqData map[string]interface{}, stream bool, trace *requestTrace) (*database.ModelRoute, string, error) {
+	// 解析路由分组：model@group 后缀优先，其次为 X-Route-Group 请求头和默认分组
+	var stripped bool
+	model, trace.group, stripped = s.resolveRouteGroup(model, headers)
+	if stripped {
+		reqData["model"] = model
+	}
+	// 会话保持：同一会话的请求优先发往上次成功的路由
+	s.resolveAffinity(trace, model, reqData, headers)
+
+	// 请求特征只提取一次：估算的输入 token 数供路由 TPM 限流使用，需要的能力供按能力选路使用，同时用于匹配内容路由规则
+	features := inspectRequest(reqData, stream)
+	trace.estimated = features.InputTokens
+	trace.needs = requestNeeds(reqData, features)
+
+	// 重定向关键字支持带后缀的模型名，先去掉 Gemini streamGenerateContent 后缀
+	realModel := strings.TrimSuffix(model, ":streamGenerateContent")
+	route, isRedirect, err := s.resolveRedirect(realModel, features, trace)
+	if isRedirect {
+		if err != nil {
+			if isCapabilityError(err) {
+				return nil, model, err
+			}
+			return nil, model, &routeLookupError{status: http.StatusNotFound, err: fmt.Errorf("redirect target not configured or not found: %v", err)}
+		}
+		log.Infof("Redirecting %s to route: %s (model: %s, id: %d)", realModel, route.Name, route.Model, route.ID)
+		reqData["model"] = trace.redirectModel
+		return route, trace.redirectModel, nil
+	}
+
+	route, err = s.selectRoute(model, trace, nil)
+	if err == nil {
+		return route, model, nil
+	}
+	if isCapabilityError(err) {
+		return nil, model, err
+	}
+	if strings.Contains(err.Error(), "model not found") {
+		availableModels, _ := s.routeService.GetAvailableModels()
+		return nil, model, &routeLookupError{status: http.StatusNotFound, err: fmt.Errorf("model '%s' not found in route list. Available models: %v", model, availableModels)}
 	}
+	// 所有路由均已熔断等情况
+	return nil, model, &routeLookupError{status: http.StatusServiceUnavailable, err: fmt.Errorf("route lookup failed for model '%s': %v", model, err)}
 }
 
-// getRedirectRoute 获取重定向目标路�?
-// 如果配置�?RedirectTargetRouteID，优先使用该ID获取路由
-// 否则根据 RedirectTargetModel 查找路由
-func (s *ProxyService) getRedirectRoute() (*database.ModelRoute, error) {
-	// 优先使用指定的路由ID
-	if s.config.RedirectTargetRouteID > 0 {
-		route, err := s.routeService.GetRouteByID(s.config.RedirectTargetRouteID)
-		if err == nil {
-			return route, nil
+// selectRoute 按优先级层和负载均衡策略选择路由，跳过 exclude 中的路由以及熔断、不健康或不具备所需能力的路由
+// 分组、会话绑定和测试目标取自 trace
+func (s *ProxyService) selectRoute(model string, trace *requestTrace, exclude map[int64]bool) (*database.ModelRoute, error) {
+	if trace.test != nil {
+		if exclude[trace.test.routeID] {
+			return nil, fmt.Errorf("route test does not fail over to other routes")
+		}
+		return s.routeService.GetRouteByIDIncludeDisabled(trace.test.routeID)
+	}
+	group := trace.group
+	routes, err := s.routeService.GetRoutesByModelInGroup(model, group)
+	if err != nil {
+		return nil, err
+	}
+	if len(routes) == 0 && group != "" && group == s.defaultRouteGroup() {
+		routes, err = s.routeService.GetRoutesByModel(model)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(routes) == 0 {
+		if group != "" {
+			return nil, fmt.Errorf("model not found: %s (group: %s)", model, group)
+		}
+		return nil, fmt.Errorf("model not found: %s", model)
+	}
+
+	candidates := make([]database.ModelRoute, 0, len(routes))
+	var unhealthy []database.ModelRoute
+	var unsupported []string
+	circuitOpen := 0
+	for _, route := range routes {
+		if exclude[route.ID] {
+			continue
+		}
+		if reason := routeCapabilities(&route).unsupportedReason(trace.needs); reason != "" {
+			log.Infof("[Capability] Skipping route %s (id=%d) for model %s: %s", route.Name, route.ID, model, reason)
+			unsupported = append(unsupported, route.Name+": "+reason)
+			continue
+		}
+		if !s.breaker.Available(route.ID) {
+			circuitOpen++
+			continue
+		}
+		if s.config.HealthCheckSkipUnhealthy && !s.healthChecker.IsHealthy(route.ID) {
+			unhealthy = append(unhealthy, route)
+			continue
+		}
+		candidates = append(candidates, route)
+	}
+	if len(candidates) == 0 && len(unhealthy) > 0 {
+		log.Warnf("No healthy route for model %s, falling back to %d unhealthy route(s)", model, len(unhealthy))
+		candidates = unhealthy
+	}
+	if len(unsupported) == len(routes) {
+		return nil, &capabilityError{model: model, reasons: unsupported}
+	}
+
+	if len(candidates) > 0 {
+		tier := topPriorityTier(candidates)
+		route := s.stickyRoute(trace, tier)
+		if route != nil {
+			log.Infof("[Affinity] Reusing route %s (id=%d) for session of model %s", route.Name, route.ID, model)
+		} else {
+			route = s.loadBalancer.Pick(model, s.GetModelStrategy(model), tier)
+		}
+		if route.Priority > 0 {
+			log.Infof("Using priority tier %d for model %s (route: %s)", route.Priority, model, route.Name)
 		}
-		log.Warnf("Failed to get route by ID %d, falling back to model lookup: %v", s.config.RedirectTargetRouteID, err)
+		return route, nil
+	}
+
+	if circuitOpen > 0 {
+		return nil, fmt.Errorf("no available route for model: %s (%d route(s) circuit open)", model, circuitOpen)
+	}
+	return nil, fmt.Errorf("no available route for model: %s", model)
+}
+
+// GetModelStrategy 获取模型生效的负载均衡策略（模型级配置优先）
+func (s *ProxyService) GetModelStrategy(model string) string {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	if strategy, ok := s.config.ModelStrategies[model]; ok && IsValidStrategy(strategy) {
+		return strategy
+	}
+	if IsValidStrategy(s.config.LoadBalanceStrategy) {
+		return s.config.LoadBalanceStrategy
+	}
+	return DefaultLoadBalanceStrategy
+}
+
+// ConfigSnapshot 获取当前配置的副本，其中的切片和 map 只读
+func (s *ProxyService) ConfigSnapshot() config.Config {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	return *s.config
+}
+
+// UpdateConfig 在配置写锁内修改配置并保存，避免和请求路径上的读取以及其他修改并发
+func (s *ProxyService) UpdateConfig(update func(cfg *config.Config)) error {
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+	update(s.config)
+	return s.config.Save()
+}
+
+// SetDefaultStrategy 设置默认负载均衡策略
+func (s *ProxyService) SetDefaultStrategy(strategy string) error {
+	if !IsValidStrategy(strategy) {
+		return fmt.Errorf("invalid load balance strategy: %s", strategy)
+	}
+	return s.UpdateConfig(func(cfg *config.Config) {
+		cfg.LoadBalanceStrategy = strategy
+	})
+}
+
+// SetModelStrategy 设置单个模型的负载均衡策略，strategy 为空时恢复默认策略
+func (s *ProxyService) SetModelStrategy(model, strategy string) error {
+	if model == "" {
+		return fmt.Errorf("model is required")
 	}
+	if strategy != "" && !IsValidStrategy(strategy) {
+		return fmt.Errorf("invalid load balance strategy: %s", strategy)
+	}
+
+	// 复制后修改再整体替换，已发布的 map 不会被并发写入
+	err := s.UpdateConfig(func(cfg *config.Config) {
+		strategies := copyStrategies(cfg.ModelStrategies)
+		if strategy == "" {
+			delete(strategies, model)
+		} else {
+			strategies[model] = strategy
+		}
+		cfg.ModelStrategies = strategies
+	})
+
+	log.Infof("Load balance strategy for %s set to: %s", model, s.GetModelStrategy(model))
+	return err
+}
+
+// GetModelStrategies 获取按模型配置的负载均衡策略（副本）
+func (s *ProxyService) GetModelStrategies() map[string]string {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	return copyStrategies(s.config.ModelStrategies)
+}
 
-	// 回退到按模型名查�?
-	if s.config.RedirectTargetModel == "" {
-		return nil, fmt.Errorf("redirect target model not configured")
+// copyStrategies 复制模型策略 map
+func copyStrategies(src map[string]string) map[string]string {
+	strategies := make(map[string]string, len(src))
+	for model, strategy := range src {
+		strategies[model] = strategy
 	}
-	return s.routeService.GetRouteByModel(s.config.RedirectTargetModel)
+	return strategies
 }
 
 // ProxyRequest 代理请求
-func (s *ProxyService) ProxyRequest(requestBody []byte, headers map[string]string) ([]byte, int, error) {
+func (s *ProxyService) ProxyRequest(ctx context.Context, requestBody []byte, headers map[string]string) ([]byte, int, error) {
 	// 解析请求
 	var reqData map[string]interface{}
 	if err := json.Unmarshal(requestBody, &reqData); err != nil {
@@ -66,6 +292,9 @@ func (s *ProxyService) ProxyRequest(requestBody []byte, headers map[string]strin
 		return nil, http.StatusBadRequest, fmt.Errorf("'model' field is required")
 	}
 
+	trace := s.traceRequest(ctx, headers)
+	requested := model
+
 	// 详细日志：记录请求头和请求体
 	log.Infof("=== PROXY REQUEST START ===")
 	log.Infof("Request model: %s", model)
@@ -81,106 +310,98 @@ func (s *ProxyService) ProxyRequest(requestBody []byte, headers map[string]strin
 	log.Infof("Request body: %s", string(requestBody))
 	log.Infof("=== PROXY REQUEST DETAILS ===")
 
-	// 提取真实的模型名（处�?Gemini streamGenerateContent 的情况）
-	realModel := model
-	if strings.Contains(model, ":streamGenerateContent") {
-		realModel = strings.TrimSuffix(model, ":streamGenerateContent")
-	}
-
-	// 首先检查是否是重定向关键字（支持带后缀的模型名�?
-	var route *database.ModelRoute
-	var err error
-	isRedirect := s.config.RedirectEnabled && (realModel == s.config.RedirectKeyword || strings.HasPrefix(realModel, s.config.RedirectKeyword+":"))
-
-	if isRedirect {
-		// 使用重定向路�?
-		route, err = s.getRedirectRoute()
-		if err != nil {
-			return nil, http.StatusNotFound, fmt.Errorf("redirect target not configured or not found: %v", err)
+	route, model, err := s.resolveRequestRoute(model, headers, reqData, false, trace)
+	if err != nil {
+		if isCapabilityError(err) {
+			return capabilityResponse(protocolOpenAI, err), http.StatusBadRequest, nil
 		}
-		log.Infof("Redirecting %s to route: %s (model: %s, id: %d)", realModel, route.Name, route.Model, route.ID)
-		model = route.Model
-		reqData["model"] = model
-
-		// 重新编码请求�?
+		return nil, routeErrorStatus(err), err
+	}
+	if model != requested {
 		requestBody, _ = json.Marshal(reqData)
-	} else {
-		// 查找路由
-		route, err = s.routeService.GetRouteByModel(model)
-		if err != nil {
-			availableModels, _ := s.routeService.GetAvailableModels()
-			return nil, http.StatusNotFound, fmt.Errorf("model '%s' not found in route list. Available models: %v", model, availableModels)
-		}
 	}
 
-	// 检查是否需要进�?API 转换
-	var transformedBody []byte
-	var targetURL string
+	// 检查是否需要进行 API 转换，每条候选路由都需要重新检测
+	var adapterName string
+	buildRequest := func(route *database.ModelRoute) (*http.Request, error) {
+		// 按路由配置的上游模型名改写请求
+		upstreamModel, upstreamReq, upstreamBody := withUpstreamModel(route, model, reqData, requestBody)
 
-	// 清理路由 API URL（移除末尾斜杠）
-	cleanAPIUrl := strings.TrimSuffix(route.APIUrl, "/")
+		var transformedBody []byte
+		var targetURL string
 
-	// 智能检测适配�? 基于路由format和请求格�?(OpenAI格式请求)
-	adapterName := s.detectAdapterForRoute(route, "openai")
-	if adapterName != "" {
-		// 使用适配器转换请�?
-		adapter := adapters.GetAdapter(adapterName)
-		transformedReq, err := adapter.AdaptRequest(reqData, model)
+		// 清理路由 API URL（移除末尾斜杠）
+		cleanAPIUrl := strings.TrimSuffix(route.APIUrl, "/")
+
+		// 智能检测适配器: 基于路由format和请求格式 (OpenAI格式请求)
+		adapterName = s.detectAdapterForRoute(route, "openai")
+		if adapterName != "" {
+			// 使用适配器转换请求
+			adapter := adapters.GetAdapter(adapterName)
+			transformedReq, err := adapter.AdaptRequest(upstreamReq, upstreamModel)
+			if err != nil {
+				log.Errorf("Failed to adapt request: %v", err)
+				return nil, err
+			}
+			transformedBody, _ = json.Marshal(transformedReq)
+			targetURL = s.buildAdapterURL(cleanAPIUrl, adapterName, upstreamModel)
+		} else {
+			// 不使用适配器，直接转发
+			transformedBody = upstreamBody
+			targetURL = buildOpenAIChatURL(route.APIUrl)
+		}
+
+		// 详细日志：记录目标路由信息
+		log.Infof("=== ROUTE TARGET ===")
+		log.Infof("Target URL: %s", targetURL)
+		log.Infof("Route name: %s", route.Name)
+		log.Infof("Route API URL: %s", route.APIUrl)
+		log.Infof("Route model: %s", route.Model)
+		log.Infof("Route format: %s", route.Format)
+		log.Infof("Route group: %s", route.Group)
+		log.Infof("Route enabled: %v", route.Enabled)
+		log.Infof("Adapter used: %s", adapterName)
+		log.Infof("Transformed body: %s", string(transformedBody))
+		log.Infof("=== ROUTE TARGET END ===")
+
+		log.Infof("Routing to: %s (route: %s)", targetURL, route.Name)
+
+		// 创建代理请求
+		proxyReq, err := http.NewRequest("POST", targetURL, bytes.NewReader(transformedBody))
 		if err != nil {
-			log.Errorf("Failed to adapt request: %v", err)
-			return nil, http.StatusInternalServerError, err
+			return nil, err
 		}
-		transformedBody, _ = json.Marshal(transformedReq)
-		targetURL = s.buildAdapterURL(cleanAPIUrl, adapterName, model)
-	} else {
-		// 不使用适配器，直接转发
-		transformedBody = requestBody
-		targetURL = buildOpenAIChatURL(route.APIUrl)
-	}
-
-	// 详细日志：记录目标路由信�?
-	log.Infof("=== ROUTE TARGET ===")
-	log.Infof("Target URL: %s", targetURL)
-	log.Infof("Route name: %s", route.Name)
-	log.Infof("Route API URL: %s", route.APIUrl)
-	log.Infof("Route model: %s", route.Model)
-	log.Infof("Route format: %s", route.Format)
-	log.Infof("Route group: %s", route.Group)
-	log.Infof("Route enabled: %v", route.Enabled)
-	log.Infof("Adapter used: %s", adapterName)
-	log.Infof("Transformed body: %s", string(transformedBody))
-	log.Infof("=== ROUTE TARGET END ===")
-
-	log.Infof("Routing to: %s (route: %s)", targetURL, route.Name)
-
-	// 创建代理请求
-	proxyReq, err := http.NewRequest("POST", targetURL, bytes.NewReader(transformedBody))
-	if err != nil {
-		return nil, http.StatusInternalServerError, err
-	}
 
-	// 设置请求�?
-	proxyReq.Header.Set("Content-Type", "application/json")
+		// 设置请求头
+		proxyReq.Header.Set("Content-Type", "application/json")
 
-	// 使用路由配置�?API Key（如果有），否则透传原始 Authorization
-	if route.APIKey != "" {
-		proxyReq.Header.Set("Authorization", "Bearer "+route.APIKey)
-	} else if auth := headers["Authorization"]; auth != "" {
-		proxyReq.Header.Set("Authorization", auth)
+		// 使用路由配置的 API Key（如果有），否则透传原始 Authorization
+		if route.APIKey != "" {
+			proxyReq.Header.Set("Authorization", "Bearer "+route.APIKey)
+		} else if auth := headers["Authorization"]; auth != "" {
+			proxyReq.Header.Set("Authorization", auth)
+		}
+		return proxyReq, nil
 	}
 
-	// 发送请�?
+	// 发送请求（失败时自动切换到下一条路由）
 	startTime := time.Now()
-	resp, err := s.httpClient.Do(proxyReq)
+	resp, route, err := s.sendWithFailover(model, route, trace, buildRequest)
 	if err != nil {
-		s.routeService.LogRequest(model, route.ID, 0, 0, 0, false, err.Error())
+		if isRequestBuildError(err) {
+			return nil, http.StatusInternalServerError, err
+		}
+		s.logRequest(model, route.ID, trace, 0, 0, 0, false, err.Error())
+		if isRateLimitError(err) {
+			return rateLimitResponse(protocolOpenAI, err), http.StatusTooManyRequests, nil
+		}
 		return nil, http.StatusServiceUnavailable, fmt.Errorf("backend service unavailable: %v", err)
 	}
 	defer resp.Body.Close()
 
 	responseBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		s.routeService.LogRequest(model, route.ID, 0, 0, 0, false, err.Error())
+		s.logRequest(model, route.ID, trace, 0, 0, 0, false, err.Error())
 		return nil, http.StatusInternalServerError, err
 	}
 
@@ -202,14 +423,18 @@ func (s *ProxyService) ProxyRequest(requestBody []byte, headers map[string]strin
 		var respData map[string]interface{}
 		if err := json.Unmarshal(responseBody, &respData); err == nil {
 			if usage, ok := respData["usage"].(map[string]interface{}); ok {
-				totalTokens := int(usage["total_tokens"].(float64))
-				promptTokens := int(usage["prompt_tokens"].(float64))
-				completionTokens := int(usage["completion_tokens"].(float64))
-				s.routeService.LogRequest(model, route.ID, promptTokens, completionTokens, totalTokens, true, "")
+				// 经过适配器的上游（如 Claude）返回 input_tokens / output_tokens，没有 total_tokens
+				promptTokens := usageTokens(usage, "prompt_tokens", "input_tokens")
+				completionTokens := usageTokens(usage, "completion_tokens", "output_tokens")
+				totalTokens := usageTokens(usage, "total_tokens")
+				if totalTokens == 0 {
+					totalTokens = promptTokens + completionTokens
+				}
+				s.logRequest(model, route.ID, trace, promptTokens, completionTokens, totalTokens, true, "")
 			}
 		}
 	} else {
-		s.routeService.LogRequest(model, route.ID, 0, 0, 0, false, string(responseBody))
+		s.logRequest(model, route.ID, trace, 0, 0, 0, false, string(responseBody))
 	}
 
 	// 如果使用了适配器，转换响应
@@ -236,7 +461,7 @@ func (s *ProxyService) ProxyRequest(requestBody []byte, headers map[string]strin
 }
 
 // ProxyStreamRequest 代理流式请求
-func (s *ProxyService) ProxyStreamRequest(requestBody []byte, headers map[string]string, writer io.Writer, flusher http.Flusher) error {
+func (s *ProxyService) ProxyStreamRequest(ctx context.Context, requestBody []byte, headers map[string]string, writer io.Writer, flusher http.Flusher) error {
 	// 解析请求
 	var reqData map[string]interface{}
 	if err := json.Unmarshal(requestBody, &reqData); err != nil {
@@ -248,6 +473,7 @@ func (s *ProxyService) ProxyStreamRequest(requestBody []byte, headers map[string
 		return fmt.Errorf("'model' field is required")
 	}
 
+	trace := s.traceRequest(ctx, headers)
 	originalModel := model
 
 	// 详细日志：记录流式请求开�?
@@ -264,113 +490,104 @@ func (s *ProxyService) ProxyStreamRequest(requestBody []byte, headers map[string
 	}
 	log.Infof("Stream request body: %s", string(requestBody))
 
-	// 提取真实的模型名（处理 Gemini streamGenerateContent 的情况）
-	realModel := model
-	if strings.Contains(model, ":streamGenerateContent") {
-		realModel = strings.TrimSuffix(model, ":streamGenerateContent")
-	}
-
-	// 首先检查是否是重定向关键字
-	var route *database.ModelRoute
-	var err error
-	isRedirect := s.config.RedirectEnabled && (realModel == s.config.RedirectKeyword || strings.HasPrefix(realModel, s.config.RedirectKeyword+":"))
-
-	if isRedirect {
-		route, err = s.getRedirectRoute()
-		if err != nil {
-			return fmt.Errorf("redirect target not configured or not found: %v", err)
+	route, model, err := s.resolveRequestRoute(model, headers, reqData, true, trace)
+	if err != nil {
+		if isCapabilityError(err) {
+			return writeCapabilityError(writer, protocolOpenAI, err)
 		}
-		log.Infof("Redirecting %s to route: %s (model: %s, id: %d)", realModel, route.Name, route.Model, route.ID)
-		model = route.Model
-		reqData["model"] = model
+		return err
+	}
+	if model != originalModel {
 		requestBody, _ = json.Marshal(reqData)
-	} else {
-		// 查找路由
-		route, err = s.routeService.GetRouteByModel(model)
-		if err != nil {
-			// 检查是否是"模型未找到"错误
-			if strings.Contains(err.Error(), "model not found") {
-				availableModels, _ := s.routeService.GetAvailableModels()
-				return fmt.Errorf("model '%s' not found in route list. Available models: %v", model, availableModels)
-			}
-			// 其他路由相关错误
-			return fmt.Errorf("route lookup failed for model '%s': %v", model, err)
-		}
 	}
 
-	// 清理路由 API URL（移除末尾斜杠）
-	cleanAPIUrl := strings.TrimSuffix(route.APIUrl, "/")
-
 	// 智能检测适配器: 基于路由format和请求格式 (OpenAI格式请求)
-	adapterName := s.detectAdapterForRoute(route, "openai")
-	var transformedBody []byte
-	var targetURL string
-
-	if adapterName != "" {
-		// 使用适配器转换请�?
-		adapter := adapters.GetAdapter(adapterName)
-		if adapter == nil {
-			return fmt.Errorf("adapter not found: %s", adapterName)
-		}
+	var adapterName string
+	buildRequest := func(route *database.ModelRoute) (*http.Request, error) {
+		// 按路由配置的上游模型名改写请求
+		upstreamModel, upstreamReq, upstreamBody := withUpstreamModel(route, model, reqData, requestBody)
+
+		// 清理路由 API URL（移除末尾斜杠）
+		cleanAPIUrl := strings.TrimSuffix(route.APIUrl, "/")
+
+		adapterName = s.detectAdapterForRoute(route, "openai")
+		var transformedBody []byte
+		var targetURL string
+
+		if adapterName != "" {
+			// 使用适配器转换请求
+			adapter := adapters.GetAdapter(adapterName)
+			if adapter == nil {
+				return nil, fmt.Errorf("adapter not found: %s", adapterName)
+			}
 
-		// 确保开启stream
-		reqData["stream"] = true
-		transformedReq, err := adapter.AdaptRequest(reqData, model)
+			// 确保开启stream
+			upstreamReq["stream"] = true
+			transformedReq, err := adapter.AdaptRequest(upstreamReq, upstreamModel)
+			if err != nil {
+				log.Errorf("Failed to adapt request: %v", err)
+				return nil, err
+			}
+			transformedBody, _ = json.Marshal(transformedReq)
+			// 对流式请求使用专门的URL构建函数
+			targetURL = s.buildAdapterStreamURL(cleanAPIUrl, adapterName, upstreamModel)
+			log.Infof("Streaming to: %s (route: %s, adapter: %s)", targetURL, route.Name, adapterName)
+		} else {
+			// 不使用适配器，直接转发
+			transformedBody = upstreamBody
+			targetURL = buildOpenAIChatURL(route.APIUrl)
+			log.Infof("Streaming to: %s (route: %s)", targetURL, route.Name)
+		}
+
+		// 详细日志：记录流式请求目标路由信息
+		log.Infof("=== STREAM ROUTE TARGET ===")
+		log.Infof("Stream target URL: %s", targetURL)
+		log.Infof("Stream route name: %s", route.Name)
+		log.Infof("Stream route API URL: %s", route.APIUrl)
+		log.Infof("Stream route model: %s", route.Model)
+		log.Infof("Stream route format: %s", route.Format)
+		log.Infof("Stream route group: %s", route.Group)
+		log.Infof("Stream route enabled: %v", route.Enabled)
+		log.Infof("Stream adapter used: %s", adapterName)
+		log.Infof("Stream transformed body: %s", string(transformedBody))
+		log.Infof("=== STREAM ROUTE TARGET END ===")
+
+		// 创建代理请求
+		proxyReq, err := http.NewRequest("POST", targetURL, bytes.NewReader(transformedBody))
 		if err != nil {
-			log.Errorf("Failed to adapt request: %v", err)
-			return err
+			return nil, err
 		}
-		transformedBody, _ = json.Marshal(transformedReq)
-		// 对流式请求使用专门的URL构建函数
-		targetURL = s.buildAdapterStreamURL(cleanAPIUrl, adapterName, model)
-		log.Infof("Streaming to: %s (route: %s, adapter: %s)", targetURL, route.Name, adapterName)
-	} else {
-		// 不使用适配器，直接转发
-		transformedBody = requestBody
-		targetURL = buildOpenAIChatURL(route.APIUrl)
-		log.Infof("Streaming to: %s (route: %s)", targetURL, route.Name)
-	}
-
-	// 详细日志：记录流式请求目标路由信�?
-	log.Infof("=== STREAM ROUTE TARGET ===")
-	log.Infof("Stream target URL: %s", targetURL)
-	log.Infof("Stream route name: %s", route.Name)
-	log.Infof("Stream route API URL: %s", route.APIUrl)
-	log.Infof("Stream route model: %s", route.Model)
-	log.Infof("Stream route format: %s", route.Format)
-	log.Infof("Stream route group: %s", route.Group)
-	log.Infof("Stream route enabled: %v", route.Enabled)
-	log.Infof("Stream adapter used: %s", adapterName)
-	log.Infof("Stream transformed body: %s", string(transformedBody))
-	log.Infof("=== STREAM ROUTE TARGET END ===")
-
-	// 创建代理请求
-	proxyReq, err := http.NewRequest("POST", targetURL, bytes.NewReader(transformedBody))
-	if err != nil {
-		return err
-	}
 
-	proxyReq.Header.Set("Content-Type", "application/json")
-	if route.APIKey != "" {
-		proxyReq.Header.Set("Authorization", "Bearer "+route.APIKey)
-	} else if auth := headers["Authorization"]; auth != "" {
-		proxyReq.Header.Set("Authorization", auth)
-	}
+		proxyReq.Header.Set("Content-Type", "application/json")
+		if route.APIKey != "" {
+			proxyReq.Header.Set("Authorization", "Bearer "+route.APIKey)
+		} else if auth := headers["Authorization"]; auth != "" {
+			proxyReq.Header.Set("Authorization", auth)
+		}
 
-	// Claude需要特殊的版本�?
-	if adapterName == "anthropic" {
-		proxyReq.Header.Set("anthropic-version", "2023-06-01")
+		// Claude需要特殊的版本头
+		if adapterName == "anthropic" {
+			proxyReq.Header.Set("anthropic-version", "2023-06-01")
+		}
+		return proxyReq, nil
 	}
 
-	// 发送请�?
-	resp, err := s.httpClient.Do(proxyReq)
+	// 发送请求（失败时自动切换到下一条路由）
+	resp, route, err := s.sendWithFailover(model, route, trace, buildRequest)
 	if err != nil {
+		if !isRequestBuildError(err) {
+			s.logRequest(model, route.ID, trace, 0, 0, 0, false, err.Error())
+		}
+		if isRateLimitError(err) {
+			return writeRateLimitError(writer, protocolOpenAI, err)
+		}
 		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
+		s.logRequest(model, route.ID, trace, 0, 0, 0, false, string(body))
 		return fmt.Errorf("backend error: %d - %s", resp.StatusCode, string(body))
 	}
 
@@ -386,7 +603,7 @@ func (s *ProxyService) ProxyStreamRequest(requestBody []byte, headers map[string
 }
 
 // ProxyStreamRequestWithAdapter 代理流式请求，使用指定的适配�?
-func (s *ProxyService) ProxyStreamRequestWithAdapter(requestBody []byte, headers map[string]string, writer io.Writer, flusher http.Flusher, forceAdapter string) error {
+func (s *ProxyService) ProxyStreamRequestWithAdapter(ctx context.Context, requestBody []byte, headers map[string]string, writer io.Writer, flusher http.Flusher, forceAdapter string) error {
 	// 解析请求
 	var reqData map[string]interface{}
 	if err := json.Unmarshal(requestBody, &reqData); err != nil {
@@ -398,6 +615,7 @@ func (s *ProxyService) ProxyStreamRequestWithAdapter(requestBody []byte, headers
 		return fmt.Errorf("'model' field is required")
 	}
 
+	trace := s.traceRequest(ctx, headers)
 	originalModel := model
 
 	// 详细日志：记录流式请求开�?
@@ -414,115 +632,103 @@ func (s *ProxyService) ProxyStreamRequestWithAdapter(requestBody []byte, headers
 	}
 	log.Infof("Stream request body: %s", string(requestBody))
 
-	// 提取真实的模型名（处理 Gemini streamGenerateContent 的情况）
-	realModel := model
-	if strings.Contains(model, ":streamGenerateContent") {
-		realModel = strings.TrimSuffix(model, ":streamGenerateContent")
-	}
-
-	// 首先检查是否是重定向关键字
-	var route *database.ModelRoute
-	var err error
-	isRedirect := s.config.RedirectEnabled && (realModel == s.config.RedirectKeyword || strings.HasPrefix(realModel, s.config.RedirectKeyword+":"))
-
-	if isRedirect {
-		route, err = s.getRedirectRoute()
-		if err != nil {
-			return fmt.Errorf("redirect target not configured or not found: %v", err)
+	route, model, err := s.resolveRequestRoute(model, headers, reqData, true, trace)
+	if err != nil {
+		if isCapabilityError(err) {
+			return writeCapabilityError(writer, protocolClaude, err)
 		}
-		log.Infof("Redirecting %s to route: %s (model: %s, id: %d)", realModel, route.Name, route.Model, route.ID)
-		model = route.Model
-		reqData["model"] = model
+		return err
+	}
+	if model != originalModel {
 		requestBody, _ = json.Marshal(reqData)
-	} else {
-		// 查找路由
-		route, err = s.routeService.GetRouteByModel(model)
-		if err != nil {
-			// 检查是否是"模型未找到"错误
-			if strings.Contains(err.Error(), "model not found") {
-				availableModels, _ := s.routeService.GetAvailableModels()
-				return fmt.Errorf("model '%s' not found in route list. Available models: %v", model, availableModels)
-			}
-			// 其他路由相关错误
-			return fmt.Errorf("route lookup failed for model '%s': %v", model, err)
-		}
 	}
 
-	// 清理路由 API URL（移除末尾斜杠）
-	cleanAPIUrl := strings.TrimSuffix(route.APIUrl, "/")
-
 	// 强制使用指定的适配器（如果为空则不使用适配器转换请求）
-	var transformedBody []byte
-	var targetURL string
-	var adapter adapters.Adapter
+	buildRequest := func(route *database.ModelRoute) (*http.Request, error) {
+		// 按路由配置的上游模型名改写请求
+		upstreamModel, upstreamReq, upstreamBody := withUpstreamModel(route, model, reqData, requestBody)
 
-	if forceAdapter != "" {
-		// 使用指定的适配器转换请�?
-		adapter = adapters.GetAdapter(forceAdapter)
-		if adapter == nil {
-			return fmt.Errorf("forced adapter not found: %s", forceAdapter)
-		}
+		// 清理路由 API URL（移除末尾斜杠）
+		cleanAPIUrl := strings.TrimSuffix(route.APIUrl, "/")
 
-		// 确保开启stream
-		reqData["stream"] = true
-		transformedReq, err := adapter.AdaptRequest(reqData, model)
+		var transformedBody []byte
+		var targetURL string
+
+		if forceAdapter != "" {
+			// 使用指定的适配器转换请求
+			adapter := adapters.GetAdapter(forceAdapter)
+			if adapter == nil {
+				return nil, fmt.Errorf("forced adapter not found: %s", forceAdapter)
+			}
+
+			// 确保开启stream
+			upstreamReq["stream"] = true
+			transformedReq, err := adapter.AdaptRequest(upstreamReq, upstreamModel)
+			if err != nil {
+				log.Errorf("Failed to adapt request: %v", err)
+				return nil, err
+			}
+			transformedBody, _ = json.Marshal(transformedReq)
+			targetURL = s.buildAdapterStreamURL(cleanAPIUrl, forceAdapter, upstreamModel)
+		} else {
+			// 不使用适配器，直接转发原始请求
+			transformedBody = upstreamBody
+			targetURL = buildOpenAIChatURL(route.APIUrl)
+
+			// 确保开启stream
+			upstreamReq["stream"] = true
+		}
+		log.Infof("Streaming to: %s (route: %s, adapter: %s)", targetURL, route.Name, forceAdapter)
+
+		// 详细日志：记录流式请求目标路由信息
+		log.Infof("=== STREAM ROUTE TARGET ===")
+		log.Infof("Stream target URL: %s", targetURL)
+		log.Infof("Stream route name: %s", route.Name)
+		log.Infof("Stream route API URL: %s", route.APIUrl)
+		log.Infof("Stream route model: %s", route.Model)
+		log.Infof("Stream route format: %s", route.Format)
+		log.Infof("Stream route group: %s", route.Group)
+		log.Infof("Stream route enabled: %v", route.Enabled)
+		log.Infof("Stream adapter used: %s", forceAdapter)
+		log.Infof("Stream transformed body: %s", string(transformedBody))
+		log.Infof("=== STREAM ROUTE TARGET END ===")
+
+		// 创建代理请求
+		proxyReq, err := http.NewRequest("POST", targetURL, bytes.NewReader(transformedBody))
 		if err != nil {
-			log.Errorf("Failed to adapt request: %v", err)
-			return err
+			return nil, err
 		}
-		transformedBody, _ = json.Marshal(transformedReq)
-		targetURL = s.buildAdapterStreamURL(cleanAPIUrl, forceAdapter, model)
-	} else {
-		// 不使用适配器，直接转发原始请求
-		transformedBody = requestBody
-		adapter = nil
-		targetURL = buildOpenAIChatURL(route.APIUrl)
-
-		// 确保开启stream
-		reqData["stream"] = true
-	}
-	log.Infof("Streaming to: %s (route: %s, adapter: %s)", targetURL, route.Name, forceAdapter)
-
-	// 详细日志：记录流式请求目标路由信�?
-	log.Infof("=== STREAM ROUTE TARGET ===")
-	log.Infof("Stream target URL: %s", targetURL)
-	log.Infof("Stream route name: %s", route.Name)
-	log.Infof("Stream route API URL: %s", route.APIUrl)
-	log.Infof("Stream route model: %s", route.Model)
-	log.Infof("Stream route format: %s", route.Format)
-	log.Infof("Stream route group: %s", route.Group)
-	log.Infof("Stream route enabled: %v", route.Enabled)
-	log.Infof("Stream adapter used: %s", forceAdapter)
-	log.Infof("Stream transformed body: %s", string(transformedBody))
-	log.Infof("=== STREAM ROUTE TARGET END ===")
-
-	// 创建代理请求
-	proxyReq, err := http.NewRequest("POST", targetURL, bytes.NewReader(transformedBody))
-	if err != nil {
-		return err
-	}
 
-	proxyReq.Header.Set("Content-Type", "application/json")
-	if route.APIKey != "" {
-		proxyReq.Header.Set("Authorization", "Bearer "+route.APIKey)
-	} else if auth := headers["Authorization"]; auth != "" {
-		proxyReq.Header.Set("Authorization", auth)
-	}
+		proxyReq.Header.Set("Content-Type", "application/json")
+		if route.APIKey != "" {
+			proxyReq.Header.Set("Authorization", "Bearer "+route.APIKey)
+		} else if auth := headers["Authorization"]; auth != "" {
+			proxyReq.Header.Set("Authorization", auth)
+		}
 
-	// Claude需要特殊的版本�?
-	if forceAdapter == "anthropic" {
-		proxyReq.Header.Set("anthropic-version", "2023-06-01")
+		// Claude需要特殊的版本头
+		if forceAdapter == "anthropic" {
+			proxyReq.Header.Set("anthropic-version", "2023-06-01")
+		}
+		return proxyReq, nil
 	}
 
-	// 发送请�?
-	resp, err := s.httpClient.Do(proxyReq)
+	// 发送请求（失败时自动切换到下一条路由）
+	resp, route, err := s.sendWithFailover(model, route, trace, buildRequest)
 	if err != nil {
+		if !isRequestBuildError(err) {
+			s.logRequest(model, route.ID, trace, 0, 0, 0, false, err.Error())
+		}
+		if isRateLimitError(err) {
+			return writeRateLimitError(writer, protocolClaude, err)
+		}
 		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
+		s.logRequest(model, route.ID, trace, 0, 0, 0, false, string(body))
 		return fmt.Errorf("backend error: %d - %s", resp.StatusCode, string(body))
 	}
 
@@ -531,7 +737,7 @@ func (s *ProxyService) ProxyStreamRequestWithAdapter(requestBody []byte, headers
 }
 
 // ProxyStreamRequestWithClaudeConversion 代理流式请求，保持原始请求格式但将响应转换为 Claude 格式
-func (s *ProxyService) ProxyStreamRequestWithClaudeConversion(requestBody []byte, headers map[string]string, writer io.Writer, flusher http.Flusher) error {
+func (s *ProxyService) ProxyStreamRequestWithClaudeConversion(ctx context.Context, requestBody []byte, headers map[string]string, writer io.Writer, flusher http.Flusher) error {
 	// 解析请求
 	var reqData map[string]interface{}
 	if err := json.Unmarshal(requestBody, &reqData); err != nil {
@@ -543,6 +749,7 @@ func (s *ProxyService) ProxyStreamRequestWithClaudeConversion(requestBody []byte
 		return fmt.Errorf("'model' field is required")
 	}
 
+	trace := s.traceRequest(ctx, headers)
 	originalModel := model
 
 	// 详细日志：记录流式请求开�?
@@ -559,73 +766,63 @@ func (s *ProxyService) ProxyStreamRequestWithClaudeConversion(requestBody []byte
 	}
 	log.Infof("Stream request body: %s", string(requestBody))
 
-	// 提取真实的模型名（处理 Gemini streamGenerateContent 的情况）
-	realModel := model
-	if strings.Contains(model, ":streamGenerateContent") {
-		realModel = strings.TrimSuffix(model, ":streamGenerateContent")
-	}
-
-	// 首先检查是否是重定向关键字
-	var route *database.ModelRoute
-	var err error
-	isRedirect := s.config.RedirectEnabled && (realModel == s.config.RedirectKeyword || strings.HasPrefix(realModel, s.config.RedirectKeyword+":"))
-
-	if isRedirect {
-		route, err = s.getRedirectRoute()
-		if err != nil {
-			return fmt.Errorf("redirect target not configured or not found: %v", err)
+	route, model, err := s.resolveRequestRoute(model, headers, reqData, true, trace)
+	if err != nil {
+		if isCapabilityError(err) {
+			return writeCapabilityError(writer, protocolClaude, err)
 		}
-		log.Infof("Redirecting %s to route: %s (model: %s, id: %d)", realModel, route.Name, route.Model, route.ID)
-		model = route.Model
-		reqData["model"] = model
+		return err
+	}
+	if model != originalModel {
 		requestBody, _ = json.Marshal(reqData)
-	} else {
-		// 查找路由
-		route, err = s.routeService.GetRouteByModel(model)
-		if err != nil {
-			// 检查是否是"模型未找到"错误
-			if strings.Contains(err.Error(), "model not found") {
-				availableModels, _ := s.routeService.GetAvailableModels()
-				return fmt.Errorf("model '%s' not found in route list. Available models: %v", model, availableModels)
-			}
-			// 其他路由相关错误
-			return fmt.Errorf("route lookup failed for model '%s': %v", model, err)
-		}
 	}
 
-	log.Infof("=== STREAM ROUTE TARGET ===")
-	log.Infof("Stream target URL: %s", buildOpenAIChatURL(route.APIUrl))
-	log.Infof("Stream route name: %s", route.Name)
-	log.Infof("Stream route API URL: %s", route.APIUrl)
-	log.Infof("Stream route model: %s", route.Model)
-	log.Infof("Stream route format: %s", route.Format)
-	log.Infof("Stream route group: %s", route.Group)
-	log.Infof("Stream route enabled: %v", route.Enabled)
-	log.Infof("Stream adapter used: openai-to-claude (response conversion only)")
-	log.Infof("=== STREAM ROUTE TARGET END ===")
+	buildRequest := func(route *database.ModelRoute) (*http.Request, error) {
+		// 按路由配置的上游模型名改写请求
+		_, _, upstreamBody := withUpstreamModel(route, model, reqData, requestBody)
 
-	// 创建代理请求
-	proxyReq, err := http.NewRequest("POST", buildOpenAIChatURL(route.APIUrl), bytes.NewReader(requestBody))
-	if err != nil {
-		return err
-	}
+		log.Infof("=== STREAM ROUTE TARGET ===")
+		log.Infof("Stream target URL: %s", buildOpenAIChatURL(route.APIUrl))
+		log.Infof("Stream route name: %s", route.Name)
+		log.Infof("Stream route API URL: %s", route.APIUrl)
+		log.Infof("Stream route model: %s", route.Model)
+		log.Infof("Stream route format: %s", route.Format)
+		log.Infof("Stream route group: %s", route.Group)
+		log.Infof("Stream route enabled: %v", route.Enabled)
+		log.Infof("Stream adapter used: openai-to-claude (response conversion only)")
+		log.Infof("=== STREAM ROUTE TARGET END ===")
+
+		// 创建代理请求
+		proxyReq, err := http.NewRequest("POST", buildOpenAIChatURL(route.APIUrl), bytes.NewReader(upstreamBody))
+		if err != nil {
+			return nil, err
+		}
 
-	proxyReq.Header.Set("Content-Type", "application/json")
-	if route.APIKey != "" {
-		proxyReq.Header.Set("Authorization", "Bearer "+route.APIKey)
-	} else if auth := headers["Authorization"]; auth != "" {
-		proxyReq.Header.Set("Authorization", auth)
+		proxyReq.Header.Set("Content-Type", "application/json")
+		if route.APIKey != "" {
+			proxyReq.Header.Set("Authorization", "Bearer "+route.APIKey)
+		} else if auth := headers["Authorization"]; auth != "" {
+			proxyReq.Header.Set("Authorization", auth)
+		}
+		return proxyReq, nil
 	}
 
-	// 发送请�?
-	resp, err := s.httpClient.Do(proxyReq)
+	// 发送请求（失败时自动切换到下一条路由）
+	resp, route, err := s.sendWithFailover(model, route, trace, buildRequest)
 	if err != nil {
+		if !isRequestBuildError(err) {
+			s.logRequest(model, route.ID, trace, 0, 0, 0, false, err.Error())
+		}
+		if isRateLimitError(err) {
+			return writeRateLimitError(writer, protocolClaude, err)
+		}
 		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
+		s.logRequest(model, route.ID, trace, 0, 0, 0, false, string(body))
 		return fmt.Errorf("backend error: %d - %s", resp.StatusCode, string(body))
 	}
 
@@ -634,7 +831,7 @@ func (s *ProxyService) ProxyStreamRequestWithClaudeConversion(requestBody []byte
 }
 
 // ProxyAnthropicRequest 代理 Anthropic 专用请求，不转换响应格式
-func (s *ProxyService) ProxyAnthropicRequest(requestBody []byte, headers map[string]string) ([]byte, int, error) {
+func (s *ProxyService) ProxyAnthropicRequest(ctx context.Context, requestBody []byte, headers map[string]string) ([]byte, int, error) {
 	// 解析请求
 	var reqData map[string]interface{}
 	if err := json.Unmarshal(requestBody, &reqData); err != nil {
@@ -646,112 +843,108 @@ func (s *ProxyService) ProxyAnthropicRequest(requestBody []byte, headers map[str
 		return nil, http.StatusBadRequest, fmt.Errorf("'model' field is required")
 	}
 
-	log.Infof("Received Anthropic request for model: %s", model)
-
-	// 提取真实的模型名（处理可能的后缀）
-	realModel := model
-	if strings.Contains(model, ":streamGenerateContent") {
-		realModel = strings.TrimSuffix(model, ":streamGenerateContent")
-	}
+	trace := s.traceRequest(ctx, headers)
+	requested := model
 
-	// 首先检查是否是重定向关键字（支持带后缀的模型名）
-	var route *database.ModelRoute
-	var err error
-	isRedirect := s.config.RedirectEnabled && (realModel == s.config.RedirectKeyword || strings.HasPrefix(realModel, s.config.RedirectKeyword+":"))
+	log.Infof("Received Anthropic request for model: %s", model)
 
-	if isRedirect {
-		route, err = s.getRedirectRoute()
-		if err != nil {
-			return nil, http.StatusNotFound, fmt.Errorf("redirect target not configured or not found: %v", err)
+	route, model, err := s.resolveRequestRoute(model, headers, reqData, false, trace)
+	if err != nil {
+		if isCapabilityError(err) {
+			return capabilityResponse(protocolClaude, err), http.StatusBadRequest, nil
 		}
-		log.Infof("Redirecting %s to route: %s (model: %s, id: %d)", realModel, route.Name, route.Model, route.ID)
-		model = route.Model
-		reqData["model"] = model
-
-		// 重新编码请求体
+		return nil, routeErrorStatus(err), err
+	}
+	if model != requested {
 		requestBody, _ = json.Marshal(reqData)
-	} else {
-		// 查找路由
-		route, err = s.routeService.GetRouteByModel(model)
-		if err != nil {
-			availableModels, _ := s.routeService.GetAvailableModels()
-			return nil, http.StatusNotFound, fmt.Errorf("model '%s' not found in route list. Available models: %v", model, availableModels)
-		}
 	}
 
-	// 检测是否需要进�?API 转换
-	// 对于 Anthropic 接口，我们收到的�?Anthropic 格式的请�?
-	var transformedBody []byte
-	var targetURL string
-
-	// 清理路由 API URL（移除末尾斜杠）
-	cleanAPIUrl := strings.TrimSuffix(route.APIUrl, "/")
-
-	// 智能检测适配�? 请求来自Claude格式,检测目标格�?
-	adapterName := s.detectAdapterForRoute(route, "claude")
+	// 检测是否需要进行 API 转换，每条候选路由都需要重新检测
+	// 对于 Anthropic 接口，我们收到的是 Anthropic 格式的请求
+	var adapterName string
+	buildRequest := func(route *database.ModelRoute) (*http.Request, error) {
+		// 按路由配置的上游模型名改写请求
+		upstreamModel, upstreamReq, upstreamBody := withUpstreamModel(route, model, reqData, requestBody)
+
+		var transformedBody []byte
+		var targetURL string
+
+		// 清理路由 API URL（移除末尾斜杠）
+		cleanAPIUrl := strings.TrimSuffix(route.APIUrl, "/")
+
+		// 智能检测适配器: 请求来自Claude格式,检测目标格式
+		adapterName = s.detectAdapterForRoute(route, "claude")
+
+		if adapterName == "" {
+			// 相同格式,直接转发 Anthropic 请求
+			transformedBody = upstreamBody
+			targetURL = buildClaudeMessagesURL(cleanAPIUrl)
+			log.Infof("Forwarding Anthropic request directly (no conversion needed)")
+		} else if adapterName == "claude-to-openai" {
+			// 上游是 OpenAI 格式，需要将 Anthropic 格式转换为 OpenAI 格式
+			adapter := adapters.GetAdapter("claude-to-openai")
+			if adapter == nil {
+				return nil, fmt.Errorf("claude-to-openai adapter not found")
+			}
 
-	if adapterName == "" {
-		// 相同格式,直接转发 Anthropic 请求
-		transformedBody = requestBody
-		targetURL = buildClaudeMessagesURL(cleanAPIUrl)
-		log.Infof("Forwarding Anthropic request directly (no conversion needed)")
-	} else if adapterName == "claude-to-openai" {
-		// 上游�?OpenAI 格式，需要将 Anthropic 格式转换�?OpenAI 格式
-		adapter := adapters.GetAdapter("claude-to-openai")
-		if adapter == nil {
-			return nil, http.StatusInternalServerError, fmt.Errorf("claude-to-openai adapter not found")
+			transformedReq, err := adapter.AdaptRequest(upstreamReq, upstreamModel)
+			if err != nil {
+				log.Errorf("Failed to adapt Anthropic request to OpenAI format: %v", err)
+				return nil, err
+			}
+			transformedBody, _ = json.Marshal(transformedReq)
+			targetURL = buildOpenAIChatURL(route.APIUrl)
+			log.Infof("Converting Anthropic request to OpenAI format for upstream")
+		} else {
+			// 其他适配器暂不支持
+			log.Warnf("Unsupported adapter for Anthropic request: %s", adapterName)
+			transformedBody = upstreamBody
+			targetURL = buildClaudeMessagesURL(cleanAPIUrl)
 		}
 
-		transformedReq, err := adapter.AdaptRequest(reqData, model)
+		log.Infof("Routing Anthropic request to: %s (route: %s)", targetURL, route.Name)
+
+		// 创建代理请求
+		proxyReq, err := http.NewRequest("POST", targetURL, bytes.NewReader(transformedBody))
 		if err != nil {
-			log.Errorf("Failed to adapt Anthropic request to OpenAI format: %v", err)
-			return nil, http.StatusInternalServerError, err
+			return nil, err
 		}
-		transformedBody, _ = json.Marshal(transformedReq)
-		targetURL = buildOpenAIChatURL(route.APIUrl)
-		log.Infof("Converting Anthropic request to OpenAI format for upstream")
-	} else {
-		// 其他适配器暂不支�?
-		log.Warnf("Unsupported adapter for Anthropic request: %s", adapterName)
-		transformedBody = requestBody
-		targetURL = buildClaudeMessagesURL(cleanAPIUrl)
-	}
 
-	log.Infof("Routing Anthropic request to: %s (route: %s)", targetURL, route.Name)
+		// 设置请求头
+		proxyReq.Header.Set("Content-Type", "application/json")
 
-	// 创建代理请求
-	proxyReq, err := http.NewRequest("POST", targetURL, bytes.NewReader(transformedBody))
-	if err != nil {
-		return nil, http.StatusInternalServerError, err
-	}
-
-	// 设置请求�?
-	proxyReq.Header.Set("Content-Type", "application/json")
-
-	// 使用路由配置�?API Key（如果有），否则透传原始 Authorization
-	if route.APIKey != "" {
-		proxyReq.Header.Set("Authorization", "Bearer "+route.APIKey)
-	} else if auth := headers["Authorization"]; auth != "" {
-		proxyReq.Header.Set("Authorization", auth)
-	}
+		// 使用路由配置的 API Key（如果有），否则透传原始 Authorization
+		if route.APIKey != "" {
+			proxyReq.Header.Set("Authorization", "Bearer "+route.APIKey)
+		} else if auth := headers["Authorization"]; auth != "" {
+			proxyReq.Header.Set("Authorization", auth)
+		}
 
-	// Claude需要特殊的版本�?
-	if adapterName == "" && normalizeFormat(route.Format) == "claude" {
-		proxyReq.Header.Set("anthropic-version", "2023-06-01")
+		// Claude需要特殊的版本头
+		if adapterName == "" && normalizeFormat(route.Format) == "claude" {
+			proxyReq.Header.Set("anthropic-version", "2023-06-01")
+		}
+		return proxyReq, nil
 	}
 
-	// 发送请�?
+	// 发送请求（失败时自动切换到下一条路由）
 	startTime := time.Now()
-	resp, err := s.httpClient.Do(proxyReq)
+	resp, route, err := s.sendWithFailover(model, route, trace, buildRequest)
 	if err != nil {
-		s.routeService.LogRequest(model, route.ID, 0, 0, 0, false, err.Error())
+		if isRequestBuildError(err) {
+			return nil, http.StatusInternalServerError, err
+		}
+		s.logRequest(model, route.ID, trace, 0, 0, 0, false, err.Error())
+		if isRateLimitError(err) {
+			return rateLimitResponse(protocolClaude, err), http.StatusTooManyRequests, nil
+		}
 		return nil, http.StatusServiceUnavailable, fmt.Errorf("backend service unavailable: %v", err)
 	}
 	defer resp.Body.Close()
 
 	responseBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		s.routeService.LogRequest(model, route.ID, 0, 0, 0, false, err.Error())
+		s.logRequest(model, route.ID, trace, 0, 0, 0, false, err.Error())
 		return nil, http.StatusInternalServerError, err
 	}
 
@@ -772,7 +965,7 @@ func (s *ProxyService) ProxyAnthropicRequest(requestBody []byte, headers map[str
 					if ct, ok := usage["completion_tokens"].(float64); ok {
 						completionTokens = int(ct)
 					}
-					s.routeService.LogRequest(model, route.ID, promptTokens, completionTokens, int(totalTokens), true, "")
+					s.logRequest(model, route.ID, trace, promptTokens, completionTokens, int(totalTokens), true, "")
 				}
 			}
 
@@ -792,7 +985,7 @@ func (s *ProxyService) ProxyAnthropicRequest(requestBody []byte, headers map[str
 			log.Errorf("Failed to unmarshal response body: %v", err)
 		}
 	} else {
-		s.routeService.LogRequest(model, route.ID, 0, 0, 0, false, string(responseBody))
+		s.logRequest(model, route.ID, trace, 0, 0, 0, false, string(responseBody))
 	}
 
 	// 对于 Anthropic 上游或转换失败的情况，返回原始响�?
@@ -803,7 +996,7 @@ func (s *ProxyService) ProxyAnthropicRequest(requestBody []byte, headers map[str
 // ProxyAnthropicStreamRequest 代理 Anthropic 专用流式请求
 // 请求来自 /api/anthropic/v1/messages，格式为 Claude 格式
 // 根据路由配置的 format 决定是否需要转换
-func (s *ProxyService) ProxyAnthropicStreamRequest(requestBody []byte, headers map[string]string, writer io.Writer, flusher http.Flusher) error {
+func (s *ProxyService) ProxyAnthropicStreamRequest(ctx context.Context, requestBody []byte, headers map[string]string, writer io.Writer, flusher http.Flusher) error {
 	// 解析请求
 	var reqData map[string]interface{}
 	if err := json.Unmarshal(requestBody, &reqData); err != nil {
@@ -815,116 +1008,109 @@ func (s *ProxyService) ProxyAnthropicStreamRequest(requestBody []byte, headers m
 		return fmt.Errorf("'model' field is required")
 	}
 
+	trace := s.traceRequest(ctx, headers)
 	originalModel := model
 
-	// 提取真实的模型名（处理 Gemini streamGenerateContent 的情况）
-	realModel := model
-	if strings.Contains(model, ":streamGenerateContent") {
-		realModel = strings.TrimSuffix(model, ":streamGenerateContent")
-	}
-
-	// 首先检查是否是重定向关键字
-	var route *database.ModelRoute
-	var err error
-	isRedirect := s.config.RedirectEnabled && (realModel == s.config.RedirectKeyword || strings.HasPrefix(realModel, s.config.RedirectKeyword+":"))
-
-	if isRedirect {
-		route, err = s.getRedirectRoute()
-		if err != nil {
-			return fmt.Errorf("redirect target not configured or not found: %v", err)
+	route, model, err := s.resolveRequestRoute(model, headers, reqData, true, trace)
+	if err != nil {
+		if isCapabilityError(err) {
+			return writeCapabilityError(writer, protocolClaude, err)
 		}
-		log.Infof("Redirecting %s to route: %s (model: %s, id: %d)", realModel, route.Name, route.Model, route.ID)
-		model = route.Model
-		reqData["model"] = model
+		return err
+	}
+	if model != originalModel {
 		requestBody, _ = json.Marshal(reqData)
-	} else {
-		// 查找路由
-		route, err = s.routeService.GetRouteByModel(model)
-		if err != nil {
-			// 检查是否是"模型未找到"错误
-			if strings.Contains(err.Error(), "model not found") {
-				availableModels, _ := s.routeService.GetAvailableModels()
-				return fmt.Errorf("model '%s' not found in route list. Available models: %v", model, availableModels)
-			}
-			// 其他路由相关错误
-			return fmt.Errorf("route lookup failed for model '%s': %v", model, err)
-		}
 	}
 
-	// 清理路由 API URL（移除末尾斜杠）
-	cleanAPIUrl := strings.TrimSuffix(route.APIUrl, "/")
+	// 检测是否需要进行 API 转换，每条候选路由都需要重新检测
+	var adapterName string
+	buildRequest := func(route *database.ModelRoute) (*http.Request, error) {
+		// 按路由配置的上游模型名改写请求
+		upstreamModel, upstreamReq, upstreamBody := withUpstreamModel(route, model, reqData, requestBody)
 
-	// 智能检测适配�? 请求来自 Claude 格式 (因为�?/api/anthropic 路径)
-	adapterName := s.detectAdapterForRoute(route, "claude")
-	var transformedBody []byte
-	var targetURL string
+		// 清理路由 API URL（移除末尾斜杠）
+		cleanAPIUrl := strings.TrimSuffix(route.APIUrl, "/")
 
-	log.Infof("[Anthropic Stream] Request format: claude, Route format: %s, Adapter: %s", route.Format, adapterName)
+		// 智能检测适配器: 请求来自 Claude 格式 (因为是 /api/anthropic 路径)
+		adapterName = s.detectAdapterForRoute(route, "claude")
+		var transformedBody []byte
+		var targetURL string
 
-	if adapterName == "claude-to-openai" {
-		// 目标�?OpenAI 格式，需要将 Claude 请求转换�?OpenAI 格式
-		adapter := adapters.GetAdapter("claude-to-openai")
-		if adapter == nil {
-			return fmt.Errorf("adapter not found: claude-to-openai")
-		}
+		log.Infof("[Anthropic Stream] Request format: claude, Route format: %s, Adapter: %s", route.Format, adapterName)
 
-		// 确保开启stream
-		reqData["stream"] = true
-		transformedReq, err := adapter.AdaptRequest(reqData, model)
+		if adapterName == "claude-to-openai" {
+			// 目标是 OpenAI 格式，需要将 Claude 请求转换为 OpenAI 格式
+			adapter := adapters.GetAdapter("claude-to-openai")
+			if adapter == nil {
+				return nil, fmt.Errorf("adapter not found: claude-to-openai")
+			}
+
+			// 确保开启stream
+			upstreamReq["stream"] = true
+			transformedReq, err := adapter.AdaptRequest(upstreamReq, upstreamModel)
+			if err != nil {
+				log.Errorf("Failed to adapt request: %v", err)
+				return nil, err
+			}
+			transformedBody, _ = json.Marshal(transformedReq)
+			targetURL = buildOpenAIChatURL(route.APIUrl)
+			log.Infof("Streaming to: %s (route: %s, adapter: claude-to-openai)", targetURL, route.Name)
+		} else {
+			// 目标也是 Claude 格式，直接透传到 /v1/messages
+			transformedBody = upstreamBody
+			targetURL = buildClaudeMessagesURL(cleanAPIUrl)
+			log.Infof("Streaming to: %s (route: %s, passthrough)", targetURL, route.Name)
+		}
+
+		// 详细日志：记录流式请求目标路由信息
+		log.Infof("=== STREAM ROUTE TARGET ===")
+		log.Infof("Stream target URL: %s", targetURL)
+		log.Infof("Stream route name: %s", route.Name)
+		log.Infof("Stream route API URL: %s", route.APIUrl)
+		log.Infof("Stream route model: %s", route.Model)
+		log.Infof("Stream route format: %s", route.Format)
+		log.Infof("Stream route group: %s", route.Group)
+		log.Infof("Stream route enabled: %v", route.Enabled)
+		log.Infof("Stream adapter used: %s", adapterName)
+		log.Infof("Stream transformed body: %s", string(transformedBody))
+		log.Infof("=== STREAM ROUTE TARGET END ===")
+
+		// 创建代理请求
+		proxyReq, err := http.NewRequest("POST", targetURL, bytes.NewReader(transformedBody))
 		if err != nil {
-			log.Errorf("Failed to adapt request: %v", err)
-			return err
+			return nil, err
 		}
-		transformedBody, _ = json.Marshal(transformedReq)
-		targetURL = buildOpenAIChatURL(route.APIUrl)
-		log.Infof("Streaming to: %s (route: %s, adapter: claude-to-openai)", targetURL, route.Name)
-	} else {
-		// 目标也是 Claude 格式，直接透传�?/v1/messages
-		transformedBody = requestBody
-		targetURL = buildClaudeMessagesURL(cleanAPIUrl)
-		log.Infof("Streaming to: %s (route: %s, passthrough)", targetURL, route.Name)
-	}
-
-	// 详细日志：记录流式请求目标路由信�?
-	log.Infof("=== STREAM ROUTE TARGET ===")
-	log.Infof("Stream target URL: %s", targetURL)
-	log.Infof("Stream route name: %s", route.Name)
-	log.Infof("Stream route API URL: %s", route.APIUrl)
-	log.Infof("Stream route model: %s", route.Model)
-	log.Infof("Stream route format: %s", route.Format)
-	log.Infof("Stream route group: %s", route.Group)
-	log.Infof("Stream route enabled: %v", route.Enabled)
-	log.Infof("Stream adapter used: %s", adapterName)
-	log.Infof("Stream transformed body: %s", string(transformedBody))
-	log.Infof("=== STREAM ROUTE TARGET END ===")
-
-	// 创建代理请求
-	proxyReq, err := http.NewRequest("POST", targetURL, bytes.NewReader(transformedBody))
-	if err != nil {
-		return err
-	}
 
-	proxyReq.Header.Set("Content-Type", "application/json")
-	if route.APIKey != "" {
-		proxyReq.Header.Set("Authorization", "Bearer "+route.APIKey)
-	} else if auth := headers["Authorization"]; auth != "" {
-		proxyReq.Header.Set("Authorization", auth)
-	}
+		proxyReq.Header.Set("Content-Type", "application/json")
+		if route.APIKey != "" {
+			proxyReq.Header.Set("Authorization", "Bearer "+route.APIKey)
+		} else if auth := headers["Authorization"]; auth != "" {
+			proxyReq.Header.Set("Authorization", auth)
+		}
 
-	// Claude需要特殊的版本�?
-	if adapterName == "anthropic" {
-		proxyReq.Header.Set("anthropic-version", "2023-06-01")
+		// Claude需要特殊的版本头
+		if adapterName == "anthropic" {
+			proxyReq.Header.Set("anthropic-version", "2023-06-01")
+		}
+		return proxyReq, nil
 	}
 
-	// 发送请�?
-	resp, err := s.httpClient.Do(proxyReq)
+	// 发送请求（失败时自动切换到下一条路由）
+	resp, route, err := s.sendWithFailover(model, route, trace, buildRequest)
 	if err != nil {
+		if !isRequestBuildError(err) {
+			s.logRequest(model, route.ID, trace, 0, 0, 0, false, err.Error())
+		}
+		if isRateLimitError(err) {
+			return writeRateLimitError(writer, protocolClaude, err)
+		}
 		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
+		s.logRequest(model, route.ID, trace, 0, 0, 0, false, string(body))
 		return fmt.Errorf("backend error: %d - %s", resp.StatusCode, string(body))
 	}
 
@@ -1000,7 +1186,7 @@ func (s *ProxyService) streamWithAdapter(reader io.Reader, writer io.Writer, flu
 				fmt.Fprintf(writer, "data: [DONE]\n\n")
 				flusher.Flush()
 				totalTokens := totalPromptTokens + totalCompletionTokens
-				s.routeService.LogRequest(model, routeID, totalPromptTokens, totalCompletionTokens, totalTokens, true, "")
+				s.logRequest(model, routeID, traceOf(reader), totalPromptTokens, totalCompletionTokens, totalTokens, true, "")
 				return nil
 			}
 
@@ -1074,7 +1260,7 @@ func (s *ProxyService) streamWithAdapter(reader io.Reader, writer io.Writer, flu
 	log.Infof("[Stream Adapter] Finished reading stream. Total chunks sent: %d", chunkCount)
 
 	if err := scanner.Err(); err != nil {
-		s.routeService.LogRequest(model, routeID, totalPromptTokens, totalCompletionTokens, totalPromptTokens+totalCompletionTokens, false, err.Error())
+		s.logRequest(model, routeID, traceOf(reader), totalPromptTokens, totalCompletionTokens, totalPromptTokens+totalCompletionTokens, false, err.Error())
 		return err
 	}
 
@@ -1088,7 +1274,7 @@ func (s *ProxyService) streamWithAdapter(reader io.Reader, writer io.Writer, flu
 	flusher.Flush()
 
 	totalTokens := totalPromptTokens + totalCompletionTokens
-	s.routeService.LogRequest(model, routeID, totalPromptTokens, totalCompletionTokens, totalTokens, true, "")
+	s.logRequest(model, routeID, traceOf(reader), totalPromptTokens, totalCompletionTokens, totalTokens, true, "")
 	return nil
 }
 
@@ -1104,7 +1290,7 @@ func (s *ProxyService) streamDirect(reader io.Reader, writer io.Writer, flusher
 			responseBuffer.Write(buf[:n])
 
 			if _, writeErr := writer.Write(buf[:n]); writeErr != nil {
-				s.routeService.LogRequest(model, routeID, 0, 0, 0, false, writeErr.Error())
+				s.logRequest(model, routeID, traceOf(reader), 0, 0, 0, false, writeErr.Error())
 				return writeErr
 			}
 			flusher.Flush()
@@ -1114,10 +1300,10 @@ func (s *ProxyService) streamDirect(reader io.Reader, writer io.Writer, flusher
 				// 尝试从响应中提取token使用信息
 				promptTokens, completionTokens := s.extractTokensFromStreamResponse(responseBuffer.String())
 				totalTokens := promptTokens + completionTokens
-				s.routeService.LogRequest(model, routeID, promptTokens, completionTokens, totalTokens, true, "")
+				s.logRequest(model, routeID, traceOf(reader), promptTokens, completionTokens, totalTokens, true, "")
 				return nil
 			}
-			s.routeService.LogRequest(model, routeID, 0, 0, 0, false, err.Error())
+			s.logRequest(model, routeID, traceOf(reader), 0, 0, 0, false, err.Error())
 			return err
 		}
 	}
@@ -1227,6 +1413,11 @@ func (s *ProxyService) streamOpenAIToClaude(reader io.Reader, writer io.Writer,
 		}
 	}
 
+	if err := scanner.Err(); err != nil {
+		s.logRequest(model, routeID, traceOf(reader), 0, 0, 0, false, err.Error())
+		return err
+	}
+
 	// content_block_stop 事件
 	contentBlockStop := map[string]interface{}{
 		"type":  "content_block_stop",
@@ -1261,13 +1452,19 @@ func (s *ProxyService) streamOpenAIToClaude(reader io.Reader, writer io.Writer,
 
 	// 记录请求
 	totalTokens := totalPromptTokens + totalCompletionTokens
-	s.routeService.LogRequest(model, routeID, totalPromptTokens, totalCompletionTokens, totalTokens, true, "")
+	s.logRequest(model, routeID, traceOf(reader), totalPromptTokens, totalCompletionTokens, totalTokens, true, "")
 
 	return nil
 }
 
-// FetchRemoteModels 获取远程模型列表
-func (s *ProxyService) FetchRemoteModels(apiUrl, apiKey string) ([]string, error) {
+// FetchRemoteModels 获取远程模型列表，outboundProxy 为路由的出站代理设置（可为空）
+func (s *ProxyService) FetchRemoteModels(apiUrl, apiKey, outboundProxy string) ([]string, error) {
+	// 界面上填写的可能是密钥引用
+	apiKey, err := s.secrets.Resolve(apiKey)
+	if err != nil {
+		return nil, err
+	}
+
 	// 记录原始 URL 是否�?"/" 结尾
 	hasTrailingSlash := strings.HasSuffix(apiUrl, "/")
 
@@ -1298,7 +1495,11 @@ func (s *ProxyService) FetchRemoteModels(apiUrl, apiKey string) ([]string, error
 		req.Header.Set("Authorization", "Bearer "+apiKey)
 	}
 
-	resp, err := s.httpClient.Do(req)
+	client, err := s.transports.client(outboundProxy)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("request failed: %v", err)
 	}
@@ -1951,7 +2152,7 @@ func (s *ProxyService) extractTokensFromStreamResponse(response string) (promptT
 
 // ProxyGeminiRequest 代理 Gemini 格式的非流式请求
 // 请求来自 /api/v1/gemini/models/{model}:generateContent
-func (s *ProxyService) ProxyGeminiRequest(requestBody []byte, headers map[string]string) ([]byte, int, error) {
+func (s *ProxyService) ProxyGeminiRequest(ctx context.Context, requestBody []byte, headers map[string]string) ([]byte, int, error) {
 	// 解析请求
 	var reqData map[string]interface{}
 	if err := json.Unmarshal(requestBody, &reqData); err != nil {
@@ -1963,125 +2164,129 @@ func (s *ProxyService) ProxyGeminiRequest(requestBody []byte, headers map[string
 		return nil, http.StatusBadRequest, fmt.Errorf("'model' field is required")
 	}
 
-	// 首先检查是否是重定向关键字
-	var route *database.ModelRoute
-	var err error
-	isRedirect := s.config.RedirectEnabled && (model == s.config.RedirectKeyword || strings.HasPrefix(model, s.config.RedirectKeyword+":"))
+	trace := s.traceRequest(ctx, headers)
+	requested := model
 
-	if isRedirect {
-		route, err = s.getRedirectRoute()
-		if err != nil {
-			return nil, http.StatusBadRequest, fmt.Errorf("redirect target not configured or not found: %v", err)
-		}
-		log.Infof("Redirecting %s to route: %s (model: %s, id: %d)", model, route.Name, route.Model, route.ID)
-		model = route.Model
-		reqData["model"] = model
-	} else {
-		// 查找路由
-		route, err = s.routeService.GetRouteByModel(model)
-		if err != nil {
-			availableModels, _ := s.routeService.GetAvailableModels()
-			return nil, http.StatusNotFound, fmt.Errorf("model '%s' not found in route list. Available models: %v", model, availableModels)
+	route, model, err := s.resolveRequestRoute(model, headers, reqData, false, trace)
+	if err != nil {
+		if isCapabilityError(err) {
+			return capabilityResponse(protocolGemini, err), http.StatusBadRequest, nil
 		}
+		return nil, routeErrorStatus(err), err
 	}
-
-	// 清理路由 API URL
-	cleanAPIUrl := strings.TrimSuffix(route.APIUrl, "/")
-
-	var transformedBody []byte
-	var targetURL string
-
-	// 获取目标格式
-	targetFormat := normalizeFormat(route.Format)
-	if targetFormat == "" {
-		targetFormat = inferFormatFromRoute(route.APIUrl, route.Model)
+	if model != requested {
+		requestBody, _ = json.Marshal(reqData)
 	}
 
-	log.Infof("[Gemini Request] Request format: gemini, Target format: %s, Route: %s", targetFormat, route.Name)
-
-	// 用于标记响应转换类型
+	// 用于标记响应转换类型，每条候选路由都需要重新计算
 	var needConvertResponse string // "none", "openai", "claude"
+	buildRequest := func(route *database.ModelRoute) (*http.Request, error) {
+		// 按路由配置的上游模型名改写请求
+		upstreamModel, upstreamReq, upstreamBody := withUpstreamModel(route, model, reqData, requestBody)
+
+		// 清理路由 API URL
+		cleanAPIUrl := strings.TrimSuffix(route.APIUrl, "/")
+
+		var transformedBody []byte
+		var targetURL string
+
+		// 获取目标格式
+		targetFormat := normalizeFormat(route.Format)
+		if targetFormat == "" {
+			targetFormat = inferFormatFromRoute(route.APIUrl, route.Model)
+		}
+
+		log.Infof("[Gemini Request] Request format: gemini, Target format: %s, Route: %s", targetFormat, route.Name)
+
+		if targetFormat == "gemini" {
+			// 目标也是 Gemini 格式，直接透传
+			transformedBody = upstreamBody
+			targetURL = fmt.Sprintf("%s/v1beta/models/%s:generateContent", cleanAPIUrl, upstreamModel)
+			needConvertResponse = "none"
+			log.Infof("Forwarding Gemini request directly to: %s", targetURL)
+		} else if targetFormat == "openai" {
+			// 目标是 OpenAI 格式，需要将 Gemini 请求转换为 OpenAI 格式
+			adapter := adapters.GetAdapter("gemini-to-openai")
+			if adapter == nil {
+				return nil, fmt.Errorf("gemini-to-openai adapter not found")
+			}
 
-	if targetFormat == "gemini" {
-		// 目标也是 Gemini 格式，直接透传
-		transformedBody = requestBody
-		targetURL = fmt.Sprintf("%s/v1beta/models/%s:generateContent", cleanAPIUrl, model)
-		needConvertResponse = "none"
-		log.Infof("Forwarding Gemini request directly to: %s", targetURL)
-	} else if targetFormat == "openai" {
-		// 目标�?OpenAI 格式，需要将 Gemini 请求转换�?OpenAI 格式
-		adapter := adapters.GetAdapter("gemini-to-openai")
-		if adapter == nil {
-			return nil, http.StatusInternalServerError, fmt.Errorf("gemini-to-openai adapter not found")
-		}
+			transformedReq, err := adapter.AdaptRequest(upstreamReq, upstreamModel)
+			if err != nil {
+				return nil, err
+			}
+			transformedBody, _ = json.Marshal(transformedReq)
+			targetURL = buildOpenAIChatURL(route.APIUrl)
+			needConvertResponse = "openai"
+			log.Infof("Converting Gemini -> OpenAI, target: %s", targetURL)
+		} else if targetFormat == "claude" {
+			// 目标是 Claude 格式，需要 Gemini -> OpenAI -> Claude 两步转换
+			// 第一步：Gemini -> OpenAI
+			geminiToOpenAI := adapters.GetAdapter("gemini-to-openai")
+			if geminiToOpenAI == nil {
+				return nil, fmt.Errorf("gemini-to-openai adapter not found")
+			}
 
-		transformedReq, err := adapter.AdaptRequest(reqData, model)
-		if err != nil {
-			return nil, http.StatusInternalServerError, err
-		}
-		transformedBody, _ = json.Marshal(transformedReq)
-		targetURL = buildOpenAIChatURL(route.APIUrl)
-		needConvertResponse = "openai"
-		log.Infof("Converting Gemini -> OpenAI, target: %s", targetURL)
-	} else if targetFormat == "claude" {
-		// 目标�?Claude 格式，需�?Gemini -> OpenAI -> Claude 两步转换
-		// 第一步：Gemini -> OpenAI
-		geminiToOpenAI := adapters.GetAdapter("gemini-to-openai")
-		if geminiToOpenAI == nil {
-			return nil, http.StatusInternalServerError, fmt.Errorf("gemini-to-openai adapter not found")
-		}
+			openaiReq, err := geminiToOpenAI.AdaptRequest(upstreamReq, upstreamModel)
+			if err != nil {
+				return nil, fmt.Errorf("gemini-to-openai conversion failed: %v", err)
+			}
 
-		openaiReq, err := geminiToOpenAI.AdaptRequest(reqData, model)
-		if err != nil {
-			return nil, http.StatusInternalServerError, fmt.Errorf("gemini-to-openai conversion failed: %v", err)
-		}
+			// 第二步：OpenAI -> Claude
+			openaiToClaude := adapters.GetAdapter("openai-to-claude")
+			if openaiToClaude == nil {
+				return nil, fmt.Errorf("openai-to-claude adapter not found")
+			}
+
+			claudeReq, err := openaiToClaude.AdaptRequest(openaiReq, upstreamModel)
+			if err != nil {
+				return nil, fmt.Errorf("openai-to-claude conversion failed: %v", err)
+			}
 
-		// 第二步：OpenAI -> Claude
-		openaiToClaude := adapters.GetAdapter("openai-to-claude")
-		if openaiToClaude == nil {
-			return nil, http.StatusInternalServerError, fmt.Errorf("openai-to-claude adapter not found")
+			transformedBody, _ = json.Marshal(claudeReq)
+			targetURL = buildClaudeMessagesURL(cleanAPIUrl)
+			needConvertResponse = "claude"
+			log.Infof("Converting Gemini -> OpenAI -> Claude, target: %s", targetURL)
+		} else {
+			return nil, fmt.Errorf("unsupported target format: %s", targetFormat)
 		}
 
-		claudeReq, err := openaiToClaude.AdaptRequest(openaiReq, model)
+		// 创建代理请求
+		proxyReq, err := http.NewRequest("POST", targetURL, bytes.NewReader(transformedBody))
 		if err != nil {
-			return nil, http.StatusInternalServerError, fmt.Errorf("openai-to-claude conversion failed: %v", err)
+			return nil, err
 		}
 
-		transformedBody, _ = json.Marshal(claudeReq)
-		targetURL = buildClaudeMessagesURL(cleanAPIUrl)
-		needConvertResponse = "claude"
-		log.Infof("Converting Gemini -> OpenAI -> Claude, target: %s", targetURL)
-	} else {
-		return nil, http.StatusInternalServerError, fmt.Errorf("unsupported target format: %s", targetFormat)
-	}
-
-	// 创建代理请求
-	proxyReq, err := http.NewRequest("POST", targetURL, bytes.NewReader(transformedBody))
-	if err != nil {
-		return nil, http.StatusInternalServerError, err
-	}
-
-	// 根据目标格式设置请求�?
-	proxyReq.Header.Set("Content-Type", "application/json")
+		// 根据目标格式设置请求头
+		proxyReq.Header.Set("Content-Type", "application/json")
 
-	if route.APIKey != "" {
-		switch targetFormat {
-		case "claude":
-			// Claude 格式使用 x-api-key
-			proxyReq.Header.Set("x-api-key", route.APIKey)
-			proxyReq.Header.Set("anthropic-version", "2023-06-01")
-		case "gemini":
-			// Gemini 使用 x-goog-api-key
-			proxyReq.Header.Set("x-goog-api-key", route.APIKey)
-		default:
-			// OpenAI 格式使用 Bearer token
-			proxyReq.Header.Set("Authorization", "Bearer "+route.APIKey)
+		if route.APIKey != "" {
+			switch targetFormat {
+			case "claude":
+				// Claude 格式使用 x-api-key
+				proxyReq.Header.Set("x-api-key", route.APIKey)
+				proxyReq.Header.Set("anthropic-version", "2023-06-01")
+			case "gemini":
+				// Gemini 使用 x-goog-api-key
+				proxyReq.Header.Set("x-goog-api-key", route.APIKey)
+			default:
+				// OpenAI 格式使用 Bearer token
+				proxyReq.Header.Set("Authorization", "Bearer "+route.APIKey)
+			}
 		}
+		return proxyReq, nil
 	}
 
-	// 发送请�?
-	resp, err := s.httpClient.Do(proxyReq)
+	// 发送请求（失败时自动切换到下一条路由）
+	resp, route, err := s.sendWithFailover(model, route, trace, buildRequest)
 	if err != nil {
+		if isRequestBuildError(err) {
+			return nil, http.StatusInternalServerError, err
+		}
+		s.logRequest(model, route.ID, trace, 0, 0, 0, false, err.Error())
+		if isRateLimitError(err) {
+			return rateLimitResponse(protocolGemini, err), http.StatusTooManyRequests, nil
+		}
 		return nil, http.StatusServiceUnavailable, fmt.Errorf("backend service unavailable: %v", err)
 	}
 	defer resp.Body.Close()
@@ -2122,7 +2327,7 @@ func (s *ProxyService) ProxyGeminiRequest(requestBody []byte, headers map[string
 
 // ProxyGeminiStreamRequest 代理 Gemini 格式的流式请求
 // 请求来自 /api/v1/gemini/models/{model}:streamGenerateContent
-func (s *ProxyService) ProxyGeminiStreamRequest(requestBody []byte, headers map[string]string, writer io.Writer, flusher http.Flusher) error {
+func (s *ProxyService) ProxyGeminiStreamRequest(ctx context.Context, requestBody []byte, headers map[string]string, writer io.Writer, flusher http.Flusher) error {
 	// 解析请求
 	var reqData map[string]interface{}
 	if err := json.Unmarshal(requestBody, &reqData); err != nil {
@@ -2134,136 +2339,140 @@ func (s *ProxyService) ProxyGeminiStreamRequest(requestBody []byte, headers map[
 		return fmt.Errorf("'model' field is required")
 	}
 
-	// 首先检查是否是重定向关键字
-	var route *database.ModelRoute
-	var err error
-	isRedirect := s.config.RedirectEnabled && (model == s.config.RedirectKeyword || strings.HasPrefix(model, s.config.RedirectKeyword+":"))
+	trace := s.traceRequest(ctx, headers)
+	requested := model
 
-	if isRedirect {
-		route, err = s.getRedirectRoute()
-		if err != nil {
-			return fmt.Errorf("redirect target not configured or not found: %v", err)
+	route, model, err := s.resolveRequestRoute(model, headers, reqData, true, trace)
+	if err != nil {
+		if isCapabilityError(err) {
+			return writeCapabilityError(writer, protocolGemini, err)
 		}
-		log.Infof("Redirecting %s to route: %s (model: %s, id: %d)", model, route.Name, route.Model, route.ID)
-		model = route.Model
-		reqData["model"] = model
+		return err
+	}
+	if model != requested {
 		requestBody, _ = json.Marshal(reqData)
-	} else {
-		// 查找路由
-		route, err = s.routeService.GetRouteByModel(model)
-		if err != nil {
-			availableModels, _ := s.routeService.GetAvailableModels()
-			return fmt.Errorf("model '%s' not found in route list. Available models: %v", model, availableModels)
-		}
 	}
 
-	// 清理路由 API URL
-	cleanAPIUrl := strings.TrimSuffix(route.APIUrl, "/")
+	// 用于标记响应转换类型，每条候选路由都需要重新计算
+	var responseConversionType string // "none", "openai-to-gemini", "claude-to-gemini"
+	buildRequest := func(route *database.ModelRoute) (*http.Request, error) {
+		// 按路由配置的上游模型名改写请求
+		upstreamModel, upstreamReq, upstreamBody := withUpstreamModel(route, model, reqData, requestBody)
+
+		// 清理路由 API URL
+		cleanAPIUrl := strings.TrimSuffix(route.APIUrl, "/")
+
+		var transformedBody []byte
+		var targetURL string
+
+		// 获取目标格式
+		targetFormat := normalizeFormat(route.Format)
+		if targetFormat == "" {
+			targetFormat = inferFormatFromRoute(route.APIUrl, route.Model)
+		}
+
+		log.Infof("[Gemini Stream] Request format: gemini, Target format: %s, Route: %s", targetFormat, route.Name)
+
+		if targetFormat == "gemini" {
+			// 目标也是 Gemini 格式，直接透传
+			transformedBody = upstreamBody
+			targetURL = fmt.Sprintf("%s/v1beta/models/%s:streamGenerateContent?alt=sse", cleanAPIUrl, upstreamModel)
+			responseConversionType = "none"
+			log.Infof("Streaming Gemini request directly to: %s", targetURL)
+		} else if targetFormat == "openai" {
+			// 目标是 OpenAI 格式，需要将 Gemini 请求转换为 OpenAI 格式
+			adapter := adapters.GetAdapter("gemini-to-openai")
+			if adapter == nil {
+				return nil, fmt.Errorf("gemini-to-openai adapter not found")
+			}
 
-	var transformedBody []byte
-	var targetURL string
+			upstreamReq["stream"] = true
+			transformedReq, err := adapter.AdaptRequest(upstreamReq, upstreamModel)
+			if err != nil {
+				return nil, err
+			}
+			transformedBody, _ = json.Marshal(transformedReq)
+			targetURL = buildOpenAIChatURL(route.APIUrl)
+			responseConversionType = "openai-to-gemini"
+			log.Infof("Converting Gemini -> OpenAI, target: %s", targetURL)
+		} else if targetFormat == "claude" {
+			// 目标是 Claude 格式，需要 Gemini -> OpenAI -> Claude 两步转换
+			// 第一步：Gemini -> OpenAI
+			geminiToOpenAI := adapters.GetAdapter("gemini-to-openai")
+			if geminiToOpenAI == nil {
+				return nil, fmt.Errorf("gemini-to-openai adapter not found")
+			}
 
-	// 获取目标格式
-	targetFormat := normalizeFormat(route.Format)
-	if targetFormat == "" {
-		targetFormat = inferFormatFromRoute(route.APIUrl, route.Model)
-	}
+			upstreamReq["stream"] = true
+			openaiReq, err := geminiToOpenAI.AdaptRequest(upstreamReq, upstreamModel)
+			if err != nil {
+				return nil, fmt.Errorf("gemini-to-openai conversion failed: %v", err)
+			}
 
-	log.Infof("[Gemini Stream] Request format: gemini, Target format: %s, Route: %s", targetFormat, route.Name)
+			// 第二步：OpenAI -> Claude
+			openaiToClaude := adapters.GetAdapter("openai-to-claude")
+			if openaiToClaude == nil {
+				return nil, fmt.Errorf("openai-to-claude adapter not found")
+			}
 
-	// 用于标记响应转换类型
-	var responseConversionType string // "none", "openai-to-gemini", "claude-to-gemini"
+			claudeReq, err := openaiToClaude.AdaptRequest(openaiReq, upstreamModel)
+			if err != nil {
+				return nil, fmt.Errorf("openai-to-claude conversion failed: %v", err)
+			}
 
-	if targetFormat == "gemini" {
-		// 目标也是 Gemini 格式，直接透传
-		transformedBody = requestBody
-		targetURL = fmt.Sprintf("%s/v1beta/models/%s:streamGenerateContent?alt=sse", cleanAPIUrl, model)
-		responseConversionType = "none"
-		log.Infof("Streaming Gemini request directly to: %s", targetURL)
-	} else if targetFormat == "openai" {
-		// 目标�?OpenAI 格式，需要将 Gemini 请求转换�?OpenAI 格式
-		adapter := adapters.GetAdapter("gemini-to-openai")
-		if adapter == nil {
-			return fmt.Errorf("gemini-to-openai adapter not found")
-		}
-
-		reqData["stream"] = true
-		transformedReq, err := adapter.AdaptRequest(reqData, model)
-		if err != nil {
-			return err
-		}
-		transformedBody, _ = json.Marshal(transformedReq)
-		targetURL = buildOpenAIChatURL(route.APIUrl)
-		responseConversionType = "openai-to-gemini"
-		log.Infof("Converting Gemini -> OpenAI, target: %s", targetURL)
-	} else if targetFormat == "claude" {
-		// 目标�?Claude 格式，需�?Gemini -> OpenAI -> Claude 两步转换
-		// 第一步：Gemini -> OpenAI
-		geminiToOpenAI := adapters.GetAdapter("gemini-to-openai")
-		if geminiToOpenAI == nil {
-			return fmt.Errorf("gemini-to-openai adapter not found")
+			transformedBody, _ = json.Marshal(claudeReq)
+			targetURL = buildClaudeMessagesURL(cleanAPIUrl)
+			responseConversionType = "claude-to-gemini"
+			log.Infof("Converting Gemini -> OpenAI -> Claude, target: %s", targetURL)
+		} else {
+			return nil, fmt.Errorf("unsupported target format: %s", targetFormat)
 		}
 
-		reqData["stream"] = true
-		openaiReq, err := geminiToOpenAI.AdaptRequest(reqData, model)
+		// 创建代理请求
+		proxyReq, err := http.NewRequest("POST", targetURL, bytes.NewReader(transformedBody))
 		if err != nil {
-			return fmt.Errorf("gemini-to-openai conversion failed: %v", err)
+			return nil, err
 		}
 
-		// 第二步：OpenAI -> Claude
-		openaiToClaude := adapters.GetAdapter("openai-to-claude")
-		if openaiToClaude == nil {
-			return fmt.Errorf("openai-to-claude adapter not found")
-		}
+		// 根据目标格式设置请求头
+		proxyReq.Header.Set("Content-Type", "application/json")
+		proxyReq.Header.Set("Accept", "text/event-stream")
 
-		claudeReq, err := openaiToClaude.AdaptRequest(openaiReq, model)
-		if err != nil {
-			return fmt.Errorf("openai-to-claude conversion failed: %v", err)
+		if route.APIKey != "" {
+			switch targetFormat {
+			case "claude":
+				// Claude 格式使用 x-api-key
+				proxyReq.Header.Set("x-api-key", route.APIKey)
+				proxyReq.Header.Set("anthropic-version", "2023-06-01")
+			case "gemini":
+				// Gemini 使用 x-goog-api-key
+				proxyReq.Header.Set("x-goog-api-key", route.APIKey)
+			default:
+				// OpenAI 格式使用 Bearer token
+				proxyReq.Header.Set("Authorization", "Bearer "+route.APIKey)
+			}
 		}
-
-		transformedBody, _ = json.Marshal(claudeReq)
-		targetURL = buildClaudeMessagesURL(cleanAPIUrl)
-		responseConversionType = "claude-to-gemini"
-		log.Infof("Converting Gemini -> OpenAI -> Claude, target: %s", targetURL)
-	} else {
-		return fmt.Errorf("unsupported target format: %s", targetFormat)
+		return proxyReq, nil
 	}
 
-	// 创建代理请求
-	proxyReq, err := http.NewRequest("POST", targetURL, bytes.NewReader(transformedBody))
+	// 发送请求（失败时自动切换到下一条路由）
+	resp, route, err := s.sendWithFailover(model, route, trace, buildRequest)
 	if err != nil {
-		return err
-	}
-
-	// 根据目标格式设置请求�?
-	proxyReq.Header.Set("Content-Type", "application/json")
-	proxyReq.Header.Set("Accept", "text/event-stream")
-
-	if route.APIKey != "" {
-		switch targetFormat {
-		case "claude":
-			// Claude 格式使用 x-api-key
-			proxyReq.Header.Set("x-api-key", route.APIKey)
-			proxyReq.Header.Set("anthropic-version", "2023-06-01")
-		case "gemini":
-			// Gemini 使用 x-goog-api-key
-			proxyReq.Header.Set("x-goog-api-key", route.APIKey)
-		default:
-			// OpenAI 格式使用 Bearer token
-			proxyReq.Header.Set("Authorization", "Bearer "+route.APIKey)
+		if isRequestBuildError(err) {
+			return err
+		}
+		s.logRequest(model, route.ID, trace, 0, 0, 0, false, err.Error())
+		if isRateLimitError(err) {
+			return writeRateLimitError(writer, protocolGemini, err)
 		}
-	}
-
-	// 发送请�?
-	resp, err := s.httpClient.Do(proxyReq)
-	if err != nil {
 		return fmt.Errorf("backend service unavailable: %v", err)
 	}
 	defer resp.Body.Close()
 
-	// 检查响应状�?
+	// 检查响应状态
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
+		s.logRequest(model, route.ID, trace, 0, 0, 0, false, string(body))
 		return fmt.Errorf("backend error: %d - %s", resp.StatusCode, string(body))
 	}
 
@@ -2389,9 +2598,14 @@ func (s *ProxyService) streamOpenAIToGemini(reader io.Reader, writer io.Writer,
 		}
 	}
 
+	if err := scanner.Err(); err != nil {
+		s.logRequest(model, routeID, traceOf(reader), 0, 0, 0, false, err.Error())
+		return err
+	}
+
 	// 记录请求
 	totalTokens := totalPromptTokens + totalCompletionTokens
-	s.routeService.LogRequest(model, routeID, totalPromptTokens, totalCompletionTokens, totalTokens, true, "")
+	s.logRequest(model, routeID, traceOf(reader), totalPromptTokens, totalCompletionTokens, totalTokens, true, "")
 
 	return nil
 }
@@ -2507,12 +2721,17 @@ func (s *ProxyService) streamClaudeToGemini(reader io.Reader, writer io.Writer,
 		}
 	}
 
+	if err := scanner.Err(); err != nil {
+		s.logRequest(model, routeID, traceOf(reader), 0, 0, 0, false, err.Error())
+		return err
+	}
+
 	log.Infof("[Claude->Gemini Stream] Stream completed. Total chunks: %d, Input tokens: %d, Output tokens: %d",
 		chunkCount, totalInputTokens, totalOutputTokens)
 
 	// 记录请求
 	totalTokens := totalInputTokens + totalOutputTokens
-	s.routeService.LogRequest(model, routeID, totalInputTokens, totalOutputTokens, totalTokens, true, "")
+	s.logRequest(model, routeID, traceOf(reader), totalInputTokens, totalOutputTokens, totalTokens, true, "")
 
 	return nil
 }
@@ -2520,7 +2739,7 @@ func (s *ProxyService) streamClaudeToGemini(reader io.Reader, writer io.Writer,
 // ProxyClaudeCodeRequest 代理 Claude Code 专用请求
 // 请求来自 /api/claudecode/v1/messages，格式为 Claude Code 格式（包含工具链、系统提示词等）
 // 智能检测目标路由格式：如果目标是 Claude 格式则直接透传，如果是 OpenAI 格式则转换
-func (s *ProxyService) ProxyClaudeCodeRequest(requestBody []byte, headers map[string]string) ([]byte, int, error) {
+func (s *ProxyService) ProxyClaudeCodeRequest(ctx context.Context, requestBody []byte, headers map[string]string) ([]byte, int, error) {
 	// 解析请求
 	var reqData map[string]interface{}
 	if err := json.Unmarshal(requestBody, &reqData); err != nil {
@@ -2532,113 +2751,111 @@ func (s *ProxyService) ProxyClaudeCodeRequest(requestBody []byte, headers map[st
 		return nil, http.StatusBadRequest, fmt.Errorf("'model' field is required")
 	}
 
-	log.Infof("[Claude Code] Received request for model: %s", model)
-
-	// 提取真实的模型名（处理可能的后缀）
-	realModel := model
-	if strings.Contains(model, ":streamGenerateContent") {
-		realModel = strings.TrimSuffix(model, ":streamGenerateContent")
-	}
+	trace := s.traceRequest(ctx, headers)
+	requested := model
 
-	// 首先检查是否是重定向关键字
-	var route *database.ModelRoute
-	var err error
-	isRedirect := s.config.RedirectEnabled && (realModel == s.config.RedirectKeyword || strings.HasPrefix(realModel, s.config.RedirectKeyword+":"))
+	log.Infof("[Claude Code] Received request for model: %s", model)
 
-	if isRedirect {
-		route, err = s.getRedirectRoute()
-		if err != nil {
-			return nil, http.StatusNotFound, fmt.Errorf("redirect target not configured or not found: %v", err)
+	route, model, err := s.resolveRequestRoute(model, headers, reqData, false, trace)
+	if err != nil {
+		if isCapabilityError(err) {
+			return capabilityResponse(protocolClaude, err), http.StatusBadRequest, nil
 		}
-		log.Infof("Redirecting %s to route: %s (model: %s, id: %d)", realModel, route.Name, route.Model, route.ID)
-		model = route.Model
-		reqData["model"] = model
+		return nil, routeErrorStatus(err), err
+	}
+	if model != requested {
 		requestBody, _ = json.Marshal(reqData)
-	} else {
-		// 查找路由
-		route, err = s.routeService.GetRouteByModel(model)
-		if err != nil {
-			availableModels, _ := s.routeService.GetAvailableModels()
-			return nil, http.StatusNotFound, fmt.Errorf("model '%s' not found in route list. Available models: %v", model, availableModels)
-		}
 	}
 
-	// 清理路由 API URL
-	cleanAPIUrl := strings.TrimSuffix(route.APIUrl, "/")
+	// 每条候选路由都需要重新检测目标格式
+	var needConvertResponse bool
+	buildRequest := func(route *database.ModelRoute) (*http.Request, error) {
+		// 按路由配置的上游模型名改写请求
+		upstreamModel, upstreamReq, upstreamBody := withUpstreamModel(route, model, reqData, requestBody)
 
-	// 智能检测目标路由格�?
-	targetFormat := normalizeFormat(route.Format)
-	if targetFormat == "" {
-		targetFormat = inferFormatFromRoute(route.APIUrl, route.Model)
-	}
+		// 清理路由 API URL
+		cleanAPIUrl := strings.TrimSuffix(route.APIUrl, "/")
 
-	log.Infof("[Claude Code] Target route format: %s", targetFormat)
+		// 智能检测目标路由格式
+		targetFormat := normalizeFormat(route.Format)
+		if targetFormat == "" {
+			targetFormat = inferFormatFromRoute(route.APIUrl, route.Model)
+		}
 
-	var transformedBody []byte
-	var targetURL string
-	var needConvertResponse bool
+		log.Infof("[Claude Code] Target route format: %s", targetFormat)
 
-	if targetFormat == "claude" || targetFormat == "anthropic" {
-		// 目标�?Claude 格式，直接透传请求
-		log.Infof("[Claude Code] Target is Claude format, passing through directly")
-		transformedBody = requestBody
-		targetURL = buildClaudeMessagesURL(cleanAPIUrl)
-		needConvertResponse = false
-	} else {
-		// 目标�?OpenAI 格式，需要转�?
-		log.Infof("[Claude Code] Target is OpenAI format, converting request")
-		adapter := adapters.GetAdapter("claudecode-to-openai")
-		if adapter == nil {
-			return nil, http.StatusInternalServerError, fmt.Errorf("claudecode-to-openai adapter not found")
-		}
+		var transformedBody []byte
+		var targetURL string
 
-		transformedReq, err := adapter.AdaptRequest(reqData, model)
-		if err != nil {
-			log.Errorf("[Claude Code] Failed to adapt request: %v", err)
-			return nil, http.StatusInternalServerError, err
-		}
-		transformedBody, _ = json.Marshal(transformedReq)
-		targetURL = buildOpenAIChatURL(route.APIUrl)
-		needConvertResponse = true
-	}
+		if targetFormat == "claude" || targetFormat == "anthropic" {
+			// 目标是 Claude 格式，直接透传请求
+			log.Infof("[Claude Code] Target is Claude format, passing through directly")
+			transformedBody = upstreamBody
+			targetURL = buildClaudeMessagesURL(cleanAPIUrl)
+			needConvertResponse = false
+		} else {
+			// 目标是 OpenAI 格式，需要转换
+			log.Infof("[Claude Code] Target is OpenAI format, converting request")
+			adapter := adapters.GetAdapter("claudecode-to-openai")
+			if adapter == nil {
+				return nil, fmt.Errorf("claudecode-to-openai adapter not found")
+			}
 
-	log.Infof("[Claude Code] Routing to: %s (route: %s)", targetURL, route.Name)
+			transformedReq, err := adapter.AdaptRequest(upstreamReq, upstreamModel)
+			if err != nil {
+				log.Errorf("[Claude Code] Failed to adapt request: %v", err)
+				return nil, err
+			}
+			transformedBody, _ = json.Marshal(transformedReq)
+			targetURL = buildOpenAIChatURL(route.APIUrl)
+			needConvertResponse = true
+		}
 
-	// 创建代理请求
-	proxyReq, err := http.NewRequest("POST", targetURL, bytes.NewReader(transformedBody))
-	if err != nil {
-		return nil, http.StatusInternalServerError, err
-	}
+		log.Infof("[Claude Code] Routing to: %s (route: %s)", targetURL, route.Name)
 
-	// 设置请求�?
-	proxyReq.Header.Set("Content-Type", "application/json")
-	if targetFormat == "claude" || targetFormat == "anthropic" {
-		// Claude 格式使用 x-api-key
-		if route.APIKey != "" {
-			proxyReq.Header.Set("x-api-key", route.APIKey)
+		// 创建代理请求
+		proxyReq, err := http.NewRequest("POST", targetURL, bytes.NewReader(transformedBody))
+		if err != nil {
+			return nil, err
 		}
-		proxyReq.Header.Set("anthropic-version", "2023-06-01")
-	} else {
-		// OpenAI 格式使用 Bearer token
-		if route.APIKey != "" {
-			proxyReq.Header.Set("Authorization", "Bearer "+route.APIKey)
-		} else if auth := headers["Authorization"]; auth != "" {
-			proxyReq.Header.Set("Authorization", auth)
+
+		// 设置请求头
+		proxyReq.Header.Set("Content-Type", "application/json")
+		if targetFormat == "claude" || targetFormat == "anthropic" {
+			// Claude 格式使用 x-api-key
+			if route.APIKey != "" {
+				proxyReq.Header.Set("x-api-key", route.APIKey)
+			}
+			proxyReq.Header.Set("anthropic-version", "2023-06-01")
+		} else {
+			// OpenAI 格式使用 Bearer token
+			if route.APIKey != "" {
+				proxyReq.Header.Set("Authorization", "Bearer "+route.APIKey)
+			} else if auth := headers["Authorization"]; auth != "" {
+				proxyReq.Header.Set("Authorization", auth)
+			}
 		}
+		return proxyReq, nil
 	}
 
-	// 发送请�?
+	// 发送请求（失败时自动切换到下一条路由）
 	startTime := time.Now()
-	resp, err := s.httpClient.Do(proxyReq)
+	resp, route, err := s.sendWithFailover(model, route, trace, buildRequest)
 	if err != nil {
-		s.routeService.LogRequest(model, route.ID, 0, 0, 0, false, err.Error())
+		if isRequestBuildError(err) {
+			return nil, http.StatusInternalServerError, err
+		}
+		s.logRequest(model, route.ID, trace, 0, 0, 0, false, err.Error())
+		if isRateLimitError(err) {
+			return rateLimitResponse(protocolClaude, err), http.StatusTooManyRequests, nil
+		}
 		return nil, http.StatusServiceUnavailable, fmt.Errorf("backend service unavailable: %v", err)
 	}
 	defer resp.Body.Close()
 
 	responseBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		s.routeService.LogRequest(model, route.ID, 0, 0, 0, false, err.Error())
+		s.logRequest(model, route.ID, trace, 0, 0, 0, false, err.Error())
 		return nil, http.StatusInternalServerError, err
 	}
 
@@ -2664,7 +2881,7 @@ func (s *ProxyService) ProxyClaudeCodeRequest(requestBody []byte, headers map[st
 					if tt, ok := usage["total_tokens"].(float64); ok {
 						totalTokens = int(tt)
 					}
-					s.routeService.LogRequest(model, route.ID, promptTokens, completionTokens, totalTokens, true, "")
+					s.logRequest(model, route.ID, trace, promptTokens, completionTokens, totalTokens, true, "")
 				}
 
 				// �?OpenAI 响应转换�?Claude 格式
@@ -2692,14 +2909,14 @@ func (s *ProxyService) ProxyClaudeCodeRequest(requestBody []byte, headers map[st
 					if ot, ok := usage["output_tokens"].(float64); ok {
 						outputTokens = int(ot)
 					}
-					s.routeService.LogRequest(model, route.ID, inputTokens, outputTokens, inputTokens+outputTokens, true, "")
+					s.logRequest(model, route.ID, trace, inputTokens, outputTokens, inputTokens+outputTokens, true, "")
 				}
 				// 直接返回 Claude 格式响应
 				return responseBody, resp.StatusCode, nil
 			}
 		}
 	} else {
-		s.routeService.LogRequest(model, route.ID, 0, 0, 0, false, string(responseBody))
+		s.logRequest(model, route.ID, trace, 0, 0, 0, false, string(responseBody))
 	}
 
 	return responseBody, resp.StatusCode, nil
@@ -2708,7 +2925,7 @@ func (s *ProxyService) ProxyClaudeCodeRequest(requestBody []byte, headers map[st
 // ProxyClaudeCodeStreamRequest 代理 Claude Code 专用流式请求
 // 请求来自 /api/claudecode/v1/messages，格式为 Claude Code 格式
 // 智能检测目标路由格式：如果目标是 Claude 格式则直接透传，如果是 OpenAI 格式则转换
-func (s *ProxyService) ProxyClaudeCodeStreamRequest(requestBody []byte, headers map[string]string, writer io.Writer, flusher http.Flusher) error {
+func (s *ProxyService) ProxyClaudeCodeStreamRequest(ctx context.Context, requestBody []byte, headers map[string]string, writer io.Writer, flusher http.Flusher) error {
 	// 解析请求
 	var reqData map[string]interface{}
 	if err := json.Unmarshal(requestBody, &reqData); err != nil {
@@ -2720,116 +2937,111 @@ func (s *ProxyService) ProxyClaudeCodeStreamRequest(requestBody []byte, headers
 		return fmt.Errorf("'model' field is required")
 	}
 
-	log.Infof("[Claude Code Stream] Received request for model: %s", model)
-
-	// 提取真实的模型名
-	realModel := model
-	if strings.Contains(model, ":streamGenerateContent") {
-		realModel = strings.TrimSuffix(model, ":streamGenerateContent")
-	}
+	trace := s.traceRequest(ctx, headers)
+	requested := model
 
-	// 首先检查是否是重定向关键字
-	var route *database.ModelRoute
-	var err error
-	isRedirect := s.config.RedirectEnabled && (realModel == s.config.RedirectKeyword || strings.HasPrefix(realModel, s.config.RedirectKeyword+":"))
+	log.Infof("[Claude Code Stream] Received request for model: %s", model)
 
-	if isRedirect {
-		route, err = s.getRedirectRoute()
-		if err != nil {
-			return fmt.Errorf("redirect target not configured or not found: %v", err)
-		}
-		log.Infof("Redirecting %s to route: %s (model: %s, id: %d)", realModel, route.Name, route.Model, route.ID)
-		model = route.Model
-		reqData["model"] = model
-		requestBody, _ = json.Marshal(reqData)
-	} else {
-		// 查找路由
-		route, err = s.routeService.GetRouteByModel(model)
-		if err != nil {
-			if strings.Contains(err.Error(), "model not found") {
-				availableModels, _ := s.routeService.GetAvailableModels()
-				return fmt.Errorf("model '%s' not found in route list. Available models: %v", model, availableModels)
-			}
-			return fmt.Errorf("route lookup failed for model '%s': %v", model, err)
+	route, model, err := s.resolveRequestRoute(model, headers, reqData, true, trace)
+	if err != nil {
+		if isCapabilityError(err) {
+			return writeCapabilityError(writer, protocolClaude, err)
 		}
+		return err
 	}
-
-	// 清理路由 API URL
-	cleanAPIUrl := strings.TrimSuffix(route.APIUrl, "/")
-
-	// 智能检测目标路由格�?
-	targetFormat := normalizeFormat(route.Format)
-	if targetFormat == "" {
-		targetFormat = inferFormatFromRoute(route.APIUrl, route.Model)
+	if model != requested {
+		requestBody, _ = json.Marshal(reqData)
 	}
 
-	log.Infof("[Claude Code Stream] Target route format: %s", targetFormat)
+	// 确保开启 stream
+	reqData["stream"] = true
 
-	var transformedBody []byte
-	var targetURL string
+	// 每条候选路由都需要重新检测目标格式
 	var needConvertResponse bool
+	buildRequest := func(route *database.ModelRoute) (*http.Request, error) {
+		// 按路由配置的上游模型名改写请求
+		upstreamModel, upstreamReq, _ := withUpstreamModel(route, model, reqData, requestBody)
 
-	// 确保开�?stream
-	reqData["stream"] = true
+		// 清理路由 API URL
+		cleanAPIUrl := strings.TrimSuffix(route.APIUrl, "/")
 
-	if targetFormat == "claude" || targetFormat == "anthropic" {
-		// 目标�?Claude 格式，直接透传请求
-		log.Infof("[Claude Code Stream] Target is Claude format, passing through directly")
-		requestBody, _ = json.Marshal(reqData)
-		transformedBody = requestBody
-		targetURL = buildClaudeMessagesURL(cleanAPIUrl)
-		needConvertResponse = false
-	} else {
-		// 目标�?OpenAI 格式，需要转�?
-		log.Infof("[Claude Code Stream] Target is OpenAI format, converting request")
-		adapter := adapters.GetAdapter("claudecode-to-openai")
-		if adapter == nil {
-			return fmt.Errorf("claudecode-to-openai adapter not found")
+		// 智能检测目标路由格式
+		targetFormat := normalizeFormat(route.Format)
+		if targetFormat == "" {
+			targetFormat = inferFormatFromRoute(route.APIUrl, route.Model)
 		}
 
-		transformedReq, err := adapter.AdaptRequest(reqData, model)
-		if err != nil {
-			log.Errorf("[Claude Code Stream] Failed to adapt request: %v", err)
-			return err
-		}
-		transformedBody, _ = json.Marshal(transformedReq)
-		targetURL = buildOpenAIChatURL(route.APIUrl)
-		needConvertResponse = true
-	}
+		log.Infof("[Claude Code Stream] Target route format: %s", targetFormat)
 
-	log.Infof("[Claude Code Stream] Streaming to: %s (route: %s)", targetURL, route.Name)
+		var transformedBody []byte
+		var targetURL string
 
-	// 创建代理请求
-	proxyReq, err := http.NewRequest("POST", targetURL, bytes.NewReader(transformedBody))
-	if err != nil {
-		return err
-	}
+		if targetFormat == "claude" || targetFormat == "anthropic" {
+			// 目标是 Claude 格式，直接透传请求
+			log.Infof("[Claude Code Stream] Target is Claude format, passing through directly")
+			transformedBody, _ = json.Marshal(upstreamReq)
+			targetURL = buildClaudeMessagesURL(cleanAPIUrl)
+			needConvertResponse = false
+		} else {
+			// 目标是 OpenAI 格式，需要转换
+			log.Infof("[Claude Code Stream] Target is OpenAI format, converting request")
+			adapter := adapters.GetAdapter("claudecode-to-openai")
+			if adapter == nil {
+				return nil, fmt.Errorf("claudecode-to-openai adapter not found")
+			}
 
-	proxyReq.Header.Set("Content-Type", "application/json")
-	if targetFormat == "claude" || targetFormat == "anthropic" {
-		// Claude 格式使用 x-api-key
-		if route.APIKey != "" {
-			proxyReq.Header.Set("x-api-key", route.APIKey)
+			transformedReq, err := adapter.AdaptRequest(upstreamReq, upstreamModel)
+			if err != nil {
+				log.Errorf("[Claude Code Stream] Failed to adapt request: %v", err)
+				return nil, err
+			}
+			transformedBody, _ = json.Marshal(transformedReq)
+			targetURL = buildOpenAIChatURL(route.APIUrl)
+			needConvertResponse = true
 		}
-		proxyReq.Header.Set("anthropic-version", "2023-06-01")
-	} else {
-		// OpenAI 格式使用 Bearer token
-		if route.APIKey != "" {
-			proxyReq.Header.Set("Authorization", "Bearer "+route.APIKey)
-		} else if auth := headers["Authorization"]; auth != "" {
-			proxyReq.Header.Set("Authorization", auth)
+
+		log.Infof("[Claude Code Stream] Streaming to: %s (route: %s)", targetURL, route.Name)
+
+		// 创建代理请求
+		proxyReq, err := http.NewRequest("POST", targetURL, bytes.NewReader(transformedBody))
+		if err != nil {
+			return nil, err
 		}
+
+		proxyReq.Header.Set("Content-Type", "application/json")
+		if targetFormat == "claude" || targetFormat == "anthropic" {
+			// Claude 格式使用 x-api-key
+			if route.APIKey != "" {
+				proxyReq.Header.Set("x-api-key", route.APIKey)
+			}
+			proxyReq.Header.Set("anthropic-version", "2023-06-01")
+		} else {
+			// OpenAI 格式使用 Bearer token
+			if route.APIKey != "" {
+				proxyReq.Header.Set("Authorization", "Bearer "+route.APIKey)
+			} else if auth := headers["Authorization"]; auth != "" {
+				proxyReq.Header.Set("Authorization", auth)
+			}
+		}
+		return proxyReq, nil
 	}
 
-	// 发送请�?
-	resp, err := s.httpClient.Do(proxyReq)
+	// 发送请求（失败时自动切换到下一条路由）
+	resp, route, err := s.sendWithFailover(model, route, trace, buildRequest)
 	if err != nil {
+		if !isRequestBuildError(err) {
+			s.logRequest(model, route.ID, trace, 0, 0, 0, false, err.Error())
+		}
+		if isRateLimitError(err) {
+			return writeRateLimitError(writer, protocolClaude, err)
+		}
 		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
+		s.logRequest(model, route.ID, trace, 0, 0, 0, false, string(body))
 		return fmt.Errorf("backend error: %d - %s", resp.StatusCode, string(body))
 	}
 
@@ -3028,6 +3240,11 @@ func (s *ProxyService) streamOpenAIToClaudeCode(reader io.Reader, writer io.Writ
 		}
 	}
 
+	if err := scanner.Err(); err != nil {
+		s.logRequest(model, routeID, traceOf(reader), 0, 0, 0, false, err.Error())
+		return err
+	}
+
 	// 关闭所有打开的内容块
 	if contentBlockStarted && !toolCallsStarted {
 		contentBlockStop := map[string]interface{}{
@@ -3081,7 +3298,7 @@ func (s *ProxyService) streamOpenAIToClaudeCode(reader io.Reader, writer io.Writ
 
 	// 记录请求
 	totalTokens := totalPromptTokens + totalCompletionTokens
-	s.routeService.LogRequest(model, routeID, totalPromptTokens, totalCompletionTokens, totalTokens, true, "")
+	s.logRequest(model, routeID, traceOf(reader), totalPromptTokens, totalCompletionTokens, totalTokens, true, "")
 
 	return nil
 }
@@ -0,0 +1,413 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"openai-router-go/internal/config"
+	"openai-router-go/internal/database"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// 路由限流默认配置，配置值非法时使用
+const (
+	DefaultRateLimitQueueSize = 50               // 每条路由最多排队等待的请求数
+	DefaultRateLimitMaxWait   = 30 * time.Second // 单个请求最长排队时间
+)
+
+// ErrorTypeRateLimited 请求超过路由 RPM/TPM 限制，且无法排队也没有其他路由可用，记录在 request_logs.error_type 中
+const ErrorTypeRateLimited = "rate_limited"
+
+// 客户端协议，决定限流时 429 响应体的格式
+const (
+	protocolOpenAI = "openai"
+	protocolClaude = "claude"
+	protocolGemini = "gemini"
+)
+
+// normalizeRateLimit 限额不能为负，负数按不限制处理
+func normalizeRateLimit(limit int) int {
+	if limit < 0 {
+		return 0
+	}
+	return limit
+}
+
+// tokenBucket 令牌桶：容量为每分钟的限额，每秒匀速补充限额 / 60 个令牌
+// 令牌数允许为负，表示已被排队中的请求预占
+type tokenBucket struct {
+	limit  int
+	tokens float64
+	last   time.Time
+}
+
+// refill 按经过的时间补充令牌，最多补满容量
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * float64(b.limit) / 60
+	if b.tokens > float64(b.limit) {
+		b.tokens = float64(b.limit)
+	}
+	b.last = now
+}
+
+// waitFor 取出 n 个令牌需要等待的时间
+func (b *tokenBucket) waitFor(n float64) time.Duration {
+	if b.tokens >= n {
+		return 0
+	}
+	return time.Duration((n - b.tokens) * 60 / float64(b.limit) * float64(time.Second))
+}
+
+// cost 请求在桶中实际扣除的令牌数：超过容量的请求按容量计算，避免永远无法发出
+func (b *tokenBucket) cost(n int) float64 {
+	if n > b.limit {
+		return float64(b.limit)
+	}
+	return float64(n)
+}
+
+// syncBucket 按路由当前的限额创建、调整或移除令牌桶，新建的桶是满的
+func syncBucket(b *tokenBucket, limit int, now time.Time) *tokenBucket {
+	if limit <= 0 {
+		return nil
+	}
+	if b == nil {
+		return &tokenBucket{limit: limit, tokens: float64(limit), last: now}
+	}
+	b.refill(now)
+	b.limit = limit
+	if b.tokens > float64(limit) {
+		b.tokens = float64(limit)
+	}
+	return b
+}
+
+// routeLimiter 单条路由的请求数、token 数令牌桶和排队数量，桶为 nil 表示不限制
+type routeLimiter struct {
+	requests *tokenBucket
+	tokens   *tokenBucket
+	queued   int
+}
+
+// RateLimitStatus 路由的限流状态，只保存在内存中
+type RateLimitStatus struct {
+	RouteID           int64 `json:"route_id"`
+	RPMLimit          int   `json:"rpm_limit"`
+	TPMLimit          int   `json:"tpm_limit"`
+	RequestsAvailable int   `json:"requests_available"` // 当前可立即发出的请求数，负数表示已被排队请求预占
+	TokensAvailable   int   `json:"tokens_available"`
+	Queued            int   `json:"queued"` // 正在排队等待的请求数
+}
+
+// rateLimitError 请求超过路由限流，且预计等待时间超过上限或排队已满
+type rateLimitError struct {
+	routeName  string
+	kind       string // requests 或 tokens，表示触发限流的是 RPM 还是 TPM
+	retryAfter time.Duration
+}
+
+func (e *rateLimitError) Error() string {
+	limit := "RPM"
+	if e.kind == "tokens" {
+		limit = "TPM"
+	}
+	return fmt.Sprintf("rate limit reached for route %s (%s), please retry after %ds", e.routeName, limit, e.retrySeconds())
+}
+
+// retrySeconds 建议客户端重试的秒数，至少为 1
+func (e *rateLimitError) retrySeconds() int {
+	seconds := int((e.retryAfter + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		return 1
+	}
+	return seconds
+}
+
+// isRateLimitError 判断错误是否为路由限流
+func isRateLimitError(err error) bool {
+	_, ok := err.(*rateLimitError)
+	return ok
+}
+
+// RateLimiter 按路由维护 RPM/TPM 令牌桶
+// 超过限额的请求在令牌桶中预占令牌后排队等待，等待顺序即预占顺序
+type RateLimiter struct {
+	mu     sync.Mutex
+	routes map[int64]*routeLimiter
+}
+
+// NewRateLimiter 创建路由限流器
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{routes: make(map[int64]*routeLimiter)}
+}
+
+// get 获取路由的限流状态并同步路由当前的限额，调用方需持有锁
+func (rl *RateLimiter) get(route *database.ModelRoute, now time.Time) *routeLimiter {
+	l, ok := rl.routes[route.ID]
+	if !ok {
+		l = &routeLimiter{}
+		rl.routes[route.ID] = l
+	}
+	l.requests = syncBucket(l.requests, route.RPMLimit, now)
+	l.tokens = syncBucket(l.tokens, route.TPMLimit, now)
+	return l
+}
+
+// reserve 为请求预占令牌，返回需要等待的时间
+// 需要等待时请求计入排队数量，调用方等待结束后需调用 dequeue
+func (rl *RateLimiter) reserve(route *database.ModelRoute, tokens, queueSize int, maxWait time.Duration) (*routeLimiter, time.Duration, error) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	l := rl.get(route, time.Now())
+	var wait time.Duration
+	kind := "requests"
+	if l.requests != nil {
+		wait = l.requests.waitFor(1)
+	}
+	if l.tokens != nil {
+		if tokenWait := l.tokens.waitFor(l.tokens.cost(tokens)); tokenWait > wait {
+			wait = tokenWait
+			kind = "tokens"
+		}
+	}
+
+	if wait > 0 && (wait > maxWait || l.queued >= queueSize) {
+		return nil, 0, &rateLimitError{routeName: route.Name, kind: kind, retryAfter: wait}
+	}
+
+	if l.requests != nil {
+		l.requests.tokens--
+	}
+	if l.tokens != nil {
+		l.tokens.tokens -= l.tokens.cost(tokens)
+	}
+	if wait > 0 {
+		l.queued++
+	}
+	return l, wait, nil
+}
+
+// dequeue 排队的请求等待结束；cancelled 为 true 时请求不再发出，退还预占的令牌
+func (rl *RateLimiter) dequeue(l *routeLimiter, tokens int, cancelled bool) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	l.queued--
+	if cancelled {
+		l.giveBack(tokens)
+	}
+}
+
+// giveBack 退还请求预占的请求数和 token 令牌，调用方需持有锁
+func (l *routeLimiter) giveBack(tokens int) {
+	now := time.Now()
+	if l.requests != nil {
+		l.requests.refill(now)
+		l.requests.tokens = math.Min(l.requests.tokens+1, float64(l.requests.limit))
+	}
+	if l.tokens != nil {
+		l.tokens.refill(now)
+		l.tokens.tokens = math.Min(l.tokens.tokens+l.tokens.cost(tokens), float64(l.tokens.limit))
+	}
+}
+
+// Cancel 已通过限流的请求最终没有发出时退还预占的请求数和 token 令牌
+func (rl *RateLimiter) Cancel(routeID int64, tokens int) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if l, ok := rl.routes[routeID]; ok {
+		l.giveBack(tokens)
+	}
+}
+
+// Wait 等待路由的限流放行，tokens 为请求估算的输入 token 数
+// 预计等待时间超过 maxWait 或排队请求数已达 queueSize 时不再等待，直接返回 rateLimitError；
+// 排队期间 ctx 结束（如客户端断开）时退还预占的令牌并返回 ctx 的错误
+func (rl *RateLimiter) Wait(ctx context.Context, route *database.ModelRoute, tokens, queueSize int, maxWait time.Duration) error {
+	if route.RPMLimit <= 0 && route.TPMLimit <= 0 {
+		return nil
+	}
+
+	l, wait, err := rl.reserve(route, tokens, queueSize, maxWait)
+	if err != nil || wait == 0 {
+		return err
+	}
+
+	log.Infof("[RateLimit] Route %s (id=%d) is over its limit, request queued for %v", route.Name, route.ID, wait.Round(time.Millisecond))
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		rl.dequeue(l, tokens, false)
+		return nil
+	case <-ctx.Done():
+		rl.dequeue(l, tokens, true)
+		log.Infof("[RateLimit] Queued request for route %s (id=%d) cancelled: %v", route.Name, route.ID, ctx.Err())
+		return ctx.Err()
+	}
+}
+
+// Settle 请求完成后按实际 token 用量校正 TPM 令牌桶：多退少补，estimated 为发出请求前预扣的估算值
+func (rl *RateLimiter) Settle(routeID int64, estimated, actual int) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	l, ok := rl.routes[routeID]
+	if !ok || l.tokens == nil || actual <= 0 {
+		return
+	}
+	l.tokens.refill(time.Now())
+	l.tokens.tokens -= float64(actual) - l.tokens.cost(estimated)
+	if l.tokens.tokens > float64(l.tokens.limit) {
+		l.tokens.tokens = float64(l.tokens.limit)
+	}
+}
+
+// Refund 请求没有消耗上游 token（如上游返回错误或故障转移到其他路由）时退还预扣的 TPM 令牌，estimated 为预扣的估算值
+func (rl *RateLimiter) Refund(routeID int64, estimated int) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	l, ok := rl.routes[routeID]
+	if !ok || l.tokens == nil {
+		return
+	}
+	l.tokens.refill(time.Now())
+	l.tokens.tokens += l.tokens.cost(estimated)
+	if l.tokens.tokens > float64(l.tokens.limit) {
+		l.tokens.tokens = float64(l.tokens.limit)
+	}
+}
+
+// Status 获取路由当前的限流状态
+func (rl *RateLimiter) Status(route *database.ModelRoute) RateLimitStatus {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	status := RateLimitStatus{RouteID: route.ID, RPMLimit: route.RPMLimit, TPMLimit: route.TPMLimit}
+	l := rl.get(route, time.Now())
+	if l.requests != nil {
+		status.RequestsAvailable = int(l.requests.tokens)
+	}
+	if l.tokens != nil {
+		status.TokensAvailable = int(l.tokens.tokens)
+	}
+	status.Queued = l.queued
+	return status
+}
+
+// Forget 清除路由的限流状态，限额在下次请求时按路由配置重新生效
+func (rl *RateLimiter) Forget(routeID int64) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	delete(rl.routes, routeID)
+}
+
+// rateLimitResponse 按客户端协议生成限流的 429 响应体
+func rateLimitResponse(protocol string, err error) []byte {
+	var body map[string]interface{}
+	switch protocol {
+	case protocolClaude:
+		body = map[string]interface{}{
+			"type": "error",
+			"error": map[string]interface{}{
+				"type":    "rate_limit_error",
+				"message": err.Error(),
+			},
+		}
+	case protocolGemini:
+		body = map[string]interface{}{
+			"error": map[string]interface{}{
+				"code":    http.StatusTooManyRequests,
+				"message": err.Error(),
+				"status":  "RESOURCE_EXHAUSTED",
+			},
+		}
+	default:
+		kind := "requests"
+		if rle, ok := err.(*rateLimitError); ok {
+			kind = rle.kind
+		}
+		body = map[string]interface{}{
+			"error": map[string]interface{}{
+				"message": err.Error(),
+				"type":    kind,
+				"param":   nil,
+				"code":    "rate_limit_exceeded",
+			},
+		}
+	}
+	data, _ := json.Marshal(body)
+	return data
+}
+
+// writeRateLimitError 流式请求被限流时向客户端写入 429 响应（此时还没有发送任何 SSE 数据）
+func writeRateLimitError(writer io.Writer, protocol string, err error) error {
+	if w, ok := writer.(http.ResponseWriter); ok {
+		w.Header().Set("Content-Type", "application/json")
+		if rle, ok := err.(*rateLimitError); ok {
+			w.Header().Set("Retry-After", strconv.Itoa(rle.retrySeconds()))
+		}
+		w.WriteHeader(http.StatusTooManyRequests)
+	}
+	writer.Write(rateLimitResponse(protocol, err))
+	return err
+}
+
+// waitRateLimit 等待路由的限流放行，排队参数取自配置；排队数量或排队秒数配置为 0 时超限的请求不排队
+// 最长排队时间从请求第一次排队时开始计算，故障转移或溢出到其他路由后只能使用剩余的排队时间
+func (s *ProxyService) waitRateLimit(route *database.ModelRoute, trace *requestTrace) error {
+	queueSize := s.config.RateLimitQueueSize
+	if queueSize < 0 {
+		queueSize = DefaultRateLimitQueueSize
+	}
+	maxWait := DefaultRateLimitMaxWait
+	if s.config.RateLimitMaxWaitSeconds >= 0 {
+		maxWait = time.Duration(s.config.RateLimitMaxWaitSeconds) * time.Second
+	}
+	if trace.queueUntil.IsZero() {
+		trace.queueUntil = time.Now().Add(maxWait)
+	}
+	maxWait = time.Until(trace.queueUntil)
+	if maxWait < 0 {
+		maxWait = 0
+	}
+	return s.rateLimiter.Wait(trace.ctx, route, trace.estimated, queueSize, maxWait)
+}
+
+// SetRateLimitConfig 更新路由限流的排队数量上限和最长排队秒数并保存
+func (s *ProxyService) SetRateLimitConfig(queueSize, maxWaitSeconds int) error {
+	if queueSize < 0 {
+		return fmt.Errorf("invalid rate limit queue size: %d", queueSize)
+	}
+	if maxWaitSeconds < 0 {
+		return fmt.Errorf("invalid rate limit max wait: %d", maxWaitSeconds)
+	}
+
+	return s.UpdateConfig(func(cfg *config.Config) {
+		cfg.RateLimitQueueSize = queueSize
+		cfg.RateLimitMaxWaitSeconds = maxWaitSeconds
+	})
+}
+
+// GetRouteRateLimitStatus 获取路由当前的限流状态
+func (s *ProxyService) GetRouteRateLimitStatus(routeID int64) (RateLimitStatus, error) {
+	route, err := s.routeService.GetRouteByID(routeID)
+	if err != nil {
+		return RateLimitStatus{}, err
+	}
+	return s.rateLimiter.Status(route), nil
+}
+
+// ForgetRouteRateLimit 清除路由在内存中的限流状态
+func (s *ProxyService) ForgetRouteRateLimit(routeID int64) {
+	s.rateLimiter.Forget(routeID)
+}
@@ -0,0 +1,245 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"openai-router-go/internal/database"
+)
+
+// drain 连续发出 n 个不需要排队的请求
+func drain(t *testing.T, rl *RateLimiter, route *database.ModelRoute, tokens, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := rl.Wait(context.Background(), route, tokens, 0, 0); err != nil {
+			t.Fatalf("request %d: %v", i+1, err)
+		}
+	}
+}
+
+func TestRateLimiterUnlimited(t *testing.T) {
+	rl := NewRateLimiter()
+	route := &database.ModelRoute{ID: 1, Name: "free"}
+	drain(t, rl, route, 1_000_000, 100)
+	if _, ok := rl.routes[route.ID]; ok {
+		t.Fatal("routes without limits should not get a limiter")
+	}
+}
+
+func TestRateLimiterRejectsWithoutQueue(t *testing.T) {
+	rl := NewRateLimiter()
+	route := &database.ModelRoute{ID: 1, Name: "limited", RPMLimit: 6}
+	drain(t, rl, route, 0, 6)
+
+	err := rl.Wait(context.Background(), route, 0, 0, 0)
+	var rle *rateLimitError
+	if !errors.As(err, &rle) {
+		t.Fatalf("Wait() over the limit = %v, want a rateLimitError", err)
+	}
+	// 每 10 秒补充一个请求
+	if rle.kind != "requests" || rle.retrySeconds() < 9 || rle.retrySeconds() > 10 {
+		t.Fatalf("error = %+v (retry %ds), want an RPM error with about 10s retry", rle, rle.retrySeconds())
+	}
+	if status := rl.Status(route); status.RequestsAvailable != 0 || status.Queued != 0 {
+		t.Fatalf("a rejected request should not reserve anything, status = %+v", status)
+	}
+}
+
+func TestRateLimiterQueue(t *testing.T) {
+	rl := NewRateLimiter()
+	route := &database.ModelRoute{ID: 1, Name: "limited", RPMLimit: 6}
+	drain(t, rl, route, 0, 6)
+
+	// 排队的请求依次预占令牌，等待时间逐个增加
+	first, wait, err := rl.reserve(route, 0, 2, time.Minute)
+	if err != nil || wait < 9*time.Second || wait > 10*time.Second {
+		t.Fatalf("first queued request: wait %v, err %v; want about 10s", wait, err)
+	}
+	_, wait, err = rl.reserve(route, 0, 2, time.Minute)
+	if err != nil || wait < 19*time.Second || wait > 20*time.Second {
+		t.Fatalf("second queued request: wait %v, err %v; want about 20s", wait, err)
+	}
+	if _, _, err := rl.reserve(route, 0, 2, time.Minute); !isRateLimitError(err) {
+		t.Fatalf("request over the queue size: err = %v, want a rateLimitError", err)
+	}
+	if status := rl.Status(route); status.Queued != 2 || status.RequestsAvailable >= 0 {
+		t.Fatalf("status = %+v, want 2 queued and the bucket reserved below zero", status)
+	}
+
+	// 取消排队退还预占的令牌，后面的请求等待时间随之缩短
+	rl.dequeue(first, 0, true)
+	_, wait, err = rl.reserve(route, 0, 2, time.Minute)
+	if err != nil || wait < 19*time.Second || wait > 20*time.Second {
+		t.Fatalf("request after a cancellation: wait %v, err %v; want about 20s", wait, err)
+	}
+	if _, _, err := rl.reserve(route, 0, 5, 25*time.Second); !isRateLimitError(err) {
+		t.Fatalf("request over the max wait: err = %v, want a rateLimitError", err)
+	}
+}
+
+func TestRateLimiterWaitsForTokens(t *testing.T) {
+	rl := NewRateLimiter()
+	// 每 10ms 补充一个请求，不排队的请求被拒绝时桶已取空
+	route := &database.ModelRoute{ID: 1, Name: "fast", RPMLimit: 6000}
+	for rl.Wait(context.Background(), route, 0, 0, 0) == nil {
+	}
+
+	start := time.Now()
+	if err := rl.Wait(context.Background(), route, 0, 1, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 5*time.Millisecond {
+		t.Fatalf("queued request returned after %v, want it to wait for a token", elapsed)
+	}
+	if status := rl.Status(route); status.Queued != 0 {
+		t.Fatalf("queued = %d after the wait, want 0", status.Queued)
+	}
+}
+
+func TestRateLimiterWaitCancelled(t *testing.T) {
+	rl := NewRateLimiter()
+	route := &database.ModelRoute{ID: 1, Name: "limited", RPMLimit: 6}
+	drain(t, rl, route, 0, 6)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := rl.Wait(ctx, route, 0, 1, time.Minute); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Wait() = %v, want the context error", err)
+	}
+	if status := rl.Status(route); status.Queued != 0 || status.RequestsAvailable != 0 {
+		t.Fatalf("status after cancellation = %+v, want the reservation returned", status)
+	}
+}
+
+func TestRateLimiterTokens(t *testing.T) {
+	rl := NewRateLimiter()
+	route := &database.ModelRoute{ID: 1, Name: "tpm", TPMLimit: 1000}
+
+	drain(t, rl, route, 400, 1)
+	if status := rl.Status(route); status.TokensAvailable != 600 {
+		t.Fatalf("tokens available = %d, want 600", status.TokensAvailable)
+	}
+
+	// 上游实际用量多于估算时补扣，少于估算时退还
+	rl.Settle(route.ID, 400, 700)
+	if status := rl.Status(route); status.TokensAvailable < 299 || status.TokensAvailable > 301 {
+		t.Fatalf("tokens available after settle = %d, want about 300", status.TokensAvailable)
+	}
+	rl.Refund(route.ID, 200)
+	if status := rl.Status(route); status.TokensAvailable < 499 || status.TokensAvailable > 501 {
+		t.Fatalf("tokens available after refund = %d, want about 500", status.TokensAvailable)
+	}
+	rl.Refund(route.ID, 5000)
+	if status := rl.Status(route); status.TokensAvailable != 1000 {
+		t.Fatalf("refund should not overfill the bucket, tokens available = %d", status.TokensAvailable)
+	}
+
+	// 超过容量的请求按容量扣除，不会永远无法发出
+	drain(t, rl, route, 5000, 1)
+	err := rl.Wait(context.Background(), route, 1, 0, 0)
+	var rle *rateLimitError
+	if !errors.As(err, &rle) || rle.kind != "tokens" {
+		t.Fatalf("Wait() with an empty token bucket = %v, want a TPM rateLimitError", err)
+	}
+}
+
+func TestRateLimiterCancel(t *testing.T) {
+	rl := NewRateLimiter()
+	route := &database.ModelRoute{ID: 1, Name: "both", RPMLimit: 10, TPMLimit: 1000}
+	drain(t, rl, route, 300, 2)
+
+	rl.Cancel(route.ID, 300)
+	status := rl.Status(route)
+	if status.RequestsAvailable != 9 || status.TokensAvailable < 699 || status.TokensAvailable > 701 {
+		t.Fatalf("status after cancel = %+v, want 9 requests and about 700 tokens", status)
+	}
+}
+
+func TestRateLimiterFollowsRouteLimits(t *testing.T) {
+	rl := NewRateLimiter()
+	route := &database.ModelRoute{ID: 1, Name: "limited", RPMLimit: 100}
+	drain(t, rl, route, 0, 10)
+
+	// 限额调低后可用令牌不超过新的容量，取消限额后不再限流
+	route.RPMLimit = 5
+	if status := rl.Status(route); status.RequestsAvailable != 5 || status.RPMLimit != 5 {
+		t.Fatalf("status after lowering the limit = %+v, want 5 available", status)
+	}
+	route.RPMLimit = 0
+	drain(t, rl, route, 0, 50)
+
+	rl.Forget(route.ID)
+	if _, ok := rl.routes[route.ID]; ok {
+		t.Fatal("Forget() should drop the route state")
+	}
+}
+
+func TestRateLimitResponse(t *testing.T) {
+	err := &rateLimitError{routeName: "r", kind: "tokens", retryAfter: 1500 * time.Millisecond}
+	if err.retrySeconds() != 2 {
+		t.Fatalf("retrySeconds() = %d, want 2", err.retrySeconds())
+	}
+
+	tests := []struct {
+		protocol string
+		path     []string
+		want     interface{}
+	}{
+		{protocolOpenAI, []string{"error", "code"}, "rate_limit_exceeded"},
+		{protocolOpenAI, []string{"error", "type"}, "tokens"},
+		{protocolClaude, []string{"error", "type"}, "rate_limit_error"},
+		{protocolGemini, []string{"error", "status"}, "RESOURCE_EXHAUSTED"},
+	}
+	for _, tt := range tests {
+		var body map[string]interface{}
+		if err := json.Unmarshal(rateLimitResponse(tt.protocol, err), &body); err != nil {
+			t.Fatal(err)
+		}
+		var value interface{} = body
+		for _, key := range tt.path {
+			value = value.(map[string]interface{})[key]
+		}
+		if value != tt.want {
+			t.Errorf("%s response %v = %v, want %v", tt.protocol, tt.path, value, tt.want)
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	if got := writeRateLimitError(recorder, protocolOpenAI, err); got != err {
+		t.Fatalf("writeRateLimitError() = %v, want the original error", got)
+	}
+	if recorder.Code != 429 || recorder.Header().Get("Retry-After") != "2" {
+		t.Fatalf("response = %d with Retry-After %q, want 429 and 2", recorder.Code, recorder.Header().Get("Retry-After"))
+	}
+}
+
+func TestSetRateLimitConfig(t *testing.T) {
+	s := newTestProxyService(t)
+	if err := s.SetRateLimitConfig(-1, 10); err == nil {
+		t.Fatal("negative queue size should be rejected")
+	}
+	if err := s.SetRateLimitConfig(10, -1); err == nil {
+		t.Fatal("negative max wait should be rejected")
+	}
+	if err := s.SetRateLimitConfig(0, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// 排队关闭时超限的请求直接被拒绝
+	route := addTestRoute(t, s.routeService, database.ModelRoute{Name: "limited", Model: "gpt-4o", RPMLimit: 1})
+	trace := s.traceRequest(context.Background(), nil)
+	if err := s.waitRateLimit(route, trace); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.waitRateLimit(route, trace); !isRateLimitError(err) {
+		t.Fatalf("waitRateLimit() over the limit = %v, want a rateLimitError", err)
+	}
+	status, err := s.GetRouteRateLimitStatus(route.ID)
+	if err != nil || status.RequestsAvailable != 0 || status.RPMLimit != 1 {
+		t.Fatalf("GetRouteRateLimitStatus() = %+v, %v", status, err)
+	}
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"openai-router-go/internal/config"
+	"openai-router-go/internal/database"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// redirectRules 返回当前生效的重定向规则，单个重定向关键字（旧配置）排在最前
+func (s *ProxyService) redirectRules() []config.RedirectRule {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	if !s.config.RedirectEnabled {
+		return nil
+	}
+
+	rules := make([]config.RedirectRule, 0, len(s.config.RedirectRules)+1)
+	if s.config.RedirectKeyword != "" {
+		rules = append(rules, config.RedirectRule{
+			Keyword:       s.config.RedirectKeyword,
+			TargetModel:   s.config.RedirectTargetModel,
+			TargetRouteID: s.config.RedirectTargetRouteID,
+		})
+	}
+	for _, rule := range s.config.RedirectRules {
+		if rule.Keyword != "" {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// matchRedirectRule 查找与模型名匹配的重定向规则，支持带后缀的模型名（如 keyword:xxx）
+func (s *ProxyService) matchRedirectRule(model string) (config.RedirectRule, bool) {
+	for _, rule := range s.redirectRules() {
+		if model == rule.Keyword || strings.HasPrefix(model, rule.Keyword+":") {
+			return rule, true
+		}
+	}
+	return config.RedirectRule{}, false
+}
+
+// resolveRedirect 判断请求是否需要重定向，是则返回目标路由
+// 先按顺序匹配内容路由规则（命中的规则名记录到 trace），再匹配重定向关键字
+// 第二个返回值表示是否命中重定向，命中但目标不可用时返回错误
+// features 为调用方提取的请求特征；路由测试请求不做重定向
+// 命中重定向时请求改用的模型名记录到 trace.redirectModel
+func (s *ProxyService) resolveRedirect(model string, features requestFeatures, trace *requestTrace) (*database.ModelRoute, bool, error) {
+	if trace.test != nil {
+		return nil, false, nil
+	}
+	if rule, ok := s.matchRoutingRules(model, features); ok {
+		trace.rule = rule.Name
+		log.Infof("[RoutingRule] Request for %s matched rule: %s", model, rule.Name)
+		route, err := s.redirectTarget(rule.Name, rule.TargetModel, rule.TargetRouteID, trace)
+		if err == nil {
+			trace.redirectModel = redirectModel(route, rule.TargetModel, model)
+		}
+		return route, true, err
+	}
+
+	rule, ok := s.matchRedirectRule(model)
+	if !ok {
+		return nil, false, nil
+	}
+	route, err := s.redirectTarget(rule.Keyword, rule.TargetModel, rule.TargetRouteID, trace)
+	if err == nil {
+		trace.redirectModel = redirectModel(route, rule.TargetModel, model)
+	}
+	return route, true, err
+}
+
+// redirectModel 重定向后请求使用的模型名，一般为目标路由的模型名
+// 目标路由的 model 是通配符或正则时不能发往上游，改用规则的目标模型，没有配置目标模型时沿用请求的模型名；
+// 路由配置了 upstream_model 时最终仍按 upstream_model 发送
+func redirectModel(route *database.ModelRoute, targetModel, requested string) string {
+	if !IsModelPattern(route.Model) {
+		return route.Model
+	}
+	if targetModel != "" {
+		return targetModel
+	}
+	return requested
+}
+
+// redirectTarget 获取重定向目标路由，配置了 targetRouteID 时优先使用该路由，否则按 targetModel 在请求的分组中选路
+// targetRouteID 指定的路由不具备请求需要的能力时同样回退到 targetModel
+func (s *ProxyService) redirectTarget(name, targetModel string, targetRouteID int64, trace *requestTrace) (*database.ModelRoute, error) {
+	var unsupported error
+	if targetRouteID > 0 {
+		route, err := s.routeService.GetRouteByID(targetRouteID)
+		if err == nil {
+			reason := routeCapabilities(route).unsupportedReason(trace.needs)
+			if reason == "" {
+				return route, nil
+			}
+			unsupported = &capabilityError{model: route.Model, reasons: []string{route.Name + ": " + reason}}
+			err = unsupported
+		}
+		log.Warnf("Failed to get route by ID %d, falling back to model lookup: %v", targetRouteID, err)
+	}
+
+	if targetModel == "" {
+		if unsupported != nil {
+			return nil, unsupported
+		}
+		return nil, fmt.Errorf("redirect target model not configured for: %s", name)
+	}
+	return s.selectRoute(targetModel, trace, nil)
+}
+
+// GetRedirectKeywords 获取所有生效的重定向关键字，重定向关闭时返回空
+func (s *ProxyService) GetRedirectKeywords() []string {
+	rules := s.redirectRules()
+	keywords := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		keywords = append(keywords, rule.Keyword)
+	}
+	return keywords
+}
+
+// GetRedirectRules 获取重定向规则表（不含单个重定向关键字）的副本
+func (s *ProxyService) GetRedirectRules() []config.RedirectRule {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	return append([]config.RedirectRule(nil), s.config.RedirectRules...)
+}
+
+// SetRedirectConfig 设置重定向开关和单个重定向关键字并保存，关键字不能和重定向规则表中的关键字重复
+func (s *ProxyService) SetRedirectConfig(enabled bool, keyword, targetModel string, targetRouteID int64) error {
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+	for _, rule := range s.config.RedirectRules {
+		if rule.Keyword == keyword {
+			return fmt.Errorf("redirect keyword already used by a redirect rule: %s", keyword)
+		}
+	}
+
+	s.config.RedirectEnabled = enabled
+	s.config.RedirectKeyword = keyword
+	s.config.RedirectTargetModel = targetModel
+	s.config.RedirectTargetRouteID = targetRouteID
+	return s.config.Save()
+}
+
+// SetRedirectRules 校验并保存重定向规则表（不含单个重定向关键字）
+func (s *ProxyService) SetRedirectRules(rules []config.RedirectRule) error {
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+
+	seen := make(map[string]bool)
+	if s.config.RedirectKeyword != "" {
+		seen[s.config.RedirectKeyword] = true
+	}
+
+	cleaned := make([]config.RedirectRule, 0, len(rules))
+	for _, rule := range rules {
+		rule.Keyword = strings.TrimSpace(rule.Keyword)
+		rule.TargetModel = strings.TrimSpace(rule.TargetModel)
+		if rule.Keyword == "" {
+			return fmt.Errorf("redirect keyword is required")
+		}
+		if strings.Contains(rule.Keyword, ":") {
+			return fmt.Errorf("redirect keyword must not contain ':': %s", rule.Keyword)
+		}
+		if seen[rule.Keyword] {
+			return fmt.Errorf("duplicate redirect keyword: %s", rule.Keyword)
+		}
+		if rule.TargetModel == "" && rule.TargetRouteID <= 0 {
+			return fmt.Errorf("redirect keyword %s has no target", rule.Keyword)
+		}
+		seen[rule.Keyword] = true
+		cleaned = append(cleaned, rule)
+	}
+
+	s.config.RedirectRules = cleaned
+	return s.config.Save()
+}
@@ -0,0 +1,219 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"openai-router-go/internal/config"
+	"openai-router-go/internal/database"
+)
+
+// newTestConfig 在临时目录中加载默认配置，测试中保存配置时只写入临时目录
+func newTestConfig(t *testing.T) *config.Config {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	return config.LoadConfig()
+}
+
+func newTestRouteService(t *testing.T) *RouteService {
+	t.Helper()
+	keys, err := database.NewKeyCipher(bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := database.InitDB(filepath.Join(t.TempDir(), "routes.db"), keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return NewRouteService(db, keys)
+}
+
+func newTestProxyService(t *testing.T) *ProxyService {
+	t.Helper()
+	cfg := newTestConfig(t)
+	return NewProxyService(newTestRouteService(t), cfg)
+}
+
+// addTestRoute 添加路由并返回保存后的路由，未指定的 api_url 使用占位地址
+func addTestRoute(t *testing.T, rs *RouteService, route database.ModelRoute) *database.ModelRoute {
+	t.Helper()
+	if route.APIUrl == "" {
+		route.APIUrl = "https://api.example.com"
+	}
+	if err := rs.AddRoute(&route); err != nil {
+		t.Fatal(err)
+	}
+	return &route
+}
+
+func TestSetRedirectRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []config.RedirectRule
+		want    []config.RedirectRule
+		wantErr bool
+	}{
+		{
+			name:  "trims keyword and target",
+			rules: []config.RedirectRule{{Keyword: " fast ", TargetModel: " gpt-4o-mini "}},
+			want:  []config.RedirectRule{{Keyword: "fast", TargetModel: "gpt-4o-mini"}},
+		},
+		{
+			name:  "target route only",
+			rules: []config.RedirectRule{{Keyword: "pinned", TargetRouteID: 3}},
+			want:  []config.RedirectRule{{Keyword: "pinned", TargetRouteID: 3}},
+		},
+		{name: "empty keyword", rules: []config.RedirectRule{{Keyword: " ", TargetModel: "gpt-4o"}}, wantErr: true},
+		{name: "keyword with colon", rules: []config.RedirectRule{{Keyword: "a:b", TargetModel: "gpt-4o"}}, wantErr: true},
+		{name: "keyword without target", rules: []config.RedirectRule{{Keyword: "fast"}}, wantErr: true},
+		{
+			name:    "duplicate keyword",
+			rules:   []config.RedirectRule{{Keyword: "fast", TargetModel: "a"}, {Keyword: "fast", TargetModel: "b"}},
+			wantErr: true,
+		},
+		{name: "same as the single redirect keyword", rules: []config.RedirectRule{{Keyword: "proxy_auto", TargetModel: "a"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestProxyService(t)
+			s.config.RedirectKeyword = "proxy_auto"
+			s.config.RedirectRules = []config.RedirectRule{{Keyword: "existing", TargetModel: "gpt-4o"}}
+
+			err := s.SetRedirectRules(tt.rules)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("SetRedirectRules() should fail")
+				}
+				if got := s.GetRedirectRules(); len(got) != 1 || got[0].Keyword != "existing" {
+					t.Fatalf("rules after a rejected update = %+v, want them unchanged", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := s.GetRedirectRules()
+			if len(got) != len(tt.want) {
+				t.Fatalf("rules = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("rules[%d] = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMatchRedirectRule(t *testing.T) {
+	s := newTestProxyService(t)
+	s.config.RedirectEnabled = true
+	s.config.RedirectKeyword = "proxy_auto"
+	s.config.RedirectTargetModel = "gpt-4o"
+	s.config.RedirectRules = []config.RedirectRule{
+		// 与单个重定向关键字重复时（手动编辑的配置文件）单个关键字优先
+		{Keyword: "proxy_auto", TargetModel: "shadowed"},
+		{Keyword: "fast", TargetModel: "gpt-4o-mini"},
+		{Keyword: "fast-large", TargetModel: "gpt-4.1"},
+		{Keyword: "fast", TargetModel: "second"},
+	}
+
+	tests := []struct {
+		model  string
+		target string // 为空表示不命中
+	}{
+		{"proxy_auto", "gpt-4o"},
+		{"proxy_auto:thinking", "gpt-4o"},
+		{"fast", "gpt-4o-mini"},
+		{"fast:low", "gpt-4o-mini"},
+		{"fast-large", "gpt-4.1"},
+		{"fastest", ""},
+		{"gpt-4o", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		rule, ok := s.matchRedirectRule(tt.model)
+		if ok != (tt.target != "") || rule.TargetModel != tt.target {
+			t.Errorf("matchRedirectRule(%q) = %+v, %v; want target %q", tt.model, rule, ok, tt.target)
+		}
+	}
+
+	s.config.RedirectEnabled = false
+	if rule, ok := s.matchRedirectRule("fast"); ok {
+		t.Fatalf("matchRedirectRule() with redirects disabled = %+v, want no match", rule)
+	}
+}
+
+func TestRedirectModel(t *testing.T) {
+	tests := []struct {
+		name        string
+		routeModel  string
+		targetModel string
+		requested   string
+		want        string
+	}{
+		{"exact route uses its model", "gpt-4o", "gpt-4o-mini", "fast", "gpt-4o"},
+		{"wildcard route uses the target model", "claude-*", "claude-sonnet-4", "smart", "claude-sonnet-4"},
+		{"regex route uses the target model", "^gemini-.*$", "gemini-2.5-pro", "smart", "gemini-2.5-pro"},
+		{"pattern route without target model keeps the request", "claude-*", "", "claude-opus-4", "claude-opus-4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := &database.ModelRoute{Model: tt.routeModel}
+			if got := redirectModel(route, tt.targetModel, tt.requested); got != tt.want {
+				t.Fatalf("redirectModel() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveRequestRouteRedirects(t *testing.T) {
+	s := newTestProxyService(t)
+	exact := addTestRoute(t, s.routeService, database.ModelRoute{Name: "exact", Model: "gpt-4o"})
+	pattern := addTestRoute(t, s.routeService, database.ModelRoute{Name: "pattern", Model: "claude-*"})
+	s.config.RedirectEnabled = true
+	s.config.RedirectKeyword = "proxy_auto"
+	s.config.RedirectRules = []config.RedirectRule{
+		{Keyword: "smart", TargetModel: "claude-sonnet-4"},
+		{Keyword: "pinned", TargetRouteID: exact.ID},
+		{Keyword: "pattern-pinned", TargetRouteID: pattern.ID},
+	}
+
+	tests := []struct {
+		model     string
+		wantRoute int64
+		wantModel string
+	}{
+		{"smart", pattern.ID, "claude-sonnet-4"},
+		{"smart:thinking", pattern.ID, "claude-sonnet-4"},
+		{"pinned", exact.ID, "gpt-4o"},
+		// 目标路由是通配符且规则没有目标模型时沿用请求的模型名
+		{"pattern-pinned", pattern.ID, "pattern-pinned"},
+		{"gpt-4o", exact.ID, "gpt-4o"},
+	}
+	for _, tt := range tests {
+		reqData := map[string]interface{}{"model": tt.model}
+		trace := s.traceRequest(context.Background(), nil)
+		route, model, err := s.resolveRequestRoute(tt.model, nil, reqData, false, trace)
+		if err != nil {
+			t.Errorf("resolveRequestRoute(%q): %v", tt.model, err)
+			continue
+		}
+		if route.ID != tt.wantRoute || model != tt.wantModel || reqData["model"] != model {
+			t.Errorf("resolveRequestRoute(%q) = route %d, model %q, body model %v; want route %d, model %q",
+				tt.model, route.ID, model, reqData["model"], tt.wantRoute, tt.wantModel)
+		}
+	}
+
+	// 单个重定向关键字没有配置目标时返回 404
+	trace := s.traceRequest(context.Background(), nil)
+	_, _, err := s.resolveRequestRoute("proxy_auto", nil, map[string]interface{}{"model": "proxy_auto"}, false, trace)
+	if err == nil || routeErrorStatus(err) != http.StatusNotFound {
+		t.Fatalf("redirect without a target: err = %v (status %d), want a 404 error", err, routeErrorStatus(err))
+	}
+}
@@ -0,0 +1,287 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"openai-router-go/internal/database"
+)
+
+// 路由的模型能力元数据（capabilities 字段），JSON 对象，所有字段可选，未填写表示未知、不做限制
+// 如 {"context_window": 128000, "max_output_tokens": 16384, "vision": false, "tools": true, "streaming": true, "json_schema": true, "reasoning": false}
+// 能力明确标记为 false（或请求超出上下文窗口、最大输出 token）的路由不会被选中，请求改走同模型下其他能满足的路由，
+// 没有任何路由能满足时按客户端协议返回 400 错误
+
+// RouteCapabilities 路由的模型能力
+type RouteCapabilities struct {
+	ContextWindow   int   `json:"context_window,omitempty"`    // 上下文窗口 token 数
+	MaxOutputTokens int   `json:"max_output_tokens,omitempty"` // 单次最大输出 token 数
+	Vision          *bool `json:"vision,omitempty"`            // 图片输入
+	Tools           *bool `json:"tools,omitempty"`             // 工具调用
+	Streaming       *bool `json:"streaming,omitempty"`         // 流式输出
+	JSONSchema      *bool `json:"json_schema,omitempty"`       // 按 JSON Schema 结构化输出
+	Reasoning       *bool `json:"reasoning,omitempty"`         // 思考/推理模式
+}
+
+// capabilityNeeds 请求需要路由具备的能力
+type capabilityNeeds struct {
+	InputTokens     int // 估算的输入 token 数
+	MaxOutputTokens int // 请求指定的最大输出 token 数，0 表示未指定
+	Vision          bool
+	Tools           bool
+	Streaming       bool
+	JSONSchema      bool
+	Reasoning       bool
+}
+
+// parseRouteCapabilities 解析路由的能力元数据，空字符串表示全部未知
+func parseRouteCapabilities(raw string) (*RouteCapabilities, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+	var caps RouteCapabilities
+	decoder := json.NewDecoder(strings.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&caps); err != nil {
+		return nil, fmt.Errorf("capabilities must be a JSON object: %v", err)
+	}
+	if caps.ContextWindow < 0 {
+		return nil, fmt.Errorf("context_window must not be negative")
+	}
+	if caps.MaxOutputTokens < 0 {
+		return nil, fmt.Errorf("max_output_tokens must not be negative")
+	}
+	if caps.ContextWindow > 0 && caps.MaxOutputTokens > caps.ContextWindow {
+		return nil, fmt.Errorf("max_output_tokens (%d) must not exceed context_window (%d)", caps.MaxOutputTokens, caps.ContextWindow)
+	}
+	return &caps, nil
+}
+
+// normalizeRouteCapabilities 校验能力元数据，返回紧凑的 JSON 以便保存；没有填写任何能力时保存为空字符串
+func normalizeRouteCapabilities(raw string) (string, error) {
+	caps, err := parseRouteCapabilities(raw)
+	if err != nil || caps == nil || *caps == (RouteCapabilities{}) {
+		return "", err
+	}
+	data, _ := json.Marshal(caps)
+	return string(data), nil
+}
+
+// routeCapabilities 返回路由的能力元数据，保存的内容无法解析时视为全部未知
+func routeCapabilities(route *database.ModelRoute) *RouteCapabilities {
+	caps, err := parseRouteCapabilities(route.Capabilities)
+	if err != nil {
+		return nil
+	}
+	return caps
+}
+
+// GetModelCapabilities 汇总每个模型所有已启用路由的能力元数据，供模型列表接口展示；通配符和正则路由不参与汇总
+// 某项能力只要有一条路由支持就视为支持，所有路由都明确不支持才视为不支持，有路由未填写时视为未知；
+// 上下文窗口和最大输出 token 取各路由的最大值，有路由未填写时视为未知。没有任何已知能力的模型不在结果中
+func (s *RouteService) GetModelCapabilities() (map[string]*RouteCapabilities, error) {
+	routes, err := s.queryRoutes(`SELECT ` + routeColumns + ` FROM model_routes WHERE enabled = 1`)
+	if err != nil {
+		return nil, err
+	}
+
+	byModel := make(map[string][]*RouteCapabilities)
+	for i := range routes {
+		if IsModelPattern(routes[i].Model) {
+			continue
+		}
+		byModel[routes[i].Model] = append(byModel[routes[i].Model], routeCapabilities(&routes[i]))
+	}
+
+	result := make(map[string]*RouteCapabilities)
+	for model, list := range byModel {
+		caps := RouteCapabilities{
+			ContextWindow:   combineLimit(list, func(c *RouteCapabilities) int { return c.ContextWindow }),
+			MaxOutputTokens: combineLimit(list, func(c *RouteCapabilities) int { return c.MaxOutputTokens }),
+			Vision:          combineSupport(list, func(c *RouteCapabilities) *bool { return c.Vision }),
+			Tools:           combineSupport(list, func(c *RouteCapabilities) *bool { return c.Tools }),
+			Streaming:       combineSupport(list, func(c *RouteCapabilities) *bool { return c.Streaming }),
+			JSONSchema:      combineSupport(list, func(c *RouteCapabilities) *bool { return c.JSONSchema }),
+			Reasoning:       combineSupport(list, func(c *RouteCapabilities) *bool { return c.Reasoning }),
+		}
+		if caps != (RouteCapabilities{}) {
+			result[model] = &caps
+		}
+	}
+	return result, nil
+}
+
+// combineLimit 取各路由 token 上限的最大值，有路由未填写时返回 0（未知）
+func combineLimit(list []*RouteCapabilities, get func(*RouteCapabilities) int) int {
+	max := 0
+	for _, c := range list {
+		if c == nil || get(c) == 0 {
+			return 0
+		}
+		if get(c) > max {
+			max = get(c)
+		}
+	}
+	return max
+}
+
+// combineSupport 汇总各路由对某项能力的支持情况：有路由支持返回 true，全部明确不支持返回 false，否则返回 nil（未知）
+func combineSupport(list []*RouteCapabilities, get func(*RouteCapabilities) *bool) *bool {
+	unknown := false
+	for _, c := range list {
+		var supported *bool
+		if c != nil {
+			supported = get(c)
+		}
+		if supported == nil {
+			unknown = true
+			continue
+		}
+		if *supported {
+			return supported
+		}
+	}
+	if unknown {
+		return nil
+	}
+	unsupported := false
+	return &unsupported
+}
+
+// requestNeeds 根据请求特征和请求体计算请求需要的能力（兼容 OpenAI / Claude / Gemini 格式）
+func requestNeeds(reqData map[string]interface{}, features requestFeatures) capabilityNeeds {
+	needs := capabilityNeeds{
+		InputTokens: features.InputTokens,
+		Vision:      features.HasImages,
+		Tools:       features.HasTools,
+		Streaming:   features.Stream,
+	}
+	generationConfig, _ := reqData["generationConfig"].(map[string]interface{})
+
+	for _, field := range []string{"max_tokens", "max_completion_tokens", "max_output_tokens"} {
+		if value, ok := reqData[field].(float64); ok && value > 0 {
+			needs.MaxOutputTokens = int(value)
+			break
+		}
+	}
+	if value, ok := generationConfig["maxOutputTokens"].(float64); ok && value > 0 {
+		needs.MaxOutputTokens = int(value)
+	}
+
+	// OpenAI response_format / Claude output_format 的 json_schema 类型，Gemini 的 responseSchema
+	for _, field := range []string{"response_format", "output_format"} {
+		if format, ok := reqData[field].(map[string]interface{}); ok && format["type"] == "json_schema" {
+			needs.JSONSchema = true
+		}
+	}
+	if generationConfig["responseSchema"] != nil || generationConfig["responseJsonSchema"] != nil {
+		needs.JSONSchema = true
+	}
+
+	// OpenAI reasoning_effort / reasoning，Claude thinking，Gemini thinkingConfig
+	if effort, ok := reqData["reasoning_effort"].(string); ok && effort != "" && effort != "none" {
+		needs.Reasoning = true
+	}
+	if reasoning, ok := reqData["reasoning"].(map[string]interface{}); ok {
+		if effort, _ := reasoning["effort"].(string); effort != "none" {
+			needs.Reasoning = true
+		}
+	}
+	if thinking, ok := reqData["thinking"].(map[string]interface{}); ok && thinking["type"] == "enabled" {
+		needs.Reasoning = true
+	}
+	if thinking, ok := generationConfig["thinkingConfig"].(map[string]interface{}); ok {
+		if budget, ok := thinking["thinkingBudget"].(float64); !ok || budget != 0 {
+			needs.Reasoning = true
+		}
+	}
+	return needs
+}
+
+// unsupportedReason 返回路由无法满足请求的原因，可以满足（或能力未知）时返回空字符串
+func (c *RouteCapabilities) unsupportedReason(needs capabilityNeeds) string {
+	if c == nil {
+		return ""
+	}
+	switch {
+	case needs.Vision && c.Vision != nil && !*c.Vision:
+		return "image input is not supported"
+	case needs.Tools && c.Tools != nil && !*c.Tools:
+		return "tool calling is not supported"
+	case needs.Streaming && c.Streaming != nil && !*c.Streaming:
+		return "streaming is not supported"
+	case needs.JSONSchema && c.JSONSchema != nil && !*c.JSONSchema:
+		return "JSON schema output is not supported"
+	case needs.Reasoning && c.Reasoning != nil && !*c.Reasoning:
+		return "reasoning is not supported"
+	case c.ContextWindow > 0 && needs.InputTokens > c.ContextWindow:
+		return fmt.Sprintf("estimated input of %d tokens exceeds the context window of %d", needs.InputTokens, c.ContextWindow)
+	case c.MaxOutputTokens > 0 && needs.MaxOutputTokens > c.MaxOutputTokens:
+		return fmt.Sprintf("max output of %d tokens exceeds the limit of %d", needs.MaxOutputTokens, c.MaxOutputTokens)
+	}
+	return ""
+}
+
+// capabilityError 请求的模型下没有能满足请求能力需求的路由
+type capabilityError struct {
+	model   string
+	reasons []string // 每条路由无法满足的原因，格式为 "路由名: 原因"
+}
+
+func (e *capabilityError) Error() string {
+	return fmt.Sprintf("no route for model %s can serve this request (%s)", e.model, strings.Join(e.reasons, "; "))
+}
+
+// isCapabilityError 判断错误是否为路由能力不满足
+func isCapabilityError(err error) bool {
+	_, ok := err.(*capabilityError)
+	return ok
+}
+
+// capabilityResponse 按客户端协议生成能力不满足的 400 响应体
+func capabilityResponse(protocol string, err error) []byte {
+	var body map[string]interface{}
+	switch protocol {
+	case protocolClaude:
+		body = map[string]interface{}{
+			"type": "error",
+			"error": map[string]interface{}{
+				"type":    "invalid_request_error",
+				"message": err.Error(),
+			},
+		}
+	case protocolGemini:
+		body = map[string]interface{}{
+			"error": map[string]interface{}{
+				"code":    http.StatusBadRequest,
+				"message": err.Error(),
+				"status":  "INVALID_ARGUMENT",
+			},
+		}
+	default:
+		body = map[string]interface{}{
+			"error": map[string]interface{}{
+				"message": err.Error(),
+				"type":    "invalid_request_error",
+				"param":   nil,
+				"code":    "unsupported_capability",
+			},
+		}
+	}
+	data, _ := json.Marshal(body)
+	return data
+}
+
+// writeCapabilityError 流式请求没有能满足的路由时向客户端写入 400 响应（此时还没有发送任何 SSE 数据）
+func writeCapabilityError(writer io.Writer, protocol string, err error) error {
+	if w, ok := writer.(http.ResponseWriter); ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	writer.Write(capabilityResponse(protocol, err))
+	return err
+}
@@ -0,0 +1,240 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"openai-router-go/internal/database"
+)
+
+func TestNormalizeRouteCapabilities(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    string
+		wantErr string
+	}{
+		{"", "", ""},
+		{"  {}  ", "", ""},
+		{`{"vision": false, "context_window": 128000}`, `{"context_window":128000,"vision":false}`, ""},
+		{`{"tools": true, "max_output_tokens": 8192, "context_window": 8192}`, `{"context_window":8192,"max_output_tokens":8192,"tools":true}`, ""},
+		{`{"max_output_tokens": 4096}`, `{"max_output_tokens":4096}`, ""},
+		{`[]`, "", "must be a JSON object"},
+		{`{"audio": true}`, "", "unknown field"},
+		{`{"vision": "yes"}`, "", "must be a JSON object"},
+		{`{"context_window": -1}`, "", "context_window must not be negative"},
+		{`{"max_output_tokens": -1}`, "", "max_output_tokens must not be negative"},
+		{`{"context_window": 4096, "max_output_tokens": 8192}`, "", "must not exceed context_window"},
+	}
+	for _, tt := range tests {
+		got, err := normalizeRouteCapabilities(tt.raw)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("normalizeRouteCapabilities(%q) error = %v, want %q", tt.raw, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("normalizeRouteCapabilities(%q) = %q, %v; want %q", tt.raw, got, err, tt.want)
+		}
+	}
+
+	// 保存路由时校验能力元数据，无法解析的旧数据按全部未知处理
+	rs := newTestRouteService(t)
+	route := &database.ModelRoute{Name: "r", Model: "gpt-4o", APIUrl: "https://api.example.com", Capabilities: `{"vision": 1}`}
+	if err := rs.AddRoute(route); err == nil {
+		t.Fatal("AddRoute() with invalid capabilities should fail")
+	}
+	if caps := routeCapabilities(&database.ModelRoute{Capabilities: "not json"}); caps != nil {
+		t.Fatalf("routeCapabilities() for invalid data = %+v, want nil", caps)
+	}
+}
+
+func TestRequestNeeds(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		stream bool
+		want   capabilityNeeds
+	}{
+		{"plain", `{"messages":[{"role":"user","content":"hi"}]}`, false, capabilityNeeds{InputTokens: 1}},
+		{"openai image and tools", `{"messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"data:"}}]}],"tools":[{"type":"function"}],"stream":true}`, false,
+			capabilityNeeds{Vision: true, Tools: true, Streaming: true}},
+		{"gemini stream endpoint", `{"contents":[{"parts":[{"inlineData":{"mimeType":"image/png","data":"..."}}]}]}`, true, capabilityNeeds{Vision: true, Streaming: true}},
+		{"openai max tokens", `{"max_completion_tokens":2048}`, false, capabilityNeeds{MaxOutputTokens: 2048}},
+		{"gemini max tokens", `{"generationConfig":{"maxOutputTokens":1024}}`, false, capabilityNeeds{MaxOutputTokens: 1024}},
+		{"openai json schema", `{"response_format":{"type":"json_schema"}}`, false, capabilityNeeds{JSONSchema: true}},
+		{"openai json object", `{"response_format":{"type":"json_object"}}`, false, capabilityNeeds{}},
+		{"claude json schema", `{"output_format":{"type":"json_schema"}}`, false, capabilityNeeds{JSONSchema: true}},
+		{"gemini json schema", `{"generationConfig":{"responseSchema":{"type":"OBJECT"}}}`, false, capabilityNeeds{JSONSchema: true}},
+		{"openai reasoning effort", `{"reasoning_effort":"high"}`, false, capabilityNeeds{Reasoning: true}},
+		{"openai reasoning none", `{"reasoning_effort":"none","reasoning":{"effort":"none"}}`, false, capabilityNeeds{}},
+		{"claude thinking", `{"thinking":{"type":"enabled","budget_tokens":1024}}`, false, capabilityNeeds{Reasoning: true}},
+		{"claude thinking disabled", `{"thinking":{"type":"disabled"}}`, false, capabilityNeeds{}},
+		{"gemini thinking", `{"generationConfig":{"thinkingConfig":{"includeThoughts":true}}}`, false, capabilityNeeds{Reasoning: true}},
+		{"gemini thinking off", `{"generationConfig":{"thinkingConfig":{"thinkingBudget":0}}}`, false, capabilityNeeds{}},
+	}
+	for _, tt := range tests {
+		reqData := decodeRequest(t, tt.body)
+		got := requestNeeds(reqData, inspectRequest(reqData, tt.stream))
+		// 输入 token 数由 inspectRequest 估算，这里只在明确给出时比较
+		if tt.want.InputTokens == 0 {
+			got.InputTokens = 0
+		}
+		if got != tt.want {
+			t.Errorf("%s: requestNeeds() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestUnsupportedReason(t *testing.T) {
+	caps := &RouteCapabilities{
+		ContextWindow: 1000, MaxOutputTokens: 500,
+		Vision: boolPtr(false), Tools: boolPtr(true), Streaming: boolPtr(false),
+	}
+	tests := []struct {
+		needs capabilityNeeds
+		want  string
+	}{
+		{capabilityNeeds{}, ""},
+		{capabilityNeeds{Tools: true, InputTokens: 1000, MaxOutputTokens: 500}, ""},
+		// 未填写的能力视为未知，不做限制
+		{capabilityNeeds{JSONSchema: true, Reasoning: true}, ""},
+		{capabilityNeeds{Vision: true}, "image input is not supported"},
+		{capabilityNeeds{Streaming: true}, "streaming is not supported"},
+		{capabilityNeeds{InputTokens: 1001}, "exceeds the context window of 1000"},
+		{capabilityNeeds{MaxOutputTokens: 501}, "exceeds the limit of 500"},
+	}
+	for _, tt := range tests {
+		got := caps.unsupportedReason(tt.needs)
+		if (tt.want == "") != (got == "") || !strings.Contains(got, tt.want) {
+			t.Errorf("unsupportedReason(%+v) = %q, want %q", tt.needs, got, tt.want)
+		}
+	}
+
+	var unknown *RouteCapabilities
+	if reason := unknown.unsupportedReason(capabilityNeeds{Vision: true, InputTokens: 1 << 20}); reason != "" {
+		t.Fatalf("routes without capabilities should serve every request, got %q", reason)
+	}
+}
+
+func TestGetModelCapabilities(t *testing.T) {
+	rs := newTestRouteService(t)
+	for _, route := range []database.ModelRoute{
+		{Name: "a", Model: "gpt-4o", Capabilities: `{"vision":true,"tools":false,"context_window":128000,"max_output_tokens":16384}`},
+		{Name: "b", Model: "gpt-4o", Capabilities: `{"vision":false,"tools":false,"context_window":64000,"max_output_tokens":4096}`},
+		{Name: "c", Model: "o3", Capabilities: `{"reasoning":true,"context_window":200000}`},
+		{Name: "d", Model: "o3"},
+		{Name: "e", Model: "gpt-*", Capabilities: `{"vision":true}`},
+		{Name: "f", Model: "deepseek-chat"},
+	} {
+		addTestRoute(t, rs, route)
+	}
+	disabled := addTestRoute(t, rs, database.ModelRoute{Name: "g", Model: "gpt-4o", Capabilities: `{"tools":true}`})
+	if err := rs.ToggleRoute(disabled.ID, false); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := rs.GetModelCapabilities()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	for model, caps := range result {
+		data, _ := json.Marshal(caps)
+		got[model] = string(data)
+	}
+	// 有路由支持即支持，全部不支持才不支持；上限取最大值，有路由未填写时为未知
+	want := map[string]string{
+		"gpt-4o": `{"context_window":128000,"max_output_tokens":16384,"vision":true,"tools":false}`,
+		"o3":     `{"reasoning":true}`,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("GetModelCapabilities() = %v, want %v", got, want)
+	}
+	for model, caps := range want {
+		if got[model] != caps {
+			t.Errorf("capabilities of %s = %s, want %s", model, got[model], caps)
+		}
+	}
+}
+
+func TestResolveRequestRouteCapabilities(t *testing.T) {
+	s := newTestProxyService(t)
+	textOnly := addTestRoute(t, s.routeService, database.ModelRoute{Name: "text-only", Model: "gpt-4o", Priority: 1, Capabilities: `{"vision":false,"tools":false}`})
+	vision := addTestRoute(t, s.routeService, database.ModelRoute{Name: "vision", Model: "gpt-4o", Priority: 2, Capabilities: `{"vision":true,"tools":false}`})
+
+	resolve := func(body string) (*database.ModelRoute, error) {
+		t.Helper()
+		trace := s.traceRequest(context.Background(), nil)
+		route, _, err := s.resolveRequestRoute("gpt-4o", nil, decodeRequest(t, body), false, trace)
+		return route, err
+	}
+
+	// 不需要特殊能力时按优先级选择，需要图片输入时跳过不支持的路由
+	if route, err := resolve(`{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`); err != nil || route.ID != textOnly.ID {
+		t.Fatalf("plain request went to %v (%v), want %s", route, err, textOnly.Name)
+	}
+	image := `{"model":"gpt-4o","messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"data:"}}]}]}`
+	if route, err := resolve(image); err != nil || route.ID != vision.ID {
+		t.Fatalf("image request went to %v (%v), want %s", route, err, vision.Name)
+	}
+
+	// 所有路由都不支持时返回能力错误，列出每条路由的原因
+	tools := `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}],"tools":[{"type":"function"}]}`
+	_, err := resolve(tools)
+	if !isCapabilityError(err) || !strings.Contains(err.Error(), "text-only: tool calling is not supported") || !strings.Contains(err.Error(), "vision: tool calling is not supported") {
+		t.Fatalf("tool request error = %v, want a capability error listing both routes", err)
+	}
+	body, status, err := s.ProxyRequest(context.Background(), []byte(tools), nil)
+	if err != nil || status != http.StatusBadRequest || !strings.Contains(string(body), `"code":"unsupported_capability"`) {
+		t.Fatalf("ProxyRequest() = %d %s, %v; want a 400 capability error", status, body, err)
+	}
+
+	// 能力未知的路由可以处理任何请求
+	unknown := addTestRoute(t, s.routeService, database.ModelRoute{Name: "unknown", Model: "gpt-4o", Priority: 3})
+	if route, err := resolve(tools); err != nil || route.ID != unknown.ID {
+		t.Fatalf("tool request went to %v (%v), want %s", route, err, unknown.Name)
+	}
+}
+
+func TestCapabilityResponse(t *testing.T) {
+	err := &capabilityError{model: "gpt-4o", reasons: []string{"a: streaming is not supported"}}
+	if err.Error() != "no route for model gpt-4o can serve this request (a: streaming is not supported)" {
+		t.Fatalf("Error() = %q", err.Error())
+	}
+
+	tests := []struct {
+		protocol string
+		path     []string
+		want     interface{}
+	}{
+		{protocolOpenAI, []string{"error", "code"}, "unsupported_capability"},
+		{protocolClaude, []string{"error", "type"}, "invalid_request_error"},
+		{protocolGemini, []string{"error", "status"}, "INVALID_ARGUMENT"},
+	}
+	for _, tt := range tests {
+		var body map[string]interface{}
+		if err := json.Unmarshal(capabilityResponse(tt.protocol, err), &body); err != nil {
+			t.Fatal(err)
+		}
+		var value interface{} = body
+		for _, key := range tt.path {
+			value = value.(map[string]interface{})[key]
+		}
+		if value != tt.want {
+			t.Errorf("%s response %v = %v, want %v", tt.protocol, tt.path, value, tt.want)
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	if got := writeCapabilityError(recorder, protocolClaude, err); got != err {
+		t.Fatalf("writeCapabilityError() = %v, want the original error", got)
+	}
+	if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), "streaming is not supported") {
+		t.Fatalf("response = %d %s, want a 400 with the reason", recorder.Code, recorder.Body.String())
+	}
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"openai-router-go/internal/database"
+)
+
+// 路由的自定义请求头和附加请求体字段
+// extra_headers 为 JSON 对象，值必须是字符串，如 {"HTTP-Referer": "https://example.com", "anthropic-beta": "prompt-caching-2024-07-31"}
+// extra_body 为 JSON 对象，在适配器转换之后深度合并到上游请求体中，如 {"provider": {"order": ["openai", "azure"]}}
+
+// parseExtraHeaders 解析路由的自定义请求头，空字符串表示没有
+func parseExtraHeaders(raw string) (map[string]string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+	var headers map[string]string
+	if err := json.Unmarshal([]byte(raw), &headers); err != nil {
+		return nil, fmt.Errorf("extra headers must be a JSON object of strings: %v", err)
+	}
+	for name := range headers {
+		if strings.TrimSpace(name) == "" || strings.ContainsAny(name, " :\r\n") {
+			return nil, fmt.Errorf("invalid header name: %q", name)
+		}
+	}
+	return headers, nil
+}
+
+// parseExtraBody 解析路由的附加请求体字段，空字符串表示没有
+func parseExtraBody(raw string) (map[string]interface{}, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &body); err != nil {
+		return nil, fmt.Errorf("extra body must be a JSON object: %v", err)
+	}
+	return body, nil
+}
+
+// normalizeRouteExtras 校验自定义请求头和请求体字段，返回紧凑的 JSON 以便保存；内容为空的对象保存为空字符串
+func normalizeRouteExtras(extraHeaders, extraBody string) (string, string, error) {
+	headers, err := parseExtraHeaders(extraHeaders)
+	if err != nil {
+		return "", "", err
+	}
+	body, err := parseExtraBody(extraBody)
+	if err != nil {
+		return "", "", err
+	}
+
+	var headersJSON, bodyJSON string
+	if len(headers) > 0 {
+		data, _ := json.Marshal(headers)
+		headersJSON = string(data)
+	}
+	if len(body) > 0 {
+		data, _ := json.Marshal(body)
+		bodyJSON = string(data)
+	}
+	return headersJSON, bodyJSON, nil
+}
+
+// mergeJSONObject 将 src 深度合并到 dst：两边都是对象时递归合并，否则 src 覆盖 dst
+func mergeJSONObject(dst, src map[string]interface{}) {
+	for key, value := range src {
+		if srcObj, ok := value.(map[string]interface{}); ok {
+			if dstObj, ok := dst[key].(map[string]interface{}); ok {
+				mergeJSONObject(dstObj, srcObj)
+				continue
+			}
+		}
+		dst[key] = value
+	}
+}
+
+// applyRouteExtras 在上游请求构建完成后（适配器转换之后）应用路由的自定义请求头和请求体字段
+// 自定义请求头会覆盖同名的内置请求头（如 anthropic-version）
+func applyRouteExtras(req *http.Request, route *database.ModelRoute) error {
+	headers, err := parseExtraHeaders(route.ExtraHeaders)
+	if err != nil {
+		return err
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	extra, err := parseExtraBody(route.ExtraBody)
+	if err != nil || len(extra) == 0 || req.Body == nil {
+		return err
+	}
+
+	data, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return err
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return fmt.Errorf("cannot merge extra body into non-JSON request: %v", err)
+	}
+	mergeJSONObject(body, extra)
+
+	merged, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(merged))
+	req.ContentLength = int64(len(merged))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(merged)), nil
+	}
+	return nil
+}
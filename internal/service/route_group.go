@@ -0,0 +1,56 @@
+package service
+
+import (
+	"strings"
+
+	"openai-router-go/internal/config"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RouteGroupHeader 客户端指定路由分组的请求头
+const RouteGroupHeader = "X-Route-Group"
+
+// headerValue 不区分大小写地读取请求头
+func headerValue(headers map[string]string, name string) string {
+	if value, ok := headers[name]; ok {
+		return value
+	}
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
+
+// resolveRouteGroup 解析请求使用的路由分组，返回去掉分组后缀的模型名、分组，以及模型名是否被改写
+// 优先级：model@group 后缀 > X-Route-Group 请求头 > 配置的默认分组
+// 只有 @ 后面是已存在的分组时才视为分组后缀，避免误拆 claude-3-5-sonnet@20240620 这类带 @ 的模型名
+func (s *ProxyService) resolveRouteGroup(model string, headers map[string]string) (string, string, bool) {
+	if i := strings.LastIndex(model, "@"); i > 0 && i < len(model)-1 {
+		if group := model[i+1:]; s.routeService.GroupExists(group) {
+			log.Infof("Using route group %s from model suffix: %s", group, model)
+			return model[:i], group, true
+		}
+	}
+
+	if group := strings.TrimSpace(headerValue(headers, RouteGroupHeader)); group != "" {
+		return model, group, false
+	}
+	return model, s.defaultRouteGroup(), false
+}
+
+// defaultRouteGroup 请求未指定分组时使用的默认分组
+func (s *ProxyService) defaultRouteGroup() string {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	return s.config.DefaultRouteGroup
+}
+
+// SetDefaultRouteGroup 设置请求未指定分组时使用的默认分组，为空表示不限分组
+func (s *ProxyService) SetDefaultRouteGroup(group string) error {
+	return s.UpdateConfig(func(cfg *config.Config) {
+		cfg.DefaultRouteGroup = strings.TrimSpace(group)
+	})
+}
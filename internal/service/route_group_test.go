@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"openai-router-go/internal/database"
+)
+
+func TestResolveRouteGroup(t *testing.T) {
+	s := newTestProxyService(t)
+	addTestRoute(t, s.routeService, database.ModelRoute{Name: "team", Model: "gpt-4o", Group: "team"})
+	addTestRoute(t, s.routeService, database.ModelRoute{Name: "backup", Model: "gpt-4o", Group: "backup"})
+
+	tests := []struct {
+		name         string
+		model        string
+		headers      map[string]string
+		defaultGroup string
+		wantModel    string
+		wantGroup    string
+	}{
+		{name: "no group", model: "gpt-4o", wantModel: "gpt-4o"},
+		{name: "model suffix", model: "gpt-4o@team", wantModel: "gpt-4o", wantGroup: "team"},
+		{
+			name:      "suffix beats header",
+			model:     "gpt-4o@team",
+			headers:   map[string]string{RouteGroupHeader: "backup"},
+			wantModel: "gpt-4o", wantGroup: "team",
+		},
+		// 不存在的分组不拆分，模型名本身可能带 @
+		{name: "unknown suffix is part of the model", model: "claude-3-5-sonnet@20240620", wantModel: "claude-3-5-sonnet@20240620"},
+		{name: "empty suffix", model: "gpt-4o@", wantModel: "gpt-4o@"},
+		{name: "leading at sign", model: "@team", wantModel: "@team"},
+		{name: "last at sign is the group", model: "vendor@model@team", wantModel: "vendor@model", wantGroup: "team"},
+		{
+			name:      "header",
+			model:     "gpt-4o",
+			headers:   map[string]string{RouteGroupHeader: " backup "},
+			wantModel: "gpt-4o", wantGroup: "backup",
+		},
+		{
+			name:      "header name ignores case",
+			model:     "gpt-4o",
+			headers:   map[string]string{"x-route-group": "backup"},
+			wantModel: "gpt-4o", wantGroup: "backup",
+		},
+		{
+			name:         "header beats default group",
+			model:        "gpt-4o",
+			headers:      map[string]string{RouteGroupHeader: "backup"},
+			defaultGroup: "team",
+			wantModel:    "gpt-4o", wantGroup: "backup",
+		},
+		{
+			name:         "blank header falls back to default group",
+			model:        "gpt-4o",
+			headers:      map[string]string{RouteGroupHeader: " "},
+			defaultGroup: "team",
+			wantModel:    "gpt-4o", wantGroup: "team",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.config.DefaultRouteGroup = tt.defaultGroup
+			model, group, stripped := s.resolveRouteGroup(tt.model, tt.headers)
+			if model != tt.wantModel || group != tt.wantGroup || stripped != (model != tt.model) {
+				t.Fatalf("resolveRouteGroup(%q) = %q, %q, %v; want %q, %q", tt.model, model, group, stripped, tt.wantModel, tt.wantGroup)
+			}
+		})
+	}
+}
+
+func TestSetDefaultRouteGroup(t *testing.T) {
+	s := newTestProxyService(t)
+	if err := s.SetDefaultRouteGroup("  team "); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.defaultRouteGroup(); got != "team" {
+		t.Fatalf("defaultRouteGroup() = %q, want %q", got, "team")
+	}
+}
+
+func TestResolveRequestRouteGroups(t *testing.T) {
+	s := newTestProxyService(t)
+	addTestRoute(t, s.routeService, database.ModelRoute{Name: "shared", Model: "gpt-4o"})
+	team := addTestRoute(t, s.routeService, database.ModelRoute{Name: "team", Model: "gpt-4o", Group: "team"})
+	sharedOnly := addTestRoute(t, s.routeService, database.ModelRoute{Name: "shared-only", Model: "gpt-4.1"})
+
+	resolve := func(model string, headers map[string]string) (*database.ModelRoute, map[string]interface{}, error) {
+		reqData := map[string]interface{}{"model": model}
+		route, _, err := s.resolveRequestRoute(model, headers, reqData, false, s.traceRequest(context.Background(), headers))
+		return route, reqData, err
+	}
+
+	route, reqData, err := resolve("gpt-4o@team", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if route.ID != team.ID || reqData["model"] != "gpt-4o" {
+		t.Fatalf("model suffix: route %d, body model %v; want route %d and the suffix stripped", route.ID, reqData["model"], team.ID)
+	}
+
+	route, _, err = resolve("gpt-4o", map[string]string{RouteGroupHeader: "team"})
+	if err != nil || route.ID != team.ID {
+		t.Fatalf("header: route %v, err %v; want route %d", route, err, team.ID)
+	}
+
+	// 显式指定的分组中没有该模型时不回退到其他分组
+	_, _, err = resolve("gpt-4.1@team", nil)
+	if err == nil || routeErrorStatus(err) != http.StatusNotFound {
+		t.Fatalf("model outside the requested group: err = %v, want a 404 error", err)
+	}
+	_, _, err = resolve("gpt-4o", map[string]string{RouteGroupHeader: "missing"})
+	if err == nil || routeErrorStatus(err) != http.StatusNotFound {
+		t.Fatalf("unknown group from header: err = %v, want a 404 error", err)
+	}
+
+	s.config.DefaultRouteGroup = "team"
+	route, _, err = resolve("gpt-4o", nil)
+	if err != nil || route.ID != team.ID {
+		t.Fatalf("default group: route %v, err %v; want route %d", route, err, team.ID)
+	}
+	// 默认分组中没有该模型时回退到所有分组
+	route, _, err = resolve("gpt-4.1", nil)
+	if err != nil || route.ID != sharedOnly.ID {
+		t.Fatalf("default group without the model: route %v, err %v; want route %d", route, err, sharedOnly.ID)
+	}
+}
@@ -12,19 +12,41 @@ import (
 )
 
 type RouteService struct {
-	db *sql.DB
+	db       *sql.DB
+	patterns *modelPatternCache
+	keys     *database.KeyCipher // 写入时加密上游 API Key，读出的仍是加密值，只在 ProxyService 中解密
 }
 
-func NewRouteService(db *sql.DB) *RouteService {
-	return &RouteService{db: db}
+func NewRouteService(db *sql.DB, keys *database.KeyCipher) *RouteService {
+	return &RouteService{db: db, patterns: newModelPatternCache(), keys: keys}
 }
 
-// GetAllRoutes 获取所有路由
-func (s *RouteService) GetAllRoutes() ([]database.ModelRoute, error) {
-	query := `SELECT id, name, model, api_url, api_key, "group", COALESCE(format, 'openai'), enabled, created_at, updated_at
-	          FROM model_routes ORDER BY created_at DESC`
+// routeColumns 路由查询的公共列
+const routeColumns = `id, name, model, api_url, api_key, "group", COALESCE(format, 'openai'), COALESCE(weight, 1), COALESCE(upstream_model, ''), COALESCE(priority, 0), COALESCE(extra_headers, ''), COALESCE(extra_body, ''),
+	COALESCE(connect_timeout, 0), COALESCE(first_byte_timeout, 0), COALESCE(idle_timeout, 0), COALESCE(outbound_proxy, ''),
+	COALESCE(rpm_limit, 0), COALESCE(tpm_limit, 0), COALESCE(provider_id, 0), COALESCE(capabilities, ''), enabled, created_at, updated_at`
 
-	rows, err := s.db.Query(query)
+// rowScanner 兼容 *sql.Row 和 *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanRoute 将查询结果扫描为路由结构
+func scanRoute(scanner rowScanner) (*database.ModelRoute, error) {
+	var route database.ModelRoute
+	err := scanner.Scan(&route.ID, &route.Name, &route.Model, &route.APIUrl, &route.APIKey,
+		&route.Group, &route.Format, &route.Weight, &route.UpstreamModel, &route.Priority, &route.ExtraHeaders, &route.ExtraBody,
+		&route.ConnectTimeout, &route.FirstByteTimeout, &route.IdleTimeout, &route.OutboundProxy,
+		&route.RPMLimit, &route.TPMLimit, &route.ProviderID, &route.Capabilities, &route.Enabled, &route.CreatedAt, &route.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &route, nil
+}
+
+// queryRoutes 执行查询并返回路由列表
+func (s *RouteService) queryRoutes(query string, args ...interface{}) ([]database.ModelRoute, error) {
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -32,46 +54,102 @@ func (s *RouteService) GetAllRoutes() ([]database.ModelRoute, error) {
 
 	var routes []database.ModelRoute
 	for rows.Next() {
-		var route database.ModelRoute
-		err := rows.Scan(&route.ID, &route.Name, &route.Model, &route.APIUrl, &route.APIKey,
-			&route.Group, &route.Format, &route.Enabled, &route.CreatedAt, &route.UpdatedAt)
+		route, err := scanRoute(rows)
 		if err != nil {
 			return nil, err
 		}
-		routes = append(routes, route)
+		routes = append(routes, *route)
 	}
 
-	return routes, nil
+	return routes, rows.Err()
 }
 
-// GetRouteByModel 根据模型名获取路由(支持负载均衡)
-func (s *RouteService) GetRouteByModel(model string) (*database.ModelRoute, error) {
-	query := `SELECT id, name, model, api_url, api_key, "group", COALESCE(format, 'openai'), enabled, created_at, updated_at
-	          FROM model_routes WHERE model = ? AND enabled = 1 ORDER BY RANDOM() LIMIT 1`
+// GetAllRoutes 获取所有路由
+func (s *RouteService) GetAllRoutes() ([]database.ModelRoute, error) {
+	return s.queryRoutes(`SELECT ` + routeColumns + ` FROM model_routes ORDER BY created_at DESC`)
+}
 
-	var route database.ModelRoute
-	err := s.db.QueryRow(query, model).Scan(&route.ID, &route.Name, &route.Model, &route.APIUrl,
-		&route.APIKey, &route.Group, &route.Format, &route.Enabled, &route.CreatedAt, &route.UpdatedAt)
+// GetRoutesByModel 获取某个模型下所有已启用的路由
+// 优先精确匹配，没有精确匹配时再按通配符（最长前缀优先）和正则匹配
+func (s *RouteService) GetRoutesByModel(model string) ([]database.ModelRoute, error) {
+	return s.GetRoutesByModelInGroup(model, "")
+}
 
-	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("model not found: %s", model)
+// GetRoutesByModelInGroup 获取某个模型在指定分组下所有已启用的路由，group 为空时不限分组
+func (s *RouteService) GetRoutesByModelInGroup(model, group string) ([]database.ModelRoute, error) {
+	groupFilter := ""
+	var groupArgs []interface{}
+	if group != "" {
+		groupFilter = ` AND "group" = ?`
+		groupArgs = append(groupArgs, group)
 	}
+
+	routes, err := s.queryRoutes(`SELECT `+routeColumns+` FROM model_routes WHERE model = ? AND enabled = 1`+groupFilter+` ORDER BY id`,
+		append([]interface{}{model}, groupArgs...)...)
+	if err != nil || len(routes) > 0 {
+		return routes, err
+	}
+
+	patternRoutes, err := s.queryRoutes(`SELECT `+routeColumns+` FROM model_routes
+		WHERE enabled = 1 AND (model LIKE '^%' OR instr(model, '*') > 0 OR instr(model, '?') > 0)`+groupFilter+` ORDER BY id`, groupArgs...)
 	if err != nil {
 		return nil, err
 	}
+	return s.patterns.matchPatternRoutes(model, patternRoutes), nil
+}
 
-	return &route, nil
+// GroupExists 判断是否有路由属于该分组
+func (s *RouteService) GroupExists(group string) bool {
+	var exists int
+	err := s.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM model_routes WHERE "group" = ?)`, group).Scan(&exists)
+	return err == nil && exists == 1
+}
+
+// GetRouteGroups 获取所有路由分组（不含空分组）
+func (s *RouteService) GetRouteGroups() ([]string, error) {
+	rows, err := s.db.Query(`SELECT DISTINCT "group" FROM model_routes WHERE "group" != '' ORDER BY "group"`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []string{}
+	for rows.Next() {
+		var group string
+		if err := rows.Scan(&group); err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	return groups, rows.Err()
+}
+
+// GetRouteByModel 根据模型名获取路由(按权重随机负载均衡)
+func (s *RouteService) GetRouteByModel(model string) (*database.ModelRoute, error) {
+	routes, err := s.GetRoutesByModel(model)
+	if err != nil {
+		return nil, err
+	}
+	if len(routes) == 0 {
+		return nil, fmt.Errorf("model not found: %s", model)
+	}
+
+	return pickWeightedRandom(routes), nil
 }
 
 // GetRouteByID 根据路由ID获取路由
 func (s *RouteService) GetRouteByID(id int64) (*database.ModelRoute, error) {
-	query := `SELECT id, name, model, api_url, api_key, "group", COALESCE(format, 'openai'), enabled, created_at, updated_at
-	          FROM model_routes WHERE id = ? AND enabled = 1`
+	return s.getRoute(`SELECT `+routeColumns+` FROM model_routes WHERE id = ? AND enabled = 1`, id)
+}
 
-	var route database.ModelRoute
-	err := s.db.QueryRow(query, id).Scan(&route.ID, &route.Name, &route.Model, &route.APIUrl,
-		&route.APIKey, &route.Group, &route.Format, &route.Enabled, &route.CreatedAt, &route.UpdatedAt)
+// GetRouteByIDIncludeDisabled 根据路由ID获取路由，已禁用的路由也会返回，供测试、编辑等管理操作使用
+func (s *RouteService) GetRouteByIDIncludeDisabled(id int64) (*database.ModelRoute, error) {
+	return s.getRoute(`SELECT `+routeColumns+` FROM model_routes WHERE id = ?`, id)
+}
 
+// getRoute 按 ID 查询单条路由
+func (s *RouteService) getRoute(query string, id int64) (*database.ModelRoute, error) {
+	route, err := scanRoute(s.db.QueryRow(query, id))
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("route not found: %d", id)
 	}
@@ -79,59 +157,120 @@ func (s *RouteService) GetRouteByID(id int64) (*database.ModelRoute, error) {
 		return nil, err
 	}
 
-	return &route, nil
+	return route, nil
 }
 
-// AddRoute 添加路由
-func (s *RouteService) AddRoute(name, model, apiUrl, apiKey, group, format string) error {
-	query := `INSERT INTO model_routes (name, model, api_url, api_key, "group", format, enabled, created_at, updated_at)
-	          VALUES (?, ?, ?, ?, ?, ?, 1, ?, ?)`
+// execer 兼容 *sql.DB 和 *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
 
-	now := time.Now()
-	_, err := s.db.Exec(query, name, model, apiUrl, apiKey, group, format, now, now)
+// normalizeRouteFormat 校验路由格式，为空时按 openai 处理
+func normalizeRouteFormat(format string) (string, error) {
+	format = strings.ToLower(strings.TrimSpace(format))
+	switch format {
+	case "":
+		return protocolOpenAI, nil
+	case protocolOpenAI, protocolClaude, protocolGemini:
+		return format, nil
+	}
+	return "", fmt.Errorf("unsupported route format: %q (use openai, claude or gemini)", format)
+}
+
+// normalizeRoute 校验路由配置并规范化各字段，添加、更新和导入路由时共用
+func normalizeRoute(route *database.ModelRoute) error {
+	if err := ValidateModelPattern(route.Model); err != nil {
+		return err
+	}
+	format, err := normalizeRouteFormat(route.Format)
+	if err != nil {
+		return err
+	}
+	extraHeaders, extraBody, err := normalizeRouteExtras(route.ExtraHeaders, route.ExtraBody)
+	if err != nil {
+		return err
+	}
+	outboundProxy, err := normalizeOutboundProxy(route.OutboundProxy)
+	if err != nil {
+		return err
+	}
+	capabilities, err := normalizeRouteCapabilities(route.Capabilities)
 	if err != nil {
-		log.Errorf("Failed to add route: %v", err)
 		return err
 	}
 
-	log.Infof("Route added: %s -> %s (%s) [%s]", model, apiUrl, name, format)
+	route.Format = format
+	route.Weight = normalizeWeight(route.Weight)
+	route.UpstreamModel = normalizeUpstreamModel(route.Model, route.UpstreamModel)
+	route.Priority = normalizePriority(route.Priority)
+	route.ExtraHeaders, route.ExtraBody = extraHeaders, extraBody
+	route.ConnectTimeout = normalizeTimeout(route.ConnectTimeout)
+	route.FirstByteTimeout = normalizeTimeout(route.FirstByteTimeout)
+	route.IdleTimeout = normalizeTimeout(route.IdleTimeout)
+	route.OutboundProxy = outboundProxy
+	route.RPMLimit = normalizeRateLimit(route.RPMLimit)
+	route.TPMLimit = normalizeRateLimit(route.TPMLimit)
+	route.Capabilities = capabilities
 	return nil
 }
 
-// UpdateRoute 更新路由
-func (s *RouteService) UpdateRoute(id int64, name, model, apiUrl, apiKey, group, format string) error {
-	query := `UPDATE model_routes SET name = ?, model = ?, api_url = ?, api_key = ?, "group" = ?, format = ?, updated_at = ?
+// insertRoute 插入已规范化的路由，返回新路由的 ID；APIKey 加密后保存
+func (s *RouteService) insertRoute(db execer, route *database.ModelRoute) (int64, error) {
+	apiKey, err := s.keys.Encrypt(route.APIKey)
+	if err != nil {
+		return 0, err
+	}
+
+	query := `INSERT INTO model_routes (name, model, api_url, api_key, "group", format, weight, upstream_model, priority, extra_headers, extra_body,
+	          connect_timeout, first_byte_timeout, idle_timeout, outbound_proxy, rpm_limit, tpm_limit, provider_id, capabilities, enabled, created_at, updated_at)
+	          VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	now := time.Now()
+	result, err := db.Exec(query, route.Name, route.Model, route.APIUrl, apiKey, route.Group, route.Format, route.Weight, route.UpstreamModel, route.Priority,
+		route.ExtraHeaders, route.ExtraBody, route.ConnectTimeout, route.FirstByteTimeout, route.IdleTimeout, route.OutboundProxy,
+		route.RPMLimit, route.TPMLimit, route.ProviderID, route.Capabilities, route.Enabled, now, now)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// updateRouteRow 按 ID 更新已规范化的路由（不修改启用状态）；APIKey 加密后保存
+func (s *RouteService) updateRouteRow(db execer, route *database.ModelRoute) error {
+	apiKey, err := s.keys.Encrypt(route.APIKey)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE model_routes SET name = ?, model = ?, api_url = ?, api_key = ?, "group" = ?, format = ?, weight = ?, upstream_model = ?, priority = ?,
+	          extra_headers = ?, extra_body = ?, connect_timeout = ?, first_byte_timeout = ?, idle_timeout = ?, outbound_proxy = ?,
+	          rpm_limit = ?, tpm_limit = ?, capabilities = ?, updated_at = ?
 	          WHERE id = ?`
 
-	result, err := s.db.Exec(query, name, model, apiUrl, apiKey, group, format, time.Now(), id)
+	result, err := db.Exec(query, route.Name, route.Model, route.APIUrl, apiKey, route.Group, route.Format, route.Weight, route.UpstreamModel, route.Priority,
+		route.ExtraHeaders, route.ExtraBody, route.ConnectTimeout, route.FirstByteTimeout, route.IdleTimeout, route.OutboundProxy,
+		route.RPMLimit, route.TPMLimit, route.Capabilities, time.Now(), route.ID)
 	if err != nil {
-		log.Errorf("Failed to update route: %v", err)
 		return err
 	}
 
 	rows, _ := result.RowsAffected()
 	if rows == 0 {
-		return fmt.Errorf("route not found: id=%d", id)
+		return fmt.Errorf("route not found: id=%d", route.ID)
 	}
-
-	log.Infof("Route updated: id=%d", id)
 	return nil
 }
 
-// DeleteRoute 删除路由及其相关的请求日志
-func (s *RouteService) DeleteRoute(id int64) error {
-	// 先删除该路由相关的请求日志
-	_, err := s.db.Exec(`DELETE FROM request_logs WHERE route_id = ?`, id)
-	if err != nil {
-		log.Errorf("Failed to delete route logs: %v", err)
-		return err
+// deleteRouteRows 删除路由及其请求日志、健康检查记录和附加 API Key
+func deleteRouteRows(db execer, id int64) error {
+	for _, table := range []string{"request_logs", "route_health", "route_keys"} {
+		if _, err := db.Exec(`DELETE FROM `+table+` WHERE route_id = ?`, id); err != nil {
+			return fmt.Errorf("failed to delete %s of route %d: %v", table, id, err)
+		}
 	}
 
-	// 再删除路由
-	query := `DELETE FROM model_routes WHERE id = ?`
-	result, err := s.db.Exec(query, id)
+	result, err := db.Exec(`DELETE FROM model_routes WHERE id = ?`, id)
 	if err != nil {
-		log.Errorf("Failed to delete route: %v", err)
 		return err
 	}
 
@@ -139,6 +278,49 @@ func (s *RouteService) DeleteRoute(id int64) error {
 	if rows == 0 {
 		return fmt.Errorf("route not found: id=%d", id)
 	}
+	return nil
+}
+
+// AddRoute 手动添加路由，各字段校验并规范化后写回 route；新路由总是启用，且不属于任何供应商
+func (s *RouteService) AddRoute(route *database.ModelRoute) error {
+	if err := normalizeRoute(route); err != nil {
+		return err
+	}
+	route.Enabled = true
+	route.ProviderID = 0
+
+	id, err := s.insertRoute(s.db, route)
+	if err != nil {
+		log.Errorf("Failed to add route: %v", err)
+		return err
+	}
+	route.ID = id
+
+	log.Infof("Route added: %s -> %s (%s) [%s]", route.Model, route.APIUrl, route.Name, route.Format)
+	return nil
+}
+
+// UpdateRoute 按 route.ID 更新路由，不修改启用状态和所属供应商
+func (s *RouteService) UpdateRoute(route *database.ModelRoute) error {
+	if err := normalizeRoute(route); err != nil {
+		return err
+	}
+
+	if err := s.updateRouteRow(s.db, route); err != nil {
+		log.Errorf("Failed to update route: %v", err)
+		return err
+	}
+
+	log.Infof("Route updated: id=%d", route.ID)
+	return nil
+}
+
+// DeleteRoute 删除路由及其相关的请求日志
+func (s *RouteService) DeleteRoute(id int64) error {
+	if err := deleteRouteRows(s.db, id); err != nil {
+		log.Errorf("Failed to delete route: %v", err)
+		return err
+	}
 
 	log.Infof("Route deleted: id=%d (with related logs)", id)
 	return nil
@@ -237,20 +419,201 @@ func (s *RouteService) GetStats() (map[string]interface{}, error) {
 
 // LogRequest 记录请求日志
 func (s *RouteService) LogRequest(model string, routeID int64, requestTokens, responseTokens, totalTokens int, success bool, errorMsg string) error {
+	return s.LogRequestDetail(database.RequestLog{
+		Model:          model,
+		RouteID:        routeID,
+		RequestTokens:  requestTokens,
+		ResponseTokens: responseTokens,
+		TotalTokens:    totalTokens,
+		Success:        success,
+		ErrorMessage:   errorMsg,
+	})
+}
+
+// LogRequestDetail 记录包含耗时、命中规则等附加信息的请求日志，Tier 由路由当前的优先级决定
+func (s *RouteService) LogRequestDetail(entry database.RequestLog) error {
 	// 使用 SQLite 的 datetime('now', 'localtime') 确保时区一致
-	query := `INSERT INTO request_logs (model, route_id, request_tokens, response_tokens, total_tokens, success, error_message, created_at)
-	          VALUES (?, ?, ?, ?, ?, ?, ?, datetime('now', 'localtime'))`
+	// tier 记录请求时该路由所在的优先级层级
+	query := `INSERT INTO request_logs (model, route_id, request_tokens, response_tokens, total_tokens, success, error_message, tier, latency_ms, ttft_ms, rule_name, error_type, created_at)
+	          VALUES (?, ?, ?, ?, ?, ?, ?, COALESCE((SELECT priority FROM model_routes WHERE id = ?), 0), ?, ?, ?, ?, datetime('now', 'localtime'))`
 
-	_, err := s.db.Exec(query, model, routeID, requestTokens, responseTokens, totalTokens, success, errorMsg)
+	_, err := s.db.Exec(query, entry.Model, entry.RouteID, entry.RequestTokens, entry.ResponseTokens, entry.TotalTokens, entry.Success, entry.ErrorMessage,
+		entry.RouteID, entry.LatencyMs, entry.TTFTMs, entry.RuleName, entry.ErrorType)
 	if err != nil {
 		log.Errorf("LogRequest error: %v", err)
 	} else {
-		log.Infof("LogRequest: model=%s, tokens=%d, success=%v", model, totalTokens, success)
+		log.Infof("LogRequest: model=%s, tokens=%d, success=%v, latency=%dms, ttft=%dms", entry.Model, entry.TotalTokens, entry.Success, entry.LatencyMs, entry.TTFTMs)
+	}
+	return err
+}
+
+// LogRouteHealth 记录一次路由健康检查结果
+func (s *RouteService) LogRouteHealth(routeID int64, status string, latencyMs int64, errorMsg string) error {
+	query := `INSERT INTO route_health (route_id, status, latency_ms, error_message, checked_at)
+	          VALUES (?, ?, ?, ?, datetime('now', 'localtime'))`
+
+	_, err := s.db.Exec(query, routeID, status, latencyMs, errorMsg)
+	if err != nil {
+		log.Errorf("LogRouteHealth error: %v", err)
+	}
+	return err
+}
+
+// GetRouteHealthHistory 获取路由最近的健康检查记录
+func (s *RouteService) GetRouteHealthHistory(routeID int64, limit int) ([]database.RouteHealth, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+
+	query := `SELECT id, route_id, status, latency_ms, COALESCE(error_message, ''), checked_at
+	          FROM route_health WHERE route_id = ? ORDER BY checked_at DESC, id DESC LIMIT ?`
+	rows, err := s.db.Query(query, routeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []database.RouteHealth
+	for rows.Next() {
+		var r database.RouteHealth
+		if err := rows.Scan(&r.ID, &r.RouteID, &r.Status, &r.LatencyMs, &r.ErrorMessage, &r.CheckedAt); err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// GetLatestRouteHealth 获取每条路由最近一次的健康检查结果
+func (s *RouteService) GetLatestRouteHealth() (map[int64]database.RouteHealth, error) {
+	query := `SELECT h.id, h.route_id, h.status, h.latency_ms, COALESCE(h.error_message, ''), h.checked_at
+	          FROM route_health h
+	          WHERE h.id = (SELECT MAX(id) FROM route_health WHERE route_id = h.route_id)`
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[int64]database.RouteHealth)
+	for rows.Next() {
+		var r database.RouteHealth
+		if err := rows.Scan(&r.ID, &r.RouteID, &r.Status, &r.LatencyMs, &r.ErrorMessage, &r.CheckedAt); err != nil {
+			return nil, err
+		}
+		result[r.RouteID] = r
 	}
+	return result, rows.Err()
+}
+
+// CleanRouteHealth 删除指定天数之前的健康检查记录
+func (s *RouteService) CleanRouteHealth(days int) error {
+	query := `DELETE FROM route_health WHERE checked_at < datetime('now', 'localtime', ?)`
+	_, err := s.db.Exec(query, fmt.Sprintf("-%d days", days))
 	return err
 }
 
+// GetRouteKeys 获取路由的附加 API Key
+func (s *RouteService) GetRouteKeys(routeID int64) ([]database.RouteKey, error) {
+	query := `SELECT id, route_id, COALESCE(name, ''), api_key, enabled, created_at
+	          FROM route_keys WHERE route_id = ? ORDER BY id`
+	rows, err := s.db.Query(query, routeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []database.RouteKey{}
+	for rows.Next() {
+		var k database.RouteKey
+		if err := rows.Scan(&k.ID, &k.RouteID, &k.Name, &k.APIKey, &k.Enabled, &k.CreatedAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// GetRouteKeyByID 根据 ID 获取附加 API Key
+func (s *RouteService) GetRouteKeyByID(id int64) (*database.RouteKey, error) {
+	query := `SELECT id, route_id, COALESCE(name, ''), api_key, enabled, created_at FROM route_keys WHERE id = ?`
+	var k database.RouteKey
+	err := s.db.QueryRow(query, id).Scan(&k.ID, &k.RouteID, &k.Name, &k.APIKey, &k.Enabled, &k.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("route key not found: id=%d", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+// AddRouteKey 为路由添加附加 API Key
+func (s *RouteService) AddRouteKey(routeID int64, name, apiKey string) (int64, error) {
+	apiKey = strings.TrimSpace(apiKey)
+	if apiKey == "" {
+		return 0, fmt.Errorf("api key is required")
+	}
+	var exists int
+	if err := s.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM model_routes WHERE id = ?)`, routeID).Scan(&exists); err != nil {
+		return 0, err
+	}
+	if exists != 1 {
+		return 0, fmt.Errorf("route not found: %d", routeID)
+	}
+
+	sealed, err := s.keys.Encrypt(apiKey)
+	if err != nil {
+		return 0, err
+	}
+	query := `INSERT INTO route_keys (route_id, name, api_key, enabled, created_at) VALUES (?, ?, ?, 1, ?)`
+	result, err := s.db.Exec(query, routeID, strings.TrimSpace(name), sealed, time.Now())
+	if err != nil {
+		log.Errorf("Failed to add route key: %v", err)
+		return 0, err
+	}
+
+	id, _ := result.LastInsertId()
+	log.Infof("Route key added: route=%d, id=%d", routeID, id)
+	return id, nil
+}
+
+// DeleteRouteKey 删除附加 API Key
+func (s *RouteService) DeleteRouteKey(id int64) error {
+	result, err := s.db.Exec(`DELETE FROM route_keys WHERE id = ?`, id)
+	if err != nil {
+		log.Errorf("Failed to delete route key: %v", err)
+		return err
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return fmt.Errorf("route key not found: id=%d", id)
+	}
+
+	log.Infof("Route key deleted: id=%d", id)
+	return nil
+}
+
+// ToggleRouteKey 启用/禁用附加 API Key
+func (s *RouteService) ToggleRouteKey(id int64, enabled bool) error {
+	result, err := s.db.Exec(`UPDATE route_keys SET enabled = ? WHERE id = ?`, enabled, id)
+	if err != nil {
+		log.Errorf("Failed to toggle route key: %v", err)
+		return err
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return fmt.Errorf("route key not found: id=%d", id)
+	}
+
+	log.Infof("Route key toggled: id=%d, enabled=%v", id, enabled)
+	return nil
+}
+
 // GetAvailableModels 获取所有可用的模型列表（包含重定向关键字）
+// 通配符和正则路由不是具体的模型名，不出现在列表中
 func (s *RouteService) GetAvailableModels() ([]string, error) {
 	query := `SELECT DISTINCT model FROM model_routes WHERE enabled = 1 ORDER BY model`
 
@@ -266,6 +629,9 @@ func (s *RouteService) GetAvailableModels() ([]string, error) {
 		if err := rows.Scan(&model); err != nil {
 			return nil, err
 		}
+		if IsModelPattern(model) {
+			continue
+		}
 		models = append(models, model)
 	}
 
@@ -273,7 +639,7 @@ func (s *RouteService) GetAvailableModels() ([]string, error) {
 }
 
 // GetAvailableModelsWithRedirect 获取所有可用的模型列表（包含重定向关键字）
-func (s *RouteService) GetAvailableModelsWithRedirect(redirectKeyword string) ([]string, error) {
+func (s *RouteService) GetAvailableModelsWithRedirect(redirectKeywords ...string) ([]string, error) {
 	query := `SELECT DISTINCT model FROM model_routes WHERE enabled = 1 ORDER BY model`
 
 	rows, err := s.db.Query(query)
@@ -285,8 +651,10 @@ func (s *RouteService) GetAvailableModelsWithRedirect(redirectKeyword string) ([
 	var models []string
 
 	// 首先添加重定向关键字（如果配置了）
-	if redirectKeyword != "" {
-		models = append(models, redirectKeyword)
+	for _, keyword := range redirectKeywords {
+		if keyword != "" {
+			models = append(models, keyword)
+		}
 	}
 
 	for rows.Next() {
@@ -294,6 +662,9 @@ func (s *RouteService) GetAvailableModelsWithRedirect(redirectKeyword string) ([
 		if err := rows.Scan(&model); err != nil {
 			return nil, err
 		}
+		if IsModelPattern(model) {
+			continue
+		}
 		models = append(models, model)
 	}
 
@@ -423,7 +794,9 @@ func (s *RouteService) ImportRouteFromFormat(name, model, apiUrl, apiKey, group,
 	}
 
 	// 添加转换后的路由
-	err = s.AddRoute(name+" ("+targetFormat+")", convertedModel, convertedUrl, apiKey, group, targetFormat)
+	err = s.AddRoute(&database.ModelRoute{
+		Name: name + " (" + targetFormat + ")", Model: convertedModel, APIUrl: convertedUrl, APIKey: apiKey, Group: group, Format: targetFormat,
+	})
 	if err != nil {
 		return "", fmt.Errorf("添加路由失败: %v", err)
 	}
@@ -0,0 +1,694 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// routeTestHeader 路由测试请求携带的令牌，只有 TestRoute 生成的令牌有效，客户端无法伪造
+const routeTestHeader = "X-Route-Test-Token"
+
+// protocolClaudeCode Claude Code 入口（/api/claudecode）
+const protocolClaudeCode = "claudecode"
+
+// RouteTestProtocols 路由测试依次模拟的客户端入口协议
+var RouteTestProtocols = []string{protocolOpenAI, protocolClaude, protocolClaudeCode, protocolGemini}
+
+// 测试请求参数
+const (
+	routeTestPrompt     = "Reply with the single word: pong"
+	routeTestToolPrompt = "What is the weather in Paris right now? Use the get_weather tool."
+	routeTestMaxTokens  = 32
+	routeTestToolTokens = 256
+	routeTestOutputMax  = 200 // 结果中保留的回复长度
+)
+
+// routeTestToolName 测试用的工具名，工具结果固定为 routeTestToolResult
+const routeTestToolName = "get_weather"
+
+var routeTestToolResult = map[string]interface{}{"city": "Paris", "temperature_c": 21, "condition": "sunny"}
+
+// RouteTestCheck 一次测试请求的结果
+type RouteTestCheck struct {
+	OK             bool   `json:"ok"`
+	StatusCode     int    `json:"status_code"`       // 上游响应状态码，请求未发出时为 0
+	LatencyMs      int64  `json:"latency_ms"`        // 包含格式转换在内的总耗时
+	TTFTMs         int64  `json:"ttft_ms,omitempty"` // 流式请求的首字耗时
+	RequestTokens  int    `json:"request_tokens"`    // 与请求日志相同的统计方式，上游未返回用量时为 0
+	ResponseTokens int    `json:"response_tokens"`
+	TotalTokens    int    `json:"total_tokens"`
+	Chunks         int    `json:"chunks,omitempty"` // 流式请求收到的 SSE 数据条数
+	Output         string `json:"output,omitempty"` // 回复内容（截断），工具调用测试为调用和最终回复
+	Error          string `json:"error,omitempty"`
+	Skipped        bool   `json:"skipped,omitempty"` // 基本请求失败时不再进行后续测试
+}
+
+// RouteProtocolTest 以某种客户端协议访问路由的测试结果
+type RouteProtocolTest struct {
+	Protocol string         `json:"protocol"`  // openai / claude / claudecode / gemini
+	Basic    RouteTestCheck `json:"basic"`     // 非流式请求
+	Stream   RouteTestCheck `json:"stream"`    // 流式请求
+	ToolCall RouteTestCheck `json:"tool_call"` // 工具调用并回传工具结果
+}
+
+// RouteTestResult 路由测试结果
+type RouteTestResult struct {
+	RouteID   int64               `json:"route_id"`
+	RouteName string              `json:"route_name"`
+	Model     string              `json:"model"`  // 测试请求使用的模型名
+	Format    string              `json:"format"` // 路由的上游格式
+	OK        bool                `json:"ok"`     // 所有协议的所有测试均通过
+	TestedAt  time.Time           `json:"tested_at"`
+	Protocols []RouteProtocolTest `json:"protocols"`
+}
+
+// routeTestRecord 单个测试请求在代理流程中记录的结果
+type routeTestRecord struct {
+	routeID int64
+
+	mu             sync.Mutex
+	status         int
+	logged         bool
+	success        bool
+	requestTokens  int
+	responseTokens int
+	totalTokens    int
+	errorMessage   string
+	errorType      string
+	ttftMs         int64
+}
+
+// setStatus 记录上游响应状态码
+func (r *routeTestRecord) setStatus(status int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status = status
+}
+
+// record 记录代理流程本应写入请求日志的结果，多次记录（如换 Key 重试）时保留最后一次
+func (r *routeTestRecord) record(requestTokens, responseTokens, totalTokens int, success bool, errorMessage, errorType string, ttftMs int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.logged = true
+	r.success = success
+	r.requestTokens, r.responseTokens, r.totalTokens = requestTokens, responseTokens, totalTokens
+	r.errorMessage, r.errorType = errorMessage, errorType
+	r.ttftMs = ttftMs
+}
+
+// fill 将记录的状态码、用量和错误写入测试结果
+func (r *routeTestRecord) fill(check *RouteTestCheck) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	check.StatusCode = r.status
+	check.RequestTokens += r.requestTokens
+	check.ResponseTokens += r.responseTokens
+	check.TotalTokens += r.totalTokens
+	if r.ttftMs > 0 && check.TTFTMs == 0 {
+		check.TTFTMs = r.ttftMs
+	}
+	if r.logged && !r.success && check.Error == "" {
+		check.Error = r.errorMessage
+		if r.errorType != "" {
+			check.Error = fmt.Sprintf("[%s] %s", r.errorType, r.errorMessage)
+		}
+	}
+}
+
+// routeTestRegistry 进行中的路由测试请求，按令牌查找
+type routeTestRegistry struct {
+	mu      sync.Mutex
+	pending map[string]*routeTestRecord
+}
+
+func newRouteTestRegistry() *routeTestRegistry {
+	return &routeTestRegistry{pending: make(map[string]*routeTestRecord)}
+}
+
+// begin 为一次测试请求生成令牌
+func (r *routeTestRegistry) begin(routeID int64) (string, *routeTestRecord) {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	token := hex.EncodeToString(buf)
+	record := &routeTestRecord{routeID: routeID}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pending[token] = record
+	return token, record
+}
+
+// lookup 查找令牌对应的测试记录
+func (r *routeTestRegistry) lookup(token string) *routeTestRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.pending[token]
+}
+
+// end 测试请求结束后令牌失效
+func (r *routeTestRegistry) end(token string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.pending, token)
+}
+
+// traceRequest 创建请求上下文，ctx 为客户端请求的上下文；携带有效测试令牌的请求绑定到被测路由
+func (s *ProxyService) traceRequest(ctx context.Context, headers map[string]string) *requestTrace {
+	trace := newRequestTrace()
+	trace.ctx = ctx
+	if token := headers[routeTestHeader]; token != "" {
+		trace.test = s.routeTests.lookup(token)
+	}
+	return trace
+}
+
+// TestRoute 以 OpenAI、Claude、Claude Code 和 Gemini 四种客户端协议分别向路由发送测试请求
+// 请求经过与真实流量相同的入口、格式转换和限流流程，但固定发往该路由（不检查启用状态、模型、分组、熔断和健康状态，不做故障转移），
+// 结果不写入请求日志。每种协议依次测试非流式请求、流式请求和工具调用（调用后回传工具结果并要求给出最终回复），
+// 非流式请求失败时跳过该协议的后续测试
+func (s *ProxyService) TestRoute(routeID int64) (*RouteTestResult, error) {
+	route, err := s.routeService.GetRouteByIDIncludeDisabled(routeID)
+	if err != nil {
+		return nil, err
+	}
+	model := route.Model
+	if IsModelPattern(model) {
+		if route.UpstreamModel == "" {
+			return nil, fmt.Errorf("route %s matches the model pattern %q; set upstream_model to test it", route.Name, model)
+		}
+		model = route.UpstreamModel
+	}
+
+	result := &RouteTestResult{
+		RouteID:   route.ID,
+		RouteName: route.Name,
+		Model:     model,
+		Format:    normalizeFormat(route.Format),
+		TestedAt:  time.Now(),
+		Protocols: make([]RouteProtocolTest, len(RouteTestProtocols)),
+	}
+	log.Infof("[RouteTest] Testing route %s (id=%d, format=%s) with model %s", route.Name, route.ID, result.Format, model)
+
+	var wg sync.WaitGroup
+	for i, protocol := range RouteTestProtocols {
+		wg.Add(1)
+		go func(i int, protocol string) {
+			defer wg.Done()
+			// 格式转换出错时不能让测试拖垮整个程序，按该协议测试失败处理
+			defer func() {
+				if r := recover(); r != nil {
+					log.Errorf("[RouteTest] Route %s (id=%d) %s test panicked: %v", route.Name, route.ID, protocol, r)
+					result.Protocols[i] = RouteProtocolTest{Protocol: protocol, Basic: RouteTestCheck{Error: fmt.Sprintf("internal error: %v", r)}}
+				}
+			}()
+			result.Protocols[i] = s.testRouteProtocol(route.ID, protocol, model, result.Format)
+		}(i, protocol)
+	}
+	wg.Wait()
+
+	result.OK = true
+	for _, p := range result.Protocols {
+		if !p.Basic.OK || !p.Stream.OK || !p.ToolCall.OK {
+			result.OK = false
+		}
+	}
+	log.Infof("[RouteTest] Route %s (id=%d) test finished, ok: %v", route.Name, route.ID, result.OK)
+	return result, nil
+}
+
+// testRouteProtocol 以一种客户端协议测试路由
+func (s *ProxyService) testRouteProtocol(routeID int64, protocol, model, format string) RouteProtocolTest {
+	test := RouteProtocolTest{Protocol: protocol}
+
+	test.Basic = s.routeTestRequest(routeID, protocol, routeTestBasicBody(protocol, model, false))
+	if test.Basic.OK {
+		if reply, _ := routeTestReply(protocol, []byte(test.Basic.Output)); reply == "" {
+			test.Basic.OK = false
+			test.Basic.Error = "response contains no text"
+			test.Basic.Output = truncateTestOutput(test.Basic.Output)
+		} else {
+			test.Basic.Output = truncateTestOutput(reply)
+		}
+	}
+	if !test.Basic.OK {
+		skipped := RouteTestCheck{Skipped: true, Error: "skipped: basic request failed"}
+		test.Stream, test.ToolCall = skipped, skipped
+		return test
+	}
+
+	test.Stream = s.routeTestStream(routeID, protocol, routeTestBasicBody(protocol, model, true))
+	test.ToolCall = s.routeTestToolCall(routeID, protocol, model, format)
+	return test
+}
+
+// routeTestRequest 通过对应协议的非流式入口发送测试请求，成功时 Output 为原始响应体
+func (s *ProxyService) routeTestRequest(routeID int64, protocol string, body map[string]interface{}) RouteTestCheck {
+	token, record := s.routeTests.begin(routeID)
+	defer s.routeTests.end(token)
+
+	data, _ := json.Marshal(body)
+	headers := map[string]string{routeTestHeader: token}
+
+	start := time.Now()
+	var respBody []byte
+	var status int
+	var err error
+	switch protocol {
+	case protocolClaude:
+		respBody, status, err = s.ProxyAnthropicRequest(context.Background(), data, headers)
+	case protocolClaudeCode:
+		respBody, status, err = s.ProxyClaudeCodeRequest(context.Background(), data, headers)
+	case protocolGemini:
+		respBody, status, err = s.ProxyGeminiRequest(context.Background(), data, headers)
+	default:
+		respBody, status, err = s.ProxyRequest(context.Background(), data, headers)
+	}
+
+	check := RouteTestCheck{LatencyMs: time.Since(start).Milliseconds()}
+	record.fill(&check)
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	if status != http.StatusOK {
+		check.StatusCode = status
+		check.Error = fmt.Sprintf("status %d: %s", status, truncateTestOutput(string(respBody)))
+		return check
+	}
+	check.OK = true
+	check.Error = ""
+	check.Output = string(respBody)
+	return check
+}
+
+// routeTestStream 通过对应协议的流式入口发送测试请求，收到文本内容视为流式可用
+func (s *ProxyService) routeTestStream(routeID int64, protocol string, body map[string]interface{}) RouteTestCheck {
+	token, record := s.routeTests.begin(routeID)
+	defer s.routeTests.end(token)
+
+	data, _ := json.Marshal(body)
+	headers := map[string]string{routeTestHeader: token}
+	var out bytes.Buffer
+	flusher := routeTestFlusher{}
+
+	start := time.Now()
+	var err error
+	switch protocol {
+	case protocolClaude:
+		err = s.ProxyAnthropicStreamRequest(context.Background(), data, headers, &out, flusher)
+	case protocolClaudeCode:
+		err = s.ProxyClaudeCodeStreamRequest(context.Background(), data, headers, &out, flusher)
+	case protocolGemini:
+		err = s.ProxyGeminiStreamRequest(context.Background(), data, headers, &out, flusher)
+	default:
+		err = s.ProxyStreamRequest(context.Background(), data, headers, &out, flusher)
+	}
+
+	check := RouteTestCheck{LatencyMs: time.Since(start).Milliseconds()}
+	record.fill(&check)
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	text, chunks := routeTestStreamText(out.Bytes())
+	check.Chunks = chunks
+	check.Output = truncateTestOutput(text)
+	switch {
+	case chunks == 0:
+		check.Error = "no SSE events received: " + truncateTestOutput(out.String())
+	case text == "":
+		check.Error = "stream contains no text"
+	default:
+		check.OK = true
+		check.Error = ""
+	}
+	return check
+}
+
+// routeTestToolCall 发送带工具定义的请求，检查模型调用了工具且参数可解析，再回传工具结果并检查最终回复
+func (s *ProxyService) routeTestToolCall(routeID int64, protocol, model, format string) RouteTestCheck {
+	first := s.routeTestRequest(routeID, protocol, routeTestToolBody(protocol, model, format, nil))
+	if !first.OK {
+		return first
+	}
+	reply, call := routeTestReply(protocol, []byte(first.Output))
+	if call == nil {
+		first.OK = false
+		first.Error = "model did not call the tool"
+		first.Output = truncateTestOutput(reply)
+		return first
+	}
+	if call.name != routeTestToolName {
+		first.OK = false
+		first.Error = fmt.Sprintf("model called unknown tool %q", call.name)
+		first.Output = ""
+		return first
+	}
+	args, _ := json.Marshal(call.args)
+	first.Output = fmt.Sprintf("%s(%s)", call.name, args)
+	if city, _ := call.args["city"].(string); city == "" {
+		first.OK = false
+		first.Error = "tool call arguments are missing the city parameter"
+		return first
+	}
+
+	second := s.routeTestRequest(routeID, protocol, routeTestToolBody(protocol, model, format, call))
+	check := RouteTestCheck{
+		StatusCode:     second.StatusCode,
+		LatencyMs:      first.LatencyMs + second.LatencyMs,
+		RequestTokens:  first.RequestTokens + second.RequestTokens,
+		ResponseTokens: first.ResponseTokens + second.ResponseTokens,
+		TotalTokens:    first.TotalTokens + second.TotalTokens,
+		Output:         first.Output,
+	}
+	if !second.OK {
+		check.Error = "sending the tool result failed: " + second.Error
+		return check
+	}
+	final, again := routeTestReply(protocol, []byte(second.Output))
+	if final == "" {
+		check.Error = "no final answer after the tool result"
+		if again != nil {
+			check.Error = "model called the tool again instead of answering"
+		}
+		return check
+	}
+	check.OK = true
+	check.Output = truncateTestOutput(first.Output + " -> " + final)
+	return check
+}
+
+// routeTestFlusher 测试流式请求时不需要刷新输出
+type routeTestFlusher struct{}
+
+func (routeTestFlusher) Flush() {}
+
+// routeTestToolCallInfo 响应中的工具调用
+type routeTestToolCallInfo struct {
+	id   string
+	name string
+	args map[string]interface{}
+}
+
+// routeTestBasicBody 按客户端协议构造最简单的对话请求
+func routeTestBasicBody(protocol, model string, stream bool) map[string]interface{} {
+	var body map[string]interface{}
+	switch protocol {
+	case protocolClaude:
+		body = map[string]interface{}{
+			"model":      model,
+			"max_tokens": routeTestMaxTokens,
+			"messages":   []interface{}{map[string]interface{}{"role": "user", "content": routeTestPrompt}},
+		}
+	case protocolClaudeCode:
+		// Claude Code 使用数组形式的 system 和消息内容
+		body = map[string]interface{}{
+			"model":      model,
+			"max_tokens": routeTestMaxTokens,
+			"system":     []interface{}{map[string]interface{}{"type": "text", "text": "You are a coding assistant."}},
+			"messages":   []interface{}{routeTestClaudeCodeUser(routeTestPrompt)},
+		}
+	case protocolGemini:
+		// 与 Gemini 入口一致，模型名和 stream 由路由注入到请求体
+		body = map[string]interface{}{
+			"model":            model,
+			"contents":         []interface{}{routeTestGeminiUser(routeTestPrompt)},
+			"generationConfig": map[string]interface{}{"maxOutputTokens": routeTestMaxTokens},
+		}
+	default:
+		body = map[string]interface{}{
+			"model":      model,
+			"max_tokens": routeTestMaxTokens,
+			"messages":   []interface{}{map[string]interface{}{"role": "user", "content": routeTestPrompt}},
+		}
+	}
+	if stream {
+		body["stream"] = true
+	}
+	return body
+}
+
+// routeTestToolBody 按客户端协议构造带工具定义的请求；call 不为空时在对话中加入该工具调用及其结果
+// format 为路由的上游格式，直连 Gemini 时参数 schema 使用 Gemini 的大写类型名
+func routeTestToolBody(protocol, model, format string, call *routeTestToolCallInfo) map[string]interface{} {
+	const description = "Get the current weather for a city"
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"city": map[string]interface{}{"type": "string", "description": "City name"}},
+		"required":   []interface{}{"city"},
+	}
+	toolResult, _ := json.Marshal(routeTestToolResult)
+
+	switch protocol {
+	case protocolClaude, protocolClaudeCode:
+		user := map[string]interface{}{"role": "user", "content": routeTestToolPrompt}
+		if protocol == protocolClaudeCode {
+			user = routeTestClaudeCodeUser(routeTestToolPrompt)
+		}
+		messages := []interface{}{user}
+		if call != nil {
+			messages = append(messages,
+				map[string]interface{}{"role": "assistant", "content": []interface{}{
+					map[string]interface{}{"type": "tool_use", "id": call.id, "name": call.name, "input": call.args},
+				}},
+				map[string]interface{}{"role": "user", "content": []interface{}{
+					map[string]interface{}{"type": "tool_result", "tool_use_id": call.id, "content": string(toolResult)},
+				}},
+			)
+		}
+		body := map[string]interface{}{
+			"model":      model,
+			"max_tokens": routeTestToolTokens,
+			"messages":   messages,
+			"tools": []interface{}{map[string]interface{}{
+				"name": routeTestToolName, "description": description, "input_schema": schema,
+			}},
+		}
+		if protocol == protocolClaudeCode {
+			body["system"] = []interface{}{map[string]interface{}{"type": "text", "text": "You are a coding assistant."}}
+		}
+		return body
+
+	case protocolGemini:
+		if format == "gemini" {
+			schema = map[string]interface{}{
+				"type":       "OBJECT",
+				"properties": map[string]interface{}{"city": map[string]interface{}{"type": "STRING", "description": "City name"}},
+				"required":   []interface{}{"city"},
+			}
+		}
+		contents := []interface{}{routeTestGeminiUser(routeTestToolPrompt)}
+		if call != nil {
+			contents = append(contents,
+				map[string]interface{}{"role": "model", "parts": []interface{}{
+					map[string]interface{}{"functionCall": map[string]interface{}{"name": call.name, "args": call.args}},
+				}},
+				map[string]interface{}{"role": "user", "parts": []interface{}{
+					map[string]interface{}{"functionResponse": map[string]interface{}{"name": call.name, "response": routeTestToolResult}},
+				}},
+			)
+		}
+		return map[string]interface{}{
+			"model":            model,
+			"contents":         contents,
+			"generationConfig": map[string]interface{}{"maxOutputTokens": routeTestToolTokens},
+			"tools": []interface{}{map[string]interface{}{
+				"functionDeclarations": []interface{}{map[string]interface{}{
+					"name": routeTestToolName, "description": description, "parameters": schema,
+				}},
+			}},
+		}
+
+	default:
+		messages := []interface{}{map[string]interface{}{"role": "user", "content": routeTestToolPrompt}}
+		if call != nil {
+			args, _ := json.Marshal(call.args)
+			messages = append(messages,
+				map[string]interface{}{"role": "assistant", "content": nil, "tool_calls": []interface{}{
+					map[string]interface{}{"id": call.id, "type": "function", "function": map[string]interface{}{
+						"name": call.name, "arguments": string(args),
+					}},
+				}},
+				map[string]interface{}{"role": "tool", "tool_call_id": call.id, "content": string(toolResult)},
+			)
+		}
+		return map[string]interface{}{
+			"model":      model,
+			"max_tokens": routeTestToolTokens,
+			"messages":   messages,
+			"tools": []interface{}{map[string]interface{}{"type": "function", "function": map[string]interface{}{
+				"name": routeTestToolName, "description": description, "parameters": schema,
+			}}},
+		}
+	}
+}
+
+// routeTestClaudeCodeUser Claude Code 格式的用户消息（内容为文本块数组）
+func routeTestClaudeCodeUser(text string) map[string]interface{} {
+	return map[string]interface{}{
+		"role":    "user",
+		"content": []interface{}{map[string]interface{}{"type": "text", "text": text}},
+	}
+}
+
+// routeTestGeminiUser Gemini 格式的用户消息
+func routeTestGeminiUser(text string) map[string]interface{} {
+	return map[string]interface{}{
+		"role":  "user",
+		"parts": []interface{}{map[string]interface{}{"text": text}},
+	}
+}
+
+// routeTestReply 按客户端协议解析非流式响应，返回回复文本和第一个工具调用
+func routeTestReply(protocol string, body []byte) (string, *routeTestToolCallInfo) {
+	var resp map[string]interface{}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", nil
+	}
+
+	var text strings.Builder
+	var call *routeTestToolCallInfo
+	switch protocol {
+	case protocolClaude, protocolClaudeCode:
+		blocks, _ := resp["content"].([]interface{})
+		for _, b := range blocks {
+			block, _ := b.(map[string]interface{})
+			switch block["type"] {
+			case "text":
+				t, _ := block["text"].(string)
+				text.WriteString(t)
+			case "tool_use":
+				if call == nil {
+					id, _ := block["id"].(string)
+					name, _ := block["name"].(string)
+					args, _ := block["input"].(map[string]interface{})
+					call = &routeTestToolCallInfo{id: id, name: name, args: args}
+				}
+			}
+		}
+
+	case protocolGemini:
+		candidates, _ := resp["candidates"].([]interface{})
+		if len(candidates) > 0 {
+			candidate, _ := candidates[0].(map[string]interface{})
+			content, _ := candidate["content"].(map[string]interface{})
+			parts, _ := content["parts"].([]interface{})
+			for _, p := range parts {
+				part, _ := p.(map[string]interface{})
+				if t, ok := part["text"].(string); ok {
+					text.WriteString(t)
+				}
+				if fc, ok := part["functionCall"].(map[string]interface{}); ok && call == nil {
+					name, _ := fc["name"].(string)
+					args, _ := fc["args"].(map[string]interface{})
+					call = &routeTestToolCallInfo{id: name, name: name, args: args}
+				}
+			}
+		}
+
+	default:
+		choices, _ := resp["choices"].([]interface{})
+		if len(choices) > 0 {
+			choice, _ := choices[0].(map[string]interface{})
+			message, _ := choice["message"].(map[string]interface{})
+			if t, ok := message["content"].(string); ok {
+				text.WriteString(t)
+			}
+			toolCalls, _ := message["tool_calls"].([]interface{})
+			if len(toolCalls) > 0 {
+				tc, _ := toolCalls[0].(map[string]interface{})
+				fn, _ := tc["function"].(map[string]interface{})
+				id, _ := tc["id"].(string)
+				name, _ := fn["name"].(string)
+				call = &routeTestToolCallInfo{id: id, name: name}
+				// arguments 是 JSON 字符串，解析失败时视为没有参数
+				if args, ok := fn["arguments"].(string); ok {
+					json.Unmarshal([]byte(args), &call.args)
+				}
+			}
+		}
+	}
+
+	if call != nil && call.id == "" {
+		call.id = "call_" + call.name
+	}
+	return strings.TrimSpace(text.String()), call
+}
+
+// routeTestStreamText 从 SSE 输出中取出回复文本，兼容 OpenAI、Claude 和 Gemini 的流式格式，同时返回数据条数
+func routeTestStreamText(output []byte) (string, int) {
+	var text strings.Builder
+	chunks := 0
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(make([]byte, 4096), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "" || data == "[DONE]" {
+			continue
+		}
+		var event map[string]interface{}
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			continue
+		}
+		chunks++
+
+		// OpenAI: choices[].delta.content
+		if choices, ok := event["choices"].([]interface{}); ok && len(choices) > 0 {
+			choice, _ := choices[0].(map[string]interface{})
+			delta, _ := choice["delta"].(map[string]interface{})
+			if t, ok := delta["content"].(string); ok {
+				text.WriteString(t)
+			}
+		}
+		// Claude: content_block_delta 的 delta.text
+		if event["type"] == "content_block_delta" {
+			delta, _ := event["delta"].(map[string]interface{})
+			if t, ok := delta["text"].(string); ok {
+				text.WriteString(t)
+			}
+		}
+		// Gemini: candidates[].content.parts[].text
+		if candidates, ok := event["candidates"].([]interface{}); ok && len(candidates) > 0 {
+			candidate, _ := candidates[0].(map[string]interface{})
+			content, _ := candidate["content"].(map[string]interface{})
+			parts, _ := content["parts"].([]interface{})
+			for _, p := range parts {
+				part, _ := p.(map[string]interface{})
+				if t, ok := part["text"].(string); ok {
+					text.WriteString(t)
+				}
+			}
+		}
+	}
+	return strings.TrimSpace(text.String()), chunks
+}
+
+// truncateTestOutput 截断测试结果中的回复内容
+func truncateTestOutput(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) <= routeTestOutputMax {
+		return s
+	}
+	// 不拆开多字节字符
+	cut := routeTestOutputMax
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + "..."
+}
@@ -0,0 +1,248 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"openai-router-go/internal/database"
+)
+
+// testChatUpstream 模拟 OpenAI 格式的上游：普通请求回复 pong，带工具的请求先调用工具，收到工具结果后给出最终回复
+func testChatUpstream(t *testing.T) (*httptest.Server, *int32) {
+	t.Helper()
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		var req struct {
+			Model    string                   `json:"model"`
+			Stream   bool                     `json:"stream"`
+			Messages []map[string]interface{} `json:"messages"`
+			Tools    []interface{}            `json:"tools"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Messages) == 0 {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		usage := map[string]interface{}{"prompt_tokens": 10, "completion_tokens": 2, "total_tokens": 12}
+		if req.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			for i, chunk := range []map[string]interface{}{
+				{"role": "assistant", "content": "po"},
+				{"content": "ng"},
+			} {
+				finish := interface{}(nil)
+				if i == 1 {
+					finish = "stop"
+				}
+				data, _ := json.Marshal(map[string]interface{}{
+					"id": "chatcmpl-test", "object": "chat.completion.chunk", "model": req.Model,
+					"choices": []interface{}{map[string]interface{}{"index": 0, "delta": chunk, "finish_reason": finish}},
+				})
+				fmt.Fprintf(w, "data: %s\n\n", data)
+			}
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+
+		message := map[string]interface{}{"role": "assistant", "content": "pong"}
+		finish := "stop"
+		switch {
+		case len(req.Tools) > 0 && req.Messages[len(req.Messages)-1]["role"] == "tool":
+			message["content"] = "It is sunny in Paris."
+		case len(req.Tools) > 0:
+			message["content"] = nil
+			message["tool_calls"] = []interface{}{map[string]interface{}{
+				"id": "call_1", "type": "function",
+				"function": map[string]interface{}{"name": routeTestToolName, "arguments": `{"city":"Paris"}`},
+			}}
+			finish = "tool_calls"
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id": "chatcmpl-test", "object": "chat.completion", "model": req.Model,
+			"choices": []interface{}{map[string]interface{}{"index": 0, "message": message, "finish_reason": finish}},
+			"usage":   usage,
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func countRequestLogs(t *testing.T, s *ProxyService) int {
+	t.Helper()
+	var n int
+	if err := s.routeService.db.QueryRow("SELECT COUNT(*) FROM request_logs").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestTestRoute(t *testing.T) {
+	s := newTestProxyService(t)
+	server, _ := testChatUpstream(t)
+	route := addTestRoute(t, s.routeService, database.ModelRoute{Name: "upstream", Model: "gpt-4o", APIUrl: server.URL, APIKey: "sk-test", Format: "openai"})
+	// 被测路由已禁用时也能测试
+	if err := s.routeService.ToggleRoute(route.ID, false); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := s.TestRoute(route.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Model != "gpt-4o" || result.Format != "openai" || len(result.Protocols) != len(RouteTestProtocols) {
+		t.Fatalf("TestRoute() = %+v", result)
+	}
+	for _, p := range result.Protocols {
+		if !p.Basic.OK || p.Basic.Output != "pong" || p.Basic.StatusCode != http.StatusOK {
+			t.Errorf("%s basic = %+v, want pong", p.Protocol, p.Basic)
+		}
+		if !p.Stream.OK || p.Stream.Output != "pong" || p.Stream.Chunks == 0 {
+			t.Errorf("%s stream = %+v, want pong", p.Protocol, p.Stream)
+		}
+	}
+	// 只检查会把工具定义和调用转换到 OpenAI 格式的入口
+	for _, p := range []RouteProtocolTest{result.Protocols[0], result.Protocols[2]} {
+		if !p.ToolCall.OK || !strings.HasPrefix(p.ToolCall.Output, routeTestToolName+`({"city":"Paris"}) -> It is sunny`) {
+			t.Errorf("%s tool call = %+v, want the tool called and a final answer", p.Protocol, p.ToolCall)
+		}
+	}
+	// 用量按上游返回的 usage 统计，工具调用测试累加两次请求
+	if openai := result.Protocols[0]; openai.Basic.TotalTokens != 12 || openai.ToolCall.TotalTokens != 24 {
+		t.Fatalf("openai usage = %d basic, %d tool call; want 12 and 24", openai.Basic.TotalTokens, openai.ToolCall.TotalTokens)
+	}
+	if n := countRequestLogs(t, s); n != 0 {
+		t.Fatalf("route tests wrote %d request log(s), want none", n)
+	}
+	if len(s.routeTests.pending) != 0 {
+		t.Fatal("test tokens should be released after the test")
+	}
+}
+
+func TestTestRouteBasicFailureSkipsChecks(t *testing.T) {
+	s := newTestProxyService(t)
+	server, calls := testUpstream(t, http.StatusUnauthorized)
+	route := addTestRoute(t, s.routeService, database.ModelRoute{Name: "broken", Model: "gpt-4o", APIUrl: server.URL})
+	// 测试请求不做故障转移，同模型的其他路由不会被使用
+	other, otherCalls := testChatUpstream(t)
+	addTestRoute(t, s.routeService, database.ModelRoute{Name: "healthy", Model: "gpt-4o", APIUrl: other.URL})
+
+	result, err := s.TestRoute(route.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.OK {
+		t.Fatal("result should fail when the upstream rejects requests")
+	}
+	for _, p := range result.Protocols {
+		if p.Basic.OK || p.Basic.StatusCode != http.StatusUnauthorized || p.Basic.Error == "" {
+			t.Errorf("%s basic = %+v, want a 401 failure", p.Protocol, p.Basic)
+		}
+		if !p.Stream.Skipped || !p.ToolCall.Skipped {
+			t.Errorf("%s: stream and tool call should be skipped after the basic request failed", p.Protocol)
+		}
+	}
+	if got := atomic.LoadInt32(calls); got != int32(len(RouteTestProtocols)) {
+		t.Fatalf("upstream received %d request(s), want one basic request per protocol", got)
+	}
+	if atomic.LoadInt32(otherCalls) != 0 {
+		t.Fatal("route tests should not fail over to other routes")
+	}
+}
+
+func TestTestRouteModelPattern(t *testing.T) {
+	s := newTestProxyService(t)
+	route := addTestRoute(t, s.routeService, database.ModelRoute{Name: "pattern", Model: "gpt-*"})
+	if _, err := s.TestRoute(route.ID); err == nil || !strings.Contains(err.Error(), "upstream_model") {
+		t.Fatalf("TestRoute() for a pattern route = %v, want an error asking for upstream_model", err)
+	}
+	if _, err := s.TestRoute(route.ID + 100); err == nil {
+		t.Fatal("testing a missing route should fail")
+	}
+}
+
+func TestRouteTestTokens(t *testing.T) {
+	s := newTestProxyService(t)
+	token, record := s.routeTests.begin(7)
+	if trace := s.traceRequest(context.Background(), map[string]string{routeTestHeader: token}); trace.test != record {
+		t.Fatal("a valid token should bind the request to the tested route")
+	}
+	if trace := s.traceRequest(context.Background(), map[string]string{routeTestHeader: "forged"}); trace.test != nil {
+		t.Fatal("an unknown token should be ignored")
+	}
+	s.routeTests.end(token)
+	if trace := s.traceRequest(context.Background(), map[string]string{routeTestHeader: token}); trace.test != nil {
+		t.Fatal("a token should not be usable after the test ended")
+	}
+}
+
+func TestRouteTestReply(t *testing.T) {
+	tests := []struct {
+		protocol string
+		body     string
+		wantText string
+		wantCall string
+	}{
+		{protocolOpenAI, `{"choices":[{"message":{"content":" pong "}}]}`, "pong", ""},
+		{protocolOpenAI, `{"choices":[{"message":{"content":null,"tool_calls":[{"id":"c1","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]}}]}`, "", "c1 get_weather Paris"},
+		{protocolClaude, `{"content":[{"type":"text","text":"pong"},{"type":"tool_use","id":"t1","name":"get_weather","input":{"city":"Paris"}}]}`, "pong", "t1 get_weather Paris"},
+		{protocolClaudeCode, `{"content":[{"type":"text","text":"po"},{"type":"text","text":"ng"}]}`, "pong", ""},
+		{protocolGemini, `{"candidates":[{"content":{"parts":[{"functionCall":{"name":"get_weather","args":{"city":"Paris"}}}]}}]}`, "", "get_weather get_weather Paris"},
+		{protocolGemini, `not json`, "", ""},
+	}
+	for _, tt := range tests {
+		text, call := routeTestReply(tt.protocol, []byte(tt.body))
+		gotCall := ""
+		if call != nil {
+			city, _ := call.args["city"].(string)
+			gotCall = strings.Join([]string{call.id, call.name, city}, " ")
+		}
+		if text != tt.wantText || gotCall != tt.wantCall {
+			t.Errorf("routeTestReply(%s, %s) = %q, %q; want %q, %q", tt.protocol, tt.body, text, gotCall, tt.wantText, tt.wantCall)
+		}
+	}
+
+	// OpenAI 工具调用没有 id 时按工具名生成
+	if _, call := routeTestReply(protocolOpenAI, []byte(`{"choices":[{"message":{"tool_calls":[{"function":{"name":"f","arguments":"bad"}}]}}]}`)); call == nil || call.id != "call_f" || call.args != nil {
+		t.Fatalf("tool call without id = %+v, want id call_f and no arguments", call)
+	}
+}
+
+func TestRouteTestStreamText(t *testing.T) {
+	tests := []struct {
+		name       string
+		output     string
+		wantText   string
+		wantChunks int
+	}{
+		{"openai", "data: {\"choices\":[{\"delta\":{\"content\":\"po\"}}]}\n\ndata: {\"choices\":[{\"delta\":{\"content\":\"ng\"}}]}\n\ndata: [DONE]\n\n", "pong", 2},
+		{"claude", "event: message_start\ndata: {\"type\":\"message_start\"}\n\nevent: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"text_delta\",\"text\":\"pong\"}}\n\n", "pong", 2},
+		{"gemini", "data: {\"candidates\":[{\"content\":{\"parts\":[{\"text\":\"pong\"}]}}]}\n\n", "pong", 1},
+		{"not sse", `{"error":"bad gateway"}`, "", 0},
+		{"invalid json skipped", "data: {oops\n\ndata: {\"choices\":[{\"delta\":{}}]}\n\n", "", 1},
+	}
+	for _, tt := range tests {
+		text, chunks := routeTestStreamText([]byte(tt.output))
+		if text != tt.wantText || chunks != tt.wantChunks {
+			t.Errorf("%s: routeTestStreamText() = %q, %d; want %q, %d", tt.name, text, chunks, tt.wantText, tt.wantChunks)
+		}
+	}
+}
+
+func TestTruncateTestOutput(t *testing.T) {
+	if got := truncateTestOutput("  pong \n"); got != "pong" {
+		t.Fatalf("truncateTestOutput() = %q, want %q", got, "pong")
+	}
+	// 截断位置落在多字节字符中间时向前退到字符边界
+	long := strings.Repeat("a", routeTestOutputMax-1) + "天气"
+	got := truncateTestOutput(long)
+	if got != strings.Repeat("a", routeTestOutputMax-1)+"..." {
+		t.Fatalf("truncateTestOutput() = %q, want the multi-byte rune dropped", got)
+	}
+}
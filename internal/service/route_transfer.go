@@ -0,0 +1,460 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"openai-router-go/internal/database"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// RouteExportVersion 路由导出文件的格式版本，文件结构有不兼容的变化时递增
+const RouteExportVersion = 1
+
+// 路由导入模式
+const (
+	RouteImportMerge   = "merge"   // 合并：更新同名路由，添加新路由，保留文件中没有的路由
+	RouteImportReplace = "replace" // 替换：在合并的基础上删除文件中没有的路由
+)
+
+// RouteExportFile 路由导出文件
+type RouteExportFile struct {
+	Version     int           `json:"version" yaml:"version"`
+	ExportedAt  time.Time     `json:"exported_at" yaml:"exported_at"`
+	IncludeKeys bool          `json:"include_keys" yaml:"include_keys"` // 为 false 时文件中不含 API Key，导入时保留已有路由的 Key
+	Routes      []RouteRecord `json:"routes" yaml:"routes"`
+}
+
+// RouteRecord 导出文件中的一条路由，以 name + model + group 识别同一条路由
+// 标识相同的多条路由按在文件中和数据库中（按 ID）的先后顺序一一对应
+type RouteRecord struct {
+	Name             string           `json:"name" yaml:"name"`
+	Model            string           `json:"model" yaml:"model"`
+	APIUrl           string           `json:"api_url" yaml:"api_url"`
+	APIKey           string           `json:"api_key,omitempty" yaml:"api_key,omitempty"`
+	Group            string           `json:"group" yaml:"group"`
+	Format           string           `json:"format" yaml:"format"`
+	Weight           int              `json:"weight,omitempty" yaml:"weight,omitempty"`
+	UpstreamModel    string           `json:"upstream_model,omitempty" yaml:"upstream_model,omitempty"`
+	Priority         int              `json:"priority,omitempty" yaml:"priority,omitempty"`
+	ExtraHeaders     string           `json:"extra_headers,omitempty" yaml:"extra_headers,omitempty"`
+	ExtraBody        string           `json:"extra_body,omitempty" yaml:"extra_body,omitempty"`
+	ConnectTimeout   int              `json:"connect_timeout,omitempty" yaml:"connect_timeout,omitempty"`
+	FirstByteTimeout int              `json:"first_byte_timeout,omitempty" yaml:"first_byte_timeout,omitempty"`
+	IdleTimeout      int              `json:"idle_timeout,omitempty" yaml:"idle_timeout,omitempty"`
+	OutboundProxy    string           `json:"outbound_proxy,omitempty" yaml:"outbound_proxy,omitempty"`
+	RPMLimit         int              `json:"rpm_limit,omitempty" yaml:"rpm_limit,omitempty"`
+	TPMLimit         int              `json:"tpm_limit,omitempty" yaml:"tpm_limit,omitempty"`
+	Capabilities     string           `json:"capabilities,omitempty" yaml:"capabilities,omitempty"`
+	Enabled          *bool            `json:"enabled,omitempty" yaml:"enabled,omitempty"` // 省略时视为启用
+	Keys             []RouteKeyRecord `json:"keys,omitempty" yaml:"keys,omitempty"`       // 附加 API Key，省略时导入不修改已有的附加 Key
+}
+
+// RouteKeyRecord 导出文件中路由的附加 API Key
+type RouteKeyRecord struct {
+	Name    string `json:"name,omitempty" yaml:"name,omitempty"`
+	APIKey  string `json:"api_key" yaml:"api_key"`
+	Enabled bool   `json:"enabled" yaml:"enabled"`
+}
+
+// RouteImportChange 导入时一条路由的变更
+type RouteImportChange struct {
+	ID     int64    `json:"id,omitempty"` // 已有路由的 ID，新增的路由为 0
+	Name   string   `json:"name"`
+	Model  string   `json:"model"`
+	Group  string   `json:"group"`
+	Fields []string `json:"fields,omitempty"` // 更新时发生变化的字段，不包含 Key 的值
+}
+
+// RouteImportResult 导入结果，dry run 时为将要执行的变更
+type RouteImportResult struct {
+	Mode      string              `json:"mode"`
+	DryRun    bool                `json:"dry_run"`
+	Added     []RouteImportChange `json:"added"`
+	Updated   []RouteImportChange `json:"updated"`
+	Deleted   []RouteImportChange `json:"deleted"`
+	Unchanged int                 `json:"unchanged"`
+	Warnings  []string            `json:"warnings"`
+	// 使用 file: / cmd: 引用作为 API Key 的路由，格式为 "路由名: 引用"；只有允许本机引用时才能导入
+	LocalSecretRefs []string `json:"local_secret_refs"`
+}
+
+// routeIdentity 识别同一条路由的键
+func routeIdentity(name, model, group string) string {
+	return name + "\x00" + model + "\x00" + group
+}
+
+// routeExportFile 读取全部路由生成导出文件
+// 文件中的 Key 为数据库中保存的值，由 ProxyService.ExportRoutes 按 includeKeys 解密或去除
+func (s *RouteService) routeExportFile(includeKeys bool) (*RouteExportFile, error) {
+	routes, err := s.queryRoutes(`SELECT ` + routeColumns + ` FROM model_routes ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &RouteExportFile{
+		Version:     RouteExportVersion,
+		ExportedAt:  time.Now(),
+		IncludeKeys: includeKeys,
+		Routes:      make([]RouteRecord, 0, len(routes)),
+	}
+	for _, route := range routes {
+		enabled := route.Enabled
+		record := RouteRecord{
+			Name: route.Name, Model: route.Model, APIUrl: route.APIUrl, Group: route.Group, Format: route.Format,
+			Weight: route.Weight, UpstreamModel: route.UpstreamModel, Priority: route.Priority,
+			ExtraHeaders: route.ExtraHeaders, ExtraBody: route.ExtraBody,
+			ConnectTimeout: route.ConnectTimeout, FirstByteTimeout: route.FirstByteTimeout, IdleTimeout: route.IdleTimeout,
+			OutboundProxy: route.OutboundProxy, RPMLimit: route.RPMLimit, TPMLimit: route.TPMLimit,
+			Capabilities: route.Capabilities, Enabled: &enabled,
+		}
+		record.APIKey = route.APIKey
+		keys, err := s.GetRouteKeys(route.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range keys {
+			record.Keys = append(record.Keys, RouteKeyRecord{Name: k.Name, APIKey: k.APIKey, Enabled: k.Enabled})
+		}
+		file.Routes = append(file.Routes, record)
+	}
+	return file, nil
+}
+
+// parseRouteFile 解析路由文件，自动识别 JSON 和 YAML
+// 兼容旧版界面导出的 JSON 数组（只有 name / model / api_url / api_key / group）
+func parseRouteFile(data []byte) (*RouteExportFile, error) {
+	data = bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))
+	if len(data) == 0 {
+		return nil, fmt.Errorf("route file is empty")
+	}
+
+	var file RouteExportFile
+	switch data[0] {
+	case '[':
+		if err := json.Unmarshal(data, &file.Routes); err != nil {
+			return nil, fmt.Errorf("invalid route file: %v", err)
+		}
+		file.Version = RouteExportVersion
+		file.IncludeKeys = true
+	case '{':
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("invalid route file: %v", err)
+		}
+	default:
+		if err := yaml.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("invalid route file: %v", err)
+		}
+	}
+
+	if file.Version == 0 {
+		return nil, fmt.Errorf("route file version is missing")
+	}
+	if file.Version > RouteExportVersion {
+		return nil, fmt.Errorf("route file version %d is newer than supported version %d", file.Version, RouteExportVersion)
+	}
+	return &file, nil
+}
+
+// localSecretRefs 返回路由 API Key 和附加 Key 中的 file: / cmd: 引用
+func (r *RouteRecord) localSecretRefs() []string {
+	var refs []string
+	if key := strings.TrimSpace(r.APIKey); isLocalSecretRef(key) {
+		refs = append(refs, key)
+	}
+	for _, k := range r.Keys {
+		if key := strings.TrimSpace(k.APIKey); isLocalSecretRef(key) {
+			refs = append(refs, key)
+		}
+	}
+	return refs
+}
+
+// toRoute 将文件中的路由转换为规范化后的路由配置
+// allowLocalRefs 为 false 时拒绝 file: / cmd: 引用：导入的文件可能来自他人，这类引用会在本机执行命令或把本机文件作为 Key 发往文件中的地址
+func (r *RouteRecord) toRoute(allowLocalRefs bool) (*database.ModelRoute, error) {
+	route := &database.ModelRoute{
+		Name: strings.TrimSpace(r.Name), Model: strings.TrimSpace(r.Model), APIUrl: strings.TrimSpace(r.APIUrl),
+		APIKey: strings.TrimSpace(r.APIKey), Group: strings.TrimSpace(r.Group), Format: r.Format,
+		Weight: r.Weight, UpstreamModel: r.UpstreamModel, Priority: r.Priority, ExtraHeaders: r.ExtraHeaders, ExtraBody: r.ExtraBody,
+		ConnectTimeout: r.ConnectTimeout, FirstByteTimeout: r.FirstByteTimeout, IdleTimeout: r.IdleTimeout,
+		OutboundProxy: r.OutboundProxy, RPMLimit: r.RPMLimit, TPMLimit: r.TPMLimit,
+		Capabilities: r.Capabilities, Enabled: r.Enabled == nil || *r.Enabled,
+	}
+	if route.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if route.APIUrl == "" {
+		return nil, fmt.Errorf("api_url is required")
+	}
+	for i, k := range r.Keys {
+		if strings.TrimSpace(k.APIKey) == "" {
+			return nil, fmt.Errorf("keys[%d]: api key is required", i)
+		}
+	}
+	if refs := r.localSecretRefs(); len(refs) > 0 && !allowLocalRefs {
+		return nil, fmt.Errorf("api key references %s read files or run commands on this machine; they can only be imported from the app after allowing them", strings.Join(refs, ", "))
+	}
+	if err := normalizeRoute(route); err != nil {
+		return nil, err
+	}
+	return route, nil
+}
+
+// changedRouteFields 比较已有路由和导入的路由，返回发生变化的字段
+// 导入的路由没有 Key 时保留已有的 Key，不算作变化
+func changedRouteFields(old, route *database.ModelRoute) []string {
+	var fields []string
+	check := func(name string, changed bool) {
+		if changed {
+			fields = append(fields, name)
+		}
+	}
+	check("api_url", old.APIUrl != route.APIUrl)
+	check("api_key", route.APIKey != "" && old.APIKey != route.APIKey)
+	check("format", old.Format != route.Format)
+	check("weight", old.Weight != route.Weight)
+	check("upstream_model", old.UpstreamModel != route.UpstreamModel)
+	check("priority", old.Priority != route.Priority)
+	check("extra_headers", old.ExtraHeaders != route.ExtraHeaders)
+	check("extra_body", old.ExtraBody != route.ExtraBody)
+	check("connect_timeout", old.ConnectTimeout != route.ConnectTimeout)
+	check("first_byte_timeout", old.FirstByteTimeout != route.FirstByteTimeout)
+	check("idle_timeout", old.IdleTimeout != route.IdleTimeout)
+	check("outbound_proxy", old.OutboundProxy != route.OutboundProxy)
+	check("rpm_limit", old.RPMLimit != route.RPMLimit)
+	check("tpm_limit", old.TPMLimit != route.TPMLimit)
+	check("capabilities", old.Capabilities != route.Capabilities)
+	check("enabled", old.Enabled != route.Enabled)
+	return fields
+}
+
+// sameRouteKeys 判断已有的附加 Key 与文件中的是否一致（按顺序比较）
+func (s *RouteService) sameRouteKeys(keys []database.RouteKey, records []RouteKeyRecord) bool {
+	if len(keys) != len(records) {
+		return false
+	}
+	for i, k := range keys {
+		r := records[i]
+		if k.Name != strings.TrimSpace(r.Name) || !s.keys.Matches(k.APIKey, strings.TrimSpace(r.APIKey)) || k.Enabled != r.Enabled {
+			return false
+		}
+	}
+	return true
+}
+
+// routeImportPlan 导入时对一条路由要执行的操作
+type routeImportPlan struct {
+	route *database.ModelRoute
+	keys  []RouteKeyRecord
+	sync  bool // 是否用 keys 替换已有的附加 Key
+}
+
+// ImportRoutes 从 JSON 或 YAML 文件导入路由，mode 为 merge 或 replace
+// 文件中的每条路由先全部校验，有错误时不做任何修改；dryRun 为 true 时只返回将要执行的变更
+// allowLocalRefs 为 false 时文件中出现 file: / cmd: 引用的 Key 视为错误
+// 所有修改在同一个事务中执行，任一步失败都会回滚
+func (s *RouteService) ImportRoutes(data []byte, mode string, dryRun, allowLocalRefs bool) (*RouteImportResult, error) {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	if mode == "" {
+		mode = RouteImportMerge
+	}
+	if mode != RouteImportMerge && mode != RouteImportReplace {
+		return nil, fmt.Errorf("unsupported import mode: %q (use merge or replace)", mode)
+	}
+
+	file, err := parseRouteFile(data)
+	if err != nil {
+		return nil, err
+	}
+	return s.importRouteFile(file, mode, dryRun, allowLocalRefs)
+}
+
+// importRouteFile 按导入模式比较文件中的路由和已有路由，并在非 dry run 时执行变更
+func (s *RouteService) importRouteFile(file *RouteExportFile, mode string, dryRun, allowLocalRefs bool) (*RouteImportResult, error) {
+	existing, err := s.queryRoutes(`SELECT ` + routeColumns + ` FROM model_routes ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	// 标识相同的已有路由按 ID 排列，文件中每出现一次该标识就取走下一条，导出的文件导入回来时一一对应
+	byIdentity := make(map[string][]*database.ModelRoute, len(existing))
+	for i := range existing {
+		id := routeIdentity(existing[i].Name, existing[i].Model, existing[i].Group)
+		byIdentity[id] = append(byIdentity[id], &existing[i])
+	}
+
+	result := &RouteImportResult{
+		Mode: mode, DryRun: dryRun,
+		Added: []RouteImportChange{}, Updated: []RouteImportChange{}, Deleted: []RouteImportChange{}, Warnings: []string{},
+		LocalSecretRefs: []string{},
+	}
+	var problems []string
+	var adds, updates []routeImportPlan
+	matched := make(map[int64]bool)
+
+	for i := range file.Routes {
+		record := &file.Routes[i]
+		route, err := record.toRoute(allowLocalRefs)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("routes[%d] (%s): %v", i, record.Name, err))
+			continue
+		}
+		for _, ref := range record.localSecretRefs() {
+			result.LocalSecretRefs = append(result.LocalSecretRefs, route.Name+": "+ref)
+		}
+		id := routeIdentity(route.Name, route.Model, route.Group)
+		change := RouteImportChange{Name: route.Name, Model: route.Model, Group: route.Group}
+
+		candidates := byIdentity[id]
+		if len(candidates) == 0 {
+			if route.APIKey == "" {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("route %s (%s) has no api key", route.Name, route.Model))
+			}
+			result.Added = append(result.Added, change)
+			adds = append(adds, routeImportPlan{route: route, keys: record.Keys, sync: len(record.Keys) > 0})
+			continue
+		}
+
+		old := candidates[0]
+		byIdentity[id] = candidates[1:]
+		matched[old.ID] = true
+		route.ID = old.ID
+		if route.APIKey == "" || s.keys.Matches(old.APIKey, route.APIKey) {
+			route.APIKey = old.APIKey
+		}
+		fields := changedRouteFields(old, route)
+		syncKeys := false
+		if record.Keys != nil {
+			keys, err := s.GetRouteKeys(old.ID)
+			if err != nil {
+				return nil, err
+			}
+			if !s.sameRouteKeys(keys, record.Keys) {
+				fields = append(fields, "keys")
+				syncKeys = true
+			}
+		}
+		if len(fields) == 0 {
+			result.Unchanged++
+			continue
+		}
+		change.ID = old.ID
+		change.Fields = fields
+		result.Updated = append(result.Updated, change)
+		updates = append(updates, routeImportPlan{route: route, keys: record.Keys, sync: syncKeys})
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid route file:\n%s", strings.Join(problems, "\n"))
+	}
+
+	if mode == RouteImportReplace {
+		for _, route := range existing {
+			if !matched[route.ID] {
+				result.Deleted = append(result.Deleted, RouteImportChange{ID: route.ID, Name: route.Name, Model: route.Model, Group: route.Group})
+			}
+		}
+	}
+
+	if dryRun || (len(adds) == 0 && len(updates) == 0 && len(result.Deleted) == 0) {
+		return result, nil
+	}
+	if err := s.applyRouteImport(adds, updates, result.Deleted); err != nil {
+		log.Errorf("Failed to import routes: %v", err)
+		return nil, err
+	}
+
+	log.Infof("Routes imported (%s): %d added, %d updated, %d deleted, %d unchanged",
+		mode, len(result.Added), len(result.Updated), len(result.Deleted), result.Unchanged)
+	return result, nil
+}
+
+// applyRouteImport 在事务中执行导入的变更
+func (s *RouteService) applyRouteImport(adds, updates []routeImportPlan, deletes []RouteImportChange) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, change := range deletes {
+		if err := deleteRouteRows(tx, change.ID); err != nil {
+			return err
+		}
+	}
+	for _, plan := range updates {
+		if err := s.updateRouteRow(tx, plan.route); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE model_routes SET enabled = ? WHERE id = ?`, plan.route.Enabled, plan.route.ID); err != nil {
+			return err
+		}
+		if plan.sync {
+			if err := s.replaceRouteKeys(tx, plan.route.ID, plan.keys); err != nil {
+				return err
+			}
+		}
+	}
+	for _, plan := range adds {
+		id, err := s.insertRoute(tx, plan.route)
+		if err != nil {
+			return err
+		}
+		if plan.sync {
+			if err := s.replaceRouteKeys(tx, id, plan.keys); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// replaceRouteKeys 用文件中的附加 Key 替换路由已有的附加 Key
+func (s *RouteService) replaceRouteKeys(db execer, routeID int64, keys []RouteKeyRecord) error {
+	if _, err := db.Exec(`DELETE FROM route_keys WHERE route_id = ?`, routeID); err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, k := range keys {
+		apiKey, err := s.keys.Encrypt(strings.TrimSpace(k.APIKey))
+		if err != nil {
+			return err
+		}
+		query := `INSERT INTO route_keys (route_id, name, api_key, enabled, created_at) VALUES (?, ?, ?, ?, ?)`
+		if _, err := db.Exec(query, routeID, strings.TrimSpace(k.Name), apiKey, k.Enabled, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ImportRoutes 导入路由，并清除被更新或删除的路由在内存中的熔断、健康、延迟、Key 轮换、限流和会话保持状态
+// allowLocalRefs 只应在用户于应用界面中明确允许时为 true，HTTP 管理接口始终为 false
+func (s *ProxyService) ImportRoutes(data []byte, mode string, dryRun, allowLocalRefs bool) (*RouteImportResult, error) {
+	result, err := s.routeService.ImportRoutes(data, mode, dryRun, allowLocalRefs)
+	if err != nil || dryRun {
+		return result, err
+	}
+	s.forgetImportedRoutes(result)
+	return result, nil
+}
+
+// forgetImportedRoutes 清除导入时被更新或删除的路由在内存中的状态
+func (s *ProxyService) forgetImportedRoutes(result *RouteImportResult) {
+	for _, changes := range [][]RouteImportChange{result.Updated, result.Deleted} {
+		for _, change := range changes {
+			s.ResetCircuitBreaker(change.ID)
+			s.ForgetRouteHealth(change.ID)
+			s.ForgetRouteLatency(change.ID)
+			s.ForgetRouteKeys(change.ID)
+			s.ForgetRouteRateLimit(change.ID)
+			s.ForgetRouteAffinity(change.ID)
+		}
+	}
+}
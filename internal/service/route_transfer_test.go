@@ -0,0 +1,281 @@
+package service
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"openai-router-go/internal/database"
+)
+
+// routeFile 生成版本 1 的 JSON 路由文件
+func routeFile(t *testing.T, records ...RouteRecord) []byte {
+	t.Helper()
+	data, err := json.Marshal(RouteExportFile{Version: RouteExportVersion, IncludeKeys: true, Routes: records})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func changeNames(changes []RouteImportChange) []string {
+	names := make([]string, 0, len(changes))
+	for _, change := range changes {
+		names = append(names, change.Name)
+	}
+	return names
+}
+
+func TestParseRouteFile(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       string
+		wantRoutes int
+		wantErr    string
+	}{
+		{"json", `{"version":1,"routes":[{"name":"a","model":"gpt-4o","api_url":"https://a"}]}`, 1, ""},
+		{"yaml", "version: 1\nroutes:\n  - name: a\n    model: gpt-4o\n    api_url: https://a\n  - name: b\n    model: gpt-4o\n    api_url: https://b\n", 2, ""},
+		{"legacy array", `[{"name":"a","model":"gpt-4o","api_url":"https://a","api_key":"sk"}]`, 1, ""},
+		{"byte order mark", "\xef\xbb\xbf {\"version\":1,\"routes\":[]}", 0, ""},
+		{"empty", "  \n", 0, "empty"},
+		{"missing version", `{"routes":[]}`, 0, "version is missing"},
+		{"newer version", `{"version":99,"routes":[]}`, 0, "newer than supported"},
+		{"invalid json", `{"version":1,`, 0, "invalid route file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := parseRouteFile([]byte(tt.data))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseRouteFile() = %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(file.Routes) != tt.wantRoutes {
+				t.Fatalf("routes = %d, want %d", len(file.Routes), tt.wantRoutes)
+			}
+		})
+	}
+
+	file, err := parseRouteFile([]byte(`[{"name":"a","model":"gpt-4o","api_url":"https://a"}]`))
+	if err != nil || !file.IncludeKeys || file.Version != RouteExportVersion {
+		t.Fatalf("legacy array = %+v, %v; want the current version with keys included", file, err)
+	}
+}
+
+func TestImportRoutesModes(t *testing.T) {
+	file := func(t *testing.T) []byte {
+		return routeFile(t,
+			RouteRecord{Name: "a", Model: "gpt-4o", APIUrl: "https://a.example.com", Weight: 5},
+			RouteRecord{Name: "c", Model: "gpt-4.1", APIUrl: "https://c.example.com", APIKey: "sk-c"},
+		)
+	}
+	setup := func(t *testing.T) (*RouteService, *database.ModelRoute, *database.ModelRoute) {
+		rs := newTestRouteService(t)
+		a := addTestRoute(t, rs, database.ModelRoute{Name: "a", Model: "gpt-4o", APIUrl: "https://a.example.com", APIKey: "sk-a"})
+		b := addTestRoute(t, rs, database.ModelRoute{Name: "b", Model: "gpt-4o", APIUrl: "https://b.example.com", APIKey: "sk-b"})
+		return rs, a, b
+	}
+
+	tests := []struct {
+		name        string
+		mode        string
+		dryRun      bool
+		wantDeleted []string
+		wantRoutes  int
+	}{
+		{"merge", "", false, nil, 3},
+		{"replace", "Replace", false, []string{"b"}, 2},
+		{"dry run", RouteImportReplace, true, []string{"b"}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs, a, _ := setup(t)
+			result, err := rs.ImportRoutes(file(t), tt.mode, tt.dryRun, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := changeNames(result.Added); len(got) != 1 || got[0] != "c" {
+				t.Fatalf("added = %v, want [c]", got)
+			}
+			if len(result.Updated) != 1 || result.Updated[0].ID != a.ID || strings.Join(result.Updated[0].Fields, ",") != "weight" {
+				t.Fatalf("updated = %+v, want route a with the weight changed", result.Updated)
+			}
+			if got := changeNames(result.Deleted); strings.Join(got, ",") != strings.Join(tt.wantDeleted, ",") {
+				t.Fatalf("deleted = %v, want %v", got, tt.wantDeleted)
+			}
+
+			routes, err := rs.GetAllRoutes()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.dryRun {
+				if len(routes) != 2 || routes[0].Weight == 5 {
+					t.Fatalf("dry run changed the routes: %+v", routes)
+				}
+				return
+			}
+			if len(routes) != tt.wantRoutes {
+				t.Fatalf("routes after import = %d, want %d", len(routes), tt.wantRoutes)
+			}
+			updated, err := rs.GetRouteByID(a.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// 文件中没有 Key 时保留已有的 Key
+			if updated.Weight != 5 || !rs.keys.Matches(updated.APIKey, "sk-a") {
+				t.Fatalf("route a after import: weight %d, key kept %v", updated.Weight, rs.keys.Matches(updated.APIKey, "sk-a"))
+			}
+		})
+	}
+}
+
+func TestImportRoutesRejectsInvalidFile(t *testing.T) {
+	rs := newTestRouteService(t)
+	addTestRoute(t, rs, database.ModelRoute{Name: "a", Model: "gpt-4o"})
+
+	data := routeFile(t,
+		RouteRecord{Name: "ok", Model: "gpt-4o", APIUrl: "https://ok.example.com"},
+		RouteRecord{Name: "", Model: "gpt-4o", APIUrl: "https://x.example.com"},
+		RouteRecord{Name: "no-url", Model: "gpt-4o"},
+		RouteRecord{Name: "empty-key", Model: "gpt-4o", APIUrl: "https://x.example.com", Keys: []RouteKeyRecord{{APIKey: " "}}},
+	)
+	_, err := rs.ImportRoutes(data, RouteImportReplace, false, false)
+	if err == nil {
+		t.Fatal("ImportRoutes() with invalid records should fail")
+	}
+	for _, want := range []string{"routes[1]", "routes[2] (no-url)", "routes[3] (empty-key)"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err, want)
+		}
+	}
+	if routes, _ := rs.GetAllRoutes(); len(routes) != 1 || routes[0].Name != "a" {
+		t.Fatalf("routes after a failed import = %+v, want them unchanged", routes)
+	}
+
+	if _, err := rs.ImportRoutes(routeFile(t), "append", false, false); err == nil {
+		t.Fatal("unknown import mode should be rejected")
+	}
+}
+
+func TestImportRoutesDuplicateIdentities(t *testing.T) {
+	rs := newTestRouteService(t)
+	first := addTestRoute(t, rs, database.ModelRoute{Name: "dup", Model: "gpt-4o", APIUrl: "https://one.example.com"})
+	second := addTestRoute(t, rs, database.ModelRoute{Name: "dup", Model: "gpt-4o", APIUrl: "https://two.example.com"})
+
+	// 标识相同的路由按顺序一一对应：第一条不变，第二条更新，第三条新增
+	data := routeFile(t,
+		RouteRecord{Name: "dup", Model: "gpt-4o", APIUrl: "https://one.example.com"},
+		RouteRecord{Name: "dup", Model: "gpt-4o", APIUrl: "https://changed.example.com"},
+		RouteRecord{Name: "dup", Model: "gpt-4o", APIUrl: "https://three.example.com"},
+	)
+	result, err := rs.ImportRoutes(data, RouteImportReplace, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Unchanged != 1 || len(result.Updated) != 1 || result.Updated[0].ID != second.ID || len(result.Added) != 1 || len(result.Deleted) != 0 {
+		t.Fatalf("result = %+v, want route %d unchanged, route %d updated and one added", result, first.ID, second.ID)
+	}
+
+	// 文件中少一条时删除多出的已有路由
+	data = routeFile(t, RouteRecord{Name: "dup", Model: "gpt-4o", APIUrl: "https://one.example.com"})
+	result, err = rs.ImportRoutes(data, RouteImportReplace, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Unchanged != 1 || len(result.Deleted) != 1 || result.Deleted[0].ID != second.ID {
+		t.Fatalf("result = %+v, want route %d deleted", result, second.ID)
+	}
+}
+
+func TestImportRouteKeys(t *testing.T) {
+	rs := newTestRouteService(t)
+	route := addTestRoute(t, rs, database.ModelRoute{Name: "a", Model: "gpt-4o", APIKey: "sk-a"})
+	if _, err := rs.AddRouteKey(route.ID, "extra", "sk-extra"); err != nil {
+		t.Fatal(err)
+	}
+
+	record := RouteRecord{Name: "a", Model: "gpt-4o", APIUrl: route.APIUrl, APIKey: "sk-a"}
+	// 省略 keys 时不修改附加 Key，内容相同的 keys 也不算变化
+	for _, keys := range [][]RouteKeyRecord{nil, {{Name: "extra", APIKey: "sk-extra", Enabled: true}}} {
+		record.Keys = keys
+		result, err := rs.ImportRoutes(routeFile(t, record), RouteImportMerge, false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Unchanged != 1 {
+			t.Fatalf("keys %v: result = %+v, want the route unchanged", keys, result)
+		}
+	}
+
+	record.Keys = []RouteKeyRecord{{Name: "new", APIKey: "sk-new", Enabled: false}, {APIKey: "sk-other", Enabled: true}}
+	result, err := rs.ImportRoutes(routeFile(t, record), RouteImportMerge, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Updated) != 1 || strings.Join(result.Updated[0].Fields, ",") != "keys" {
+		t.Fatalf("result = %+v, want only the keys updated", result)
+	}
+	keys, err := rs.GetRouteKeys(route.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0].Name != "new" || keys[0].Enabled || !rs.keys.Matches(keys[1].APIKey, "sk-other") {
+		t.Fatalf("keys after import = %+v, want them replaced in file order", keys)
+	}
+}
+
+func TestImportRoutesLocalSecretRefs(t *testing.T) {
+	rs := newTestRouteService(t)
+	data := routeFile(t,
+		RouteRecord{Name: "env", Model: "gpt-4o", APIUrl: "https://a.example.com", APIKey: "env:OPENAI_API_KEY"},
+		RouteRecord{Name: "cmd", Model: "gpt-4o", APIUrl: "https://b.example.com", Keys: []RouteKeyRecord{{APIKey: "cmd:pass show openai", Enabled: true}}},
+	)
+
+	_, err := rs.ImportRoutes(data, RouteImportMerge, true, false)
+	if err == nil || !strings.Contains(err.Error(), "cmd:pass show openai") || strings.Contains(err.Error(), "routes[0]") {
+		t.Fatalf("ImportRoutes() = %v, want only the cmd: reference rejected", err)
+	}
+
+	result, err := rs.ImportRoutes(data, RouteImportMerge, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.LocalSecretRefs) != 1 || result.LocalSecretRefs[0] != "cmd: cmd:pass show openai" {
+		t.Fatalf("local secret refs = %v, want the cmd: reference listed", result.LocalSecretRefs)
+	}
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	s := newTestProxyService(t)
+	route := addTestRoute(t, s.routeService, database.ModelRoute{
+		Name: "a", Model: "gpt-4o", APIKey: "sk-a", Group: "team", Priority: 2, RPMLimit: 60, UpstreamModel: "gpt-4o-2024-08-06",
+	})
+	addTestRoute(t, s.routeService, database.ModelRoute{Name: "a", Model: "gpt-4o", APIKey: "sk-a2", Group: "team"})
+	addTestRoute(t, s.routeService, database.ModelRoute{Name: "ref", Model: "claude-*", APIKey: "env:ANTHROPIC_API_KEY"})
+	if _, err := s.routeService.AddRouteKey(route.ID, "extra", "sk-extra"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []string{"json", "yaml"} {
+		for _, includeKeys := range []bool{true, false} {
+			data, err := s.ExportRoutes(format, includeKeys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !includeKeys && (strings.Contains(string(data), "sk-") || !strings.Contains(string(data), "env:ANTHROPIC_API_KEY")) {
+				t.Fatalf("%s export without keys should keep only secret references:\n%s", format, data)
+			}
+			result, err := s.ImportRoutes(data, RouteImportReplace, false, false)
+			if err != nil {
+				t.Fatalf("%s (keys %v): %v", format, includeKeys, err)
+			}
+			if result.Unchanged != 3 || len(result.Added)+len(result.Updated)+len(result.Deleted) != 0 {
+				t.Fatalf("%s (keys %v): re-importing an export = %+v, want everything unchanged", format, includeKeys, result)
+			}
+		}
+	}
+}
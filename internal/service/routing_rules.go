@@ -0,0 +1,250 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"openai-router-go/internal/config"
+)
+
+// requestFeatures 从请求中提取的、供内容路由规则匹配的特征
+type requestFeatures struct {
+	InputTokens  int // 估算的输入 token 数
+	HasTools     bool
+	HasImages    bool
+	Stream       bool
+	SystemPrompt string
+}
+
+// 参与输入 token 估算的请求字段（兼容 OpenAI / Claude / Gemini 格式）
+var inputFields = []string{"messages", "contents", "system", "systemInstruction", "system_instruction", "tools", "functions", "prompt", "input"}
+
+// 不计入输入 token 的结构性字段
+var structuralKeys = map[string]bool{
+	"type": true, "role": true, "id": true, "tool_use_id": true, "tool_call_id": true,
+	"mimeType": true, "mime_type": true, "media_type": true, "cache_control": true,
+}
+
+// inspectRequest 提取请求特征，stream 为调用入口是否为流式接口（Gemini 流式请求体中没有 stream 字段）
+func inspectRequest(reqData map[string]interface{}, stream bool) requestFeatures {
+	features := requestFeatures{Stream: stream}
+	if streamFlag, ok := reqData["stream"].(bool); ok && streamFlag {
+		features.Stream = true
+	}
+
+	var ascii, other int
+	for _, field := range inputFields {
+		if value, ok := reqData[field]; ok {
+			countText(value, &ascii, &other, &features.HasImages)
+		}
+	}
+	// 英文约 4 个字符一个 token，中日韩等字符约一个字符一个 token
+	features.InputTokens = (ascii+3)/4 + other
+
+	features.HasTools = nonEmptyList(reqData["tools"]) || nonEmptyList(reqData["functions"])
+	features.SystemPrompt = extractSystemPrompt(reqData)
+	return features
+}
+
+// countText 递归统计文本字符数，遇到图片内容时只做标记不计数
+func countText(value interface{}, ascii, other *int, hasImages *bool) {
+	switch v := value.(type) {
+	case string:
+		for _, r := range v {
+			if r < utf8.RuneSelf {
+				*ascii++
+			} else {
+				*other++
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			countText(item, ascii, other, hasImages)
+		}
+	case map[string]interface{}:
+		if isImagePart(v) {
+			*hasImages = true
+			return
+		}
+		for key, item := range v {
+			if !structuralKeys[key] {
+				countText(item, ascii, other, hasImages)
+			}
+		}
+	}
+}
+
+// isImagePart 判断内容块是否为图片（OpenAI image_url / Claude image / Gemini inlineData）
+func isImagePart(part map[string]interface{}) bool {
+	switch part["type"] {
+	case "image", "image_url", "input_image":
+		return true
+	}
+	for _, key := range []string{"inlineData", "inline_data", "fileData", "file_data"} {
+		if data, ok := part[key].(map[string]interface{}); ok {
+			mimeType, _ := data["mimeType"].(string)
+			if mimeType == "" {
+				mimeType, _ = data["mime_type"].(string)
+			}
+			if strings.HasPrefix(mimeType, "image/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// nonEmptyList 判断值是否为非空数组
+func nonEmptyList(value interface{}) bool {
+	list, ok := value.([]interface{})
+	return ok && len(list) > 0
+}
+
+// extractSystemPrompt 提取系统提示词：OpenAI 的 system/developer 消息、Claude 的 system 字段、Gemini 的 systemInstruction
+func extractSystemPrompt(reqData map[string]interface{}) string {
+	var parts []string
+	if messages, ok := reqData["messages"].([]interface{}); ok {
+		for _, item := range messages {
+			msg, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if role, _ := msg["role"].(string); role == "system" || role == "developer" {
+				parts = append(parts, collectText(msg["content"])...)
+			}
+		}
+	}
+	for _, field := range []string{"system", "systemInstruction", "system_instruction"} {
+		if value, ok := reqData[field]; ok {
+			parts = append(parts, collectText(value)...)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// collectText 收集内容中的文本（字符串或 text 字段）
+func collectText(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var texts []string
+		for _, item := range v {
+			texts = append(texts, collectText(item)...)
+		}
+		return texts
+	case map[string]interface{}:
+		if text, ok := v["text"].(string); ok {
+			return []string{text}
+		}
+		if parts, ok := v["parts"]; ok {
+			return collectText(parts)
+		}
+	}
+	return nil
+}
+
+// matchRoutingRule 判断请求是否满足规则的所有条件
+func (s *ProxyService) matchRoutingRule(rule config.RoutingRule, model string, features requestFeatures) bool {
+	if len(rule.Models) > 0 && !s.matchRuleModel(rule.Models, model) {
+		return false
+	}
+	if rule.MinInputTokens > 0 && features.InputTokens < rule.MinInputTokens {
+		return false
+	}
+	if rule.MaxInputTokens > 0 && features.InputTokens > rule.MaxInputTokens {
+		return false
+	}
+	if rule.HasTools != nil && *rule.HasTools != features.HasTools {
+		return false
+	}
+	if rule.HasImages != nil && *rule.HasImages != features.HasImages {
+		return false
+	}
+	if rule.Stream != nil && *rule.Stream != features.Stream {
+		return false
+	}
+	if rule.SystemContains != "" &&
+		!strings.Contains(strings.ToLower(features.SystemPrompt), strings.ToLower(rule.SystemContains)) {
+		return false
+	}
+	return true
+}
+
+// matchRuleModel 判断模型是否在规则的适用范围内，支持通配符和正则
+func (s *ProxyService) matchRuleModel(patterns []string, model string) bool {
+	for _, pattern := range patterns {
+		if pattern == model {
+			return true
+		}
+		if !IsModelPattern(pattern) {
+			continue
+		}
+		if re, err := s.routeService.patterns.compile(pattern); err == nil && re.MatchString(model) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchRoutingRules 按顺序查找第一条命中的内容路由规则
+func (s *ProxyService) matchRoutingRules(model string, features requestFeatures) (config.RoutingRule, bool) {
+	// 规则表修改时整体替换，这里只在锁内取出当前的切片
+	s.configMu.RLock()
+	rules := s.config.RoutingRules
+	s.configMu.RUnlock()
+	if len(rules) == 0 {
+		return config.RoutingRule{}, false
+	}
+
+	for _, rule := range rules {
+		if rule.Enabled && s.matchRoutingRule(rule, model, features) {
+			return rule, true
+		}
+	}
+	return config.RoutingRule{}, false
+}
+
+// SetRoutingRules 校验并保存内容路由规则，规则按数组顺序匹配
+func (s *ProxyService) SetRoutingRules(rules []config.RoutingRule) error {
+	seen := make(map[string]bool)
+	cleaned := make([]config.RoutingRule, 0, len(rules))
+	for _, rule := range rules {
+		rule.Name = strings.TrimSpace(rule.Name)
+		rule.TargetModel = strings.TrimSpace(rule.TargetModel)
+		if rule.Name == "" {
+			return fmt.Errorf("routing rule name is required")
+		}
+		if seen[rule.Name] {
+			return fmt.Errorf("duplicate routing rule name: %s", rule.Name)
+		}
+		if rule.TargetModel == "" && rule.TargetRouteID <= 0 {
+			return fmt.Errorf("routing rule %s has no target", rule.Name)
+		}
+		if rule.MinInputTokens < 0 || rule.MaxInputTokens < 0 ||
+			(rule.MaxInputTokens > 0 && rule.MinInputTokens > rule.MaxInputTokens) {
+			return fmt.Errorf("routing rule %s has an invalid token range", rule.Name)
+		}
+		for _, pattern := range rule.Models {
+			if err := ValidateModelPattern(pattern); err != nil {
+				return fmt.Errorf("routing rule %s: %v", rule.Name, err)
+			}
+		}
+		seen[rule.Name] = true
+		cleaned = append(cleaned, rule)
+	}
+
+	return s.UpdateConfig(func(cfg *config.Config) {
+		cfg.RoutingRules = cleaned
+	})
+}
+
+// GetRoutingRules 获取内容路由规则的副本（按匹配顺序）
+func (s *ProxyService) GetRoutingRules() []config.RoutingRule {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	rules := make([]config.RoutingRule, len(s.config.RoutingRules))
+	copy(rules, s.config.RoutingRules)
+	return rules
+}
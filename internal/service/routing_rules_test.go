@@ -0,0 +1,230 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"openai-router-go/internal/config"
+	"openai-router-go/internal/database"
+)
+
+func boolPtr(v bool) *bool {
+	return &v
+}
+
+func decodeRequest(t *testing.T, body string) map[string]interface{} {
+	t.Helper()
+	var reqData map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &reqData); err != nil {
+		t.Fatal(err)
+	}
+	return reqData
+}
+
+func TestInspectRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		stream bool
+		want   requestFeatures
+	}{
+		{
+			name: "openai messages",
+			body: `{"model":"gpt-4o","messages":[{"role":"system","content":"Be brief."},{"role":"user","content":"12345678"}]}`,
+			want: requestFeatures{InputTokens: 5, SystemPrompt: "Be brief."},
+		},
+		{
+			name: "cjk characters count one token each",
+			body: `{"messages":[{"role":"user","content":"你好世界"}]}`,
+			want: requestFeatures{InputTokens: 4},
+		},
+		{
+			name: "tools and stream flag",
+			body: `{"stream":true,"messages":[],"tools":[{"type":"function","function":{"name":"f"}}]}`,
+			want: requestFeatures{InputTokens: 1, HasTools: true, Stream: true},
+		},
+		{
+			name: "empty tools list",
+			body: `{"messages":[],"tools":[]}`,
+			want: requestFeatures{},
+		},
+		{
+			name: "openai image part is not counted",
+			body: `{"messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"data:image/png;base64,AAAA"}}]}]}`,
+			want: requestFeatures{HasImages: true},
+		},
+		{
+			name:   "gemini inline image and system instruction",
+			body:   `{"systemInstruction":{"parts":[{"text":"Sys"}]},"contents":[{"parts":[{"inlineData":{"mimeType":"image/jpeg","data":"AAAA"}}]}]}`,
+			stream: true,
+			want:   requestFeatures{InputTokens: 1, HasImages: true, Stream: true, SystemPrompt: "Sys"},
+		},
+		{
+			name: "claude system field",
+			body: `{"system":[{"type":"text","text":"You are a reviewer"}],"messages":[]}`,
+			want: requestFeatures{InputTokens: 5, SystemPrompt: "You are a reviewer"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := inspectRequest(decodeRequest(t, tt.body), tt.stream); got != tt.want {
+				t.Fatalf("inspectRequest() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchRoutingRule(t *testing.T) {
+	s := newTestProxyService(t)
+	features := requestFeatures{InputTokens: 500, HasTools: true, SystemPrompt: "You are a Code Reviewer."}
+
+	tests := []struct {
+		name string
+		rule config.RoutingRule
+		want bool
+	}{
+		{"no conditions", config.RoutingRule{}, true},
+		{"exact model", config.RoutingRule{Models: []string{"gpt-4o"}}, true},
+		{"wildcard model", config.RoutingRule{Models: []string{"claude-*", "gpt-*"}}, true},
+		{"regex model", config.RoutingRule{Models: []string{"^gpt-4.*$"}}, true},
+		{"other model", config.RoutingRule{Models: []string{"gpt-4o-mini"}}, false},
+		{"token range", config.RoutingRule{MinInputTokens: 500, MaxInputTokens: 500}, true},
+		{"below minimum", config.RoutingRule{MinInputTokens: 501}, false},
+		{"above maximum", config.RoutingRule{MaxInputTokens: 499}, false},
+		{"tools required", config.RoutingRule{HasTools: boolPtr(true)}, true},
+		{"tools forbidden", config.RoutingRule{HasTools: boolPtr(false)}, false},
+		{"images required", config.RoutingRule{HasImages: boolPtr(true)}, false},
+		{"non-stream only", config.RoutingRule{Stream: boolPtr(false)}, true},
+		{"system prompt ignores case", config.RoutingRule{SystemContains: "code reviewer"}, true},
+		{"system prompt missing", config.RoutingRule{SystemContains: "translator"}, false},
+		{"all conditions must match", config.RoutingRule{Models: []string{"gpt-*"}, HasTools: boolPtr(true), Stream: boolPtr(true)}, false},
+	}
+	for _, tt := range tests {
+		if got := s.matchRoutingRule(tt.rule, "gpt-4o", features); got != tt.want {
+			t.Errorf("%s: matchRoutingRule() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMatchRoutingRulesOrder(t *testing.T) {
+	s := newTestProxyService(t)
+	s.config.RoutingRules = []config.RoutingRule{
+		{Name: "disabled", Enabled: false, TargetModel: "a"},
+		{Name: "long context", Enabled: true, MinInputTokens: 1000, TargetModel: "b"},
+		{Name: "tools", Enabled: true, HasTools: boolPtr(true), TargetModel: "c"},
+		{Name: "catch all", Enabled: true, TargetModel: "d"},
+	}
+
+	tests := []struct {
+		features requestFeatures
+		want     string
+	}{
+		{requestFeatures{InputTokens: 2000, HasTools: true}, "long context"},
+		{requestFeatures{InputTokens: 10, HasTools: true}, "tools"},
+		{requestFeatures{InputTokens: 10}, "catch all"},
+	}
+	for _, tt := range tests {
+		rule, ok := s.matchRoutingRules("gpt-4o", tt.features)
+		if !ok || rule.Name != tt.want {
+			t.Errorf("matchRoutingRules(%+v) = %q, %v; want %q", tt.features, rule.Name, ok, tt.want)
+		}
+	}
+
+	s.config.RoutingRules = nil
+	if rule, ok := s.matchRoutingRules("gpt-4o", requestFeatures{}); ok {
+		t.Fatalf("matchRoutingRules() without rules = %+v, want no match", rule)
+	}
+}
+
+func TestSetRoutingRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    config.RoutingRule
+		wantErr string
+	}{
+		{"trims name and target", config.RoutingRule{Name: " tools ", TargetModel: " gpt-4o "}, ""},
+		{"target route only", config.RoutingRule{Name: "pinned", TargetRouteID: 1}, ""},
+		{"empty name", config.RoutingRule{Name: " ", TargetModel: "gpt-4o"}, "name is required"},
+		{"no target", config.RoutingRule{Name: "r"}, "has no target"},
+		{"negative tokens", config.RoutingRule{Name: "r", TargetModel: "a", MinInputTokens: -1}, "invalid token range"},
+		{"inverted token range", config.RoutingRule{Name: "r", TargetModel: "a", MinInputTokens: 10, MaxInputTokens: 5}, "invalid token range"},
+		{"invalid model regex", config.RoutingRule{Name: "r", TargetModel: "a", Models: []string{"^gpt-(4"}}, "invalid model regex"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestProxyService(t)
+			err := s.SetRoutingRules([]config.RoutingRule{tt.rule})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("SetRoutingRules() = %v, want an error containing %q", err, tt.wantErr)
+				}
+				if rules := s.GetRoutingRules(); len(rules) != 0 {
+					t.Fatalf("rules after a rejected update = %+v, want none", rules)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			rules := s.GetRoutingRules()
+			if len(rules) != 1 || rules[0].Name != strings.TrimSpace(tt.rule.Name) || rules[0].TargetModel != strings.TrimSpace(tt.rule.TargetModel) {
+				t.Fatalf("rules = %+v, want the trimmed rule", rules)
+			}
+		})
+	}
+
+	s := newTestProxyService(t)
+	err := s.SetRoutingRules([]config.RoutingRule{{Name: "r", TargetModel: "a"}, {Name: "r", TargetModel: "b"}})
+	if err == nil || !strings.Contains(err.Error(), "duplicate") {
+		t.Fatalf("SetRoutingRules() with duplicate names = %v, want an error", err)
+	}
+}
+
+func TestResolveRequestRouteRoutingRules(t *testing.T) {
+	s := newTestProxyService(t)
+	addTestRoute(t, s.routeService, database.ModelRoute{Name: "default", Model: "gpt-4o"})
+	long := addTestRoute(t, s.routeService, database.ModelRoute{Name: "long", Model: "gpt-4.1"})
+	vision := addTestRoute(t, s.routeService, database.ModelRoute{Name: "vision", Model: "gemini-*"})
+	s.config.RoutingRules = []config.RoutingRule{
+		{Name: "long context", Enabled: true, Models: []string{"gpt-4o"}, MinInputTokens: 100, TargetModel: "gpt-4.1"},
+		{Name: "images", Enabled: true, HasImages: boolPtr(true), TargetModel: "gemini-2.5-pro"},
+	}
+
+	tests := []struct {
+		name      string
+		body      string
+		wantRoute int64
+		wantModel string
+		wantRule  string
+	}{
+		{"no rule matches", `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`, 0, "gpt-4o", ""},
+		{
+			name:      "long prompt",
+			body:      `{"model":"gpt-4o","messages":[{"role":"user","content":"` + strings.Repeat("word ", 100) + `"}]}`,
+			wantRoute: long.ID, wantModel: "gpt-4.1", wantRule: "long context",
+		},
+		{
+			name:      "image to a wildcard route",
+			body:      `{"model":"gpt-4o","messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"https://example.com/a.png"}}]}]}`,
+			wantRoute: vision.ID, wantModel: "gemini-2.5-pro", wantRule: "images",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reqData := decodeRequest(t, tt.body)
+			trace := s.traceRequest(context.Background(), nil)
+			route, model, err := s.resolveRequestRoute("gpt-4o", nil, reqData, false, trace)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantRoute != 0 && route.ID != tt.wantRoute {
+				t.Fatalf("route = %s (id=%d), want id %d", route.Name, route.ID, tt.wantRoute)
+			}
+			if model != tt.wantModel || reqData["model"] != tt.wantModel || trace.rule != tt.wantRule {
+				t.Fatalf("model = %q, body model %v, rule %q; want %q and rule %q", model, reqData["model"], trace.rule, tt.wantModel, tt.wantRule)
+			}
+		})
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+// +build !windows
+
+package service
+
+import (
+	"context"
+	"os/exec"
+)
+
+// shellCommand 通过 /bin/sh 执行密钥命令
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	return exec.CommandContext(ctx, "/bin/sh", "-c", command)
+}
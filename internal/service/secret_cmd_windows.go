@@ -0,0 +1,17 @@
+//go:build windows
+// +build windows
+
+package service
+
+import (
+	"context"
+	"os/exec"
+	"syscall"
+)
+
+// shellCommand 通过 cmd.exe 执行密钥命令，不弹出控制台窗口
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "cmd", "/C", command)
+	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
+	return cmd
+}
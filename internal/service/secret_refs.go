@@ -0,0 +1,178 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"openai-router-go/internal/database"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// DefaultSecretCacheTTL 密钥引用解析结果的缓存时间，过期后重新读取，轮换 Key 后无需修改路由
+const DefaultSecretCacheTTL = time.Minute
+
+// secretFailureTTL 解析失败的缓存时间，避免引用失效时每个请求都重新执行命令或读取文件
+const secretFailureTTL = 5 * time.Second
+
+// secretCommandTimeout cmd: 引用执行命令的超时时间
+const secretCommandTimeout = 10 * time.Second
+
+// localSecretRefPrefixes 会在本机执行命令或读取文件的引用前缀，只允许在应用中手动添加，导入时需要用户明确允许
+var localSecretRefPrefixes = []string{"file:", "cmd:"}
+
+// isLocalSecretRef 判断值是否为 file: 或 cmd: 引用
+func isLocalSecretRef(value string) bool {
+	for _, prefix := range localSecretRefPrefixes {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// secretEntry 缓存的解析结果及过期时间，err 不为空时表示解析失败
+type secretEntry struct {
+	value   string
+	err     error
+	expires time.Time
+}
+
+// SecretResolver 将路由 API Key 中的密钥引用解析为真正的 Key
+// 支持 env:变量名、file:文件路径 和 cmd:命令（取标准输出），解析成功的结果缓存 ttl 时间，失败的结果缓存 secretFailureTTL
+// 同一引用的并发解析合并为一次
+type SecretResolver struct {
+	mu      sync.Mutex
+	entries map[string]secretEntry
+	ttl     time.Duration
+	group   singleflight.Group
+}
+
+// NewSecretResolver 创建密钥引用解析器
+func NewSecretResolver(ttl time.Duration) *SecretResolver {
+	if ttl <= 0 {
+		ttl = DefaultSecretCacheTTL
+	}
+	return &SecretResolver{entries: make(map[string]secretEntry), ttl: ttl}
+}
+
+// Resolve 解析密钥引用；不是引用的值原样返回
+func (r *SecretResolver) Resolve(value string) (string, error) {
+	if !database.IsSecretRef(value) {
+		return value, nil
+	}
+
+	r.mu.Lock()
+	entry, ok := r.entries[value]
+	r.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.value, entry.err
+	}
+
+	// 命令可能较慢，解析时不持有锁，同一引用的并发请求等待同一次解析的结果
+	secret, err, _ := r.group.Do(value, func() (interface{}, error) {
+		secret, err := lookupSecretRef(value)
+		r.store(value, secretEntry{value: secret, err: err})
+		return secret, err
+	})
+	if err != nil {
+		return "", err
+	}
+	return secret.(string), nil
+}
+
+// store 缓存解析结果，并顺便清理过期的缓存
+func (r *SecretResolver) store(ref string, entry secretEntry) {
+	now := time.Now()
+	ttl := r.ttl
+	if entry.err != nil {
+		ttl = secretFailureTTL
+	}
+	entry.expires = now.Add(ttl)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key, e := range r.entries {
+		if now.After(e.expires) {
+			delete(r.entries, key)
+		}
+	}
+	r.entries[ref] = entry
+}
+
+// Clear 清空缓存，下次请求时重新解析所有引用
+func (r *SecretResolver) Clear() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = make(map[string]secretEntry)
+}
+
+// lookupSecretRef 读取引用指向的 Key，结果为空时视为错误
+func lookupSecretRef(ref string) (string, error) {
+	kind, target, _ := strings.Cut(ref, ":")
+	target = strings.TrimSpace(target)
+	if target == "" {
+		return "", fmt.Errorf("secret reference %q is empty", ref)
+	}
+
+	var secret string
+	switch kind {
+	case "env":
+		value, ok := os.LookupEnv(target)
+		if !ok {
+			return "", fmt.Errorf("secret reference %q: environment variable %s is not set", ref, target)
+		}
+		secret = value
+	case "file":
+		data, err := os.ReadFile(target)
+		if err != nil {
+			return "", fmt.Errorf("secret reference %q: %v", ref, err)
+		}
+		secret = string(data)
+	case "cmd":
+		out, err := runSecretCommand(target)
+		if err != nil {
+			return "", fmt.Errorf("secret reference %q: %v", ref, err)
+		}
+		secret = out
+	default:
+		return "", fmt.Errorf("unsupported secret reference %q", ref)
+	}
+
+	// 只取第一行，兼容 pass 等工具在密码后输出的附加信息
+	secret, _, _ = strings.Cut(strings.TrimSpace(secret), "\n")
+	secret = strings.TrimSpace(secret)
+	if secret == "" {
+		return "", fmt.Errorf("secret reference %q resolved to an empty value", ref)
+	}
+	return secret, nil
+}
+
+// runSecretCommand 通过系统 shell 执行命令并返回标准输出，失败时附带标准错误的内容
+func runSecretCommand(command string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), secretCommandTimeout)
+	defer cancel()
+
+	cmd := shellCommand(ctx, command)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", fmt.Errorf("command timed out after %s", secretCommandTimeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			if len(msg) > 200 {
+				msg = msg[:200] + "..."
+			}
+			return "", fmt.Errorf("command failed: %v: %s", err, msg)
+		}
+		return "", fmt.Errorf("command failed: %v", err)
+	}
+	return stdout.String(), nil
+}
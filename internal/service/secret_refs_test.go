@@ -0,0 +1,62 @@
+package service
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestSecretResolverCachesValues(t *testing.T) {
+	t.Setenv("ROUTER_TEST_SECRET", "sk-first")
+	r := NewSecretResolver(0)
+
+	if got, err := r.Resolve("env:ROUTER_TEST_SECRET"); err != nil || got != "sk-first" {
+		t.Fatalf("Resolve() = %q, %v; want sk-first", got, err)
+	}
+	t.Setenv("ROUTER_TEST_SECRET", "sk-second")
+	if got, _ := r.Resolve("env:ROUTER_TEST_SECRET"); got != "sk-first" {
+		t.Fatalf("Resolve() within the TTL = %q, want the cached sk-first", got)
+	}
+
+	r.Clear()
+	if got, _ := r.Resolve("env:ROUTER_TEST_SECRET"); got != "sk-second" {
+		t.Fatalf("Resolve() after Clear() = %q, want sk-second", got)
+	}
+	if got, err := r.Resolve("sk-plain"); err != nil || got != "sk-plain" {
+		t.Fatalf("Resolve() of a plain key = %q, %v; want it unchanged", got, err)
+	}
+}
+
+func TestSecretResolverCachesFailures(t *testing.T) {
+	r := NewSecretResolver(0)
+	if _, err := r.Resolve("env:ROUTER_TEST_MISSING"); err == nil {
+		t.Fatal("Resolve() of an unset variable should fail")
+	}
+
+	// 失败结果在短时间内直接返回，不会重新读取
+	t.Setenv("ROUTER_TEST_MISSING", "sk-late")
+	if _, err := r.Resolve("env:ROUTER_TEST_MISSING"); err == nil {
+		t.Fatal("Resolve() should return the cached failure")
+	}
+
+	r.Clear()
+	if got, err := r.Resolve("env:ROUTER_TEST_MISSING"); err != nil || got != "sk-late" {
+		t.Fatalf("Resolve() after Clear() = %q, %v; want sk-late", got, err)
+	}
+}
+
+func TestSecretResolverConcurrentResolve(t *testing.T) {
+	t.Setenv("ROUTER_TEST_SECRET", "sk-shared")
+	r := NewSecretResolver(0)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got, err := r.Resolve("env:ROUTER_TEST_SECRET"); err != nil || got != "sk-shared" {
+				t.Errorf("Resolve() = %q, %v; want sk-shared", got, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
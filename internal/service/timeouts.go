@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"openai-router-go/internal/database"
+)
+
+// 上游超时的错误类型，记录在 request_logs.error_type 中
+const (
+	ErrorTypeConnectTimeout   = "connect_timeout"    // 建立 TCP 连接超时
+	ErrorTypeFirstByteTimeout = "first_byte_timeout" // 发出请求后等待响应头超时
+	ErrorTypeIdleTimeout      = "idle_timeout"       // 响应体两次数据之间（如 SSE 分块之间）的间隔超时
+)
+
+// timeoutError 上游超时错误，kind 为上面的错误类型之一
+type timeoutError struct {
+	kind  string
+	after time.Duration
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("upstream %s after %v", e.kind, e.after)
+}
+
+// Timeout 实现 net.Error 的超时判断
+func (e *timeoutError) Timeout() bool {
+	return true
+}
+
+// connectTimeoutKey 请求 context 中保存连接超时的键，由传输层的 DialContext 读取
+type connectTimeoutKey struct{}
+
+// newUpstreamTransport 创建上游请求使用的传输层，连接超时按请求 context 中的路由配置生效
+func newUpstreamTransport() *http.Transport {
+	dialer := &net.Dialer{KeepAlive: 30 * time.Second}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		timeout, _ := ctx.Value(connectTimeoutKey{}).(time.Duration)
+		if timeout <= 0 {
+			return dialer.DialContext(ctx, network, addr)
+		}
+		dialCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		conn, err := dialer.DialContext(dialCtx, network, addr)
+		if err != nil && errors.Is(dialCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+			return nil, &timeoutError{kind: ErrorTypeConnectTimeout, after: timeout}
+		}
+		return conn, err
+	}
+	return transport
+}
+
+// secondsToDuration 将路由配置的秒数转换为时长，0 或负数表示不限制
+func secondsToDuration(seconds int) time.Duration {
+	if seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// normalizeTimeout 超时秒数不能为负，负数按不限制处理
+func normalizeTimeout(seconds int) int {
+	if seconds < 0 {
+		return 0
+	}
+	return seconds
+}
+
+// upstreamDeadline 单次上游尝试的超时控制
+// 首字节计时从发出请求开始，收到响应头时停止；空闲计时从收到响应头开始，每读到一次数据重新计时
+// 任一计时到期都会取消请求的 context，使阻塞中的连接或读取立即返回
+type upstreamDeadline struct {
+	firstByte time.Duration
+	idle      time.Duration
+	cancel    context.CancelFunc
+
+	mu        sync.Mutex
+	timer     *time.Timer
+	expired   *timeoutError
+	closed    bool
+	idleTimer *time.Timer
+}
+
+// withRouteTimeouts 为上游请求挂上路由配置的连接、首字节和空闲超时
+func withRouteTimeouts(req *http.Request, route *database.ModelRoute) (*http.Request, *upstreamDeadline) {
+	ctx := req.Context()
+	if connect := secondsToDuration(route.ConnectTimeout); connect > 0 {
+		ctx = context.WithValue(ctx, connectTimeoutKey{}, connect)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+
+	d := &upstreamDeadline{
+		firstByte: secondsToDuration(route.FirstByteTimeout),
+		idle:      secondsToDuration(route.IdleTimeout),
+		cancel:    cancel,
+	}
+	if d.firstByte > 0 {
+		d.timer = time.AfterFunc(d.firstByte, func() { d.expire(ErrorTypeFirstByteTimeout, d.firstByte) })
+	}
+	return req.WithContext(ctx), d
+}
+
+// expire 记录超时原因并取消请求，只记录第一次
+func (d *upstreamDeadline) expire(kind string, after time.Duration) {
+	d.mu.Lock()
+	if d.expired == nil && !d.closed {
+		d.expired = &timeoutError{kind: kind, after: after}
+	}
+	d.mu.Unlock()
+	d.cancel()
+}
+
+// err 已经发生的超时，没有超时时返回 nil
+func (d *upstreamDeadline) err() *timeoutError {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.expired
+}
+
+// responded 收到响应头（或请求失败）时调用：停止首字节计时并开始空闲计时
+// 请求因超时失败时返回对应的 timeoutError
+func (d *upstreamDeadline) responded(err error) error {
+	d.mu.Lock()
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	if err == nil && d.idle > 0 {
+		d.idleTimer = time.AfterFunc(d.idle, func() { d.expire(ErrorTypeIdleTimeout, d.idle) })
+	}
+	d.mu.Unlock()
+
+	if err == nil {
+		return nil
+	}
+	d.close()
+
+	var te *timeoutError
+	if errors.As(err, &te) {
+		return te
+	}
+	if expired := d.err(); expired != nil {
+		return expired
+	}
+	return err
+}
+
+// received 读到响应数据时重新开始空闲计时
+func (d *upstreamDeadline) received() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.idleTimer != nil && d.expired == nil {
+		d.idleTimer.Reset(d.idle)
+	}
+}
+
+// close 停止所有计时并释放请求的 context
+func (d *upstreamDeadline) close() {
+	d.mu.Lock()
+	d.closed = true
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	if d.idleTimer != nil {
+		d.idleTimer.Stop()
+	}
+	d.mu.Unlock()
+	d.cancel()
+}
+
+// timeoutErrorType 如果错误是上游超时则返回错误类型，否则返回空
+func timeoutErrorType(err error) string {
+	var te *timeoutError
+	if errors.As(err, &te) {
+		return te.kind
+	}
+	return ""
+}
@@ -117,16 +117,26 @@ func main() {
 	log.Infof("Port %d is available", cfg.Port)
 
 	// 初始化数据库
-	db, err := database.InitDB(cfg.DatabasePath)
+	keys, err := database.LoadKeyCipher(cfg.MasterKeyFile)
+	if err != nil {
+		log.Fatalf("Failed to load master key: %v", err)
+	}
+	db, err := database.InitDB(cfg.DatabasePath, keys)
 	if err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 	defer db.Close()
 
 	// 创建服务
-	routeService := service.NewRouteService(db)
+	routeService := service.NewRouteService(db, keys)
 	proxyService := service.NewProxyService(routeService, cfg)
 
+	// 启动后台健康检查和供应商模型同步
+	proxyService.StartHealthChecker()
+	defer proxyService.StopHealthChecker()
+	proxyService.StartModelSyncer()
+	defer proxyService.StopModelSyncer()
+
 	// 初始化开机自启动管理器
 	autoStart := system.NewAutoStart()
 
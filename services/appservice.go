@@ -6,6 +6,7 @@ import (
 	"os/exec"
 
 	"openai-router-go/internal/config"
+	"openai-router-go/internal/database"
 	"openai-router-go/internal/service"
 	"openai-router-go/internal/system"
 
@@ -15,16 +16,33 @@ import (
 
 // RouteInfo 路由信息结构体（用于前端）
 type RouteInfo struct {
-	ID      int64  `json:"id"`
-	Name    string `json:"name"`
-	Model   string `json:"model"`
-	APIUrl  string `json:"api_url"`
-	APIKey  string `json:"api_key"`
-	Group   string `json:"group"`
-	Format  string `json:"format"`
-	Enabled bool   `json:"enabled"`
-	Created string `json:"created"`
-	Updated string `json:"updated"`
+	ID            int64  `json:"id"`
+	Name          string `json:"name"`
+	Model         string `json:"model"`
+	APIUrl        string `json:"api_url"`
+	APIKey        string `json:"api_key"`
+	Group         string `json:"group"`
+	Format        string `json:"format"`
+	Weight        int    `json:"weight"`
+	UpstreamModel string `json:"upstream_model"`
+	Priority      int    `json:"priority"` // 优先级层级，0 为主路由，数值越大越靠后
+	ExtraHeaders  string `json:"extra_headers"`
+	ExtraBody     string `json:"extra_body"`
+	// 上游超时秒数，0 表示不限制
+	ConnectTimeout   int    `json:"connect_timeout"`
+	FirstByteTimeout int    `json:"first_byte_timeout"`
+	IdleTimeout      int    `json:"idle_timeout"`
+	OutboundProxy    string `json:"outbound_proxy"` // 出站代理，为空时沿用系统代理，direct 表示直连
+	RPMLimit         int    `json:"rpm_limit"`      // 每分钟请求数限额，0 表示不限制
+	TPMLimit         int    `json:"tpm_limit"`      // 每分钟 token 数限额，0 表示不限制
+	ProviderID       int64  `json:"provider_id"`    // 同步创建该路由的供应商，0 表示手动添加
+	Capabilities     string `json:"capabilities"`   // 模型能力元数据的 JSON 对象字符串，为空表示未知
+	Enabled          bool   `json:"enabled"`
+	Created          string `json:"created"`
+	Updated          string `json:"updated"`
+	CircuitState     string `json:"circuit_state"`  // 熔断器状态：closed / open / half_open
+	HealthStatus     string `json:"health_status"`  // 健康检查状态：healthy / unhealthy / unknown
+	AvgLatencyMs     int64  `json:"avg_latency_ms"` // 最近请求耗时的移动平均，0 表示暂无数据
 }
 
 // StatsInfo 统计信息结构体
@@ -118,8 +136,9 @@ func (a *AppService) GetLanguage() string {
 
 // SetLanguage 设置语言
 func (a *AppService) SetLanguage(lang string) error {
-	a.Config.Language = lang
-	return a.Config.Save()
+	return a.ProxyService.UpdateConfig(func(cfg *config.Config) {
+		cfg.Language = lang
+	})
 }
 
 // GetRoutes 获取所有路由
@@ -132,34 +151,409 @@ func (a *AppService) GetRoutes() ([]RouteInfo, error) {
 	result := make([]RouteInfo, len(routes))
 	for i, route := range routes {
 		result[i] = RouteInfo{
-			ID:      route.ID,
-			Name:    route.Name,
-			Model:   route.Model,
-			APIUrl:  route.APIUrl,
-			APIKey:  route.APIKey,
-			Group:   route.Group,
-			Format:  route.Format,
-			Enabled: route.Enabled,
-			Created: route.CreatedAt.Format("2006-01-02 15:04:05"),
-			Updated: route.UpdatedAt.Format("2006-01-02 15:04:05"),
+			ID:               route.ID,
+			Name:             route.Name,
+			Model:            route.Model,
+			APIUrl:           route.APIUrl,
+			APIKey:           a.ProxyService.MaskAPIKey(route.APIKey),
+			Group:            route.Group,
+			Format:           route.Format,
+			Weight:           route.Weight,
+			UpstreamModel:    route.UpstreamModel,
+			Priority:         route.Priority,
+			ExtraHeaders:     route.ExtraHeaders,
+			ExtraBody:        route.ExtraBody,
+			ConnectTimeout:   route.ConnectTimeout,
+			FirstByteTimeout: route.FirstByteTimeout,
+			IdleTimeout:      route.IdleTimeout,
+			OutboundProxy:    route.OutboundProxy,
+			RPMLimit:         route.RPMLimit,
+			TPMLimit:         route.TPMLimit,
+			ProviderID:       route.ProviderID,
+			Capabilities:     route.Capabilities,
+			Enabled:          route.Enabled,
+			Created:          route.CreatedAt.Format("2006-01-02 15:04:05"),
+			Updated:          route.UpdatedAt.Format("2006-01-02 15:04:05"),
+			CircuitState:     a.ProxyService.GetRouteCircuitState(route.ID).State,
+			HealthStatus:     a.ProxyService.GetRouteHealthStatus(route.ID),
+			AvgLatencyMs:     a.ProxyService.GetRouteLatency(route.ID),
 		}
 	}
 	return result, nil
 }
 
-// AddRoute 添加路由
-func (a *AppService) AddRoute(name, model, apiUrl, apiKey, group, format string) error {
-	return a.RouteService.AddRoute(name, model, apiUrl, apiKey, group, format)
+// AddRoute 添加路由，字段与 GetRoutes 返回的路由一致（id、enabled 等状态字段会被忽略）
+func (a *AppService) AddRoute(route database.ModelRoute) error {
+	return a.RouteService.AddRoute(&route)
 }
 
-// UpdateRoute 更新路由
-func (a *AppService) UpdateRoute(id int64, name, model, apiUrl, apiKey, group, format string) error {
-	return a.RouteService.UpdateRoute(id, name, model, apiUrl, apiKey, group, format)
+// UpdateRoute 按 route.id 更新路由，api_key 为界面显示的遮蔽值时保留原有的 Key
+func (a *AppService) UpdateRoute(route database.ModelRoute) error {
+	id := route.ID
+	if current, err := a.RouteService.GetRouteByIDIncludeDisabled(id); err == nil {
+		route.APIKey = a.ProxyService.KeepMaskedAPIKey(current.APIKey, route.APIKey)
+	}
+	if err := a.RouteService.UpdateRoute(&route); err != nil {
+		return err
+	}
+	// 路由配置已变化，之前的熔断统计、健康状态和延迟统计不再有意义
+	a.ProxyService.ResetCircuitBreaker(id)
+	a.ProxyService.ForgetRouteHealth(id)
+	a.ProxyService.ForgetRouteLatency(id)
+	a.ProxyService.ForgetRouteKeys(id)
+	a.ProxyService.ForgetRouteAffinity(id)
+	return nil
+}
+
+// GetLoadBalanceConfig 获取负载均衡策略配置
+func (a *AppService) GetLoadBalanceConfig() map[string]interface{} {
+	return map[string]interface{}{
+		"defaultStrategy": a.ProxyService.GetModelStrategy(""),
+		"modelStrategies": a.ProxyService.GetModelStrategies(),
+		"strategies": []string{
+			service.StrategyRandom,
+			service.StrategyWeightedRandom,
+			service.StrategyRoundRobin,
+			service.StrategyLeastLatency,
+		},
+	}
+}
+
+// SetDefaultLoadBalanceStrategy 设置默认负载均衡策略
+func (a *AppService) SetDefaultLoadBalanceStrategy(strategy string) error {
+	return a.ProxyService.SetDefaultStrategy(strategy)
+}
+
+// SetModelLoadBalanceStrategy 设置单个模型的负载均衡策略，strategy 为空时恢复默认
+func (a *AppService) SetModelLoadBalanceStrategy(model, strategy string) error {
+	return a.ProxyService.SetModelStrategy(model, strategy)
+}
+
+// GetFailoverConfig 获取故障转移配置
+func (a *AppService) GetFailoverConfig() map[string]interface{} {
+	enabled, maxRetries, statusCodes := a.ProxyService.GetFailoverConfig()
+	return map[string]interface{}{
+		"enabled":     enabled,
+		"maxRetries":  maxRetries,
+		"statusCodes": statusCodes,
+	}
+}
+
+// SetFailoverConfig 设置故障转移配置
+func (a *AppService) SetFailoverConfig(enabled bool, maxRetries int, statusCodes []int) error {
+	return a.ProxyService.SetFailoverConfig(enabled, maxRetries, statusCodes)
+}
+
+// GetCircuitBreakerStatus 获取路由熔断器状态
+func (a *AppService) GetCircuitBreakerStatus() []service.BreakerStatus {
+	return a.ProxyService.GetCircuitBreakerStatus()
+}
+
+// ResetCircuitBreaker 手动重置路由熔断器
+func (a *AppService) ResetCircuitBreaker(id int64) {
+	a.ProxyService.ResetCircuitBreaker(id)
+}
+
+// GetHealthCheckConfig 获取健康检查配置
+func (a *AppService) GetHealthCheckConfig() map[string]interface{} {
+	return map[string]interface{}{
+		"enabled":         a.Config.HealthCheckEnabled,
+		"intervalSeconds": a.Config.HealthCheckIntervalSeconds,
+		"method":          a.Config.HealthCheckMethod,
+		"skipUnhealthy":   a.Config.HealthCheckSkipUnhealthy,
+	}
+}
+
+// SetHealthCheckConfig 设置健康检查配置
+func (a *AppService) SetHealthCheckConfig(enabled bool, intervalSeconds int, method string, skipUnhealthy bool) error {
+	return a.ProxyService.SetHealthCheckConfig(enabled, intervalSeconds, method, skipUnhealthy)
+}
+
+// GetRouteHealthHistory 获取路由的健康检查历史
+func (a *AppService) GetRouteHealthHistory(id int64, limit int) ([]map[string]interface{}, error) {
+	records, err := a.RouteService.GetRouteHealthHistory(id, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]map[string]interface{}, len(records))
+	for i, r := range records {
+		result[i] = map[string]interface{}{
+			"id":            r.ID,
+			"route_id":      r.RouteID,
+			"status":        r.Status,
+			"latency_ms":    r.LatencyMs,
+			"error_message": r.ErrorMessage,
+			"checked_at":    r.CheckedAt.Format("2006-01-02 15:04:05"),
+		}
+	}
+	return result, nil
+}
+
+// CheckRouteHealth 立即对路由执行一次健康检查
+func (a *AppService) CheckRouteHealth(id int64) (map[string]interface{}, error) {
+	r, err := a.ProxyService.CheckRouteHealth(id)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"route_id":      r.RouteID,
+		"status":        r.Status,
+		"latency_ms":    r.LatencyMs,
+		"error_message": r.ErrorMessage,
+		"checked_at":    r.CheckedAt.Format("2006-01-02 15:04:05"),
+	}, nil
+}
+
+// TestRoute 以 OpenAI、Claude、Claude Code 和 Gemini 协议分别测试路由，包括流式请求和工具调用
+func (a *AppService) TestRoute(id int64) (*service.RouteTestResult, error) {
+	return a.ProxyService.TestRoute(id)
+}
+
+// GetRouteKeys 获取路由的附加 API Key 及其使用统计
+func (a *AppService) GetRouteKeys(routeId int64) ([]map[string]interface{}, error) {
+	keys, err := a.RouteService.GetRouteKeys(routeId)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, len(keys))
+	for i, k := range keys {
+		ids[i] = k.ID
+	}
+	usage := a.ProxyService.GetRouteKeyUsage(routeId, ids)
+
+	result := make([]map[string]interface{}, len(keys))
+	for i, k := range keys {
+		result[i] = map[string]interface{}{
+			"id":         k.ID,
+			"route_id":   k.RouteID,
+			"name":       k.Name,
+			"api_key":    a.ProxyService.MaskAPIKey(k.APIKey),
+			"enabled":    k.Enabled,
+			"created_at": k.CreatedAt.Format("2006-01-02 15:04:05"),
+			"usage":      usage[i],
+		}
+	}
+	return result, nil
+}
+
+// GetRouteKeyUsage 获取路由所有 Key 的使用统计，key_id 为 0 的是路由自身的 API Key
+func (a *AppService) GetRouteKeyUsage(routeId int64) ([]service.KeyUsage, error) {
+	keys, err := a.RouteService.GetRouteKeys(routeId)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []int64{service.PrimaryKeyID}
+	for _, k := range keys {
+		ids = append(ids, k.ID)
+	}
+	return a.ProxyService.GetRouteKeyUsage(routeId, ids), nil
+}
+
+// AddRouteKey 为路由添加附加 API Key，与路由自身的 API Key 一起轮换使用
+func (a *AppService) AddRouteKey(routeId int64, name, apiKey string) error {
+	id, err := a.RouteService.AddRouteKey(routeId, name, apiKey)
+	if err != nil {
+		return err
+	}
+	a.ProxyService.ForgetRouteKey(routeId, id)
+	return nil
+}
+
+// DeleteRouteKey 删除附加 API Key
+func (a *AppService) DeleteRouteKey(id int64) error {
+	key, err := a.RouteService.GetRouteKeyByID(id)
+	if err != nil {
+		return err
+	}
+	if err := a.RouteService.DeleteRouteKey(id); err != nil {
+		return err
+	}
+	a.ProxyService.ForgetRouteKey(key.RouteID, id)
+	return nil
+}
+
+// ToggleRouteKey 启用/禁用附加 API Key
+func (a *AppService) ToggleRouteKey(id int64, enabled bool) error {
+	key, err := a.RouteService.GetRouteKeyByID(id)
+	if err != nil {
+		return err
+	}
+	if err := a.RouteService.ToggleRouteKey(id, enabled); err != nil {
+		return err
+	}
+	a.ProxyService.ForgetRouteKey(key.RouteID, id)
+	return nil
+}
+
+// GetKeyRotationConfig 获取多 Key 轮换配置
+func (a *AppService) GetKeyRotationConfig() map[string]interface{} {
+	return map[string]interface{}{
+		"strategy":        a.Config.KeyRotationStrategy,
+		"cooldownSeconds": a.Config.KeyCooldownSeconds,
+		"strategies": []string{
+			service.KeyRotationRoundRobin,
+			service.KeyRotationLeastUsed,
+		},
+	}
+}
+
+// SetKeyRotationConfig 设置多 Key 轮换策略和 Key 返回 401/429 后的冷却秒数
+func (a *AppService) SetKeyRotationConfig(strategy string, cooldownSeconds int) error {
+	return a.ProxyService.SetKeyRotationConfig(strategy, cooldownSeconds)
+}
+
+// GetRateLimitConfig 获取路由限流的排队配置
+func (a *AppService) GetRateLimitConfig() map[string]interface{} {
+	return map[string]interface{}{
+		"queueSize":      a.Config.RateLimitQueueSize,
+		"maxWaitSeconds": a.Config.RateLimitMaxWaitSeconds,
+	}
+}
+
+// SetRateLimitConfig 设置超过路由 RPM/TPM 限额的请求最多排队的数量和最长排队秒数，0 表示不排队
+func (a *AppService) SetRateLimitConfig(queueSize, maxWaitSeconds int) error {
+	return a.ProxyService.SetRateLimitConfig(queueSize, maxWaitSeconds)
+}
+
+// GetRouteRateLimitStatus 获取路由当前的限流状态（剩余请求数、剩余 token 数和排队数量）
+func (a *AppService) GetRouteRateLimitStatus(routeId int64) (service.RateLimitStatus, error) {
+	return a.ProxyService.GetRouteRateLimitStatus(routeId)
+}
+
+// GetStickySessionConfig 获取会话保持配置和当前有效的会话绑定数量
+func (a *AppService) GetStickySessionConfig() map[string]interface{} {
+	return map[string]interface{}{
+		"enabled":    a.Config.StickySessionEnabled,
+		"ttlSeconds": a.Config.StickySessionTTLSeconds,
+		"sessions":   a.ProxyService.GetStickySessionCount(),
+	}
+}
+
+// SetStickySessionConfig 设置是否开启会话保持以及会话与路由绑定的有效秒数
+func (a *AppService) SetStickySessionConfig(enabled bool, ttlSeconds int) error {
+	return a.ProxyService.SetStickySessionConfig(enabled, ttlSeconds)
+}
+
+// ClearStickySessions 清除所有会话与路由的绑定
+func (a *AppService) ClearStickySessions() {
+	a.ProxyService.ClearStickySessions()
+}
+
+// ExportRoutes 导出全部路由为 JSON 或 YAML 文本，includeKeys 为 false 时不包含 API Key
+func (a *AppService) ExportRoutes(format string, includeKeys bool) (string, error) {
+	data, err := a.ProxyService.ExportRoutes(format, includeKeys)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// ImportRoutes 从导出的 JSON 或 YAML 文本导入路由，mode 为 merge 或 replace，dryRun 为 true 时只预览变更
+// allowLocalRefs 为用户是否允许导入 file: / cmd: 引用的 Key（会在本机读取文件或执行命令）
+func (a *AppService) ImportRoutes(content, mode string, dryRun, allowLocalRefs bool) (*service.RouteImportResult, error) {
+	return a.ProxyService.ImportRoutes([]byte(content), mode, dryRun, allowLocalRefs)
+}
+
+// ImportExternalConfig 从 cc-switch / ccNexus / code-switch 的配置导入路由，path 为空时读取默认配置目录
+func (a *AppService) ImportExternalConfig(source, path, group string, dryRun bool) (*service.ExternalImportResult, error) {
+	return a.ProxyService.ImportExternalConfig(source, path, group, dryRun)
+}
+
+// GetProviders 获取所有供应商及其路由数量
+func (a *AppService) GetProviders() ([]map[string]interface{}, error) {
+	providers, err := a.RouteService.GetProviders()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]map[string]interface{}, len(providers))
+	for i, p := range providers {
+		routes, err := a.RouteService.GetProviderRoutes(p.ID)
+		if err != nil {
+			return nil, err
+		}
+		enabledRoutes := 0
+		for _, route := range routes {
+			if route.Enabled {
+				enabledRoutes++
+			}
+		}
+		lastSync := ""
+		if p.LastSyncAt != nil {
+			lastSync = p.LastSyncAt.Format("2006-01-02 15:04:05")
+		}
+		result[i] = map[string]interface{}{
+			"id":               p.ID,
+			"name":             p.Name,
+			"api_url":          p.APIUrl,
+			"api_key":          a.ProxyService.MaskAPIKey(p.APIKey),
+			"format":           p.Format,
+			"group":            p.Group,
+			"include_patterns": p.IncludePatterns,
+			"exclude_patterns": p.ExcludePatterns,
+			"outbound_proxy":   p.OutboundProxy,
+			"sync_interval":    p.SyncInterval,
+			"models":           p.Models,
+			"routes":           len(routes),
+			"enabled_routes":   enabledRoutes,
+			"last_sync_at":     lastSync,
+			"last_sync_error":  p.LastSyncError,
+			"enabled":          p.Enabled,
+			"created_at":       p.CreatedAt.Format("2006-01-02 15:04:05"),
+		}
+	}
+	return result, nil
+}
+
+// AddProvider 添加供应商并立即同步一次模型列表，同步失败不影响添加，错误记录在供应商的 last_sync_error 中
+// includePatterns / excludePatterns 为逗号或换行分隔的模型匹配规则，syncInterval 为同步间隔分钟数（0 表示默认 60 分钟）
+func (a *AppService) AddProvider(name, apiUrl, apiKey, format, group, includePatterns, excludePatterns, outboundProxy string, syncInterval int) (int64, error) {
+	id, err := a.RouteService.AddProvider(name, apiUrl, apiKey, format, group, includePatterns, excludePatterns, outboundProxy, syncInterval)
+	if err != nil {
+		return 0, err
+	}
+	a.ProxyService.SyncProvider(id)
+	return id, nil
+}
+
+// UpdateProvider 更新供应商，连接配置同步到它创建的路由
+func (a *AppService) UpdateProvider(id int64, name, apiUrl, apiKey, format, group, includePatterns, excludePatterns, outboundProxy string, syncInterval int) error {
+	if p, err := a.RouteService.GetProviderByID(id); err == nil {
+		apiKey = a.ProxyService.KeepMaskedAPIKey(p.APIKey, apiKey)
+	}
+	return a.ProxyService.UpdateProvider(id, name, apiUrl, apiKey, format, group, includePatterns, excludePatterns, outboundProxy, syncInterval)
+}
+
+// ToggleProvider 启用/禁用供应商的定时同步
+func (a *AppService) ToggleProvider(id int64, enabled bool) error {
+	return a.RouteService.ToggleProvider(id, enabled)
+}
+
+// DeleteProvider 删除供应商，deleteRoutes 为 true 时同时删除它创建的路由，否则保留为普通路由
+func (a *AppService) DeleteProvider(id int64, deleteRoutes bool) error {
+	return a.ProxyService.DeleteProvider(id, deleteRoutes)
+}
+
+// SyncProvider 立即同步供应商的模型列表
+func (a *AppService) SyncProvider(id int64) (*service.ProviderSyncResult, error) {
+	return a.ProxyService.SyncProvider(id)
 }
 
 // DeleteRoute 删除路由
 func (a *AppService) DeleteRoute(id int64) error {
-	return a.RouteService.DeleteRoute(id)
+	if err := a.RouteService.DeleteRoute(id); err != nil {
+		return err
+	}
+	a.ProxyService.ResetCircuitBreaker(id)
+	a.ProxyService.ForgetRouteHealth(id)
+	a.ProxyService.ForgetRouteLatency(id)
+	a.ProxyService.ForgetRouteKeys(id)
+	a.ProxyService.ForgetRouteRateLimit(id)
+	a.ProxyService.ForgetRouteAffinity(id)
+	return nil
 }
 
 // GetStats 获取统计信息
@@ -212,45 +606,126 @@ func (a *AppService) GetModelRanking(limit int) ([]map[string]interface{}, error
 
 // GetConfig 获取配置
 func (a *AppService) GetConfig() map[string]interface{} {
+	cfg := a.ProxyService.ConfigSnapshot()
 	return map[string]interface{}{
-		"localApiKey":           a.Config.LocalAPIKey,
-		"openaiEndpoint":        fmt.Sprintf("http://%s:%d", a.Config.Host, a.Config.Port),
-		"redirectEnabled":       a.Config.RedirectEnabled,
-		"redirectKeyword":       a.Config.RedirectKeyword,
-		"redirectTargetModel":   a.Config.RedirectTargetModel,
-		"redirectTargetName":    a.Config.RedirectTargetName,
-		"redirectTargetRouteId": a.Config.RedirectTargetRouteID,
-		"minimizeToTray":        a.Config.MinimizeToTray,
-		"autoStart":             a.Config.AutoStart,
-		"enableFileLog":         a.Config.EnableFileLog,
-		"port":                  a.Config.Port,
+		"localApiKey":           cfg.LocalAPIKey,
+		"openaiEndpoint":        fmt.Sprintf("http://%s:%d", cfg.Host, cfg.Port),
+		"redirectEnabled":       cfg.RedirectEnabled,
+		"redirectKeyword":       cfg.RedirectKeyword,
+		"redirectTargetModel":   cfg.RedirectTargetModel,
+		"redirectTargetName":    cfg.RedirectTargetName,
+		"redirectTargetRouteId": cfg.RedirectTargetRouteID,
+		"redirectRules":         a.GetRedirectRules(),
+		"defaultRouteGroup":     cfg.DefaultRouteGroup,
+		"minimizeToTray":        cfg.MinimizeToTray,
+		"autoStart":             cfg.AutoStart,
+		"enableFileLog":         cfg.EnableFileLog,
+		"port":                  cfg.Port,
+		"loadBalanceStrategy":   a.ProxyService.GetModelStrategy(""),
 	}
 }
 
 // UpdateConfig 更新配置
 func (a *AppService) UpdateConfig(redirectEnabled bool, redirectKeyword, redirectTargetModel string, redirectTargetRouteId int64) error {
-	a.Config.RedirectEnabled = redirectEnabled
-	a.Config.RedirectKeyword = redirectKeyword
-	a.Config.RedirectTargetModel = redirectTargetModel
-	a.Config.RedirectTargetRouteID = redirectTargetRouteId
-	return a.Config.Save()
+	return a.ProxyService.SetRedirectConfig(redirectEnabled, redirectKeyword, redirectTargetModel, redirectTargetRouteId)
+}
+
+// GetRedirectRules 获取额外的重定向规则
+func (a *AppService) GetRedirectRules() []map[string]interface{} {
+	rules := a.ProxyService.GetRedirectRules()
+	result := make([]map[string]interface{}, len(rules))
+	for i, rule := range rules {
+		targetName := ""
+		if rule.TargetRouteID > 0 {
+			if route, err := a.RouteService.GetRouteByID(rule.TargetRouteID); err == nil {
+				targetName = route.Name
+			}
+		}
+		result[i] = map[string]interface{}{
+			"keyword":       rule.Keyword,
+			"targetModel":   rule.TargetModel,
+			"targetRouteId": rule.TargetRouteID,
+			"targetName":    targetName,
+		}
+	}
+	return result
+}
+
+// AddRedirectRule 添加重定向规则
+func (a *AppService) AddRedirectRule(keyword, targetModel string, targetRouteId int64) error {
+	rules := append(a.ProxyService.GetRedirectRules(), config.RedirectRule{Keyword: keyword, TargetModel: targetModel, TargetRouteID: targetRouteId})
+	return a.ProxyService.SetRedirectRules(rules)
+}
+
+// UpdateRedirectRule 修改重定向规则，oldKeyword 为修改前的关键字
+func (a *AppService) UpdateRedirectRule(oldKeyword, keyword, targetModel string, targetRouteId int64) error {
+	rules := a.ProxyService.GetRedirectRules()
+	for i := range rules {
+		if rules[i].Keyword == oldKeyword {
+			rules[i] = config.RedirectRule{Keyword: keyword, TargetModel: targetModel, TargetRouteID: targetRouteId}
+			return a.ProxyService.SetRedirectRules(rules)
+		}
+	}
+	return fmt.Errorf("redirect rule not found: %s", oldKeyword)
+}
+
+// DeleteRedirectRule 删除重定向规则
+func (a *AppService) DeleteRedirectRule(keyword string) error {
+	current := a.ProxyService.GetRedirectRules()
+	rules := make([]config.RedirectRule, 0, len(current))
+	for _, rule := range current {
+		if rule.Keyword != keyword {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) == len(current) {
+		return fmt.Errorf("redirect rule not found: %s", keyword)
+	}
+	return a.ProxyService.SetRedirectRules(rules)
+}
+
+// GetRoutingRules 获取内容路由规则（按匹配顺序）
+func (a *AppService) GetRoutingRules() []config.RoutingRule {
+	return a.ProxyService.GetRoutingRules()
+}
+
+// SetRoutingRules 保存内容路由规则，规则按数组顺序匹配
+func (a *AppService) SetRoutingRules(rules []config.RoutingRule) error {
+	return a.ProxyService.SetRoutingRules(rules)
+}
+
+// GetRouteGroups 获取所有路由分组
+func (a *AppService) GetRouteGroups() ([]string, error) {
+	return a.RouteService.GetRouteGroups()
+}
+
+// SetDefaultRouteGroup 设置请求未指定分组时使用的默认分组，为空表示不限分组
+func (a *AppService) SetDefaultRouteGroup(group string) error {
+	return a.ProxyService.SetDefaultRouteGroup(group)
 }
 
 // UpdatePort 更新端口配置
 func (a *AppService) UpdatePort(port int) error {
-	a.Config.Port = port
-	return a.Config.Save()
+	return a.ProxyService.UpdateConfig(func(cfg *config.Config) {
+		cfg.Port = port
+	})
 }
 
 // UpdateLocalApiKey 更新本地 API Key
 func (a *AppService) UpdateLocalApiKey(newApiKey string) error {
-	a.Config.LocalAPIKey = newApiKey
-	return a.Config.Save()
+	return a.ProxyService.UpdateConfig(func(cfg *config.Config) {
+		cfg.LocalAPIKey = newApiKey
+	})
+}
+
+// FetchRemoteModels 获取远程模型列表，outboundProxy 为路由的出站代理设置（可为空）
+func (a *AppService) FetchRemoteModels(apiUrl, apiKey, outboundProxy string) ([]string, error) {
+	return a.ProxyService.FetchRemoteModels(apiUrl, apiKey, outboundProxy)
 }
 
-// FetchRemoteModels 获取远程模型列表
-func (a *AppService) FetchRemoteModels(apiUrl, apiKey string) ([]string, error) {
-	return a.ProxyService.FetchRemoteModels(apiUrl, apiKey)
+// FetchRouteRemoteModels 使用路由已保存的 API Key 获取远程模型列表（界面上只有遮蔽后的 Key 时使用）
+func (a *AppService) FetchRouteRemoteModels(routeId int64, apiUrl, outboundProxy string) ([]string, error) {
+	return a.ProxyService.FetchRouteRemoteModels(routeId, apiUrl, outboundProxy)
 }
 
 // ImportRouteFromFormat 从不同格式导入路由
@@ -275,9 +750,10 @@ func (a *AppService) GetAppSettings() map[string]interface{} {
 // SetMinimizeToTray 设置关闭时最小化到托盘
 func (a *AppService) SetMinimizeToTray(enabled bool) error {
 	log.Infof("Setting minimize to tray: %v", enabled)
-	a.Config.MinimizeToTray = enabled
-
-	if err := a.Config.Save(); err != nil {
+	err := a.ProxyService.UpdateConfig(func(cfg *config.Config) {
+		cfg.MinimizeToTray = enabled
+	})
+	if err != nil {
 		log.Errorf("Failed to save config: %v", err)
 		return fmt.Errorf("failed to save config: %v", err)
 	}
@@ -307,8 +783,10 @@ func (a *AppService) SetAutoStart(enabled bool) error {
 		}
 	}
 
-	a.Config.AutoStart = enabled
-	if err := a.Config.Save(); err != nil {
+	err := a.ProxyService.UpdateConfig(func(cfg *config.Config) {
+		cfg.AutoStart = enabled
+	})
+	if err != nil {
 		log.Errorf("Failed to save config: %v", err)
 		return fmt.Errorf("failed to save config: %v", err)
 	}
@@ -336,9 +814,10 @@ var LogFile interface {
 // SetEnableFileLog 设置是否启用文件日志
 func (a *AppService) SetEnableFileLog(enabled bool) error {
 	log.Infof("Setting enable file log: %v", enabled)
-	a.Config.EnableFileLog = enabled
-
-	if err := a.Config.Save(); err != nil {
+	err := a.ProxyService.UpdateConfig(func(cfg *config.Config) {
+		cfg.EnableFileLog = enabled
+	})
+	if err != nil {
 		log.Errorf("Failed to save config: %v", err)
 		return fmt.Errorf("failed to save config: %v", err)
 	}